@@ -0,0 +1,77 @@
+package goproxy
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/sirkon/goproxy/auth"
+)
+
+// Access who may fetch modules of a route. Principals are established by authentication middleware in front of the
+// proxy, see auth.Middleware. Zero Access lets nobody in
+type Access struct {
+	Anonymous     bool     // anyone, even requests without a principal
+	Authenticated bool     // any principal
+	Users         []string // principals with these names
+	Groups        []string // principals belonging to any of these groups
+}
+
+// permits checks if the principal may fetch modules, nil principal means an anonymous request
+func (a *Access) permits(p *auth.Principal) bool {
+	switch {
+	case a.Anonymous:
+		return true
+	case p == nil:
+		return false
+	case a.Authenticated:
+		return true
+	}
+	for _, user := range a.Users {
+		if p.Name == user {
+			return true
+		}
+	}
+	for _, group := range a.Groups {
+		if p.InGroup(group) {
+			return true
+		}
+	}
+	return false
+}
+
+// AccessDenied error of a request not permitted by access rules of the route
+type AccessDenied struct {
+	Path      string
+	Principal *auth.Principal // nil for anonymous requests
+}
+
+func (e *AccessDenied) Error() string {
+	if e.Principal == nil {
+		return fmt.Sprintf("authentication required to access %s", e.Path)
+	}
+	return fmt.Sprintf("%s is not allowed to access %s", e.Principal.Name, e.Path)
+}
+
+// StatusCode 401 Unauthorized for anonymous requests, they may get through with credentials, 403 Forbidden otherwise
+func (e *AccessDenied) StatusCode() int {
+	if e.Principal == nil {
+		return http.StatusUnauthorized
+	}
+	return http.StatusForbidden
+}
+
+// authorize checks access rules of the module for the principal of the request
+func (r *Router) authorize(req *http.Request, path string) error {
+	access := r.Access(path)
+	if access == nil {
+		return nil
+	}
+	p := auth.FromContext(req.Context())
+	if access.permits(p) {
+		return nil
+	}
+	return &AccessDenied{
+		Path:      path,
+		Principal: p,
+	}
+}
@@ -0,0 +1,130 @@
+package goproxy
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"github.com/sirkon/goproxy/auth"
+)
+
+// listPlugin serves modules having the only version
+type listPlugin struct{}
+
+func (listPlugin) Module(req *http.Request, prefix string) (Module, error) {
+	path, _, err := GetModInfo(req, prefix)
+	if err != nil {
+		return nil, err
+	}
+	return listModule(path), nil
+}
+func (listPlugin) Leave(source Module) error { return nil }
+func (listPlugin) Close() error              { return nil }
+func (listPlugin) String() string            { return "list" }
+
+type listModule string
+
+func (m listModule) ModulePath() string { return string(m) }
+func (m listModule) Versions(ctx context.Context, prefix string) ([]string, error) {
+	return []string{"v1.0.0"}, nil
+}
+func (m listModule) Stat(ctx context.Context, rev string) (*RevInfo, error) {
+	return &RevInfo{Version: rev}, nil
+}
+func (m listModule) GoMod(ctx context.Context, version string) ([]byte, error) {
+	return []byte("module " + string(m)), nil
+}
+func (m listModule) Zip(ctx context.Context, version string) (io.ReadCloser, error) {
+	return nil, io.EOF
+}
+
+func TestMiddlewareAccess(t *testing.T) {
+	r, err := NewRouter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.AddRoute("", listPlugin{}); err != nil {
+		t.Fatal(err)
+	}
+	for mask, access := range map[string]*Access{
+		"corp.example.com":          {Authenticated: true},
+		"corp.example.com/payments": {Groups: []string{"team-a"}},
+		"corp.example.com/secrets":  {Users: []string{"root"}},
+		"corp.example.com/public":   {Anonymous: true},
+	} {
+		if err := r.AddAccess(mask, access); err != nil {
+			t.Fatal(err)
+		}
+	}
+	logger := zerolog.New(ioutil.Discard)
+	m := Middleware(r, "", &logger)
+
+	teamA := &auth.Principal{Name: "alice", Groups: []string{"team-a"}}
+	tests := []struct {
+		name      string
+		path      string
+		principal *auth.Principal
+		want      int
+	}{
+		{
+			name: "no-rules",
+			path: "github.com/user/lib",
+			want: http.StatusOK,
+		},
+		{
+			name: "anonymous",
+			path: "corp.example.com/payments/billing",
+			want: http.StatusUnauthorized,
+		},
+		{
+			name:      "group",
+			path:      "corp.example.com/payments/billing",
+			principal: teamA,
+			want:      http.StatusOK,
+		},
+		{
+			name:      "other-route",
+			path:      "corp.example.com/secrets/vault",
+			principal: teamA,
+			want:      http.StatusForbidden,
+		},
+		{
+			name:      "user",
+			path:      "corp.example.com/secrets/vault",
+			principal: &auth.Principal{Name: "root"},
+			want:      http.StatusOK,
+		},
+		{
+			name:      "authenticated",
+			path:      "corp.example.com/tools",
+			principal: &auth.Principal{Name: "bob"},
+			want:      http.StatusOK,
+		},
+		{
+			name: "public",
+			path: "corp.example.com/public/lib",
+			want: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/"+tt.path+"/@v/list", nil)
+			if tt.principal != nil {
+				req = req.WithContext(auth.WithPrincipal(req.Context(), tt.principal))
+			}
+			w := httptest.NewRecorder()
+			m.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("status %d expected, got %d: %s", tt.want, w.Code, w.Body.String())
+			}
+			if w.Code == http.StatusUnauthorized && len(w.Header().Get("WWW-Authenticate")) == 0 {
+				t.Error("authentication challenge expected")
+			}
+		})
+	}
+}
@@ -0,0 +1,123 @@
+// Package accesslog records of served requests, one per request, and sinks they are written into
+package accesslog
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// Record of the access log
+type Record struct {
+	Start     time.Time
+	RequestID string
+	Remote    string
+	Method    string
+	Path      string
+	Module    string // empty if the path is not a proxy protocol one
+	Version   string // version requested, the one resolved for @latest
+	Endpoint  string // endpoint type, see metrics.Endpoint
+	Plugin    string // empty if there is no plugin for the module
+	Principal string // empty for anonymous requests
+	Status    int
+	Bytes     int64
+	Duration  time.Duration
+}
+
+// Sink of access log records
+type Sink interface {
+	Log(rec *Record)
+}
+
+// SinkFunc is a function which is a Sink
+type SinkFunc func(rec *Record)
+
+// Log calls f(rec)
+func (f SinkFunc) Log(rec *Record) {
+	f(rec)
+}
+
+// Zerolog sink writing records as info messages of the logger. Use zerolog.New(file) with a RotatingFile to have
+// a separate log file
+func Zerolog(logger zerolog.Logger) Sink {
+	return SinkFunc(func(rec *Record) {
+		event := logger.Info().
+			Time("start", rec.Start).
+			Str("request-id", rec.RequestID).
+			Str("remote", rec.Remote).
+			Str("method", rec.Method).
+			Str("path", rec.Path)
+		for _, field := range []struct{ name, value string }{
+			{"module", rec.Module},
+			{"version", rec.Version},
+			{"endpoint", rec.Endpoint},
+			{"plugin", rec.Plugin},
+			{"principal", rec.Principal},
+		} {
+			if len(field.value) > 0 {
+				event = event.Str(field.name, field.value)
+			}
+		}
+		event.
+			Int("status", rec.Status).
+			Int64("bytes", rec.Bytes).
+			Dur("duration", rec.Duration).
+			Msg("access")
+	})
+}
+
+// Discard sink dropping records
+var Discard Sink = SinkFunc(func(*Record) {})
+
+// Multi sink writing records into each of sinks
+func Multi(sinks ...Sink) Sink {
+	return SinkFunc(func(rec *Record) {
+		for _, sink := range sinks {
+			sink.Log(rec)
+		}
+	})
+}
+
+// RequestIDHeader header with the request id, it is taken from incoming requests, set in responses and passed further
+// in requests to upstreams
+const RequestIDHeader = "X-Request-ID"
+
+// maxRequestIDLength longer incoming request ids are not honored
+const maxRequestIDLength = 128
+
+type requestIDKey struct{}
+
+// WithRequestID returns context with the request id
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request id of the context, empty if there is none
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// IncomingRequestID returns the request id sent by the client, empty if there is none or it is not a sane one
+func IncomingRequestID(req *http.Request) string {
+	id := req.Header.Get(RequestIDHeader)
+	if len(id) == 0 || len(id) > maxRequestIDLength {
+		return ""
+	}
+	for i := 0; i < len(id); i++ {
+		// printable ASCII without spaces, so the id can't break log lines
+		if id[i] <= ' ' || id[i] > '~' {
+			return ""
+		}
+	}
+	return id
+}
+
+// SetRequestID sets request id of the context into headers of an outgoing request
+func SetRequestID(req *http.Request) {
+	if id := RequestID(req.Context()); len(id) > 0 {
+		req.Header.Set(RequestIDHeader, id)
+	}
+}
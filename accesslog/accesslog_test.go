@@ -0,0 +1,94 @@
+package accesslog
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIncomingRequestID(t *testing.T) {
+	tests := []struct {
+		name   string
+		header string
+		want   string
+	}{
+		{
+			name:   "none",
+			header: "",
+			want:   "",
+		},
+		{
+			name:   "valid",
+			header: "0af7651916cd43dd-8448eb211c80319c",
+			want:   "0af7651916cd43dd-8448eb211c80319c",
+		},
+		{
+			name:   "spaces",
+			header: "request 1",
+			want:   "",
+		},
+		{
+			name:   "non-ascii",
+			header: "запрос",
+			want:   "",
+		},
+		{
+			name:   "too-long",
+			header: strings.Repeat("a", maxRequestIDLength+1),
+			want:   "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			if len(tt.header) > 0 {
+				req.Header.Set(RequestIDHeader, tt.header)
+			}
+			require.Equal(t, tt.want, IncomingRequestID(req))
+		})
+	}
+}
+
+func TestZerolog(t *testing.T) {
+	var buf bytes.Buffer
+	sink := Zerolog(zerolog.New(&buf))
+	sink.Log(&Record{
+		Start:     time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC),
+		RequestID: "request-1",
+		Remote:    "127.0.0.1:1234",
+		Method:    "GET",
+		Path:      "/example.com/lib/@v/v1.0.0.zip",
+		Module:    "example.com/lib",
+		Version:   "v1.0.0",
+		Endpoint:  "zip",
+		Plugin:    "cascade",
+		Status:    200,
+		Bytes:     1024,
+		Duration:  1500 * time.Millisecond,
+	})
+
+	var got map[string]interface{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &got))
+	require.Equal(t, map[string]interface{}{
+		"level":      "info",
+		"message":    "access",
+		"start":      "2020-01-02T03:04:05Z",
+		"request-id": "request-1",
+		"remote":     "127.0.0.1:1234",
+		"method":     "GET",
+		"path":       "/example.com/lib/@v/v1.0.0.zip",
+		"module":     "example.com/lib",
+		"version":    "v1.0.0",
+		"endpoint":   "zip",
+		"plugin":     "cascade",
+		"status":     float64(200),
+		"bytes":      float64(1024),
+		"duration":   float64(1500),
+	}, got)
+}
@@ -0,0 +1,134 @@
+package accesslog
+
+import (
+	"fmt"
+	"os"
+	"sync"
+
+	"github.com/sirkon/goproxy/internal/errors"
+)
+
+// RotatingFile is a log file which is rotated when it grows over the size limit: file is renamed into file.1, file.1
+// into file.2 and so on, up to the number of backups to keep
+type RotatingFile struct {
+	path    string
+	maxSize int64
+	backups int
+
+	lock sync.Mutex
+	file *os.File
+	size int64
+}
+
+// NewRotatingFile opens the file for appending. Files are not rotated if maxSize is not positive
+func NewRotatingFile(path string, maxSize int64, backups int) (*RotatingFile, error) {
+	res := &RotatingFile{
+		path:    path,
+		maxSize: maxSize,
+		backups: backups,
+	}
+	if err := res.open(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func (f *RotatingFile) open() error {
+	file, err := os.OpenFile(f.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return errors.Wrap(err, "accesslog opening log file")
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return errors.Wrapf(err, "accesslog getting size of %s", f.path)
+	}
+	f.file = file
+	f.size = stat.Size()
+	return nil
+}
+
+// Write writes p into the file, the file is rotated before if p does not fit into it
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.file == nil {
+		return 0, errors.Newf("accesslog %s is closed", f.path)
+	}
+	if f.maxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.maxSize {
+		// the file is kept on failed rotation, p goes there then and rotation is retried on the next write
+		if err := f.rotate(); err != nil && f.file == nil {
+			return 0, err
+		}
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	return n, err
+}
+
+func (f *RotatingFile) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return errors.Wrapf(err, "accesslog closing %s", f.path)
+	}
+	f.file = nil
+
+	if err := f.shift(); err != nil {
+		// keep on writing into the file as is rather than losing records
+		if openErr := f.open(); openErr != nil {
+			return errors.Wrapf(openErr, "accesslog reopening %s after rotation failure (%s)", f.path, err)
+		}
+		return err
+	}
+	return f.open()
+}
+
+// shift moves the file and its backups one step up
+func (f *RotatingFile) shift() error {
+	if f.backups <= 0 {
+		if err := os.Remove(f.path); err != nil {
+			return errors.Wrapf(err, "accesslog removing %s", f.path)
+		}
+		return nil
+	}
+	for i := f.backups - 1; i > 0; i-- {
+		if err := os.Rename(f.backup(i), f.backup(i+1)); err != nil && !os.IsNotExist(err) {
+			return errors.Wrapf(err, "accesslog rotating %s", f.backup(i))
+		}
+	}
+	if err := os.Rename(f.path, f.backup(1)); err != nil {
+		return errors.Wrapf(err, "accesslog rotating %s", f.path)
+	}
+	return nil
+}
+
+func (f *RotatingFile) backup(i int) string {
+	return fmt.Sprintf("%s.%d", f.path, i)
+}
+
+// Reopen reopens the file, call it after the file was moved away by external log rotation
+func (f *RotatingFile) Reopen() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.file != nil {
+		if err := f.file.Close(); err != nil {
+			return errors.Wrapf(err, "accesslog closing %s", f.path)
+		}
+		f.file = nil
+	}
+	return f.open()
+}
+
+// Close closes the file
+func (f *RotatingFile) Close() error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.file == nil {
+		return nil
+	}
+	err := f.file.Close()
+	f.file = nil
+	return err
+}
@@ -0,0 +1,78 @@
+package accesslog
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRotatingFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "accesslog")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "access.log")
+
+	f, err := NewRotatingFile(path, 10, 2)
+	require.NoError(t, err)
+	for _, line := range []string{"first\n", "second\n", "third\n", "fourth\n"} {
+		_, err := f.Write([]byte(line))
+		require.NoError(t, err)
+	}
+
+	read := func(name string) string {
+		data, err := ioutil.ReadFile(name)
+		require.NoError(t, err)
+		return string(data)
+	}
+	require.Equal(t, "fourth\n", read(path))
+	require.Equal(t, "third\n", read(path+".1"))
+	require.Equal(t, "second\n", read(path+".2"))
+	_, err = os.Stat(path + ".3")
+	require.True(t, os.IsNotExist(err))
+
+	// external rotation
+	require.NoError(t, os.Rename(path, path+".old"))
+	require.NoError(t, f.Reopen())
+	_, err = f.Write([]byte("fifth\n"))
+	require.NoError(t, err)
+	require.Equal(t, "fifth\n", read(path))
+
+	require.NoError(t, f.Close())
+	_, err = f.Write([]byte("sixth\n"))
+	require.Error(t, err)
+}
+
+func TestRotatingFileRotationFailure(t *testing.T) {
+	dir, err := ioutil.TempDir("", "accesslog")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "access.log")
+
+	// the file cannot be renamed over a non-empty directory
+	require.NoError(t, os.MkdirAll(filepath.Join(path+".1", "busy"), 0755))
+
+	f, err := NewRotatingFile(path, 10, 1)
+	require.NoError(t, err)
+	defer f.Close()
+	read := func(name string) string {
+		data, err := ioutil.ReadFile(name)
+		require.NoError(t, err)
+		return string(data)
+	}
+
+	// records are kept in the file while it cannot be rotated
+	for _, line := range []string{"first\n", "second\n"} {
+		_, err := f.Write([]byte(line))
+		require.NoError(t, err)
+	}
+	require.Equal(t, "first\nsecond\n", read(path))
+
+	require.NoError(t, os.RemoveAll(path+".1"))
+	_, err = f.Write([]byte("third\n"))
+	require.NoError(t, err)
+	require.Equal(t, "third\n", read(path))
+	require.Equal(t, "first\nsecond\n", read(path+".1"))
+}
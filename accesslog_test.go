@@ -0,0 +1,77 @@
+package goproxy
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"github.com/sirkon/goproxy/accesslog"
+)
+
+func TestMiddlewareAccessLog(t *testing.T) {
+	r, err := NewRouter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.AddRoute("example.com", listPlugin{}); err != nil {
+		t.Fatal(err)
+	}
+	var records []*accesslog.Record
+	logger := zerolog.New(ioutil.Discard)
+	m := MiddlewareAccessLog(r, "", &logger, accesslog.SinkFunc(func(rec *accesslog.Record) {
+		records = append(records, rec)
+	}))
+
+	req := httptest.NewRequest("GET", "/example.com/lib/@v/v1.0.0.mod", nil)
+	req.Header.Set(accesslog.RequestIDHeader, "request-1")
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, req)
+	if id := w.Header().Get(accesslog.RequestIDHeader); id != "request-1" {
+		t.Errorf("incoming request id expected in response, got %q", id)
+	}
+
+	w = httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest("GET", "/unknown.example.com/lib/@v/v1.0.0.info", nil))
+	generated := w.Header().Get(accesslog.RequestIDHeader)
+	if len(generated) == 0 {
+		t.Errorf("request id must be generated when there is no incoming one")
+	}
+
+	if len(records) != 2 {
+		t.Fatalf("2 records expected, got %d", len(records))
+	}
+	rec := records[0]
+	if rec.RequestID != "request-1" || rec.Module != "example.com/lib" || rec.Version != "v1.0.0" ||
+		rec.Endpoint != "mod" || rec.Plugin != "list" || rec.Status != 200 || rec.Bytes != 22 || rec.Duration <= 0 {
+		t.Errorf("unexpected record %+v", rec)
+	}
+	rec = records[1]
+	if rec.RequestID != generated || rec.Plugin != "" || rec.Status != 400 {
+		t.Errorf("unexpected record %+v", rec)
+	}
+}
+
+func TestMiddlewareNoAccessLog(t *testing.T) {
+	r, err := NewRouter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.AddRoute("example.com", listPlugin{}); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf).Level(zerolog.InfoLevel)
+	m := Middleware(r, "", &logger)
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest("GET", "/example.com/lib/@v/v1.0.0.mod", nil))
+	if w.Code != 200 {
+		t.Fatalf("200 expected, got %d", w.Code)
+	}
+	if buf.Len() > 0 {
+		t.Errorf("nothing is to be logged by default, got %s", buf.String())
+	}
+}
@@ -0,0 +1,50 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/sirkon/goproxy/internal/errors"
+)
+
+// ClientCert authenticator of TLS client certificates. The principal name is the certificate common name, groups
+// are its organizational units. Certificates are to be verified by the server, see ClientCertTLSConfig
+type ClientCert struct{}
+
+func (ClientCert) String() string {
+	return "mtls"
+}
+
+// Authenticate takes the leaf of the first verified chain of the connection
+func (ClientCert) Authenticate(req *http.Request) (*Principal, error) {
+	if req.TLS == nil || len(req.TLS.VerifiedChains) == 0 || len(req.TLS.VerifiedChains[0]) == 0 {
+		return nil, nil
+	}
+	cert := req.TLS.VerifiedChains[0][0]
+	if len(cert.Subject.CommonName) == 0 {
+		return nil, errors.New("client certificate has no common name")
+	}
+	return &Principal{
+		Name:   cert.Subject.CommonName,
+		Groups: cert.Subject.OrganizationalUnit,
+	}, nil
+}
+
+// ClientCertTLSConfig returns server TLS config verifying client certificates against CA certificates from PEM file.
+// Clients without certificates are let through, other authenticators may serve them
+func ClientCertTLSConfig(caFile string) (*tls.Config, error) {
+	data, err := ioutil.ReadFile(caFile)
+	if err != nil {
+		return nil, errors.Wrap(err, "auth reading client CA file")
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(data) {
+		return nil, errors.Newf("auth: no certificates in %s", caFile)
+	}
+	return &tls.Config{
+		ClientAuth: tls.VerifyClientCertIfGiven,
+		ClientCAs:  pool,
+	}, nil
+}
@@ -0,0 +1,30 @@
+package auth
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientCert(t *testing.T) {
+	req := httptest.NewRequest("GET", "/github.com/user/lib/@v/list", nil)
+	p, err := ClientCert{}.Authenticate(req)
+	require.NoError(t, err)
+	require.Nil(t, p)
+
+	// certificates which were not verified are not trusted
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "builder-01", OrganizationalUnit: []string{"builders"}}}
+	req.TLS = &tls.ConnectionState{PeerCertificates: []*x509.Certificate{cert}}
+	p, err = ClientCert{}.Authenticate(req)
+	require.NoError(t, err)
+	require.Nil(t, p)
+
+	req.TLS.VerifiedChains = [][]*x509.Certificate{{cert}}
+	p, err = ClientCert{}.Authenticate(req)
+	require.NoError(t, err)
+	require.Equal(t, &Principal{Name: "builder-01", Groups: []string{"builders"}}, p)
+}
@@ -0,0 +1,20 @@
+package auth
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// writeFile writes a file into a temporary directory, the returned function removes it
+func writeFile(t *testing.T, name, content string) (string, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "auth")
+	require.NoError(t, err)
+	file := filepath.Join(dir, name)
+	require.NoError(t, ioutil.WriteFile(file, []byte(content), 0644))
+	return file, func() { os.RemoveAll(dir) }
+}
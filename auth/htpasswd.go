@@ -0,0 +1,197 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base64"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/sirkon/goproxy/internal/errors"
+)
+
+// Htpasswd authenticator of basic auth credentials checked against Apache htpasswd file. bcrypt, MD5 ($apr1$) and SHA1
+// ({SHA}) password hashes are supported
+type Htpasswd struct {
+	file string
+
+	lock  sync.RWMutex
+	users map[string]string
+}
+
+// LoadHtpasswd creates htpasswd authenticator with users from the file
+func LoadHtpasswd(file string) (*Htpasswd, error) {
+	res := &Htpasswd{file: file}
+	if err := res.Reload(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Reload reads users from the file again. Current users are kept if the file is broken
+func (h *Htpasswd) Reload() error {
+	file, err := os.Open(h.file)
+	if err != nil {
+		return errors.Wrap(err, "auth opening htpasswd file")
+	}
+	defer file.Close()
+
+	users := map[string]string{}
+	scanner := bufio.NewScanner(file)
+	var lineNo int
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		pos := strings.IndexByte(line, ':')
+		if pos <= 0 {
+			return errors.Newf("auth %s:%d: user:hash expected", h.file, lineNo)
+		}
+		hash := line[pos+1:]
+		if !supportedHash(hash) {
+			return errors.Newf("auth %s:%d: unsupported password hash of %s", h.file, lineNo, line[:pos])
+		}
+		users[line[:pos]] = hash
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.Wrapf(err, "auth reading %s", h.file)
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.users = users
+	return nil
+}
+
+func (h *Htpasswd) String() string {
+	return "htpasswd"
+}
+
+// Authenticate checks basic auth credentials of the request. Unknown users are not errors, they may be of other
+// authenticators
+func (h *Htpasswd) Authenticate(req *http.Request) (*Principal, error) {
+	user, password, ok := req.BasicAuth()
+	if !ok {
+		return nil, nil
+	}
+	h.lock.RLock()
+	hash, ok := h.users[user]
+	h.lock.RUnlock()
+	if !ok {
+		return nil, nil
+	}
+	if !checkHash(hash, password) {
+		return nil, errors.Newf("invalid password of %s", user)
+	}
+	return &Principal{
+		Name:   user,
+		Secret: password,
+	}, nil
+}
+
+func supportedHash(hash string) bool {
+	for _, prefix := range []string{"$2a$", "$2b$", "$2y$", "$apr1$", "{SHA}"} {
+		if strings.HasPrefix(hash, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func checkHash(hash, password string) bool {
+	var computed string
+	switch {
+	case strings.HasPrefix(hash, "$apr1$"):
+		salt := strings.TrimPrefix(hash, "$apr1$")
+		if pos := strings.IndexByte(salt, '$'); pos >= 0 {
+			salt = salt[:pos]
+		}
+		computed = apr1(password, salt)
+	case strings.HasPrefix(hash, "{SHA}"):
+		sum := sha1.Sum([]byte(password))
+		computed = "{SHA}" + base64.StdEncoding.EncodeToString(sum[:])
+	default:
+		return bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)) == nil
+	}
+	return subtle.ConstantTimeCompare([]byte(hash), []byte(computed)) == 1
+}
+
+// apr1 computes Apache variant of MD5-based crypt
+func apr1(password, salt string) string {
+	const magic = "$apr1$"
+	if len(salt) > 8 {
+		salt = salt[:8]
+	}
+	pw := []byte(password)
+
+	alt := md5.New()
+	alt.Write(pw)
+	alt.Write([]byte(salt))
+	alt.Write(pw)
+	sum := alt.Sum(nil)
+
+	d := md5.New()
+	d.Write(pw)
+	d.Write([]byte(magic))
+	d.Write([]byte(salt))
+	for i := len(pw); i > 0; i -= md5.Size {
+		if i < md5.Size {
+			d.Write(sum[:i])
+		} else {
+			d.Write(sum)
+		}
+	}
+	for i := len(pw); i > 0; i >>= 1 {
+		if i&1 == 1 {
+			d.Write([]byte{0})
+		} else {
+			d.Write(pw[:1])
+		}
+	}
+	sum = d.Sum(nil)
+
+	for i := 0; i < 1000; i++ {
+		d := md5.New()
+		if i&1 == 1 {
+			d.Write(pw)
+		} else {
+			d.Write(sum)
+		}
+		if i%3 != 0 {
+			d.Write([]byte(salt))
+		}
+		if i%7 != 0 {
+			d.Write(pw)
+		}
+		if i&1 == 1 {
+			d.Write(sum)
+		} else {
+			d.Write(pw)
+		}
+		sum = d.Sum(nil)
+	}
+
+	const alphabet = "./0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+	var buf strings.Builder
+	encode := func(v uint, n int) {
+		for ; n > 0; n-- {
+			buf.WriteByte(alphabet[v&0x3f])
+			v >>= 6
+		}
+	}
+	encode(uint(sum[0])<<16|uint(sum[6])<<8|uint(sum[12]), 4)
+	encode(uint(sum[1])<<16|uint(sum[7])<<8|uint(sum[13]), 4)
+	encode(uint(sum[2])<<16|uint(sum[8])<<8|uint(sum[14]), 4)
+	encode(uint(sum[3])<<16|uint(sum[9])<<8|uint(sum[15]), 4)
+	encode(uint(sum[4])<<16|uint(sum[10])<<8|uint(sum[5]), 4)
+	encode(uint(sum[11]), 2)
+	return magic + salt + "$" + buf.String()
+}
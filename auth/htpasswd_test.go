@@ -0,0 +1,83 @@
+package auth
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestApr1(t *testing.T) {
+	// openssl passwd -apr1 -salt saltsalt password
+	require.Equal(t, "$apr1$saltsalt$yAAkm4libquA.ZWLHbSBq/", apr1("password", "saltsalt"))
+}
+
+func TestHtpasswd(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("bcrypt-password"), bcrypt.MinCost)
+	require.NoError(t, err)
+	file, cleanup := writeFile(t, "htpasswd", "alice:$apr1$saltsalt$yAAkm4libquA.ZWLHbSBq/\n"+
+		"bob:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g=\n"+
+		"carol:"+string(hash)+"\n")
+	defer cleanup()
+	htpasswd, err := LoadHtpasswd(file)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name    string
+		user    string
+		pass    string
+		want    *Principal
+		wantErr bool
+	}{
+		{
+			name: "apr1",
+			user: "alice",
+			pass: "password",
+			want: &Principal{Name: "alice", Secret: "password"},
+		},
+		{
+			name: "sha",
+			user: "bob",
+			pass: "password",
+			want: &Principal{Name: "bob", Secret: "password"},
+		},
+		{
+			name: "bcrypt",
+			user: "carol",
+			pass: "bcrypt-password",
+			want: &Principal{Name: "carol", Secret: "bcrypt-password"},
+		},
+		{
+			name:    "wrong-password",
+			user:    "carol",
+			pass:    "password",
+			wantErr: true,
+		},
+		{
+			name: "unknown-user",
+			user: "dave",
+			pass: "password",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/github.com/user/lib/@v/list", nil)
+			req.SetBasicAuth(tt.user, tt.pass)
+			p, err := htpasswd.Authenticate(req)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, p)
+		})
+	}
+}
+
+func TestHtpasswdUnsupportedHash(t *testing.T) {
+	file, cleanup := writeFile(t, "htpasswd", "alice:password\n")
+	defer cleanup()
+	_, err := LoadHtpasswd(file)
+	require.Error(t, err)
+}
@@ -0,0 +1,290 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	_ "crypto/sha256" // hashes of signing algorithms
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirkon/goproxy/internal/errors"
+)
+
+// clockSkew tolerance of exp and nbf claims checks
+const clockSkew = time.Minute
+
+// JWTOptions what JWT authenticator requires of tokens and where it takes principal data from
+type JWTOptions struct {
+	Issuer      string // required iss claim, any issuer is accepted if empty
+	Audience    string // required item of aud claim, any audience is accepted if empty
+	NameClaim   string // claim with the principal name, sub if empty
+	GroupsClaim string // claim with principal groups, a string or a list of strings, groups if empty
+}
+
+// JWT authenticator of JSON Web Tokens signed with keys from a local JWKS file. RS*, PS* and ES* algorithms are
+// supported. Tokens are taken from Authorization: Bearer header or from basic auth, see bearer
+type JWT struct {
+	file    string
+	options JWTOptions
+
+	lock sync.RWMutex
+	keys []jsonWebKey
+}
+
+type jsonWebKey struct {
+	id  string
+	alg string
+	key crypto.PublicKey
+}
+
+// LoadJWT creates JWT authenticator with keys from JWKS file
+func LoadJWT(jwksFile string, options JWTOptions) (*JWT, error) {
+	if len(options.NameClaim) == 0 {
+		options.NameClaim = "sub"
+	}
+	if len(options.GroupsClaim) == 0 {
+		options.GroupsClaim = "groups"
+	}
+	res := &JWT{
+		file:    jwksFile,
+		options: options,
+	}
+	if err := res.Reload(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Reload reads keys from the file again. Current keys are kept if the file is broken
+func (j *JWT) Reload() error {
+	data, err := ioutil.ReadFile(j.file)
+	if err != nil {
+		return errors.Wrap(err, "auth reading JWKS file")
+	}
+	var set struct {
+		Keys []struct {
+			Kty string `json:"kty"`
+			Kid string `json:"kid"`
+			Alg string `json:"alg"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &set); err != nil {
+		return errors.Wrapf(err, "auth decoding %s", j.file)
+	}
+
+	var keys []jsonWebKey
+	for i, k := range set.Keys {
+		if len(k.Use) > 0 && k.Use != "sig" {
+			continue
+		}
+		key := jsonWebKey{id: k.Kid, alg: k.Alg}
+		switch k.Kty {
+		case "RSA":
+			n, nErr := decodeInt(k.N)
+			e, eErr := decodeInt(k.E)
+			if nErr != nil || eErr != nil || !e.IsInt64() {
+				return errors.Newf("auth %s: invalid RSA key #%d", j.file, i)
+			}
+			key.key = &rsa.PublicKey{N: n, E: int(e.Int64())}
+		case "EC":
+			curve := curves[k.Crv]
+			x, xErr := decodeInt(k.X)
+			y, yErr := decodeInt(k.Y)
+			if curve == nil || xErr != nil || yErr != nil || !curve.IsOnCurve(x, y) {
+				return errors.Newf("auth %s: invalid EC key #%d", j.file, i)
+			}
+			key.key = &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		default:
+			continue
+		}
+		keys = append(keys, key)
+	}
+	if len(keys) == 0 {
+		return errors.Newf("auth %s: no signing keys", j.file)
+	}
+
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	j.keys = keys
+	return nil
+}
+
+var curves = map[string]elliptic.Curve{
+	"P-256": elliptic.P256(),
+	"P-384": elliptic.P384(),
+	"P-521": elliptic.P521(),
+}
+
+func decodeInt(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(data), nil
+}
+
+func (j *JWT) String() string {
+	return "jwt"
+}
+
+// Authenticate validates the token of the request. Tokens which are not JWTs are left for other authenticators
+func (j *JWT) Authenticate(req *http.Request) (*Principal, error) {
+	token := bearer(req)
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, nil
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil || len(header.Alg) == 0 {
+		return nil, nil
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, errors.Wrap(err, "decoding token signature")
+	}
+	if err := j.verify(header.Alg, header.Kid, parts[0]+"."+parts[1], signature); err != nil {
+		return nil, err
+	}
+
+	var claims map[string]interface{}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, errors.Wrap(err, "decoding token claims")
+	}
+	if err := j.validate(claims); err != nil {
+		return nil, err
+	}
+	name, _ := claims[j.options.NameClaim].(string)
+	if len(name) == 0 {
+		return nil, errors.Newf("token has no %s claim", j.options.NameClaim)
+	}
+	return &Principal{
+		Name:   name,
+		Groups: stringList(claims[j.options.GroupsClaim]),
+		Secret: token,
+	}, nil
+}
+
+func decodeSegment(segment string, dest interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, dest)
+}
+
+// verify checks the signature with the key of the token, or with every suitable key if the token does not refer one
+func (j *JWT) verify(alg, kid, signed string, signature []byte) error {
+	hash, ok := algHashes[alg]
+	if !ok || !hash.Available() {
+		return errors.Newf("unsupported token algorithm %s", alg)
+	}
+	h := hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	j.lock.RLock()
+	defer j.lock.RUnlock()
+	for _, key := range j.keys {
+		if (len(kid) > 0 && key.id != kid) || (len(key.alg) > 0 && key.alg != alg) {
+			continue
+		}
+		var valid bool
+		switch k := key.key.(type) {
+		case *rsa.PublicKey:
+			switch {
+			case strings.HasPrefix(alg, "RS"):
+				valid = rsa.VerifyPKCS1v15(k, hash, digest, signature) == nil
+			case strings.HasPrefix(alg, "PS"):
+				valid = rsa.VerifyPSS(k, hash, digest, signature, nil) == nil
+			}
+		case *ecdsa.PublicKey:
+			size := (k.Curve.Params().BitSize + 7) / 8
+			if strings.HasPrefix(alg, "ES") && len(signature) == 2*size {
+				r := new(big.Int).SetBytes(signature[:size])
+				s := new(big.Int).SetBytes(signature[size:])
+				valid = ecdsa.Verify(k, digest, r, s)
+			}
+		}
+		if valid {
+			return nil
+		}
+	}
+	return errors.New("invalid token signature")
+}
+
+var algHashes = map[string]crypto.Hash{
+	"RS256": crypto.SHA256,
+	"RS384": crypto.SHA384,
+	"RS512": crypto.SHA512,
+	"PS256": crypto.SHA256,
+	"PS384": crypto.SHA384,
+	"PS512": crypto.SHA512,
+	"ES256": crypto.SHA256,
+	"ES384": crypto.SHA384,
+	"ES512": crypto.SHA512,
+}
+
+// validate checks registered claims of the token
+func (j *JWT) validate(claims map[string]interface{}) error {
+	now := time.Now()
+	if exp, ok := claims["exp"].(float64); ok && now.After(time.Unix(int64(exp), 0).Add(clockSkew)) {
+		return errors.New("token expired")
+	}
+	if nbf, ok := claims["nbf"].(float64); ok && now.Add(clockSkew).Before(time.Unix(int64(nbf), 0)) {
+		return errors.New("token is not valid yet")
+	}
+	if len(j.options.Issuer) > 0 {
+		if iss, _ := claims["iss"].(string); iss != j.options.Issuer {
+			return errors.Newf("token issuer %q is not %q", iss, j.options.Issuer)
+		}
+	}
+	if len(j.options.Audience) > 0 {
+		var found bool
+		for _, aud := range stringList(claims["aud"]) {
+			if aud == j.options.Audience {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return errors.Newf("token is not issued for %s", j.options.Audience)
+		}
+	}
+	return nil
+}
+
+// stringList takes a claim value which is either a string or a list of strings
+func stringList(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		var res []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				res = append(res, s)
+			}
+		}
+		return res
+	default:
+		return nil
+	}
+}
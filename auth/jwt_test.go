@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func encodeSegment(t *testing.T, value interface{}) string {
+	t.Helper()
+	data, err := json.Marshal(value)
+	require.NoError(t, err)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// sign creates JWT signed with RS256 if key is RSA one and with ES256 otherwise
+func sign(t *testing.T, kid string, key crypto.Signer, claims map[string]interface{}) string {
+	t.Helper()
+	alg := "ES256"
+	if _, ok := key.(*rsa.PrivateKey); ok {
+		alg = "RS256"
+	}
+	signed := encodeSegment(t, map[string]string{"alg": alg, "kid": kid, "typ": "JWT"}) + "." + encodeSegment(t, claims)
+	digest := crypto.SHA256.New()
+	digest.Write([]byte(signed))
+	var signature []byte
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		var err error
+		signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest.Sum(nil))
+		require.NoError(t, err)
+	case *ecdsa.PrivateKey:
+		r, s, err := ecdsa.Sign(rand.Reader, k, digest.Sum(nil))
+		require.NoError(t, err)
+		signature = make([]byte, 64)
+		r.FillBytes(signature[:32])
+		s.FillBytes(signature[32:])
+	}
+	return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func encodeInt(i *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(i.Bytes())
+}
+
+func TestJWT(t *testing.T) {
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	otherKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	jwks, err := json.Marshal(map[string]interface{}{
+		"keys": []map[string]string{
+			{"kty": "RSA", "kid": "rsa", "use": "sig", "n": encodeInt(rsaKey.N), "e": encodeInt(big.NewInt(int64(rsaKey.E)))},
+			{"kty": "EC", "kid": "ec", "crv": "P-256", "x": encodeInt(ecKey.X), "y": encodeInt(ecKey.Y)},
+		},
+	})
+	require.NoError(t, err)
+	file, cleanup := writeFile(t, "jwks.json", string(jwks))
+	defer cleanup()
+	authenticator, err := LoadJWT(file, JWTOptions{Issuer: "https://sso.example.com", Audience: "goproxy"})
+	require.NoError(t, err)
+
+	claims := func(changes map[string]interface{}) map[string]interface{} {
+		res := map[string]interface{}{
+			"iss":    "https://sso.example.com",
+			"aud":    []string{"goproxy", "other"},
+			"sub":    "alice",
+			"groups": []string{"developers"},
+			"exp":    time.Now().Add(time.Hour).Unix(),
+		}
+		for k, v := range changes {
+			if v == nil {
+				delete(res, k)
+				continue
+			}
+			res[k] = v
+		}
+		return res
+	}
+
+	tests := []struct {
+		name     string
+		token    string
+		wantName string
+		wantErr  bool
+	}{
+		{
+			name:     "rsa",
+			token:    sign(t, "rsa", rsaKey, claims(nil)),
+			wantName: "alice",
+		},
+		{
+			name:     "ec",
+			token:    sign(t, "ec", ecKey, claims(map[string]interface{}{"sub": "bob", "aud": "goproxy"})),
+			wantName: "bob",
+		},
+		{
+			name:     "no-kid",
+			token:    sign(t, "", ecKey, claims(nil)),
+			wantName: "alice",
+		},
+		{
+			name:    "unknown-key",
+			token:   sign(t, "", otherKey, claims(nil)),
+			wantErr: true,
+		},
+		{
+			name:    "expired",
+			token:   sign(t, "rsa", rsaKey, claims(map[string]interface{}{"exp": time.Now().Add(-time.Hour).Unix()})),
+			wantErr: true,
+		},
+		{
+			name:    "not-yet",
+			token:   sign(t, "rsa", rsaKey, claims(map[string]interface{}{"nbf": time.Now().Add(time.Hour).Unix()})),
+			wantErr: true,
+		},
+		{
+			name:    "issuer",
+			token:   sign(t, "rsa", rsaKey, claims(map[string]interface{}{"iss": "https://evil.example.com"})),
+			wantErr: true,
+		},
+		{
+			name:    "audience",
+			token:   sign(t, "rsa", rsaKey, claims(map[string]interface{}{"aud": "other"})),
+			wantErr: true,
+		},
+		{
+			name:    "no-subject",
+			token:   sign(t, "rsa", rsaKey, claims(map[string]interface{}{"sub": nil})),
+			wantErr: true,
+		},
+		{
+			name:  "not-jwt",
+			token: "3c1f8a0d5e",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/github.com/user/lib/@v/list", nil)
+			req.SetBasicAuth("oauth2", tt.token)
+			p, err := authenticator.Authenticate(req)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			if len(tt.wantName) == 0 {
+				require.Nil(t, p)
+				return
+			}
+			require.Equal(t, tt.wantName, p.Name)
+			require.Equal(t, []string{"developers"}, p.Groups)
+			require.Equal(t, tt.token, p.Secret)
+		})
+	}
+}
@@ -0,0 +1,97 @@
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/rs/zerolog"
+
+	"github.com/sirkon/goproxy/internal/errors"
+)
+
+// Authenticator establishes the principal of a request. It returns nil principal and nil error when the request has no
+// credentials it knows, the next authenticator tries then. An error means credentials are recognized but invalid
+type Authenticator interface {
+	Authenticate(req *http.Request) (*Principal, error)
+	String() string
+}
+
+// Realm of basic authentication challenges
+const Realm = "goproxy"
+
+// Middleware authenticates requests before passing them to next, the principal is put into request context. Requests
+// no authenticator has established the principal of are refused with 401 Unauthorized
+func Middleware(next http.Handler, logger *zerolog.Logger, authenticators ...Authenticator) http.Handler {
+	return &middleware{
+		next:           next,
+		logger:         logger,
+		authenticators: authenticators,
+	}
+}
+
+// OptionalMiddleware Middleware which passes requests without recognized credentials to next as anonymous ones.
+// Requests with invalid credentials are still refused
+func OptionalMiddleware(next http.Handler, logger *zerolog.Logger, authenticators ...Authenticator) http.Handler {
+	return &middleware{
+		next:           next,
+		logger:         logger,
+		authenticators: authenticators,
+		anonymous:      true,
+	}
+}
+
+type middleware struct {
+	next           http.Handler
+	logger         *zerolog.Logger
+	authenticators []Authenticator
+	anonymous      bool
+}
+
+func (m *middleware) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	logger := m.logger.With().Str("request", req.URL.String()).Logger()
+	for _, a := range m.authenticators {
+		p, err := a.Authenticate(req)
+		if err != nil {
+			logger.Warn().Err(err).Str("authenticator", a.String()).Msg("authentication failed")
+			unauthorized(w, errors.Wrap(err, a.String()))
+			return
+		}
+		if p == nil {
+			continue
+		}
+		p.Method = a.String()
+		logger.Debug().Str("principal", p.Name).Str("authenticator", p.Method).Msg("authenticated")
+		m.next.ServeHTTP(w, req.WithContext(WithPrincipal(req.Context(), p)))
+		return
+	}
+
+	if m.anonymous {
+		m.next.ServeHTTP(w, req)
+		return
+	}
+	logger.Warn().Msg("authentication required")
+	unauthorized(w, errors.New("authentication required"))
+}
+
+func unauthorized(w http.ResponseWriter, err error) {
+	w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Basic realm="%s"`, Realm))
+	http.Error(w, err.Error(), http.StatusUnauthorized)
+}
+
+// bearer returns a token of the request: the one of Authorization: Bearer header, a password of basic auth, or a user
+// name of basic auth with empty password. The go command can only send basic auth, hence the latter two
+func bearer(req *http.Request) string {
+	if header := req.Header.Get("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimSpace(header[len("Bearer "):])
+	}
+	user, password, ok := req.BasicAuth()
+	switch {
+	case !ok:
+		return ""
+	case len(password) > 0:
+		return password
+	default:
+		return user
+	}
+}
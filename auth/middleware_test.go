@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMiddleware(t *testing.T) {
+	tokenFile, cleanup := writeFile(t, "tokens", "ci 3c1f8a0d5e builders\n")
+	defer cleanup()
+	tokens, err := LoadTokens(tokenFile)
+	require.NoError(t, err)
+	htpasswdFile, cleanup := writeFile(t, "htpasswd", "alice:$apr1$saltsalt$yAAkm4libquA.ZWLHbSBq/\n")
+	defer cleanup()
+	htpasswd, err := LoadHtpasswd(htpasswdFile)
+	require.NoError(t, err)
+
+	next := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		user, password, _ := Credentials(req)
+		p := FromContext(req.Context())
+		if p == nil {
+			_, _ = w.Write([]byte("anonymous " + user + ":" + password))
+			return
+		}
+		_, _ = w.Write([]byte(p.Method + " " + user + ":" + password))
+	})
+	logger := zerolog.New(ioutil.Discard)
+
+	tests := []struct {
+		name     string
+		optional bool
+		forward  bool
+		user     string
+		pass     string
+		wantCode int
+		wantBody string
+	}{
+		{
+			name:     "token",
+			user:     "3c1f8a0d5e",
+			wantCode: http.StatusOK,
+			wantBody: "token :",
+		},
+		{
+			name:     "token-forward",
+			forward:  true,
+			user:     "3c1f8a0d5e",
+			wantCode: http.StatusOK,
+			wantBody: "token ci:3c1f8a0d5e",
+		},
+		{
+			name:     "htpasswd",
+			user:     "alice",
+			pass:     "password",
+			wantCode: http.StatusOK,
+			wantBody: "htpasswd :",
+		},
+		{
+			name:     "wrong-password",
+			optional: true,
+			user:     "alice",
+			pass:     "wrong",
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "unknown",
+			user:     "bob",
+			pass:     "password",
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "anonymous",
+			wantCode: http.StatusUnauthorized,
+		},
+		{
+			name:     "optional-unknown",
+			optional: true,
+			user:     "bob",
+			pass:     "password",
+			wantCode: http.StatusOK,
+			wantBody: "anonymous bob:password",
+		},
+		{
+			name:     "optional-anonymous",
+			optional: true,
+			wantCode: http.StatusOK,
+			wantBody: "anonymous :",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tokenAuth Authenticator = tokens
+			if tt.forward {
+				tokenAuth = Forward(tokens)
+			}
+			handler := Middleware(next, &logger, tokenAuth, htpasswd)
+			if tt.optional {
+				handler = OptionalMiddleware(next, &logger, tokenAuth, htpasswd)
+			}
+			req := httptest.NewRequest("GET", "/github.com/user/lib/@v/list", nil)
+			if len(tt.user) > 0 {
+				req.SetBasicAuth(tt.user, tt.pass)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+			require.Equal(t, tt.wantCode, w.Code)
+			if tt.wantCode == http.StatusUnauthorized {
+				require.Equal(t, `Basic realm="goproxy"`, w.Header().Get("WWW-Authenticate"))
+				return
+			}
+			require.Equal(t, tt.wantBody, w.Body.String())
+		})
+	}
+}
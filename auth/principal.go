@@ -0,0 +1,75 @@
+package auth
+
+import (
+	"context"
+	"net/http"
+)
+
+// Principal authenticated client of the proxy
+type Principal struct {
+	Name   string   // user name, token owner, JWT subject or certificate common name
+	Groups []string // groups the principal belongs to, if an authenticator knows them
+	Method string   // name of the authenticator which established the principal
+
+	// Secret is a token or a password the principal presented, it is empty for client certificates
+	Secret string
+
+	// Forwardable means Secret is a credential of upstream services as well, plugins pass it further then. It is only
+	// set by authenticators wrapped with Forward
+	Forwardable bool
+}
+
+// InGroup checks if the principal belongs to the group
+func (p *Principal) InGroup(group string) bool {
+	for _, g := range p.Groups {
+		if g == group {
+			return true
+		}
+	}
+	return false
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a copy of ctx with the principal
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the principal established for a request with the context, nil for anonymous requests
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
+
+// Credentials returns the principal name and secret of the request if there is the principal with a forwardable
+// secret. Credentials of principals with secrets of the proxy itself are never returned, basic auth credentials of the
+// request are returned only if there is no principal at all. Plugins passing credentials further are to use it
+func Credentials(req *http.Request) (user, password string, ok bool) {
+	if p := FromContext(req.Context()); p != nil {
+		if !p.Forwardable || len(p.Secret) == 0 {
+			return "", "", false
+		}
+		return p.Name, p.Secret, true
+	}
+	return req.BasicAuth()
+}
+
+// Forward wraps the authenticator to mark secrets of principals it establishes as forwardable. Use it only when these
+// secrets are accepted by upstream services too, e.g. JWTs issued by the same identity provider or tokens of the
+// GitLab instance behind the proxy
+func Forward(a Authenticator) Authenticator {
+	return forward{a}
+}
+
+type forward struct {
+	Authenticator
+}
+
+func (f forward) Authenticate(req *http.Request) (*Principal, error) {
+	p, err := f.Authenticator.Authenticate(req)
+	if p != nil && len(p.Secret) > 0 {
+		p.Forwardable = true
+	}
+	return p, err
+}
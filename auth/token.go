@@ -0,0 +1,106 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/sirkon/goproxy/internal/errors"
+)
+
+// Tokens authenticator of static tokens listed in a file, one per line as <name> <token> [<group>,...], e.g.
+//
+//	ci     3c1f8a0d5e    builders
+//	alice  9b2e77c4a1    admins,developers
+//
+// Empty lines and lines starting with # are skipped. Tokens are taken from Authorization: Bearer header or from basic
+// auth, see bearer
+type Tokens struct {
+	file string
+
+	lock   sync.RWMutex
+	tokens map[[sha256.Size]byte]tokenOwner
+}
+
+type tokenOwner struct {
+	name   string
+	groups []string
+}
+
+// LoadTokens creates token authenticator with tokens from the file
+func LoadTokens(file string) (*Tokens, error) {
+	res := &Tokens{file: file}
+	if err := res.Reload(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Reload reads tokens from the file again. Current tokens are kept if the file is broken
+func (t *Tokens) Reload() error {
+	file, err := os.Open(t.file)
+	if err != nil {
+		return errors.Wrap(err, "auth opening tokens file")
+	}
+	defer file.Close()
+
+	tokens := map[[sha256.Size]byte]tokenOwner{}
+	scanner := bufio.NewScanner(file)
+	var lineNo int
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 || len(fields) > 3 {
+			return errors.Newf("auth %s:%d: name, token and optional groups expected", t.file, lineNo)
+		}
+		key := sha256.Sum256([]byte(fields[1]))
+		if _, ok := tokens[key]; ok {
+			return errors.Newf("auth %s:%d: duplicate token", t.file, lineNo)
+		}
+		owner := tokenOwner{name: fields[0]}
+		if len(fields) == 3 {
+			owner.groups = strings.Split(fields[2], ",")
+		}
+		tokens[key] = owner
+	}
+	if err := scanner.Err(); err != nil {
+		return errors.Wrapf(err, "auth reading %s", t.file)
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.tokens = tokens
+	return nil
+}
+
+func (t *Tokens) String() string {
+	return "token"
+}
+
+// Authenticate looks for the token of the request. Unknown tokens are not errors, they may be of other authenticators
+func (t *Tokens) Authenticate(req *http.Request) (*Principal, error) {
+	token := bearer(req)
+	if len(token) == 0 {
+		return nil, nil
+	}
+	// tokens are looked up by their hashes, this way lookup time does not tell anything about the tokens
+	key := sha256.Sum256([]byte(token))
+	t.lock.RLock()
+	owner, ok := t.tokens[key]
+	t.lock.RUnlock()
+	if !ok {
+		return nil, nil
+	}
+	return &Principal{
+		Name:   owner.name,
+		Groups: owner.groups,
+		Secret: token,
+	}, nil
+}
@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTokens(t *testing.T) {
+	file, cleanup := writeFile(t, "tokens", `
+# builders
+ci     3c1f8a0d5e  builders
+alice  9b2e77c4a1  admins,developers
+`)
+	defer cleanup()
+	tokens, err := LoadTokens(file)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		header string
+		user   string
+		pass   string
+		want   *Principal
+	}{
+		{
+			name:   "bearer",
+			header: "Bearer 9b2e77c4a1",
+			want:   &Principal{Name: "alice", Groups: []string{"admins", "developers"}, Secret: "9b2e77c4a1"},
+		},
+		{
+			name: "basic-password",
+			user: "anyone",
+			pass: "3c1f8a0d5e",
+			want: &Principal{Name: "ci", Groups: []string{"builders"}, Secret: "3c1f8a0d5e"},
+		},
+		{
+			name: "basic-user",
+			user: "3c1f8a0d5e",
+			want: &Principal{Name: "ci", Groups: []string{"builders"}, Secret: "3c1f8a0d5e"},
+		},
+		{
+			name:   "unknown",
+			header: "Bearer 0000000000",
+		},
+		{
+			name: "none",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/github.com/user/lib/@v/list", nil)
+			if len(tt.header) > 0 {
+				req.Header.Set("Authorization", tt.header)
+			} else if len(tt.user) > 0 {
+				req.SetBasicAuth(tt.user, tt.pass)
+			}
+			p, err := tokens.Authenticate(req)
+			require.NoError(t, err)
+			require.Equal(t, tt.want, p)
+		})
+	}
+}
+
+func TestTokensInvalidFile(t *testing.T) {
+	file, cleanup := writeFile(t, "tokens", "ci 3c1f8a0d5e\nbob 3c1f8a0d5e\n")
+	defer cleanup()
+	_, err := LoadTokens(file)
+	require.Error(t, err)
+}
@@ -0,0 +1,53 @@
+// Package bundle moves go proxy content across air gaps. A bundle is a gzipped tar archive with manifest.json as its
+// first entry followed by .info, .mod and .zip files of module versions laid out like in
+// $GOPATH/pkg/mod/cache/download. The manifest lists every module version in the bundle along with SHA-256 hashes of
+// its files, so the importer verifies the whole content before putting anything into the destination
+package bundle
+
+import (
+	"time"
+
+	"github.com/sirkon/goproxy/internal/errors"
+	"github.com/sirkon/goproxy/internal/module"
+)
+
+// Format is the version of bundle format produced by this package
+const Format = 1
+
+const manifestName = "manifest.json"
+
+// Kinds of module version files
+const (
+	InfoFile = "info"
+	ModFile  = "mod"
+	ZipFile  = "zip"
+)
+
+var kinds = []string{InfoFile, ModFile, ZipFile}
+
+// Manifest describes bundle content
+type Manifest struct {
+	Format  int
+	Created time.Time
+	Modules []Module
+}
+
+// Module describes a module version in a bundle
+type Module struct {
+	Path    string
+	Version string
+	Hashes  map[string]string // file kind → hex encoded SHA-256 of the file
+}
+
+// fileName returns bundle entry name of the module version file of given kind
+func fileName(path, version, kind string) (string, error) {
+	encPath, err := module.EncodePath(path)
+	if err != nil {
+		return "", errors.Wrapf(err, "bundle encoding module path %s", path)
+	}
+	encVersion, err := module.EncodeVersion(version)
+	if err != nil {
+		return "", errors.Wrapf(err, "bundle encoding version %s of %s", version, path)
+	}
+	return encPath + "/@v/" + encVersion + "." + kind, nil
+}
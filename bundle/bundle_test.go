@@ -0,0 +1,146 @@
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sirkon/goproxy"
+	"github.com/sirkon/goproxy/gomod"
+	"github.com/sirkon/goproxy/internal/plugintest"
+	"github.com/sirkon/goproxy/plugin/apriori"
+)
+
+func writeModule(t *testing.T, root, encPath, version, goMod string) {
+	dir := filepath.Join(root, filepath.FromSlash(encPath), "@v")
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	files := map[string]string{
+		version + ".info": `{"Version":"` + version + `","Time":"2019-01-02T03:04:05Z"}`,
+		version + ".mod":  goMod,
+		version + ".zip":  "zip of " + encPath + "@" + version,
+	}
+	for name, content := range files {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "bundle-test")
+	require.NoError(t, err)
+	return dir
+}
+
+func TestExportImport(t *testing.T) {
+	srcRoot := tempDir(t)
+	defer os.RemoveAll(srcRoot)
+	writeModule(t, srcRoot, "github.com/!user/a", "v1.0.0", "module github.com/User/a\n\nrequire github.com/user/b v0.1.0\n")
+	writeModule(t, srcRoot, "github.com/user/b", "v0.1.0", "module github.com/user/b\n")
+	writeModule(t, srcRoot, "github.com/user/b", "v0.2.0", "module github.com/user/b\n")
+
+	src, err := apriori.NewDirPlugin(srcRoot)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	deps, err := Graph(ctx, src, []byte("module example.com/main\n\nrequire github.com/User/a v1.0.0\n"))
+	require.NoError(t, err)
+	require.Equal(t, []gomod.Dependency{
+		{Path: "github.com/User/a", Version: "v1.0.0"},
+		{Path: "github.com/user/b", Version: "v0.1.0"},
+	}, deps)
+
+	list, err := ParseList(strings.NewReader("# comment\n\ngithub.com/user/b@v0.2.0\n"))
+	require.NoError(t, err)
+	deps = append(deps, list...)
+
+	var buf bytes.Buffer
+	manifest, err := Export(ctx, &buf, src, deps)
+	require.NoError(t, err)
+	require.Len(t, manifest.Modules, 3)
+
+	// import into apriori directory and serve it from there
+	dstRoot := tempDir(t)
+	defer os.RemoveAll(dstRoot)
+	_, err = Import(bytes.NewReader(buf.Bytes()), Dir(dstRoot))
+	require.NoError(t, err)
+
+	dst, err := apriori.NewDirPlugin(dstRoot)
+	require.NoError(t, err)
+	req, err := goproxy.NewModuleRequest(ctx, "github.com/user/b")
+	require.NoError(t, err)
+	mod, err := dst.Module(req, "")
+	require.NoError(t, err)
+	versions, err := mod.Versions(ctx, "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"v0.1.0", "v0.2.0"}, versions)
+
+	// import into file cache
+	cache := plugintest.NewCache()
+	registry := map[string]map[string]struct{}{}
+	_, err = Import(bytes.NewReader(buf.Bytes()), FileCache(cache, registry))
+	require.NoError(t, err)
+	data, ok := cache.Item("github.com/User/a/v1.0.0/src.zip")
+	require.True(t, ok)
+	require.Equal(t, "zip of github.com/!user/a@v1.0.0", string(data))
+	require.Contains(t, registry["github.com/user/b"], "v0.2.0")
+}
+
+func TestImportCorrupted(t *testing.T) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	entries := []struct {
+		name string
+		data string
+	}{
+		{
+			name: manifestName,
+			data: `{"Format":1,"Modules":[{"Path":"a.b/c","Version":"v1.0.0","Hashes":{` +
+				`"info":"ca978112ca1bbdcafac231b39a23dc4da786eff8146d4c9e2b6e2b38b1d3b1a1",` +
+				`"mod":"ca978112ca1bbdcafac231b39a23dc4da786eff8146d4c9e2b6e2b38b1d3b1a1",` +
+				`"zip":"ca978112ca1bbdcafac231b39a23dc4da786eff8146d4c9e2b6e2b38b1d3b1a1"}}]}`,
+		},
+		{
+			name: "a.b/c/@v/v1.0.0.info",
+			data: "b",
+		},
+	}
+	for _, entry := range entries {
+		require.NoError(t, tw.WriteHeader(&tar.Header{Name: entry.name, Mode: 0644, Size: int64(len(entry.data))}))
+		_, err := io.WriteString(tw, entry.data)
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	require.NoError(t, gz.Close())
+
+	cache := plugintest.NewCache()
+	_, err := Import(&buf, FileCache(cache, nil))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "checksum mismatch")
+	require.Zero(t, cache.Len())
+}
+
+func TestDirListsCompleteVersions(t *testing.T) {
+	root := tempDir(t)
+	defer os.RemoveAll(root)
+	dst := Dir(root)
+	listPath := filepath.Join(root, "github.com", "user", "b", "@v", "list")
+
+	require.NoError(t, dst.Put("github.com/user/b", "v0.1.0", InfoFile, strings.NewReader(`{"Version":"v0.1.0"}`)))
+	require.NoError(t, dst.Put("github.com/user/b", "v0.1.0", ModFile, strings.NewReader("module github.com/user/b\n")))
+	_, err := os.Stat(listPath)
+	require.True(t, os.IsNotExist(err), "version listed before its zip is written")
+
+	require.NoError(t, dst.Put("github.com/user/b", "v0.1.0", ZipFile, strings.NewReader("zip")))
+	data, err := ioutil.ReadFile(listPath)
+	require.NoError(t, err)
+	require.Equal(t, "v0.1.0\n", string(data))
+}
@@ -0,0 +1,131 @@
+package bundle
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/sirkon/goproxy/internal/errors"
+	"github.com/sirkon/goproxy/plugin/aposteriori"
+	"github.com/sirkon/goproxy/semver"
+)
+
+// FileCache returns destination saving bundle content into aposteriori cache. Versions are also added into registry
+// if it is not nil, so it can be passed to aposteriori.NewCachePriority
+func FileCache(cache aposteriori.FileCache, registry map[string]map[string]struct{}) Destination {
+	return &fileCacheDestination{
+		cache:    cache,
+		registry: registry,
+	}
+}
+
+type fileCacheDestination struct {
+	cache    aposteriori.FileCache
+	registry map[string]map[string]struct{}
+}
+
+func (d *fileCacheDestination) Put(path, version, kind string, data io.Reader) error {
+	var name string
+	switch kind {
+	case InfoFile:
+		name = aposteriori.RevInfoName
+	case ModFile:
+		name = aposteriori.GoModName
+	case ZipFile:
+		name = aposteriori.ZipName
+	default:
+		return errors.Newf("unsupported file kind %s", kind)
+	}
+	if err := d.cache.Set(aposteriori.CachePath(path, version, name), data); err != nil {
+		return err
+	}
+	if kind == ZipFile && d.registry != nil {
+		versions, ok := d.registry[path]
+		if !ok {
+			versions = map[string]struct{}{}
+			d.registry[path] = versions
+		}
+		versions[version] = struct{}{}
+	}
+	return nil
+}
+
+// Dir returns destination saving bundle content into a directory served with apriori.NewDirPlugin. Version lists are
+// updated as well
+func Dir(root string) Destination {
+	return dirDestination(root)
+}
+
+type dirDestination string
+
+func (d dirDestination) Put(path, version, kind string, data io.Reader) error {
+	name, err := fileName(path, version, kind)
+	if err != nil {
+		return err
+	}
+	dst := filepath.Join(string(d), filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return errors.Wrap(err, "creating module directory")
+	}
+	if err := writeFileAtomic(dst, data); err != nil {
+		return err
+	}
+	// zip is the last file of a version written, it is not listed before all of them are in place
+	if kind != ZipFile {
+		return nil
+	}
+	return d.addToList(filepath.Dir(dst), version)
+}
+
+func (d dirDestination) addToList(dir, version string) error {
+	listPath := filepath.Join(dir, "list")
+	data, err := ioutil.ReadFile(listPath)
+	if err != nil && !os.IsNotExist(err) {
+		return errors.Wrap(err, "reading version list")
+	}
+	versions := []string{version}
+	for _, v := range strings.Split(string(data), "\n") {
+		v = strings.TrimSpace(v)
+		if len(v) == 0 {
+			continue
+		}
+		if v == version {
+			return nil
+		}
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return semver.Compare(versions[i], versions[j]) < 0
+	})
+	return writeFileAtomic(listPath, strings.NewReader(strings.Join(versions, "\n")+"\n"))
+}
+
+// writeFileAtomic writes data into a temporary file next to dst then renames it to dst, so apriori plugin never
+// serves partially written files
+func writeFileAtomic(dst string, data io.Reader) error {
+	file, err := ioutil.TempFile(filepath.Dir(dst), ".tmp-")
+	if err != nil {
+		return errors.Wrapf(err, "creating temporary file for %s", dst)
+	}
+	if _, err := io.Copy(file, data); err != nil {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+		return errors.Wrapf(err, "writing %s", dst)
+	}
+	if err := file.Close(); err != nil {
+		_ = os.Remove(file.Name())
+		return errors.Wrapf(err, "writing %s", dst)
+	}
+	if err := os.Chmod(file.Name(), 0644); err != nil {
+		_ = os.Remove(file.Name())
+		return errors.Wrapf(err, "setting mode of %s", dst)
+	}
+	if err := os.Rename(file.Name(), dst); err != nil {
+		_ = os.Remove(file.Name())
+		return errors.Wrapf(err, "renaming into %s", dst)
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/sirkon/goproxy"
+	"github.com/sirkon/goproxy/gomod"
+	"github.com/sirkon/goproxy/internal/errors"
+)
+
+// Export retrieves given module versions with src and writes them as a bundle into dst. Files are spooled into a
+// temporary directory first as the manifest with their hashes must precede them in the archive
+func Export(ctx context.Context, dst io.Writer, src goproxy.Plugin, deps []gomod.Dependency) (*Manifest, error) {
+	tmpDir, err := ioutil.TempDir("", "goproxy-bundle")
+	if err != nil {
+		return nil, errors.Wrap(err, "bundle creating temporary directory")
+	}
+	defer func() {
+		if err := os.RemoveAll(tmpDir); err != nil {
+			zerolog.Ctx(ctx).Error().Err(err).Msg("bundle failed to remove temporary directory")
+		}
+	}()
+
+	manifest := &Manifest{
+		Format:  Format,
+		Created: time.Now().UTC(),
+	}
+	seen := map[gomod.Dependency]struct{}{}
+	for _, dep := range deps {
+		if _, ok := seen[dep]; ok {
+			continue
+		}
+		seen[dep] = struct{}{}
+		item, err := spool(ctx, tmpDir, src, dep)
+		if err != nil {
+			return nil, err
+		}
+		manifest.Modules = append(manifest.Modules, *item)
+	}
+
+	gz := gzip.NewWriter(dst)
+	tw := tar.NewWriter(gz)
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, errors.Wrap(err, "bundle marshaling manifest")
+	}
+	if err := writeEntry(tw, manifestName, manifest.Created, int64(len(data)), bytes.NewReader(data)); err != nil {
+		return nil, err
+	}
+	for _, item := range manifest.Modules {
+		for _, kind := range kinds {
+			name, err := fileName(item.Path, item.Version, kind)
+			if err != nil {
+				return nil, err
+			}
+			if err := writeFile(tw, tmpDir, name, manifest.Created); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, errors.Wrap(err, "bundle finishing archive")
+	}
+	if err := gz.Close(); err != nil {
+		return nil, errors.Wrap(err, "bundle finishing compression")
+	}
+	return manifest, nil
+}
+
+// spool saves files of module version into dir
+func spool(ctx context.Context, dir string, src goproxy.Plugin, dep gomod.Dependency) (*Module, error) {
+	logger := zerolog.Ctx(ctx).With().Str("module", dep.Path).Str("version", dep.Version).Logger()
+	logger.Debug().Msg("bundle exporting")
+
+	mod, err := getModule(ctx, src, dep.Path)
+	if err != nil {
+		return nil, err
+	}
+	info, err := mod.Stat(ctx, dep.Version)
+	if err != nil {
+		return nil, errors.Wrapf(err, "bundle getting revision info of %s@%s", dep.Path, dep.Version)
+	}
+	// version may be a branch or commit, use exact version of revision then
+	version := info.Version
+	res := &Module{
+		Path:    dep.Path,
+		Version: version,
+		Hashes:  map[string]string{},
+	}
+
+	save := func(kind string, r io.Reader) error {
+		name, err := fileName(dep.Path, version, kind)
+		if err != nil {
+			return err
+		}
+		dst := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+			return errors.Wrapf(err, "bundle creating directory for %s", name)
+		}
+		file, err := os.Create(dst)
+		if err != nil {
+			return errors.Wrapf(err, "bundle creating %s", name)
+		}
+		hash := sha256.New()
+		if _, err := io.Copy(io.MultiWriter(file, hash), r); err != nil {
+			_ = file.Close()
+			return errors.Wrapf(err, "bundle saving %s", name)
+		}
+		if err := file.Close(); err != nil {
+			return errors.Wrapf(err, "bundle saving %s", name)
+		}
+		res.Hashes[kind] = hex.EncodeToString(hash.Sum(nil))
+		return nil
+	}
+
+	infoData, err := json.Marshal(info)
+	if err != nil {
+		return nil, errors.Wrapf(err, "bundle marshaling revision info of %s@%s", dep.Path, version)
+	}
+	if err := save(InfoFile, bytes.NewReader(infoData)); err != nil {
+		return nil, err
+	}
+
+	goMod, err := mod.GoMod(ctx, version)
+	if err != nil {
+		return nil, errors.Wrapf(err, "bundle getting go.mod of %s@%s", dep.Path, version)
+	}
+	if err := save(ModFile, bytes.NewReader(goMod)); err != nil {
+		return nil, err
+	}
+
+	archive, err := mod.Zip(ctx, version)
+	if err != nil {
+		return nil, errors.Wrapf(err, "bundle getting source archive of %s@%s", dep.Path, version)
+	}
+	err = save(ZipFile, archive)
+	if cErr := archive.Close(); cErr != nil {
+		logger.Error().Err(cErr).Msg("bundle closing source archive")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func writeFile(tw *tar.Writer, dir, name string, moment time.Time) error {
+	file, err := os.Open(filepath.Join(dir, filepath.FromSlash(name)))
+	if err != nil {
+		return errors.Wrapf(err, "bundle opening spooled %s", name)
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		return errors.Wrapf(err, "bundle getting spooled %s size", name)
+	}
+	return writeEntry(tw, name, moment, stat.Size(), file)
+}
+
+func writeEntry(tw *tar.Writer, name string, moment time.Time, size int64, r io.Reader) error {
+	header := &tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     0644,
+		Size:     size,
+		ModTime:  moment,
+	}
+	if err := tw.WriteHeader(header); err != nil {
+		return errors.Wrapf(err, "bundle writing header of %s", name)
+	}
+	if _, err := io.Copy(tw, r); err != nil {
+		return errors.Wrapf(err, "bundle writing %s", name)
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package bundle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/sirkon/goproxy/internal/errors"
+)
+
+// Destination is where bundle content is imported into
+type Destination interface {
+	// Put stores file of the given kind (InfoFile, ModFile or ZipFile) of module version
+	Put(path, version, kind string, data io.Reader) error
+}
+
+// Import reads a bundle from src and puts its content into dst. Every file is verified against hashes from the
+// manifest and nothing gets into dst unless the whole bundle is valid
+func Import(src io.Reader, dst Destination) (*Manifest, error) {
+	gz, err := gzip.NewReader(src)
+	if err != nil {
+		return nil, errors.Wrap(err, "bundle decompressing")
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+
+	header, err := tr.Next()
+	if err != nil {
+		return nil, errors.Wrap(err, "bundle reading manifest header")
+	}
+	if header.Name != manifestName {
+		return nil, errors.Newf("bundle %s expected to be the first entry, got %s", manifestName, header.Name)
+	}
+	var manifest Manifest
+	decoder := json.NewDecoder(tr)
+	if err := decoder.Decode(&manifest); err != nil {
+		return nil, errors.Wrap(err, "bundle decoding manifest")
+	}
+	if manifest.Format != Format {
+		return nil, errors.Newf("bundle unsupported format %d, only %d is supported", manifest.Format, Format)
+	}
+
+	expected := map[string]string{}
+	for _, item := range manifest.Modules {
+		for _, kind := range kinds {
+			name, err := fileName(item.Path, item.Version, kind)
+			if err != nil {
+				return nil, err
+			}
+			hash, ok := item.Hashes[kind]
+			if !ok {
+				return nil, errors.Newf("bundle no %s hash for %s@%s in the manifest", kind, item.Path, item.Version)
+			}
+			expected[name] = hash
+		}
+	}
+
+	tmpDir, err := ioutil.TempDir("", "goproxy-bundle")
+	if err != nil {
+		return nil, errors.Wrap(err, "bundle creating temporary directory")
+	}
+	defer os.RemoveAll(tmpDir)
+
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, errors.Wrap(err, "bundle reading archive")
+		}
+		hash, ok := expected[header.Name]
+		if !ok {
+			return nil, errors.Newf("bundle unexpected entry %s", header.Name)
+		}
+		if err := extract(tr, tmpDir, header.Name, hash); err != nil {
+			return nil, err
+		}
+		delete(expected, header.Name)
+	}
+	for name := range expected {
+		return nil, errors.Newf("bundle %s is missing", name)
+	}
+
+	for _, item := range manifest.Modules {
+		for _, kind := range kinds {
+			if err := put(dst, tmpDir, item, kind); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return &manifest, nil
+}
+
+// extract saves entry into dir verifying its hash
+func extract(r io.Reader, dir, name, expectedHash string) error {
+	dst := filepath.Join(dir, filepath.FromSlash(name))
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return errors.Wrapf(err, "bundle creating directory for %s", name)
+	}
+	file, err := os.Create(dst)
+	if err != nil {
+		return errors.Wrapf(err, "bundle creating %s", name)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(file, hash), r); err != nil {
+		return errors.Wrapf(err, "bundle extracting %s", name)
+	}
+	if actual := hex.EncodeToString(hash.Sum(nil)); actual != expectedHash {
+		return errors.Newf("bundle %s checksum mismatch: expected %s, got %s", name, expectedHash, actual)
+	}
+	return nil
+}
+
+func put(dst Destination, dir string, item Module, kind string) error {
+	name, err := fileName(item.Path, item.Version, kind)
+	if err != nil {
+		return err
+	}
+	file, err := os.Open(filepath.Join(dir, filepath.FromSlash(name)))
+	if err != nil {
+		return errors.Wrapf(err, "bundle opening extracted %s", name)
+	}
+	defer file.Close()
+	if err := dst.Put(item.Path, item.Version, kind, file); err != nil {
+		return errors.Wrapf(err, "bundle importing %s", name)
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package bundle
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog"
+
+	"github.com/sirkon/goproxy"
+	"github.com/sirkon/goproxy/gomod"
+	"github.com/sirkon/goproxy/internal/errors"
+	"github.com/sirkon/goproxy/semver"
+)
+
+// ParseList parses module@version lines. Empty lines and lines starting with # are ignored
+func ParseList(r io.Reader) ([]gomod.Dependency, error) {
+	var res []gomod.Dependency
+	scanner := bufio.NewScanner(r)
+	lineNo := 0
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		dep, err := ParseDependency(line)
+		if err != nil {
+			return nil, errors.Wrapf(err, "bundle line %d", lineNo)
+		}
+		res = append(res, dep)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, "bundle reading module list")
+	}
+	return res, nil
+}
+
+// ParseDependency parses module@version
+func ParseDependency(line string) (gomod.Dependency, error) {
+	pos := strings.LastIndexByte(line, '@')
+	if pos <= 0 || pos == len(line)-1 {
+		return gomod.Dependency{}, errors.Newf("module@version expected, got %s", line)
+	}
+	return gomod.Dependency{
+		Path:    line[:pos],
+		Version: line[pos+1:],
+	}, nil
+}
+
+// Graph returns every module version reachable from requirements of given go.mod through go.mod files of
+// dependencies retrieved with src. Replacements and exclusions of the main module are honored, path replacements
+// are skipped as there's nothing to bundle for them
+func Graph(ctx context.Context, src goproxy.Plugin, goMod []byte) ([]gomod.Dependency, error) {
+	main, err := gomod.Parse("go.mod", goMod)
+	if err != nil {
+		return nil, errors.Wrap(err, "bundle parsing go.mod")
+	}
+
+	logger := zerolog.Ctx(ctx)
+	visited := map[gomod.Dependency]struct{}{}
+	var queue []gomod.Dependency
+	push := func(path, version string) {
+		if v, ok := main.Exclude[path]; ok && v == version {
+			return
+		}
+		dep := gomod.Dependency{Path: path, Version: version}
+		if rep, ok := main.Replace[path]; ok {
+			switch v := rep.(type) {
+			case gomod.Dependency:
+				dep = v
+			case gomod.RelativePath:
+				logger.Debug().Str("module", path).Msgf("bundle skipping module replaced with %s", v)
+				return
+			}
+		}
+		if _, ok := visited[dep]; ok {
+			return
+		}
+		visited[dep] = struct{}{}
+		queue = append(queue, dep)
+	}
+	for path, version := range main.Require {
+		push(path, version)
+	}
+
+	for len(queue) > 0 {
+		dep := queue[0]
+		queue = queue[1:]
+
+		mod, err := getModule(ctx, src, dep.Path)
+		if err != nil {
+			return nil, err
+		}
+		data, err := mod.GoMod(ctx, dep.Version)
+		if err != nil {
+			return nil, errors.Wrapf(err, "bundle getting go.mod of %s@%s", dep.Path, dep.Version)
+		}
+		depMod, err := gomod.Parse("go.mod", data)
+		if err != nil {
+			return nil, errors.Wrapf(err, "bundle parsing go.mod of %s@%s", dep.Path, dep.Version)
+		}
+		for path, version := range depMod.Require {
+			push(path, version)
+		}
+	}
+
+	res := make([]gomod.Dependency, 0, len(visited))
+	for dep := range visited {
+		res = append(res, dep)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Path != res[j].Path {
+			return res[i].Path < res[j].Path
+		}
+		return semver.Compare(res[i].Version, res[j].Version) < 0
+	})
+	return res, nil
+}
+
+func getModule(ctx context.Context, src goproxy.Plugin, path string) (goproxy.Module, error) {
+	req, err := goproxy.NewModuleRequest(ctx, path)
+	if err != nil {
+		return nil, errors.Wrap(err, "bundle")
+	}
+	mod, err := src.Module(req, "")
+	if err != nil {
+		return nil, errors.Wrapf(err, "bundle getting module %s from %s", path, src)
+	}
+	return mod, nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/rs/zerolog"
+
+	"github.com/sirkon/goproxy"
+	"github.com/sirkon/goproxy/bundle"
+	"github.com/sirkon/goproxy/gomod"
+	"github.com/sirkon/goproxy/plugin/apriori"
+	"github.com/sirkon/goproxy/plugin/cascade"
+)
+
+var exportPath string
+var importPath string
+var proxyURL string
+var sourceDir string
+var targetDir string
+var listPath string
+var goModPath string
+
+func init() {
+	flag.StringVar(&exportPath, "export", "", "bundle file to export modules into")
+	flag.StringVar(&importPath, "import", "", "bundle file to import modules from")
+	flag.StringVar(&proxyURL, "proxy", "", "go proxy URL to export modules from")
+	flag.StringVar(&sourceDir, "source-dir", "", "apriori directory to export modules from")
+	flag.StringVar(&targetDir, "target-dir", "", "apriori directory to import modules into")
+	flag.StringVar(&listPath, "list", "", "file with module@version lines to export, positional module@version arguments are exported as well")
+	flag.StringVar(&goModPath, "gomod", "", "go.mod file whose module graph to export")
+	flag.Parse()
+}
+
+func main() {
+	log := zerolog.New(zerolog.NewConsoleWriter()).Level(zerolog.DebugLevel)
+	ctx := log.WithContext(context.Background())
+
+	var err error
+	switch {
+	case len(exportPath) > 0 && len(importPath) == 0:
+		err = export(ctx)
+	case len(importPath) > 0 && len(exportPath) == 0:
+		err = importBundle(ctx)
+	default:
+		fmt.Println("either -export or -import must be set")
+		flag.Usage()
+		os.Exit(1)
+	}
+	if err != nil {
+		log.Fatal().Err(err).Msg("exiting")
+	}
+}
+
+func export(ctx context.Context) error {
+	var src goproxy.Plugin
+	switch {
+	case len(proxyURL) > 0:
+		src = cascade.NewPlugin(proxyURL)
+	case len(sourceDir) > 0:
+		var err error
+		src, err = apriori.NewDirPlugin(sourceDir)
+		if err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("either -proxy or -source-dir must be set to export modules")
+	}
+
+	var deps []gomod.Dependency
+	for _, arg := range flag.Args() {
+		dep, err := bundle.ParseDependency(arg)
+		if err != nil {
+			return err
+		}
+		deps = append(deps, dep)
+	}
+	if len(listPath) > 0 {
+		file, err := os.Open(listPath)
+		if err != nil {
+			return err
+		}
+		list, err := bundle.ParseList(file)
+		_ = file.Close()
+		if err != nil {
+			return err
+		}
+		deps = append(deps, list...)
+	}
+	if len(goModPath) > 0 {
+		data, err := ioutil.ReadFile(goModPath)
+		if err != nil {
+			return err
+		}
+		graph, err := bundle.Graph(ctx, src, data)
+		if err != nil {
+			return err
+		}
+		deps = append(deps, graph...)
+	}
+
+	file, err := os.Create(exportPath)
+	if err != nil {
+		return err
+	}
+	manifest, err := bundle.Export(ctx, file, src, deps)
+	if cErr := file.Close(); cErr != nil && err == nil {
+		err = cErr
+	}
+	if err != nil {
+		return err
+	}
+	zerolog.Ctx(ctx).Info().Int("modules", len(manifest.Modules)).Str("bundle", exportPath).Msg("exported")
+	return nil
+}
+
+func importBundle(ctx context.Context) error {
+	if len(targetDir) == 0 {
+		return fmt.Errorf("-target-dir must be set to import modules")
+	}
+	if err := os.MkdirAll(targetDir, 0755); err != nil {
+		return err
+	}
+	file, err := os.Open(importPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	manifest, err := bundle.Import(file, bundle.Dir(targetDir))
+	if err != nil {
+		return err
+	}
+	zerolog.Ctx(ctx).Info().Int("modules", len(manifest.Modules)).Str("target", targetDir).Msg("imported")
+	return nil
+}
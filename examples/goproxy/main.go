@@ -13,7 +13,6 @@ import (
 	"time"
 
 	"github.com/rs/zerolog"
-	gitlab2 "github.com/sirkon/gitlab"
 
 	"github.com/sirkon/goproxy"
 	"github.com/sirkon/goproxy/plugin/gitlab"
@@ -82,7 +81,7 @@ func main() {
 	}
 
 	if len(gitlabAPIURL) > 0 {
-		gl := gitlab.NewPlugin(gitlab2.NewAPIAccess(nil, gitlabAPIURL), true)
+		gl := gitlab.NewPluginURL(gitlabAPIURL, true)
 		if err := r.AddRoute("gitlab", gl); err != nil {
 			log.Fatal().Err(err).Msg("exiting")
 		}
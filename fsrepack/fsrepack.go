@@ -1,7 +1,9 @@
 package fsrepack
 
 import (
+	"archive/zip"
 	"fmt"
+	"io"
 	"strings"
 
 	"github.com/sirkon/goproxy/internal/errors"
@@ -98,3 +100,66 @@ func (r standard) Relativer(path string) (string, error) {
 	}
 	return path, nil
 }
+
+// Module returns repacker moving content of a module archive from one module version to another, i.e. from
+// <from path>@<from version>/… to <to path>@<to version>/…
+func Module(fromPath, fromVersion, toPath, toVersion string) FSRepacker {
+	return modulePrefix{
+		from: fromPath + "@" + fromVersion + "/",
+		to:   toPath + "@" + toVersion + "/",
+	}
+}
+
+type modulePrefix struct {
+	from string
+	to   string
+}
+
+func (r modulePrefix) Relativer(path string) (string, error) {
+	if !strings.HasPrefix(path, r.from) {
+		return "", errors.Newf("wrong path `%s` out of %s", path, r.from)
+	}
+	return path[len(r.from):], nil
+}
+
+func (r modulePrefix) Destinator(path string) string {
+	return r.to + strings.TrimLeft(path, "/")
+}
+
+// Repack copies files of src archive into dst with names transformed by the repacker
+func Repack(dst *zip.Writer, src *zip.Reader, r FSRepacker) error {
+	if err := dst.SetComment(src.Comment); err != nil {
+		return errors.Wrap(err, "setting comment to output archive")
+	}
+	for _, file := range src.File {
+		rel, err := r.Relativer(file.Name)
+		if err != nil {
+			return errors.Wrap(err, "relative file name computation")
+		}
+		fh := file.FileHeader
+		fh.Name = r.Destinator(rel)
+		fileWriter, err := dst.CreateHeader(&fh)
+		if err != nil {
+			return errors.Wrapf(err, "copying attributes for %s", fh.Name)
+		}
+		if file.FileInfo().IsDir() {
+			continue
+		}
+		if err := copyFile(fileWriter, file); err != nil {
+			return errors.Wrapf(err, "copying content for %s", fh.Name)
+		}
+	}
+	return nil
+}
+
+func copyFile(dst io.Writer, file *zip.File) error {
+	src, err := file.Open()
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		_ = src.Close()
+		return err
+	}
+	return src.Close()
+}
@@ -1,6 +1,10 @@
 package fsrepack
 
 import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"reflect"
 	"testing"
 )
 
@@ -226,3 +230,66 @@ func Test_standard_Relativer(t *testing.T) {
 		})
 	}
 }
+
+func TestRepackModule(t *testing.T) {
+	var src bytes.Buffer
+	zw := zip.NewWriter(&src)
+	for name, content := range map[string]string{
+		"gitlab.com/fork/lib/v2@v2.1.0-patched.1/go.mod":     "module gitlab.com/fork/lib/v2\n",
+		"gitlab.com/fork/lib/v2@v2.1.0-patched.1/pkg/lib.go": "package pkg\n",
+	} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err := zip.NewReader(bytes.NewReader(src.Bytes()), int64(src.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dst bytes.Buffer
+	zw = zip.NewWriter(&dst)
+	r := Module("gitlab.com/fork/lib/v2", "v2.1.0-patched.1", "github.com/user/lib/v2", "v2.1.0")
+	if err := Repack(zw, zr, r); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	zr, err = zip.NewReader(bytes.NewReader(dst.Bytes()), int64(dst.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	for _, file := range zr.File {
+		rc, err := file.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := ioutil.ReadAll(rc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		rc.Close()
+		got[file.Name] = string(data)
+	}
+	want := map[string]string{
+		"github.com/user/lib/v2@v2.1.0/go.mod":     "module gitlab.com/fork/lib/v2\n",
+		"github.com/user/lib/v2@v2.1.0/pkg/lib.go": "package pkg\n",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Repack() = %v, want %v", got, want)
+	}
+
+	if _, err := r.Relativer("gitlab.com/fork/lib/v2@v2.0.0/go.mod"); err == nil {
+		t.Errorf("Relativer() error expected for a file of another version")
+	}
+}
@@ -14,3 +14,8 @@ func New(msg string) error {
 func Newf(format string, a ...interface{}) error {
 	return fmt.Errorf(format, a...)
 }
+
+// As a copy of stdlib errors.As
+func As(err error, target interface{}) bool {
+	return errors.As(err, target)
+}
@@ -17,3 +17,22 @@ func TestNewf(t *testing.T) {
 		t.Errorf("`error: 1` expected, got %s", err.Error())
 	}
 }
+
+type codeError int
+
+func (e codeError) Error() string {
+	return Newf("code %d", int(e)).Error()
+}
+
+func TestAs(t *testing.T) {
+	var target codeError
+	if !As(Wrap(Wrap(codeError(403), "1"), "2"), &target) {
+		t.Fatal("code error expected in the chain")
+	}
+	if target != 403 {
+		t.Errorf("403 expected, got %d", target)
+	}
+	if As(New("error"), &target) {
+		t.Errorf("no code error expected")
+	}
+}
@@ -6,6 +6,7 @@ package modfetch
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -24,19 +25,23 @@ var QuietLookup bool // do not print about lookups
 
 var PkgMod string // $GOPATH/pkg/mod; set by package modload
 
-func cacheDir(path string) (string, error) {
-	if PkgMod == "" {
+func cacheDir(pkgMod, path string) (string, error) {
+	if pkgMod == "" {
 		return "", fmt.Errorf("internal error: modfetch.PkgMod not set")
 	}
 	enc, err := module.EncodePath(path)
 	if err != nil {
 		return "", err
 	}
-	return filepath.Join(PkgMod, "cache/download", enc, "/@v"), nil
+	return filepath.Join(pkgMod, "cache/download", enc, "/@v"), nil
 }
 
 func CachePath(m module.Version, suffix string) (string, error) {
-	dir, err := cacheDir(m.Path)
+	return cachePath(PkgMod, m, suffix)
+}
+
+func cachePath(pkgMod string, m module.Version, suffix string) (string, error) {
+	dir, err := cacheDir(pkgMod, m.Path)
 	if err != nil {
 		return "", err
 	}
@@ -83,28 +88,43 @@ type cachingRepo struct {
 	path  string
 	cache par.Cache // cache for all operations
 	r     Repo
+	f     *Fetcher
 }
 
-func newCachingRepo(r Repo) *cachingRepo {
+func newCachingRepo(f *Fetcher, r Repo) *cachingRepo {
 	return &cachingRepo{
 		r:    r,
 		path: r.ModulePath(),
+		f:    f,
 	}
 }
 
+var _ codehost.Refresher = (*cachingRepo)(nil)
+
+// Refresh drops cached results of the repo and refreshes the repo beneath,
+// so new versions are seen.
+func (r *cachingRepo) Refresh() {
+	r.cache.Clear()
+	codehost.Refresh(r.r)
+}
+
 func (r *cachingRepo) ModulePath() string {
 	return r.path
 }
 
-func (r *cachingRepo) Versions(prefix string) ([]string, error) {
+func (r *cachingRepo) Versions(ctx context.Context, prefix string) ([]string, error) {
 	type cached struct {
 		list []string
 		err  error
 	}
-	c := r.cache.Do("versions:"+prefix, func() interface{} {
-		list, err := r.r.Versions(prefix)
+	v, err := r.cache.DoContext(ctx, "versions:"+prefix, func() interface{} {
+		list, err := r.r.Versions(ctx, prefix)
 		return cached{list, err}
-	}).(cached)
+	})
+	if err != nil {
+		return nil, err
+	}
+	c := v.(cached)
 
 	if c.err != nil {
 		return nil, c.err
@@ -117,17 +137,17 @@ type cachedInfo struct {
 	err  error
 }
 
-func (r *cachingRepo) Stat(rev string) (*RevInfo, error) {
-	c := r.cache.Do("stat:"+rev, func() interface{} {
-		file, info, err := readDiskStat(r.path, rev)
+func (r *cachingRepo) Stat(ctx context.Context, rev string) (*RevInfo, error) {
+	v, err := r.cache.DoContext(ctx, "stat:"+rev, func() interface{} {
+		file, info, err := readDiskStat(r.f.PkgMod(), r.path, rev)
 		if err == nil {
 			return cachedInfo{info, nil}
 		}
 
-		if !QuietLookup {
+		if !r.f.quietLookup() {
 			fmt.Fprintf(os.Stderr, "go: finding %s %s\n", r.path, rev)
 		}
-		info, err = r.r.Stat(rev)
+		info, err = r.r.Stat(ctx, rev)
 		if err == nil {
 			if err := writeDiskStat(file, info); err != nil {
 				fmt.Fprintf(os.Stderr, "go: writing stat cache: %v\n", err)
@@ -141,7 +161,11 @@ func (r *cachingRepo) Stat(rev string) (*RevInfo, error) {
 			}
 		}
 		return cachedInfo{info, err}
-	}).(cachedInfo)
+	})
+	if err != nil {
+		return nil, err
+	}
+	c := v.(cachedInfo)
 
 	if c.err != nil {
 		return nil, c.err
@@ -150,25 +174,29 @@ func (r *cachingRepo) Stat(rev string) (*RevInfo, error) {
 	return &info, nil
 }
 
-func (r *cachingRepo) Latest() (*RevInfo, error) {
-	c := r.cache.Do("latest:", func() interface{} {
-		if !QuietLookup {
+func (r *cachingRepo) Latest(ctx context.Context) (*RevInfo, error) {
+	v, err := r.cache.DoContext(ctx, "latest:", func() interface{} {
+		if !r.f.quietLookup() {
 			fmt.Fprintf(os.Stderr, "go: finding %s latest\n", r.path)
 		}
-		info, err := r.r.Latest()
+		info, err := r.r.Latest(ctx)
 
 		// Save info for likely future Stat call.
 		if err == nil {
 			r.cache.Do("stat:"+info.Version, func() interface{} {
 				return cachedInfo{info, err}
 			})
-			if file, _, err := readDiskStat(r.path, info.Version); err != nil {
+			if file, _, err := readDiskStat(r.f.PkgMod(), r.path, info.Version); err != nil {
 				writeDiskStat(file, info)
 			}
 		}
 
 		return cachedInfo{info, err}
-	}).(cachedInfo)
+	})
+	if err != nil {
+		return nil, err
+	}
+	c := v.(cachedInfo)
 
 	if c.err != nil {
 		return nil, c.err
@@ -177,13 +205,13 @@ func (r *cachingRepo) Latest() (*RevInfo, error) {
 	return &info, nil
 }
 
-func (r *cachingRepo) GoMod(rev string) ([]byte, error) {
+func (r *cachingRepo) GoMod(ctx context.Context, rev string) ([]byte, error) {
 	type cached struct {
 		text []byte
 		err  error
 	}
-	c := r.cache.Do("gomod:"+rev, func() interface{} {
-		file, text, err := readDiskGoMod(r.path, rev)
+	v, err := r.cache.DoContext(ctx, "gomod:"+rev, func() interface{} {
+		file, text, err := readDiskGoMod(r.f.PkgMod(), r.path, rev)
 		if err == nil {
 			// Note: readDiskGoMod already called checkGoMod.
 			return cached{text, nil}
@@ -191,13 +219,13 @@ func (r *cachingRepo) GoMod(rev string) ([]byte, error) {
 
 		// Convert rev to canonical version
 		// so that we use the right identifier in the go.sum check.
-		info, err := r.Stat(rev)
+		info, err := r.Stat(ctx, rev)
 		if err != nil {
 			return cached{nil, err}
 		}
 		rev = info.Version
 
-		text, err = r.r.GoMod(rev)
+		text, err = r.r.GoMod(ctx, rev)
 		if err == nil {
 			checkGoMod(r.path, rev, text)
 			if err := writeDiskGoMod(file, text); err != nil {
@@ -205,7 +233,11 @@ func (r *cachingRepo) GoMod(rev string) ([]byte, error) {
 			}
 		}
 		return cached{text, err}
-	}).(cached)
+	})
+	if err != nil {
+		return nil, err
+	}
+	c := v.(cached)
 
 	if c.err != nil {
 		return nil, c.err
@@ -213,15 +245,15 @@ func (r *cachingRepo) GoMod(rev string) ([]byte, error) {
 	return append([]byte(nil), c.text...), nil
 }
 
-func (r *cachingRepo) Zip(version, tmpdir string) (string, error) {
-	return r.r.Zip(version, tmpdir)
+func (r *cachingRepo) Zip(ctx context.Context, version, tmpdir string) (string, error) {
+	return r.r.Zip(ctx, version, tmpdir)
 }
 
 // Stat is like Lookup(path).Stat(rev) but avoids the
 // repository path resolution in Lookup if the result is
 // already cached on local disk.
 func Stat(path, rev string) (*RevInfo, error) {
-	_, info, err := readDiskStat(path, rev)
+	_, info, err := readDiskStat(PkgMod, path, rev)
 	if err == nil {
 		return info, nil
 	}
@@ -229,7 +261,7 @@ func Stat(path, rev string) (*RevInfo, error) {
 	if err != nil {
 		return nil, err
 	}
-	return repo.Stat(rev)
+	return repo.Stat(context.Background(), rev)
 }
 
 // InfoFile is like Stat but returns the name of the file containing
@@ -242,7 +274,7 @@ func InfoFile(path, version string) (string, error) {
 		return "", err
 	}
 	// Stat should have populated the disk cache for us.
-	file, _, err := readDiskStat(path, version)
+	file, _, err := readDiskStat(PkgMod, path, version)
 	if err != nil {
 		return "", err
 	}
@@ -262,7 +294,7 @@ func GoMod(path, rev string) ([]byte, error) {
 		}
 		rev = info.Version
 	}
-	_, data, err := readDiskGoMod(path, rev)
+	_, data, err := readDiskGoMod(PkgMod, path, rev)
 	if err == nil {
 		return data, nil
 	}
@@ -270,7 +302,7 @@ func GoMod(path, rev string) ([]byte, error) {
 	if err != nil {
 		return nil, err
 	}
-	return repo.GoMod(rev)
+	return repo.GoMod(context.Background(), rev)
 }
 
 // GoModFile is like GoMod but returns the name of the file containing
@@ -283,7 +315,7 @@ func GoModFile(path, version string) (string, error) {
 		return "", err
 	}
 	// GoMod should have populated the disk cache for us.
-	file, _, err := readDiskGoMod(path, version)
+	file, _, err := readDiskGoMod(PkgMod, path, version)
 	if err != nil {
 		return "", err
 	}
@@ -313,10 +345,10 @@ var errNotCached = fmt.Errorf("not in cache")
 // returning the name of the cache file and the result.
 // If the read fails, the caller can use
 // writeDiskStat(file, info) to write a new cache entry.
-func readDiskStat(path, rev string) (file string, info *RevInfo, err error) {
-	file, data, err := readDiskCache(path, rev, "info")
+func readDiskStat(pkgMod, path, rev string) (file string, info *RevInfo, err error) {
+	file, data, err := readDiskCache(pkgMod, path, rev, "info")
 	if err != nil {
-		if file, info, err := readDiskStatByHash(path, rev); err == nil {
+		if file, info, err := readDiskStatByHash(pkgMod, path, rev); err == nil {
 			return file, info, nil
 		}
 		return file, nil, err
@@ -344,8 +376,8 @@ func readDiskStat(path, rev string) (file string, info *RevInfo, err error) {
 // Without this check we'd be doing network I/O to the remote repo
 // just to find out about a commit we already know about
 // (and have cached under its pseudo-version).
-func readDiskStatByHash(path, rev string) (file string, info *RevInfo, err error) {
-	if PkgMod == "" {
+func readDiskStatByHash(pkgMod, path, rev string) (file string, info *RevInfo, err error) {
+	if pkgMod == "" {
 		// Do not download to current directory.
 		return "", nil, errNotCached
 	}
@@ -354,7 +386,7 @@ func readDiskStatByHash(path, rev string) (file string, info *RevInfo, err error
 		return "", nil, errNotCached
 	}
 	rev = rev[:12]
-	cdir, err := cacheDir(path)
+	cdir, err := cacheDir(pkgMod, path)
 	if err != nil {
 		return "", nil, errNotCached
 	}
@@ -370,7 +402,7 @@ func readDiskStatByHash(path, rev string) (file string, info *RevInfo, err error
 	suffix := "-" + rev + ".info"
 	for _, name := range names {
 		if strings.HasSuffix(name, suffix) && IsPseudoVersion(strings.TrimSuffix(name, ".info")) {
-			return readDiskStat(path, strings.TrimSuffix(name, ".info"))
+			return readDiskStat(pkgMod, path, strings.TrimSuffix(name, ".info"))
 		}
 	}
 	return "", nil, errNotCached
@@ -387,8 +419,8 @@ var oldVgoPrefix = []byte("//vgo 0.0.")
 // returning the name of the cache file and the result.
 // If the read fails, the caller can use
 // writeDiskGoMod(file, data) to write a new cache entry.
-func readDiskGoMod(path, rev string) (file string, data []byte, err error) {
-	file, data, err = readDiskCache(path, rev, "mod")
+func readDiskGoMod(pkgMod, path, rev string) (file string, data []byte, err error) {
+	file, data, err = readDiskCache(pkgMod, path, rev, "mod")
 
 	// If the file has an old auto-conversion prefix, pretend it's not there.
 	if bytes.HasPrefix(data, oldVgoPrefix) {
@@ -408,8 +440,8 @@ func readDiskGoMod(path, rev string) (file string, data []byte, err error) {
 // It returns the name of the cache file and the content of the file.
 // If the read fails, the caller can use
 // writeDiskCache(file, data) to write a new cache entry.
-func readDiskCache(path, rev, suffix string) (file string, data []byte, err error) {
-	file, err = CachePath(module.Version{Path: path, Version: rev}, suffix)
+func readDiskCache(pkgMod, path, rev, suffix string) (file string, data []byte, err error) {
+	file, err = cachePath(pkgMod, module.Version{Path: path, Version: rev}, suffix)
 	if err != nil {
 		return "", nil, errNotCached
 	}
@@ -8,6 +8,7 @@ package codehost
 
 import (
 	"bytes"
+	"context"
 	"crypto/sha256"
 	"fmt"
 	"io"
@@ -19,7 +20,10 @@ import (
 	"sync"
 	"time"
 
+	"github.com/go-git/go-git/v5/plumbing/transport"
+
 	"github.com/sirkon/goproxy/internal/cfg"
+	"github.com/sirkon/goproxy/internal/par"
 	"github.com/sirkon/goproxy/internal/str"
 )
 
@@ -34,25 +38,26 @@ const (
 // Typical implementations include local version control repositories,
 // remote version control servers, and code hosting sites.
 // A Repo must be safe for simultaneous use by multiple goroutines.
+// Work done on behalf of a call is abandoned when its ctx is done.
 type Repo interface {
 	// List lists all tags with the given prefix.
-	Tags(prefix string) (tags []string, err error)
+	Tags(ctx context.Context, prefix string) (tags []string, err error)
 
 	// Stat returns information about the revision rev.
 	// A revision can be any identifier known to the underlying service:
 	// commit hash, branch, tag, and so on.
-	Stat(rev string) (*RevInfo, error)
+	Stat(ctx context.Context, rev string) (*RevInfo, error)
 
 	// Latest returns the latest revision on the default branch,
 	// whatever that means in the underlying implementation.
-	Latest() (*RevInfo, error)
+	Latest(ctx context.Context) (*RevInfo, error)
 
 	// ReadFile reads the given file in the file tree corresponding to revision rev.
 	// It should refuse to read more than maxSize bytes.
 	//
 	// If the requested file does not exist it should return an error for which
 	// os.IsNotExist(err) returns true.
-	ReadFile(rev, file string, maxSize int64) (data []byte, err error)
+	ReadFile(ctx context.Context, rev, file string, maxSize int64) (data []byte, err error)
 
 	// ReadFileRevs reads a single file at multiple versions.
 	// It should refuse to read more than maxSize bytes.
@@ -67,7 +72,7 @@ type Repo interface {
 	// a network failure.
 	// Implementations may assume that revs only contain tags,
 	// not direct commit hashes.
-	ReadFileRevs(revs []string, file string, maxSize int64) (files map[string]*FileRev, err error)
+	ReadFileRevs(ctx context.Context, revs []string, file string, maxSize int64) (files map[string]*FileRev, err error)
 
 	// ReadZip downloads a zip file for the subdir subdirectory
 	// of the given revision to a new file in a given temporary directory.
@@ -76,7 +81,7 @@ type Repo interface {
 	// along with the actual subdirectory (possibly shorter than subdir)
 	// contained in the zip file. All files in the zip file are expected to be
 	// nested in a single top-level directory, whose name is not specified.
-	ReadZip(rev, subdir string, maxSize int64) (zip io.ReadCloser, actualSubdir string, err error)
+	ReadZip(ctx context.Context, rev, subdir string, maxSize int64) (zip io.ReadCloser, actualSubdir string, err error)
 
 	// RecentTag returns the most recent tag at or before the given rev
 	// with the given prefix. It should make a best-effort attempt to
@@ -85,7 +90,22 @@ type Repo interface {
 	// incur great expense in doing so. For example, the git implementation
 	// of RecentTag limits git's search to tags matching the glob expression
 	// "v[0-9]*.[0-9]*.[0-9]*" (after the prefix).
-	RecentTag(rev, prefix string) (tag string, err error)
+	RecentTag(ctx context.Context, rev, prefix string) (tag string, err error)
+}
+
+// Refresher is a repo caching the state of its remote: tags, branches and
+// revisions they point to. Refresh drops what was cached, so the state is
+// loaded from the remote again by the next calls.
+type Refresher interface {
+	Refresh()
+}
+
+// Refresh refreshes r if it is a Refresher. It accepts repos of any
+// layer, modfetch repos wrapping a Repo refresh it in turn.
+func Refresh(r interface{}) {
+	if rf, ok := r.(Refresher); ok {
+		rf.Refresh()
+	}
 }
 
 // A Rev describes a single revision in a source code repository.
@@ -129,10 +149,78 @@ func ShortenSHA1(rev string) string {
 // It is set by github.com/sirkon/goproxy/internal/modload.InitMod.
 var WorkRoot string
 
+// A Host scopes code hosting work: work directories of repositories it creates
+// are placed under its own work root and repositories are cached per host,
+// so independent hosts can coexist in a single process.
+// Package level functions use the default host whose work root is WorkRoot.
+type Host struct {
+	workRoot string
+	global   bool     // use WorkRoot
+	env      []string // additional environment of commands run for repositories of the host
+
+	gitBackend GitBackend
+	auth       transport.AuthMethod // credentials for in-process git
+	tempDir    string               // directory for temporary files, the default one if empty
+
+	gitRepoCache par.Cache
+	vcsRepoCache par.Cache
+}
+
+// NewHost returns a host keeping work directories under workRoot.
+func NewHost(workRoot string) *Host {
+	return &Host{workRoot: workRoot}
+}
+
+var defaultHost = &Host{global: true}
+
+// DefaultHost returns the host used by package level functions.
+func DefaultHost() *Host {
+	return defaultHost
+}
+
+// NewHostEnv returns a host keeping work directories under workRoot and
+// running commands with env added to the process environment.
+func NewHostEnv(workRoot string, env []string) *Host {
+	return &Host{workRoot: workRoot, env: env}
+}
+
+// Env returns additional environment of commands run for repositories of the host.
+func (h *Host) Env() []string {
+	return h.env
+}
+
+// SetGitBackend selects how the host accesses git repositories.
+// It must be called before the host is used.
+func (h *Host) SetGitBackend(backend GitBackend) {
+	h.gitBackend = backend
+}
+
+// SetTempDir sets the directory for temporary files of the host, such as
+// archives being read out. The default directory for temporary files is
+// used if it is not set. It must be called before the host is used.
+func (h *Host) SetTempDir(dir string) {
+	h.tempDir = dir
+}
+
+// WorkRoot returns the root of the cached work directory of the host.
+func (h *Host) WorkRoot() string {
+	if h.global {
+		return WorkRoot
+	}
+	return h.workRoot
+}
+
 // WorkDir returns the name of the cached work directory to use for the
 // given repository type and name.
 func WorkDir(typ, name string) (string, error) {
-	if WorkRoot == "" {
+	return defaultHost.WorkDir(typ, name)
+}
+
+// WorkDir returns the name of the cached work directory of the host to use for the
+// given repository type and name.
+func (h *Host) WorkDir(typ, name string) (string, error) {
+	workRoot := h.WorkRoot()
+	if workRoot == "" {
 		return "", fmt.Errorf("codehost.WorkRoot not set")
 	}
 
@@ -145,7 +233,7 @@ func WorkDir(typ, name string) (string, error) {
 		return "", fmt.Errorf("codehost.WorkDir: type cannot contain colon")
 	}
 	key := typ + ":" + name
-	dir := filepath.Join(WorkRoot, fmt.Sprintf("%x", sha256.Sum256([]byte(key))))
+	dir := filepath.Join(workRoot, fmt.Sprintf("%x", sha256.Sum256([]byte(key))))
 	data, err := ioutil.ReadFile(dir + ".info")
 	info, err2 := os.Stat(dir)
 	if err == nil && err2 == nil && info.IsDir() {
@@ -190,30 +278,51 @@ func (e *RunError) Error() string {
 	return text
 }
 
+// dirLock holds a semaphore (a channel with a single slot) for each directory
+// commands are run in.
 var dirLock sync.Map
 
+// cancelWaitDelay is how long a command is given to exit after it was
+// interrupted due to its context being done before it is killed.
+const cancelWaitDelay = 5 * time.Second
+
 // Run runs the command line in the given directory
 // (an empty dir means the current directory).
 // It returns the standard output and, for a non-zero exit,
 // a *RunError indicating the command, exit status, and standard error.
 // Standard error is unavailable for commands that exit successfully.
-func Run(dir string, cmdline ...interface{}) ([]byte, error) {
-	return RunWithStdin(dir, nil, cmdline...)
+// The command is interrupted when ctx is done and ctx.Err() is returned then.
+func Run(ctx context.Context, dir string, cmdline ...interface{}) ([]byte, error) {
+	return RunWithStdin(ctx, dir, nil, cmdline...)
+}
+
+// RunEnv is like Run but adds env to the environment of the command.
+func RunEnv(ctx context.Context, dir string, env []string, cmdline ...interface{}) ([]byte, error) {
+	return RunEnvWithStdin(ctx, dir, env, nil, cmdline...)
 }
 
 // bashQuoter escapes characters that have special meaning in double-quoted strings in the bash shell.
 // See https://www.gnu.org/software/bash/manual/html_node/Double-Quotes.html.
 var bashQuoter = strings.NewReplacer(`"`, `\"`, `$`, `\$`, "`", "\\`", `\`, `\\`)
 
-func RunWithStdin(dir string, stdin io.Reader, cmdline ...interface{}) ([]byte, error) {
+func RunWithStdin(ctx context.Context, dir string, stdin io.Reader, cmdline ...interface{}) ([]byte, error) {
+	return RunEnvWithStdin(ctx, dir, nil, stdin, cmdline...)
+}
+
+// RunEnvWithStdin is like RunWithStdin but adds env to the environment of the command.
+func RunEnvWithStdin(ctx context.Context, dir string, env []string, stdin io.Reader, cmdline ...interface{}) ([]byte, error) {
 	if dir != "" {
-		muIface, ok := dirLock.Load(dir)
+		semIface, ok := dirLock.Load(dir)
 		if !ok {
-			muIface, _ = dirLock.LoadOrStore(dir, new(sync.Mutex))
+			semIface, _ = dirLock.LoadOrStore(dir, make(chan struct{}, 1))
+		}
+		sem := semIface.(chan struct{})
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
 		}
-		mu := muIface.(*sync.Mutex)
-		mu.Lock()
-		defer mu.Unlock()
+		defer func() { <-sem }()
 	}
 
 	cmd := str.StringList(cmdline...)
@@ -253,12 +362,26 @@ func RunWithStdin(dir string, stdin io.Reader, cmdline ...interface{}) ([]byte,
 	// TODO: Set environment to get English error messages.
 	var stderr bytes.Buffer
 	var stdout bytes.Buffer
-	c := exec.Command(cmd[0], cmd[1:]...)
+	c := exec.CommandContext(ctx, cmd[0], cmd[1:]...)
+	// Give the command a chance to clean up its lock files.
+	c.Cancel = func() error {
+		if err := c.Process.Signal(os.Interrupt); err != nil {
+			return c.Process.Kill()
+		}
+		return nil
+	}
+	c.WaitDelay = cancelWaitDelay
 	c.Dir = dir
+	if len(env) > 0 {
+		c.Env = append(os.Environ(), env...)
+	}
 	c.Stdin = stdin
 	c.Stderr = &stderr
 	c.Stdout = &stdout
 	err := c.Run()
+	if ctxErr := ctx.Err(); err != nil && ctxErr != nil {
+		return nil, ctxErr
+	}
 	if err != nil {
 		err = &RunError{Cmd: strings.Join(cmd, " ") + " in " + dir, Stderr: stderr.Bytes(), Err: err}
 	}
@@ -0,0 +1,53 @@
+package codehost
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+)
+
+// Environment variables git credential helper of hosts created by NewCredentialsHost takes credentials from.
+const (
+	credentialsUsernameEnv = "GOPROXY_GIT_USERNAME"
+	credentialsPasswordEnv = "GOPROXY_GIT_PASSWORD"
+)
+
+// credentialHelper answers git credential get requests with credentials
+// taken from the environment, thus they never appear on a command line.
+const credentialHelper = `!f() { test "$1" = get && printf 'username=%s\npassword=%s\n' "$` +
+	credentialsUsernameEnv + `" "$` + credentialsPasswordEnv + `"; }; f`
+
+// CredentialsIdentity returns a file name safe identity of the given
+// credentials keyed with the secret key. Different credentials have
+// different identities. The identity is an HMAC, so it reveals nothing
+// about the credentials to those who don't know the key.
+func CredentialsIdentity(key []byte, username, password string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(username + "\x00" + password))
+	return fmt.Sprintf("%x", mac.Sum(nil))
+}
+
+// NewCredentialsHost returns a host keeping work directories under workRoot
+// whose git commands authenticate with the given credentials instead of
+// whatever credentials the process owner has. Credential helpers
+// configured for the process owner are not consulted and git never
+// prompts for credentials. In-process git passes the credentials itself.
+// The caller is responsible for isolating workRoot for each identity,
+// so one's fetched objects are never reused for another.
+func NewCredentialsHost(workRoot, username, password string) *Host {
+	h := NewHostEnv(workRoot, []string{
+		"GIT_TERMINAL_PROMPT=0",
+		"GIT_ASKPASS=",
+		"SSH_ASKPASS=",
+		// An empty value resets the list of configured helpers.
+		"GIT_CONFIG_COUNT=2",
+		"GIT_CONFIG_KEY_0=credential.helper",
+		"GIT_CONFIG_VALUE_0=",
+		"GIT_CONFIG_KEY_1=credential.helper",
+		"GIT_CONFIG_VALUE_1=" + credentialHelper,
+		credentialsUsernameEnv + "=" + username,
+		credentialsPasswordEnv + "=" + password,
+	})
+	h.auth = newInProcessAuth(username, password)
+	return h
+}
@@ -0,0 +1,33 @@
+package codehost
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"testing"
+)
+
+func TestNewCredentialsHost(t *testing.T) {
+	ctx := context.Background()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git binary not found")
+	}
+	h := NewCredentialsHost(t.TempDir(), "user", "pa$$ 'word'")
+	out, err := RunEnvWithStdin(ctx, "", h.Env(), strings.NewReader("protocol=https\nhost=example.com\n\n"), "git", "credential", "fill")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"username=user\n", "password=pa$$ 'word'\n"} {
+		if !strings.Contains(string(out), want) {
+			t.Errorf("git credential fill: %q not found in\n%s", want, out)
+		}
+	}
+
+	key := []byte("key")
+	if CredentialsIdentity(key, "user", "a") == CredentialsIdentity(key, "user", "b") {
+		t.Errorf("CredentialsIdentity: different passwords must have different identities")
+	}
+	if CredentialsIdentity(key, "user", "a") == CredentialsIdentity([]byte("other"), "user", "a") {
+		t.Errorf("CredentialsIdentity: different keys must give different identities")
+	}
+}
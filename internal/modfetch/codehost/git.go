@@ -6,6 +6,7 @@ package codehost
 
 import (
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -14,7 +15,6 @@ import (
 	"sort"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/sirkon/goproxy/internal/par"
@@ -22,20 +22,29 @@ import (
 
 // GitRepo returns the code repository at the given Git remote reference.
 func GitRepo(remote string) (Repo, error) {
-	return newGitRepoCached(remote, false)
+	return defaultHost.GitRepo(remote)
 }
 
 // LocalGitRepo is like Repo but accepts both Git remote references
 // and paths to repositories on the local file system.
 func LocalGitRepo(remote string) (Repo, error) {
-	return newGitRepoCached(remote, true)
+	return defaultHost.LocalGitRepo(remote)
 }
 
-const gitWorkDirType = "git2"
+// GitRepo returns the code repository of the host at the given Git remote reference.
+func (h *Host) GitRepo(remote string) (Repo, error) {
+	return h.newGitRepoCached(remote, false)
+}
+
+// LocalGitRepo is like GitRepo but accepts both Git remote references
+// and paths to repositories on the local file system.
+func (h *Host) LocalGitRepo(remote string) (Repo, error) {
+	return h.newGitRepoCached(remote, true)
+}
 
-var gitRepoCache par.Cache
+const gitWorkDirType = "git2"
 
-func newGitRepoCached(remote string, localOK bool) (Repo, error) {
+func (h *Host) newGitRepoCached(remote string, localOK bool) (Repo, error) {
 	type key struct {
 		remote  string
 		localOK bool
@@ -45,25 +54,28 @@ func newGitRepoCached(remote string, localOK bool) (Repo, error) {
 		err  error
 	}
 
-	c := gitRepoCache.Do(key{remote, localOK}, func() interface{} {
-		repo, err := newGitRepo(remote, localOK)
+	c := h.gitRepoCache.Do(key{remote, localOK}, func() interface{} {
+		repo, err := h.newGitRepo(remote, localOK)
 		return cached{repo, err}
 	}).(cached)
 
 	return c.repo, c.err
 }
 
-func newGitRepo(remote string, localOK bool) (Repo, error) {
-	r := &gitRepo{remote: remote}
+func (h *Host) newGitRepo(remote string, localOK bool) (Repo, error) {
+	if h.gitBackend == GitInProcess {
+		return h.newInProcessGitRepo(remote, localOK)
+	}
+	r := &gitRepo{remote: remote, env: h.Env(), mu: make(chan struct{}, 1)}
 	if strings.Contains(remote, "://") {
 		// This is a remote path.
-		dir, err := WorkDir(gitWorkDirType, r.remote)
+		dir, err := h.WorkDir(gitWorkDirType, r.remote)
 		if err != nil {
 			return nil, err
 		}
 		r.dir = dir
 		if _, err := os.Stat(filepath.Join(dir, "objects")); err != nil {
-			if _, err := Run(dir, "git", "init", "--bare"); err != nil {
+			if _, err := RunEnv(context.Background(), dir, r.env, "git", "init", "--bare"); err != nil {
 				os.RemoveAll(dir)
 				return nil, err
 			}
@@ -71,7 +83,7 @@ func newGitRepo(remote string, localOK bool) (Repo, error) {
 			// but this lets us say git fetch origin instead, which
 			// is a little nicer. More importantly, using a named remote
 			// avoids a problem with Git LFS. See golang.org/issue/25605.
-			if _, err := Run(dir, "git", "remote", "add", "origin", r.remote); err != nil {
+			if _, err := RunEnv(context.Background(), dir, r.env, "git", "remote", "add", "origin", r.remote); err != nil {
 				os.RemoveAll(dir)
 				return nil, err
 			}
@@ -105,18 +117,17 @@ type gitRepo struct {
 	remote string
 	local  bool
 	dir    string
+	env    []string
 
-	mu         sync.Mutex // protects fetchLevel, some git repo state
+	mu         chan struct{} // locked by lock, protects fetchLevel, some git repo state
 	fetchLevel int
 
 	statCache par.Cache
 
-	refsOnce sync.Once
-	refs     map[string]string
-	refsErr  error
-
-	localTagsOnce sync.Once
-	localTags     map[string]bool
+	// refsCache and localTagsCache keep results of loadRefs and loadLocalTags,
+	// unless they were interrupted
+	refsCache      par.Cache
+	localTagsCache par.Cache
 }
 
 const (
@@ -126,64 +137,79 @@ const (
 	fetchAll         // "fetch -t origin": get all remote branches and tags
 )
 
-// loadLocalTags loads tag references from the local git cache
-// into the map r.localTags.
-// Should only be called as r.localTagsOnce.Do(r.loadLocalTags).
-func (r *gitRepo) loadLocalTags() {
-	// The git protocol sends all known refs and ls-remote filters them on the client side,
-	// so we might as well record both heads and tags in one shot.
-	// Most of the time we only care about tags but sometimes we care about heads too.
-	out, err := Run(r.dir, "git", "tag", "-l")
-	if err != nil {
-		return
-	}
+// loadLocalTags loads tag references from the local git cache.
+// The result is computed once unless the computation was interrupted.
+func (r *gitRepo) loadLocalTags(ctx context.Context) map[string]bool {
+	v, _ := r.localTagsCache.DoContext(ctx, "", func() interface{} {
+		// The git protocol sends all known refs and ls-remote filters them on the client side,
+		// so we might as well record both heads and tags in one shot.
+		// Most of the time we only care about tags but sometimes we care about heads too.
+		out, err := RunEnv(ctx, r.dir, r.env, "git", "tag", "-l")
+		if err != nil {
+			return map[string]bool(nil)
+		}
 
-	r.localTags = make(map[string]bool)
-	for _, line := range strings.Split(string(out), "\n") {
-		if line != "" {
-			r.localTags[line] = true
+		localTags := make(map[string]bool)
+		for _, line := range strings.Split(string(out), "\n") {
+			if line != "" {
+				localTags[line] = true
+			}
 		}
-	}
+		return localTags
+	})
+	res, _ := v.(map[string]bool)
+	return res
 }
 
-// loadRefs loads heads and tags references from the remote into the map r.refs.
-// Should only be called as r.refsOnce.Do(r.loadRefs).
-func (r *gitRepo) loadRefs() {
-	// The git protocol sends all known refs and ls-remote filters them on the client side,
-	// so we might as well record both heads and tags in one shot.
-	// Most of the time we only care about tags but sometimes we care about heads too.
-	out, err := Run(r.dir, "git", "ls-remote", "-q", r.remote)
-	if err != nil {
-		r.refsErr = err
-		return
+// loadRefs loads heads and tags references from the remote.
+// The result is computed once unless the computation was interrupted.
+func (r *gitRepo) loadRefs(ctx context.Context) (map[string]string, error) {
+	type cached struct {
+		refs map[string]string
+		err  error
 	}
-
-	r.refs = make(map[string]string)
-	for _, line := range strings.Split(string(out), "\n") {
-		f := strings.Fields(line)
-		if len(f) != 2 {
-			continue
+	v, err := r.refsCache.DoContext(ctx, "", func() interface{} {
+		// The git protocol sends all known refs and ls-remote filters them on the client side,
+		// so we might as well record both heads and tags in one shot.
+		// Most of the time we only care about tags but sometimes we care about heads too.
+		out, err := RunEnv(ctx, r.dir, r.env, "git", "ls-remote", "-q", r.remote)
+		if err != nil {
+			return cached{nil, err}
 		}
-		if f[1] == "HEAD" || strings.HasPrefix(f[1], "refs/heads/") || strings.HasPrefix(f[1], "refs/tags/") {
-			r.refs[f[1]] = f[0]
+
+		refs := make(map[string]string)
+		for _, line := range strings.Split(string(out), "\n") {
+			f := strings.Fields(line)
+			if len(f) != 2 {
+				continue
+			}
+			if f[1] == "HEAD" || strings.HasPrefix(f[1], "refs/heads/") || strings.HasPrefix(f[1], "refs/tags/") {
+				refs[f[1]] = f[0]
+			}
 		}
-	}
-	for ref, hash := range r.refs {
-		if strings.HasSuffix(ref, "^{}") { // record unwrapped annotated tag as value of tag
-			r.refs[strings.TrimSuffix(ref, "^{}")] = hash
-			delete(r.refs, ref)
+		for ref, hash := range refs {
+			if strings.HasSuffix(ref, "^{}") { // record unwrapped annotated tag as value of tag
+				refs[strings.TrimSuffix(ref, "^{}")] = hash
+				delete(refs, ref)
+			}
 		}
+		return cached{refs, nil}
+	})
+	if err != nil {
+		return nil, err
 	}
+	c := v.(cached)
+	return c.refs, c.err
 }
 
-func (r *gitRepo) Tags(prefix string) ([]string, error) {
-	r.refsOnce.Do(r.loadRefs)
-	if r.refsErr != nil {
-		return nil, r.refsErr
+func (r *gitRepo) Tags(ctx context.Context, prefix string) ([]string, error) {
+	refs, err := r.loadRefs(ctx)
+	if err != nil {
+		return nil, err
 	}
 
 	tags := []string{}
-	for ref := range r.refs {
+	for ref := range refs {
 		if !strings.HasPrefix(ref, "refs/tags/") {
 			continue
 		}
@@ -197,24 +223,24 @@ func (r *gitRepo) Tags(prefix string) ([]string, error) {
 	return tags, nil
 }
 
-func (r *gitRepo) Latest() (*RevInfo, error) {
-	r.refsOnce.Do(r.loadRefs)
-	if r.refsErr != nil {
-		return nil, r.refsErr
+func (r *gitRepo) Latest(ctx context.Context) (*RevInfo, error) {
+	refs, err := r.loadRefs(ctx)
+	if err != nil {
+		return nil, err
 	}
-	if r.refs["HEAD"] == "" {
+	if refs["HEAD"] == "" {
 		return nil, fmt.Errorf("no commits")
 	}
-	return r.Stat(r.refs["HEAD"])
+	return r.Stat(ctx, refs["HEAD"])
 }
 
 // findRef finds some ref name for the given hash,
 // for use when the server requires giving a ref instead of a hash.
 // There may be multiple ref names for a given hash,
 // in which case this returns some name - it doesn't matter which.
-func (r *gitRepo) findRef(hash string) (ref string, ok bool) {
-	r.refsOnce.Do(r.loadRefs)
-	for ref, h := range r.refs {
+func (r *gitRepo) findRef(ctx context.Context, hash string) (ref string, ok bool) {
+	refs, _ := r.loadRefs(ctx)
+	for ref, h := range refs {
 		if h == hash {
 			return ref, true
 		}
@@ -239,50 +265,55 @@ const minHashDigits = 7
 
 // stat stats the given rev in the local repository,
 // or else it fetches more info from the remote repository and tries again.
-func (r *gitRepo) stat(rev string) (*RevInfo, error) {
+func (r *gitRepo) stat(ctx context.Context, rev string) (*RevInfo, error) {
 	if r.local {
-		return r.statLocal(rev, rev)
+		return r.statLocal(ctx, rev, rev)
 	}
 
 	// Fast path: maybe rev is a hash we already have locally.
 	didStatLocal := false
 	if len(rev) >= minHashDigits && len(rev) <= 40 && AllHex(rev) {
-		if info, err := r.statLocal(rev, rev); err == nil {
+		if info, err := r.statLocal(ctx, rev, rev); err == nil {
 			return info, nil
 		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
 		didStatLocal = true
 	}
 
 	// Maybe rev is a tag we already have locally.
 	// (Note that we're excluding branches, which can be stale.)
-	r.localTagsOnce.Do(r.loadLocalTags)
-	if r.localTags[rev] {
-		return r.statLocal(rev, "refs/tags/"+rev)
+	if r.loadLocalTags(ctx)[rev] {
+		return r.statLocal(ctx, rev, "refs/tags/"+rev)
 	}
 
 	// Maybe rev is the name of a tag or branch on the remote server.
 	// Or maybe it's the prefix of a hash of a named ref.
 	// Try to resolve to both a ref (git name) and full (40-hex-digit) commit hash.
-	r.refsOnce.Do(r.loadRefs)
+	refs, _ := r.loadRefs(ctx)
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
 	var ref, hash string
-	if r.refs["refs/tags/"+rev] != "" {
+	if refs["refs/tags/"+rev] != "" {
 		ref = "refs/tags/" + rev
-		hash = r.refs[ref]
+		hash = refs[ref]
 		// Keep rev as is: tags are assumed not to change meaning.
-	} else if r.refs["refs/heads/"+rev] != "" {
+	} else if refs["refs/heads/"+rev] != "" {
 		ref = "refs/heads/" + rev
-		hash = r.refs[ref]
+		hash = refs[ref]
 		rev = hash // Replace rev, because meaning of refs/heads/foo can change.
-	} else if rev == "HEAD" && r.refs["HEAD"] != "" {
+	} else if rev == "HEAD" && refs["HEAD"] != "" {
 		ref = "HEAD"
-		hash = r.refs[ref]
+		hash = refs[ref]
 		rev = hash // Replace rev, because meaning of HEAD can change.
 	} else if len(rev) >= minHashDigits && len(rev) <= 40 && AllHex(rev) {
 		// At the least, we have a hash prefix we can look up after the fetch below.
 		// Maybe we can map it to a full hash using the known refs.
 		prefix := rev
 		// Check whether rev is prefix of known ref hash.
-		for k, h := range r.refs {
+		for k, h := range refs {
 			if strings.HasPrefix(h, prefix) {
 				if hash != "" && hash != h {
 					// Hash is an ambiguous hash prefix.
@@ -307,18 +338,20 @@ func (r *gitRepo) stat(rev string) (*RevInfo, error) {
 	// TODO(rsc): Add LockDir and use it for protecting that
 	// sequence, so that multiple processes don't collide in their
 	// git commands.
-	r.mu.Lock()
-	defer r.mu.Unlock()
+	if err := r.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer r.unlock()
 
 	// Perhaps r.localTags did not have the ref when we loaded local tags,
 	// but we've since done fetches that pulled down the hash we need
 	// (or already have the hash we need, just without its tag).
 	// Either way, try a local stat before falling back to network I/O.
 	if !didStatLocal {
-		if info, err := r.statLocal(rev, hash); err == nil {
+		if info, err := r.statLocal(ctx, rev, hash); err == nil {
 			if strings.HasPrefix(ref, "refs/tags/") {
 				// Make sure tag exists, so it will be in localTags next time the go command is run.
-				Run(r.dir, "git", "tag", strings.TrimPrefix(ref, "refs/tags/"), hash)
+				RunEnv(ctx, r.dir, r.env, "git", "tag", strings.TrimPrefix(ref, "refs/tags/"), hash)
 			}
 			return info, nil
 		}
@@ -343,9 +376,12 @@ func (r *gitRepo) stat(rev string) (*RevInfo, error) {
 			ref = hash
 			refspec = hash + ":refs/dummy"
 		}
-		_, err := Run(r.dir, "git", "fetch", "-f", "--depth=1", r.remote, refspec)
+		_, err := RunEnv(ctx, r.dir, r.env, "git", "fetch", "-f", "--depth=1", r.remote, refspec)
 		if err == nil {
-			return r.statLocal(rev, ref)
+			return r.statLocal(ctx, rev, ref)
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
 		}
 		// Don't try to be smart about parsing the error.
 		// It's too complex and varies too much by git version.
@@ -355,19 +391,46 @@ func (r *gitRepo) stat(rev string) (*RevInfo, error) {
 	// Last resort.
 	// Fetch all heads and tags and hope the hash we want is in the history.
 	if r.fetchLevel < fetchAll {
-		// TODO(bcmills): should we wait to upgrade fetchLevel until after we check
-		// err? If there is a temporary server error, we want subsequent fetches to
-		// try again instead of proceeding with an incomplete repo.
-		r.fetchLevel = fetchAll
-		if err := r.fetchUnshallow("refs/heads/*:refs/heads/*", "refs/tags/*:refs/tags/*"); err != nil {
+		// Upgrade fetchLevel only after a successful fetch: if it was interrupted
+		// or there was a temporary server error, subsequent fetches try again
+		// instead of proceeding with an incomplete repo.
+		if err := r.fetchUnshallow(ctx, "refs/heads/*:refs/heads/*", "refs/tags/*:refs/tags/*"); err != nil {
 			return nil, err
 		}
+		r.fetchLevel = fetchAll
+	}
+
+	return r.statLocal(ctx, rev, rev)
+}
+
+// Refresh drops cached refs and revisions. New commits are fetched by need
+// again even if the whole repository was fetched before.
+func (r *gitRepo) Refresh() {
+	r.mu <- struct{}{}
+	defer r.unlock()
+	if r.fetchLevel == fetchAll {
+		r.fetchLevel = fetchSome
+	}
+	r.refsCache.Clear()
+	r.localTagsCache.Clear()
+	r.statCache.Clear()
+}
+
+// lock locks r.mu unless ctx is done first.
+func (r *gitRepo) lock(ctx context.Context) error {
+	select {
+	case r.mu <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
+}
 
-	return r.statLocal(rev, rev)
+func (r *gitRepo) unlock() {
+	<-r.mu
 }
 
-func (r *gitRepo) fetchUnshallow(refSpecs ...string) error {
+func (r *gitRepo) fetchUnshallow(ctx context.Context, refSpecs ...string) error {
 	// To work around a protocol version 2 bug that breaks --unshallow,
 	// add -c protocol.version=0.
 	// TODO(rsc): The bug is believed to be server-side, meaning only
@@ -378,15 +441,18 @@ func (r *gitRepo) fetchUnshallow(refSpecs ...string) error {
 	if len(unshallowFlag) > 0 {
 		protoFlag = []string{"-c", "protocol.version=0"}
 	}
-	_, err := Run(r.dir, "git", protoFlag, "fetch", unshallowFlag, "-f", r.remote, refSpecs)
+	_, err := RunEnv(ctx, r.dir, r.env, "git", protoFlag, "fetch", unshallowFlag, "-f", r.remote, refSpecs)
 	return err
 }
 
 // statLocal returns a RevInfo describing rev in the local git repository.
 // It uses version as info.Version.
-func (r *gitRepo) statLocal(version, rev string) (*RevInfo, error) {
-	out, err := Run(r.dir, "git", "-c", "log.showsignature=false", "log", "-n1", "--format=format:%H %ct %D", rev)
+func (r *gitRepo) statLocal(ctx context.Context, version, rev string) (*RevInfo, error) {
+	out, err := RunEnv(ctx, r.dir, r.env, "git", "-c", "log.showsignature=false", "log", "-n1", "--format=format:%H %ct %D", rev)
 	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
 		return nil, fmt.Errorf("unknown revision %s", rev)
 	}
 	f := strings.Fields(string(out))
@@ -433,35 +499,42 @@ func (r *gitRepo) statLocal(version, rev string) (*RevInfo, error) {
 	return info, nil
 }
 
-func (r *gitRepo) Stat(rev string) (*RevInfo, error) {
+func (r *gitRepo) Stat(ctx context.Context, rev string) (*RevInfo, error) {
 	if rev == "latest" {
-		return r.Latest()
+		return r.Latest(ctx)
 	}
 	type cached struct {
 		info *RevInfo
 		err  error
 	}
-	c := r.statCache.Do(rev, func() interface{} {
-		info, err := r.stat(rev)
+	v, err := r.statCache.DoContext(ctx, rev, func() interface{} {
+		info, err := r.stat(ctx, rev)
 		return cached{info, err}
-	}).(cached)
+	})
+	if err != nil {
+		return nil, err
+	}
+	c := v.(cached)
 	return c.info, c.err
 }
 
-func (r *gitRepo) ReadFile(rev, file string, maxSize int64) ([]byte, error) {
+func (r *gitRepo) ReadFile(ctx context.Context, rev, file string, maxSize int64) ([]byte, error) {
 	// TODO: Could use git cat-file --batch.
-	info, err := r.Stat(rev) // download rev into local git repo
+	info, err := r.Stat(ctx, rev) // download rev into local git repo
 	if err != nil {
 		return nil, err
 	}
-	out, err := Run(r.dir, "git", "cat-file", "blob", info.Name+":"+file)
+	out, err := RunEnv(ctx, r.dir, r.env, "git", "cat-file", "blob", info.Name+":"+file)
 	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
 		return nil, os.ErrNotExist
 	}
 	return out, nil
 }
 
-func (r *gitRepo) ReadFileRevs(revs []string, file string, maxSize int64) (map[string]*FileRev, error) {
+func (r *gitRepo) ReadFileRevs(ctx context.Context, revs []string, file string, maxSize int64) (map[string]*FileRev, error) {
 	// Create space to hold results.
 	files := make(map[string]*FileRev)
 	for _, rev := range revs {
@@ -470,7 +543,7 @@ func (r *gitRepo) ReadFileRevs(revs []string, file string, maxSize int64) (map[s
 	}
 
 	// Collect locally-known revs.
-	need, err := r.readFileRevs(revs, file, files)
+	need, err := r.readFileRevs(ctx, revs, file, files)
 	if err != nil {
 		return nil, err
 	}
@@ -480,12 +553,12 @@ func (r *gitRepo) ReadFileRevs(revs []string, file string, maxSize int64) (map[s
 
 	// Build list of known remote refs that might help.
 	var redo []string
-	r.refsOnce.Do(r.loadRefs)
-	if r.refsErr != nil {
-		return nil, r.refsErr
+	refs, err := r.loadRefs(ctx)
+	if err != nil {
+		return nil, err
 	}
 	for _, tag := range need {
-		if r.refs["refs/tags/"+tag] != "" {
+		if refs["refs/tags/"+tag] != "" {
 			redo = append(redo, tag)
 		}
 	}
@@ -495,16 +568,18 @@ func (r *gitRepo) ReadFileRevs(revs []string, file string, maxSize int64) (map[s
 
 	// Protect r.fetchLevel and the "fetch more and more" sequence.
 	// See stat method above.
-	r.mu.Lock()
-	defer r.mu.Unlock()
+	if err := r.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer r.unlock()
 
-	var refs []string
+	var refSpecs []string
 	var protoFlag []string
 	var unshallowFlag []string
 	for _, tag := range redo {
-		refs = append(refs, "refs/tags/"+tag+":refs/tags/"+tag)
+		refSpecs = append(refSpecs, "refs/tags/"+tag+":refs/tags/"+tag)
 	}
-	if len(refs) > 1 {
+	if len(refSpecs) > 1 {
 		unshallowFlag = unshallow(r.dir)
 		if len(unshallowFlag) > 0 {
 			// To work around a protocol version 2 bug that breaks --unshallow,
@@ -515,7 +590,7 @@ func (r *gitRepo) ReadFileRevs(revs []string, file string, maxSize int64) (map[s
 			protoFlag = []string{"-c", "protocol.version=0"}
 		}
 	}
-	if _, err := Run(r.dir, "git", protoFlag, "fetch", unshallowFlag, "-f", r.remote, refs); err != nil {
+	if _, err := RunEnv(ctx, r.dir, r.env, "git", protoFlag, "fetch", unshallowFlag, "-f", r.remote, refSpecs); err != nil {
 		return nil, err
 	}
 
@@ -526,26 +601,26 @@ func (r *gitRepo) ReadFileRevs(revs []string, file string, maxSize int64) (map[s
 	//		for _, tag := range redo {
 	//			refs = append(refs, "refs/tags/"+tag+":refs/tags/"+tag)
 	//		}
-	//		if _, err := Run(r.dir, "git", "fetch", "--update-shallow", "-f", r.remote, refs); err != nil {
+	//		if _, err := RunEnv(ctx, r.dir, r.env, "git", "fetch", "--update-shallow", "-f", r.remote, refs); err != nil {
 	//			return nil, err
 	//		}
 	//	}
 
-	if _, err := r.readFileRevs(redo, file, files); err != nil {
+	if _, err := r.readFileRevs(ctx, redo, file, files); err != nil {
 		return nil, err
 	}
 
 	return files, nil
 }
 
-func (r *gitRepo) readFileRevs(tags []string, file string, fileMap map[string]*FileRev) (missing []string, err error) {
+func (r *gitRepo) readFileRevs(ctx context.Context, tags []string, file string, fileMap map[string]*FileRev) (missing []string, err error) {
 	var stdin bytes.Buffer
 	for _, tag := range tags {
 		fmt.Fprintf(&stdin, "refs/tags/%s\n", tag)
 		fmt.Fprintf(&stdin, "refs/tags/%s:%s\n", tag, file)
 	}
 
-	data, err := RunWithStdin(r.dir, &stdin, "git", "cat-file", "--batch")
+	data, err := RunEnvWithStdin(ctx, r.dir, r.env, &stdin, "git", "cat-file", "--batch")
 	if err != nil {
 		return nil, err
 	}
@@ -621,8 +696,8 @@ func (r *gitRepo) readFileRevs(tags []string, file string, fileMap map[string]*F
 	return missing, nil
 }
 
-func (r *gitRepo) RecentTag(rev, prefix string) (tag string, err error) {
-	info, err := r.Stat(rev)
+func (r *gitRepo) RecentTag(ctx context.Context, rev, prefix string) (tag string, err error) {
+	info, err := r.Stat(ctx, rev)
 	if err != nil {
 		return "", err
 	}
@@ -632,7 +707,7 @@ func (r *gitRepo) RecentTag(rev, prefix string) (tag string, err error) {
 	// result is definitive.
 	describe := func() (definitive bool) {
 		var out []byte
-		out, err = Run(r.dir, "git", "describe", "--first-parent", "--always", "--abbrev=0", "--match", prefix+"v[0-9]*.[0-9]*.[0-9]*", "--tags", rev)
+		out, err = RunEnv(ctx, r.dir, r.env, "git", "describe", "--first-parent", "--always", "--abbrev=0", "--match", prefix+"v[0-9]*.[0-9]*.[0-9]*", "--tags", rev)
 		if err != nil {
 			return true // Because we use "--always", describe should never fail.
 		}
@@ -647,7 +722,7 @@ func (r *gitRepo) RecentTag(rev, prefix string) (tag string, err error) {
 
 	// Git didn't find a version tag preceding the requested rev.
 	// See whether any plausible tag exists.
-	tags, err := r.Tags(prefix + "v")
+	tags, err := r.Tags(ctx, prefix+"v")
 	if err != nil {
 		return "", err
 	}
@@ -658,12 +733,14 @@ func (r *gitRepo) RecentTag(rev, prefix string) (tag string, err error) {
 	// There are plausible tags, but we don't know if rev is a descendent of any of them.
 	// Fetch the history to find out.
 
-	r.mu.Lock()
-	defer r.mu.Unlock()
+	if err := r.lock(ctx); err != nil {
+		return "", err
+	}
+	defer r.unlock()
 
 	if r.fetchLevel < fetchAll {
 		// Fetch all heads and tags and see if that gives us enough history.
-		if err := r.fetchUnshallow("refs/heads/*:refs/heads/*", "refs/tags/*:refs/tags/*"); err != nil {
+		if err := r.fetchUnshallow(ctx, "refs/heads/*:refs/heads/*", "refs/tags/*:refs/tags/*"); err != nil {
 			return "", err
 		}
 		r.fetchLevel = fetchAll
@@ -683,13 +760,13 @@ func (r *gitRepo) RecentTag(rev, prefix string) (tag string, err error) {
 	return tag, err
 }
 
-func (r *gitRepo) ReadZip(rev, subdir string, maxSize int64) (zip io.ReadCloser, actualSubdir string, err error) {
+func (r *gitRepo) ReadZip(ctx context.Context, rev, subdir string, maxSize int64) (zip io.ReadCloser, actualSubdir string, err error) {
 	// TODO: Use maxSize or drop it.
 	args := []string{}
 	if subdir != "" {
 		args = append(args, "--", subdir)
 	}
-	info, err := r.Stat(rev) // download rev into local git repo
+	info, err := r.Stat(ctx, rev) // download rev into local git repo
 	if err != nil {
 		return nil, "", err
 	}
@@ -699,7 +776,7 @@ func (r *gitRepo) ReadZip(rev, subdir string, maxSize int64) (zip io.ReadCloser,
 	// text file line endings. Setting -c core.autocrlf=input means only
 	// translate files on the way into the repo, not on the way out (archive).
 	// The -c core.eol=lf should be unnecessary but set it anyway.
-	archive, err := Run(r.dir, "git", "-c", "core.autocrlf=input", "-c", "core.eol=lf", "archive", "--format=zip", "--prefix=prefix/", info.Name, args)
+	archive, err := RunEnv(ctx, r.dir, r.env, "git", "-c", "core.autocrlf=input", "-c", "core.eol=lf", "archive", "--format=zip", "--prefix=prefix/", info.Name, args)
 	if err != nil {
 		if bytes.Contains(err.(*RunError).Stderr, []byte("did not match any files")) {
 			return nil, "", os.ErrNotExist
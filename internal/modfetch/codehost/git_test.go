@@ -7,6 +7,7 @@ package codehost
 import (
 	"archive/zip"
 	"bytes"
+	"context"
 	"flag"
 	"fmt"
 	"github.com/sirkon/goproxy/internal/testenv"
@@ -46,6 +47,7 @@ var altRepos = []string{
 var localGitRepo string
 
 func testMain(m *testing.M) int {
+	ctx := context.Background()
 	if _, err := exec.LookPath("git"); err != nil {
 		fmt.Fprintln(os.Stderr, "skipping because git binary not found")
 		fmt.Println("PASS")
@@ -65,10 +67,10 @@ func testMain(m *testing.M) int {
 		// then git starts up all the usual protocol machinery,
 		// which will let us test remote git archive invocations.
 		localGitRepo = filepath.Join(dir, "gitrepo2")
-		if _, err := Run("", "git", "clone", "--mirror", gitrepo1, localGitRepo); err != nil {
+		if _, err := Run(ctx, "", "git", "clone", "--mirror", gitrepo1, localGitRepo); err != nil {
 			log.Fatal(err)
 		}
-		if _, err := Run(localGitRepo, "git", "config", "daemon.uploadarch", "true"); err != nil {
+		if _, err := Run(ctx, localGitRepo, "git", "config", "daemon.uploadarch", "true"); err != nil {
 			log.Fatal(err)
 		}
 	}
@@ -102,6 +104,7 @@ var tagsTests = []struct {
 }
 
 func TestTags(t *testing.T) {
+	ctx := context.Background()
 	testenv.MustHaveExternalNetwork(t)
 	testenv.MustHaveExec(t)
 
@@ -111,7 +114,7 @@ func TestTags(t *testing.T) {
 			if err != nil {
 				t.Fatal(err)
 			}
-			tags, err := r.Tags(tt.prefix)
+			tags, err := r.Tags(ctx, tt.prefix)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -154,6 +157,7 @@ var latestTests = []struct {
 }
 
 func TestLatest(t *testing.T) {
+	ctx := context.Background()
 	testenv.MustHaveExternalNetwork(t)
 	testenv.MustHaveExec(t)
 
@@ -163,7 +167,7 @@ func TestLatest(t *testing.T) {
 			if err != nil {
 				t.Fatal(err)
 			}
-			info, err := r.Latest()
+			info, err := r.Latest(ctx)
 			if err != nil {
 				t.Fatal(err)
 			}
@@ -207,6 +211,7 @@ var readFileTests = []struct {
 }
 
 func TestReadFile(t *testing.T) {
+	ctx := context.Background()
 	testenv.MustHaveExternalNetwork(t)
 	testenv.MustHaveExec(t)
 
@@ -216,7 +221,7 @@ func TestReadFile(t *testing.T) {
 			if err != nil {
 				t.Fatal(err)
 			}
-			data, err := r.ReadFile(tt.rev, tt.file, 100)
+			data, err := r.ReadFile(ctx, tt.rev, tt.file, 100)
 			if err != nil {
 				if tt.err == "" {
 					t.Fatalf("ReadFile: unexpected error %v", err)
@@ -399,6 +404,7 @@ type zipFile struct {
 }
 
 func TestReadZip(t *testing.T) {
+	ctx := context.Background()
 	testenv.MustHaveExternalNetwork(t)
 	testenv.MustHaveExec(t)
 
@@ -408,7 +414,7 @@ func TestReadZip(t *testing.T) {
 			if err != nil {
 				t.Fatal(err)
 			}
-			rc, actualSubdir, err := r.ReadZip(tt.rev, tt.subdir, 100000)
+			rc, actualSubdir, err := r.ReadZip(ctx, tt.rev, tt.subdir, 100000)
 			if err != nil {
 				if tt.err == "" {
 					t.Fatalf("ReadZip: unexpected error %v", err)
@@ -571,6 +577,7 @@ var statTests = []struct {
 }
 
 func TestStat(t *testing.T) {
+	ctx := context.Background()
 	testenv.MustHaveExternalNetwork(t)
 	testenv.MustHaveExec(t)
 
@@ -580,7 +587,7 @@ func TestStat(t *testing.T) {
 			if err != nil {
 				t.Fatal(err)
 			}
-			info, err := r.Stat(tt.rev)
+			info, err := r.Stat(ctx, tt.rev)
 			if err != nil {
 				if tt.err == "" {
 					t.Fatalf("Stat: unexpected error %v", err)
@@ -0,0 +1,80 @@
+package codehost
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// makeLocalGitRepo creates a git repository with a single tagged commit
+func makeLocalGitRepo(t *testing.T, dir string) string {
+	t.Helper()
+	ctx := context.Background()
+	repo := filepath.Join(dir, "repo")
+	if err := os.MkdirAll(repo, 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(repo, "go.mod"), []byte("module example.com/repo\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	for _, args := range [][]string{
+		{"git", "init", "-q"},
+		{"git", "add", "go.mod"},
+		{"git", "-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "init"},
+		{"git", "tag", "v1.0.0"},
+	} {
+		if _, err := Run(ctx, repo, args); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return "file://" + filepath.ToSlash(repo)
+}
+
+func TestHostsAreIndependent(t *testing.T) {
+	ctx := context.Background()
+	dir, err := ioutil.TempDir("", "codehost-host-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	remote := makeLocalGitRepo(t, dir)
+	roots := []string{filepath.Join(dir, "a"), filepath.Join(dir, "b")}
+	for _, root := range roots {
+		h := NewHost(root)
+		r, err := h.GitRepo(remote)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tags, err := r.Tags(ctx, "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(tags, []string{"v1.0.0"}) {
+			t.Errorf("Tags: have %v, want [v1.0.0]", tags)
+		}
+		data, err := r.ReadFile(ctx, "v1.0.0", "go.mod", MaxGoMod)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(string(data), "module example.com/repo") {
+			t.Errorf("ReadFile: unexpected go.mod content %q", data)
+		}
+
+		workDir, err := h.WorkDir(gitWorkDirType, remote)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(workDir, root+string(filepath.Separator)) {
+			t.Errorf("WorkDir: %s is not under host work root %s", workDir, root)
+		}
+	}
+
+	if _, err := os.Stat(filepath.Join(WorkRoot, "repo")); err == nil {
+		t.Errorf("default work root must not be touched by independent hosts")
+	}
+}
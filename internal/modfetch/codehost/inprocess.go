@@ -0,0 +1,749 @@
+package codehost
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/go-git/go-git/v5"
+	"github.com/go-git/go-git/v5/config"
+	"github.com/go-git/go-git/v5/plumbing"
+	"github.com/go-git/go-git/v5/plumbing/filemode"
+	"github.com/go-git/go-git/v5/plumbing/object"
+	"github.com/go-git/go-git/v5/plumbing/transport"
+	githttp "github.com/go-git/go-git/v5/plumbing/transport/http"
+
+	"github.com/sirkon/goproxy/internal/par"
+	"github.com/sirkon/goproxy/internal/semver"
+)
+
+// GitBackend selects how git repositories are accessed.
+type GitBackend int
+
+const (
+	// GitBinary runs the git command.
+	GitBinary GitBackend = iota
+
+	// GitInProcess uses go-git, the git command is not needed.
+	// Remote repositories are accessible over http(s), ssh and git protocols,
+	// local ones are read directly.
+	GitInProcess
+)
+
+const inProcessGitWorkDirType = "git-inprocess2"
+
+// unshallowDepth is the depth asking a server for the whole history, the same git fetch --unshallow uses.
+const unshallowDepth = math.MaxInt32
+
+// inProcessGitRepo git repository accessed with go-git. Local repositories
+// are read directly, remote ones are fetched into a work directory: a
+// reference is fetched shallow first and the whole history is only fetched
+// when it is really needed.
+type inProcessGitRepo struct {
+	remote string
+	repo   *git.Repository
+	client *git.Remote // nil for local repositories
+	auth   transport.AuthMethod
+
+	tempDir string // directory for archives being made
+
+	mu         chan struct{} // locked by lock, protects fetches
+	fetchedAll bool
+
+	statCache par.Cache
+	refsCache par.Cache // keeps result of loadRefs unless it was interrupted
+}
+
+// inProcessGitRefs heads and tags of a repository
+type inProcessGitRefs struct {
+	refs  map[string]string // heads, tags and HEAD, annotated tags are peeled
+	names map[string]string // reference to fetch to get a commit referred by heads and tags
+}
+
+func (h *Host) newInProcessGitRepo(remote string, localOK bool) (Repo, error) {
+	r := &inProcessGitRepo{remote: remote, mu: make(chan struct{}, 1), tempDir: h.tempDir}
+	switch {
+	case strings.HasPrefix(remote, "file://"):
+		repo, err := git.PlainOpen(filepath.FromSlash(strings.TrimPrefix(remote, "file://")))
+		if err != nil {
+			return nil, err
+		}
+		r.repo = repo
+	case strings.HasPrefix(remote, "https://"), strings.HasPrefix(remote, "http://"),
+		strings.HasPrefix(remote, "ssh://"), strings.HasPrefix(remote, "git://"):
+		if h.auth != nil {
+			if !strings.HasPrefix(remote, "https://") && !strings.HasPrefix(remote, "http://") {
+				return nil, fmt.Errorf("git remote %s: credentials can only be passed over http(s)", remote)
+			}
+			r.auth = h.auth
+		}
+		dir, err := h.WorkDir(inProcessGitWorkDirType, remote)
+		if err != nil {
+			return nil, err
+		}
+		repo, err := git.PlainOpen(dir)
+		if err == git.ErrRepositoryNotExists {
+			repo, err = git.PlainInit(dir, true)
+		}
+		if err != nil {
+			os.RemoveAll(dir)
+			return nil, err
+		}
+		r.repo = repo
+		r.client = git.NewRemote(repo.Storer, &config.RemoteConfig{
+			Name: "origin",
+			URLs: []string{remote},
+		})
+	case strings.Contains(remote, "://"):
+		return nil, fmt.Errorf("git remote %s is not supported by in-process git", remote)
+	default:
+		if strings.Contains(remote, ":") {
+			return nil, fmt.Errorf("git remote cannot use host:path syntax")
+		}
+		if !localOK {
+			return nil, fmt.Errorf("git remote must not be local directory")
+		}
+		repo, err := git.PlainOpen(remote)
+		if err != nil {
+			return nil, err
+		}
+		r.repo = repo
+	}
+	return r, nil
+}
+
+// newInProcessAuth returns http credentials for in-process git.
+func newInProcessAuth(username, password string) *githttp.BasicAuth {
+	return &githttp.BasicAuth{Username: username, Password: password}
+}
+
+// loadRefs loads heads and tags references.
+// The result is computed once unless the computation was interrupted.
+func (r *inProcessGitRepo) loadRefs(ctx context.Context) (*inProcessGitRefs, error) {
+	type cached struct {
+		refs *inProcessGitRefs
+		err  error
+	}
+	v, err := r.refsCache.DoContext(ctx, "", func() interface{} {
+		refs, err := r.listRefs(ctx)
+		return cached{refs, err}
+	})
+	if err != nil {
+		return nil, err
+	}
+	c := v.(cached)
+	return c.refs, c.err
+}
+
+func (r *inProcessGitRepo) listRefs(ctx context.Context) (*inProcessGitRefs, error) {
+	res := &inProcessGitRefs{
+		refs:  map[string]string{},
+		names: map[string]string{},
+	}
+	if r.client == nil {
+		return res, r.listLocalRefs(res)
+	}
+
+	list, err := r.client.ListContext(ctx, &git.ListOptions{Auth: r.auth, PeelingOption: git.AppendPeeled})
+	if err == transport.ErrEmptyRemoteRepository {
+		return res, nil
+	}
+	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		return nil, err
+	}
+	byName := map[string]*plumbing.Reference{}
+	for _, ref := range list {
+		byName[ref.Name().String()] = ref
+	}
+	for _, ref := range list {
+		name := ref.Name().String()
+		if !strings.HasPrefix(name, "refs/heads/") && !strings.HasPrefix(name, "refs/tags/") {
+			continue
+		}
+		if strings.HasSuffix(name, "^{}") || ref.Type() != plumbing.HashReference {
+			continue
+		}
+		hash := ref.Hash().String()
+		if peeled, ok := byName[name+"^{}"]; ok { // record unwrapped annotated tag as value of tag
+			hash = peeled.Hash().String()
+		}
+		res.refs[name] = hash
+		if _, ok := res.names[hash]; !ok || strings.HasPrefix(name, "refs/tags/") {
+			res.names[hash] = name
+		}
+	}
+	if head, ok := byName["HEAD"]; ok {
+		switch head.Type() {
+		case plumbing.SymbolicReference:
+			if hash, ok := res.refs[head.Target().String()]; ok {
+				res.refs["HEAD"] = hash
+			}
+		case plumbing.HashReference:
+			res.refs["HEAD"] = head.Hash().String()
+		}
+	}
+	return res, nil
+}
+
+// listLocalRefs lists references of a local repository, annotated tags are peeled here
+func (r *inProcessGitRepo) listLocalRefs(res *inProcessGitRefs) error {
+	iter, err := r.repo.References()
+	if err != nil {
+		return err
+	}
+	err = iter.ForEach(func(ref *plumbing.Reference) error {
+		name := ref.Name().String()
+		if ref.Type() != plumbing.HashReference {
+			return nil
+		}
+		if !strings.HasPrefix(name, "refs/heads/") && !strings.HasPrefix(name, "refs/tags/") {
+			return nil
+		}
+		hash := ref.Hash()
+		if tag, err := r.repo.TagObject(hash); err == nil {
+			commit, err := tag.Commit()
+			if err != nil {
+				return nil
+			}
+			hash = commit.Hash
+		}
+		res.refs[name] = hash.String()
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if head, err := r.repo.Head(); err == nil {
+		res.refs["HEAD"] = head.Hash().String()
+	}
+	return nil
+}
+
+// Refresh drops cached refs and revisions, heads and tags are listed again
+// when needed.
+func (r *inProcessGitRepo) Refresh() {
+	r.mu <- struct{}{}
+	defer r.unlock()
+	r.fetchedAll = false
+	r.refsCache.Clear()
+	r.statCache.Clear()
+}
+
+// lock locks r.mu unless ctx is done first.
+func (r *inProcessGitRepo) lock(ctx context.Context) error {
+	select {
+	case r.mu <- struct{}{}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *inProcessGitRepo) unlock() {
+	<-r.mu
+}
+
+func (r *inProcessGitRepo) Tags(ctx context.Context, prefix string) ([]string, error) {
+	refs, err := r.loadRefs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := []string{}
+	for ref := range refs.refs {
+		if !strings.HasPrefix(ref, "refs/tags/") {
+			continue
+		}
+		tag := ref[len("refs/tags/"):]
+		if !strings.HasPrefix(tag, prefix) {
+			continue
+		}
+		tags = append(tags, tag)
+	}
+	sort.Strings(tags)
+	return tags, nil
+}
+
+func (r *inProcessGitRepo) Latest(ctx context.Context) (*RevInfo, error) {
+	refs, err := r.loadRefs(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if refs.refs["HEAD"] == "" {
+		return nil, fmt.Errorf("no commits")
+	}
+	return r.Stat(ctx, refs.refs["HEAD"])
+}
+
+func (r *inProcessGitRepo) Stat(ctx context.Context, rev string) (*RevInfo, error) {
+	if rev == "latest" {
+		return r.Latest(ctx)
+	}
+	type cached struct {
+		info *RevInfo
+		err  error
+	}
+	v, err := r.statCache.DoContext(ctx, rev, func() interface{} {
+		info, err := r.stat(ctx, rev)
+		return cached{info, err}
+	})
+	if err != nil {
+		return nil, err
+	}
+	c := v.(cached)
+	return c.info, c.err
+}
+
+func (r *inProcessGitRepo) stat(ctx context.Context, rev string) (*RevInfo, error) {
+	refs, err := r.loadRefs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	version := rev
+	var hash string
+	switch {
+	case refs.refs["refs/tags/"+rev] != "":
+		// Keep version as is: tags are assumed not to change meaning.
+		hash = refs.refs["refs/tags/"+rev]
+	case refs.refs["refs/heads/"+rev] != "":
+		hash = refs.refs["refs/heads/"+rev]
+		version = hash
+	case rev == "HEAD" && refs.refs["HEAD"] != "":
+		hash = refs.refs["HEAD"]
+		version = hash
+	case len(rev) >= minHashDigits && len(rev) <= 40 && AllHex(rev):
+		for _, h := range refs.refs {
+			if strings.HasPrefix(h, rev) {
+				if hash != "" && hash != h {
+					return nil, fmt.Errorf("ambiguous revision %s", rev)
+				}
+				hash = h
+			}
+		}
+		if hash == "" {
+			h, err := r.resolvePrefix(ctx, rev)
+			if err != nil {
+				return nil, err
+			}
+			hash = h.String()
+		}
+	default:
+		return nil, fmt.Errorf("unknown revision %s", rev)
+	}
+
+	if err := r.ensure(ctx, refs, hash); err != nil {
+		return nil, err
+	}
+	return r.statLocal(refs, version, hash)
+}
+
+// resolvePrefix looks for a commit with the given hash prefix fetching the whole history if needed
+func (r *inProcessGitRepo) resolvePrefix(ctx context.Context, prefix string) (plumbing.Hash, error) {
+	h, err := r.repo.ResolveRevision(plumbing.Revision(prefix))
+	if err == nil {
+		return *h, nil
+	}
+	if r.client == nil {
+		return plumbing.ZeroHash, fmt.Errorf("unknown revision %s", prefix)
+	}
+
+	if err := r.lock(ctx); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	defer r.unlock()
+	if err := r.fetchAll(ctx); err != nil {
+		return plumbing.ZeroHash, err
+	}
+	h, err = r.repo.ResolveRevision(plumbing.Revision(prefix))
+	if err != nil {
+		return plumbing.ZeroHash, fmt.Errorf("unknown revision %s", prefix)
+	}
+	return *h, nil
+}
+
+// has checks if commit with the given hash is in the local repository
+func (r *inProcessGitRepo) has(h plumbing.Hash) bool {
+	_, err := r.repo.CommitObject(h)
+	return err == nil
+}
+
+// ensure makes sure commit with the given hash is in the local repository
+func (r *inProcessGitRepo) ensure(ctx context.Context, refs *inProcessGitRefs, hash string) error {
+	h := plumbing.NewHash(hash)
+	if r.has(h) {
+		return nil
+	}
+	if r.client == nil {
+		return fmt.Errorf("unknown revision %s", hash)
+	}
+
+	if err := r.lock(ctx); err != nil {
+		return err
+	}
+	defer r.unlock()
+	if r.has(h) {
+		return nil
+	}
+	// Advertised references are fetched alone without history, other
+	// commits are searched in the whole history.
+	if name, ok := refs.names[hash]; ok {
+		spec := config.RefSpec("+" + name + ":" + name)
+		if err := r.fetch(ctx, []config.RefSpec{spec}, 1); err != nil {
+			return err
+		}
+	} else if err := r.fetchAll(ctx); err != nil {
+		return err
+	}
+	if !r.has(h) {
+		return fmt.Errorf("unknown revision %s", hash)
+	}
+	return nil
+}
+
+// fetchAll fetches all heads and tags with the whole history. Must be called with r.mu locked
+func (r *inProcessGitRepo) fetchAll(ctx context.Context) error {
+	if r.fetchedAll {
+		return nil
+	}
+	specs := []config.RefSpec{
+		"+refs/heads/*:refs/heads/*",
+		"+refs/tags/*:refs/tags/*",
+	}
+	if err := r.fetch(ctx, specs, unshallowDepth); err != nil {
+		return err
+	}
+	r.fetchedAll = true
+	return nil
+}
+
+// fetch fetches references with history of the given depth. Must be called with r.mu locked
+func (r *inProcessGitRepo) fetch(ctx context.Context, specs []config.RefSpec, depth int) error {
+	err := r.client.FetchContext(ctx, &git.FetchOptions{
+		RefSpecs: specs,
+		Depth:    depth,
+		Auth:     r.auth,
+		Tags:     git.NoTags,
+		Force:    true,
+	})
+	if err == nil || err == git.NoErrAlreadyUpToDate {
+		return nil
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	return err
+}
+
+// commit returns commit with the given hash, the whole history is fetched
+// if it is not in the local repository
+func (r *inProcessGitRepo) commit(ctx context.Context, h plumbing.Hash) (*object.Commit, error) {
+	commit, err := r.repo.CommitObject(h)
+	if err != plumbing.ErrObjectNotFound || r.client == nil {
+		return commit, err
+	}
+
+	if err := r.lock(ctx); err != nil {
+		return nil, err
+	}
+	err = r.fetchAll(ctx)
+	r.unlock()
+	if err != nil {
+		return nil, err
+	}
+	return r.repo.CommitObject(h)
+}
+
+// statLocal returns a RevInfo describing commit with the given hash in the local repository.
+// It uses version as info.Version if it is one of commit's tags.
+func (r *inProcessGitRepo) statLocal(refs *inProcessGitRefs, version, hash string) (*RevInfo, error) {
+	commit, err := r.repo.CommitObject(plumbing.NewHash(hash))
+	if err != nil {
+		return nil, fmt.Errorf("unknown revision %s: %v", hash, err)
+	}
+	hash = commit.Hash.String()
+	if strings.HasPrefix(hash, version) {
+		version = hash // extend to full hash
+	}
+
+	info := &RevInfo{
+		Name:    hash,
+		Short:   ShortenSHA1(hash),
+		Time:    commit.Committer.When.UTC(),
+		Version: hash,
+	}
+	for ref, value := range refs.refs {
+		if value == hash && strings.HasPrefix(ref, "refs/tags/") {
+			info.Tags = append(info.Tags, strings.TrimPrefix(ref, "refs/tags/"))
+		}
+	}
+	sort.Strings(info.Tags)
+
+	// Use caller's suggested version if it appears in the tag list
+	// (filters out branch names, HEAD).
+	for _, tag := range info.Tags {
+		if version == tag {
+			info.Version = version
+		}
+	}
+	return info, nil
+}
+
+// tree returns tree of the commit
+func (r *inProcessGitRepo) tree(commitHash string) (*object.Tree, error) {
+	commit, err := r.repo.CommitObject(plumbing.NewHash(commitHash))
+	if err != nil {
+		return nil, err
+	}
+	return commit.Tree()
+}
+
+// isNotFound checks if err means there's no such entry in a tree
+func isNotFound(err error) bool {
+	return err == object.ErrFileNotFound || err == object.ErrDirectoryNotFound || err == object.ErrEntryNotFound
+}
+
+func (r *inProcessGitRepo) ReadFile(ctx context.Context, rev, file string, maxSize int64) ([]byte, error) {
+	info, err := r.Stat(ctx, rev) // download rev into local git repo
+	if err != nil {
+		return nil, err
+	}
+	tree, err := r.tree(info.Name)
+	if err != nil {
+		return nil, err
+	}
+	f, err := tree.File(file)
+	if isNotFound(err) {
+		return nil, os.ErrNotExist
+	}
+	if err != nil {
+		return nil, err
+	}
+	if f.Size > maxSize {
+		return nil, fmt.Errorf("%s:%s is too large", rev, file)
+	}
+	return readBlob(&f.Blob)
+}
+
+// readBlob reads the whole blob
+func readBlob(blob *object.Blob) ([]byte, error) {
+	rc, err := blob.Reader()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return ioutil.ReadAll(rc)
+}
+
+func (r *inProcessGitRepo) ReadFileRevs(ctx context.Context, revs []string, file string, maxSize int64) (map[string]*FileRev, error) {
+	files := make(map[string]*FileRev)
+	for _, rev := range revs {
+		f := &FileRev{Rev: rev}
+		files[rev] = f
+		if _, err := r.Stat(ctx, rev); err != nil {
+			if ctx.Err() != nil {
+				return nil, ctx.Err()
+			}
+			// Note: f.Err must not satisfy os.IsNotExist. That's reserved for the file not existing in a valid commit.
+			f.Err = fmt.Errorf("no such rev %s", rev)
+			continue
+		}
+		data, err := r.ReadFile(ctx, rev, file, maxSize)
+		switch {
+		case os.IsNotExist(err):
+			f.Err = &os.PathError{Path: rev + ":" + file, Op: "read", Err: os.ErrNotExist}
+		case err != nil:
+			f.Err = err
+		default:
+			f.Data = data
+		}
+	}
+	return files, nil
+}
+
+func (r *inProcessGitRepo) RecentTag(ctx context.Context, rev, prefix string) (tag string, err error) {
+	info, err := r.Stat(ctx, rev)
+	if err != nil {
+		return "", err
+	}
+	refs, err := r.loadRefs(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	// The same tags git describe --match prefix+"v[0-9]*.[0-9]*.[0-9]*" would consider.
+	tagsByHash := map[string][]string{}
+	for ref, hash := range refs.refs {
+		if !strings.HasPrefix(ref, "refs/tags/") {
+			continue
+		}
+		tag := strings.TrimPrefix(ref, "refs/tags/")
+		if ok, _ := path.Match(prefix+"v[0-9]*.[0-9]*.[0-9]*", tag); ok {
+			tagsByHash[hash] = append(tagsByHash[hash], tag)
+		}
+	}
+	if len(tagsByHash) == 0 {
+		return "", nil
+	}
+
+	// Walk first parents looking for the most recent tagged commit.
+	// Shallow fetched history is deepened on the way.
+	h := plumbing.NewHash(info.Name)
+	for {
+		if tags := tagsByHash[h.String()]; len(tags) > 0 {
+			best := tags[0]
+			for _, tag := range tags[1:] {
+				if semver.Compare(strings.TrimPrefix(tag, prefix), strings.TrimPrefix(best, prefix)) > 0 {
+					best = tag
+				}
+			}
+			return best, nil
+		}
+		if err := ctx.Err(); err != nil {
+			return "", err
+		}
+		commit, err := r.commit(ctx, h)
+		if err != nil {
+			return "", err
+		}
+		if len(commit.ParentHashes) == 0 {
+			return "", nil
+		}
+		h = commit.ParentHashes[0]
+	}
+}
+
+func (r *inProcessGitRepo) ReadZip(ctx context.Context, rev, subdir string, maxSize int64) (zip io.ReadCloser, actualSubdir string, err error) {
+	info, err := r.Stat(ctx, rev) // download rev into local git repo
+	if err != nil {
+		return nil, "", err
+	}
+	root, err := r.tree(info.Name)
+	if err != nil {
+		return nil, "", err
+	}
+	dir := strings.Trim(subdir, "/")
+	if dir != "" {
+		root, err = root.Tree(dir)
+		if isNotFound(err) {
+			return nil, "", os.ErrNotExist
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		dir += "/"
+	}
+
+	// The archive may be large, it is spooled to a file rather than kept in memory.
+	f, err := ioutil.TempFile(r.tempDir, "go-readzip-*.zip")
+	if err != nil {
+		return nil, "", err
+	}
+	zw := newZipTreeWriter(ctx, r.repo, f, info, maxSize)
+	err = zw.writeTree(root, dir)
+	if err == nil {
+		err = zw.close()
+	}
+	if err == nil {
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, "", err
+	}
+	return &deleteCloser{f}, "", nil
+}
+
+// zipTreeWriter writes trees into zip archive like git archive --prefix=prefix/ does
+type zipTreeWriter struct {
+	ctx  context.Context
+	repo *git.Repository
+	zw   *zip.Writer
+	info *RevInfo
+	left int64
+}
+
+func newZipTreeWriter(ctx context.Context, repo *git.Repository, w io.Writer, info *RevInfo, maxSize int64) *zipTreeWriter {
+	return &zipTreeWriter{
+		ctx:  ctx,
+		repo: repo,
+		zw:   zip.NewWriter(w),
+		info: info,
+		left: maxSize,
+	}
+}
+
+func (w *zipTreeWriter) writeTree(tree *object.Tree, dir string) error {
+	if err := w.ctx.Err(); err != nil {
+		return err
+	}
+	for _, entry := range tree.Entries {
+		name := dir + entry.Name
+		switch entry.Mode {
+		case filemode.Dir:
+			sub, err := w.repo.TreeObject(entry.Hash)
+			if err != nil {
+				return err
+			}
+			if err := w.writeTree(sub, name+"/"); err != nil {
+				return err
+			}
+		case filemode.Regular, filemode.Deprecated, filemode.Executable, filemode.Symlink:
+			if err := w.writeFile(entry, name); err != nil {
+				return err
+			}
+		}
+		// Submodules are not a part of the archive.
+	}
+	return nil
+}
+
+func (w *zipTreeWriter) writeFile(entry object.TreeEntry, name string) error {
+	blob, err := w.repo.BlobObject(entry.Hash)
+	if err != nil {
+		return err
+	}
+	w.left -= blob.Size
+	if w.left < 0 {
+		return fmt.Errorf("zip file too large")
+	}
+	data, err := readBlob(blob)
+	if err != nil {
+		return err
+	}
+	header := &zip.FileHeader{
+		Name:     "prefix/" + name,
+		Method:   zip.Deflate,
+		Modified: w.info.Time,
+	}
+	switch entry.Mode {
+	case filemode.Symlink:
+		header.SetMode(os.ModeSymlink | 0777)
+	case filemode.Executable:
+		header.SetMode(0755)
+	default:
+		header.SetMode(0644)
+	}
+	fw, err := w.zw.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = fw.Write(data)
+	return err
+}
+
+func (w *zipTreeWriter) close() error {
+	return w.zw.Close()
+}
@@ -0,0 +1,288 @@
+package codehost
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http/cgi"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// makeHistoryRepo creates a bare repository with tags on the history, a subdirectory with its own module
+// and an executable
+func makeHistoryRepo(t *testing.T, dir string) string {
+	t.Helper()
+	ctx := context.Background()
+	work := filepath.Join(dir, "work")
+	if err := os.MkdirAll(filepath.Join(work, "sub"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	env := []string{
+		"GIT_AUTHOR_NAME=test", "GIT_AUTHOR_EMAIL=test@example.com",
+		"GIT_COMMITTER_NAME=test", "GIT_COMMITTER_EMAIL=test@example.com",
+	}
+	run := func(args ...string) {
+		t.Helper()
+		if _, err := RunEnv(ctx, work, env, args); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write := func(name, content string, mode os.FileMode) {
+		t.Helper()
+		if err := ioutil.WriteFile(filepath.Join(work, name), []byte(content), mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	run("git", "init", "-q")
+	for i := 0; i < 4; i++ {
+		write("go.mod", "module example.com/repo\n", 0666)
+		write("file.go", fmt.Sprintf("package repo\n\nconst Version = %d\n", i), 0666)
+		write("run.sh", "#!/bin/sh\n", 0777)
+		write("sub/go.mod", "module example.com/repo/sub\n", 0666)
+		write("sub/sub.go", fmt.Sprintf("package sub\n\nconst Version = %d\n", i), 0666)
+		run("git", "add", "-A")
+		date := fmt.Sprintf("2019-01-0%dT00:00:00Z", i+1)
+		if _, err := RunEnv(ctx, work, append(env, "GIT_AUTHOR_DATE="+date, "GIT_COMMITTER_DATE="+date), "git", "commit", "-q", "-m", "commit"); err != nil {
+			t.Fatal(err)
+		}
+		switch i {
+		case 0:
+			run("git", "tag", "v1.0.0")
+		case 1:
+			run("git", "tag", "-a", "-m", "release", "v1.1.0")
+			run("git", "tag", "sub/v0.1.0")
+		case 2:
+			run("git", "tag", "not-a-version")
+		}
+	}
+	bare := filepath.Join(dir, "repo.git")
+	if _, err := Run(ctx, dir, "git", "clone", "-q", "--bare", work, bare); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Run(ctx, bare, "git", "repack", "-a", "-d"); err != nil {
+		t.Fatal(err)
+	}
+	return bare
+}
+
+// zipContent returns names and contents of files in zip
+func zipContent(t *testing.T, r Repo, rev, subdir string) map[string]string {
+	t.Helper()
+	ctx := context.Background()
+	rc, _, err := r.ReadZip(ctx, rev, subdir, MaxZipFile)
+	if err != nil {
+		t.Fatalf("ReadZip(%s, %s): %v", rev, subdir, err)
+	}
+	defer rc.Close()
+	data, err := ioutil.ReadAll(rc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := map[string]string{}
+	for _, f := range zr.File {
+		if strings.HasSuffix(f.Name, "/") {
+			continue
+		}
+		fr, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := ioutil.ReadAll(fr)
+		fr.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		res[f.Name] = fmt.Sprintf("%s %s", f.Mode()&0111, content)
+	}
+	return res
+}
+
+// TestInProcessGitRepo checks in-process git gives the same results as the git command does
+func TestInProcessGitRepo(t *testing.T) {
+	ctx := context.Background()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git binary not found")
+	}
+	dir, err := ioutil.TempDir("", "codehost-inprocess-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	bare := makeHistoryRepo(t, dir)
+
+	gitPath, _ := exec.LookPath("git")
+	server := httptest.NewServer(&cgi.Handler{
+		Path: gitPath,
+		Args: []string{"http-backend"},
+		Env:  []string{"GIT_PROJECT_ROOT=" + dir, "GIT_HTTP_EXPORT_ALL=1"},
+	})
+	defer server.Close()
+
+	expectedHost := NewHost(filepath.Join(dir, "binary"))
+	expected, err := expectedHost.GitRepo("file://" + filepath.ToSlash(bare))
+	if err != nil {
+		t.Fatal(err)
+	}
+	head, err := expected.Latest(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := expected.Stat(ctx, "v1.0.0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	remotes := map[string]string{
+		"file": "file://" + filepath.ToSlash(bare),
+		"http": server.URL + "/repo.git",
+	}
+	for name, remote := range remotes {
+		t.Run(name, func(t *testing.T) {
+			h := NewHost(filepath.Join(dir, "inprocess-"+name))
+			h.SetGitBackend(GitInProcess)
+			tmp := filepath.Join(dir, "tmp-"+name)
+			if err := os.MkdirAll(tmp, 0755); err != nil {
+				t.Fatal(err)
+			}
+			h.SetTempDir(tmp)
+			r, err := h.GitRepo(remote)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for _, prefix := range []string{"", "v", "v1.1", "sub/", "x"} {
+				want, _ := expected.Tags(ctx, prefix)
+				have, err := r.Tags(ctx, prefix)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !reflect.DeepEqual(have, want) {
+					t.Errorf("Tags(%q): have %v, want %v", prefix, have, want)
+				}
+			}
+
+			if name == "http" {
+				// a tag is fetched without history
+				if _, err := r.Stat(ctx, "v1.1.0"); err != nil {
+					t.Fatal(err)
+				}
+				shallow, err := r.(*inProcessGitRepo).repo.Storer.Shallow()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if len(shallow) == 0 {
+					t.Errorf("Stat(v1.1.0): shallow fetch expected")
+				}
+			}
+
+			revs := []string{"v1.0.0", "v1.1.0", "sub/v0.1.0", "not-a-version", "master", "HEAD", head.Name, head.Name[:12], first.Name[:8]}
+			for _, rev := range revs {
+				want, err := expected.Stat(ctx, rev)
+				if err != nil {
+					t.Fatal(err)
+				}
+				have, err := r.Stat(ctx, rev)
+				if err != nil {
+					t.Fatalf("Stat(%s): %v", rev, err)
+				}
+				if !reflect.DeepEqual(have, want) {
+					t.Errorf("Stat(%s): have %+v, want %+v", rev, have, want)
+				}
+			}
+			if _, err := r.Stat(ctx, "unknown"); err == nil {
+				t.Errorf("Stat(unknown): error expected")
+			}
+			latest, err := r.Latest(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(latest, head) {
+				t.Errorf("Latest: have %+v, want %+v", latest, head)
+			}
+
+			data, err := r.ReadFile(ctx, "v1.1.0", "sub/sub.go", MaxGoMod)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := "package sub\n\nconst Version = 1\n"; string(data) != want {
+				t.Errorf("ReadFile: have %q, want %q", data, want)
+			}
+			if _, err := r.ReadFile(ctx, "v1.1.0", "missing.go", MaxGoMod); !os.IsNotExist(err) {
+				t.Errorf("ReadFile(missing.go): not exist error expected, got %v", err)
+			}
+
+			files, err := r.ReadFileRevs(ctx, []string{"v1.0.0", "v1.1.0", "v9.9.9"}, "go.mod", MaxGoMod)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(files["v1.0.0"].Data) != "module example.com/repo\n" || files["v1.1.0"].Err != nil {
+				t.Errorf("ReadFileRevs: unexpected results %+v %+v", files["v1.0.0"], files["v1.1.0"])
+			}
+			if files["v9.9.9"].Err == nil || os.IsNotExist(files["v9.9.9"].Err) {
+				t.Errorf("ReadFileRevs: unexpected error for missing revision: %v", files["v9.9.9"].Err)
+			}
+
+			for _, tt := range []struct {
+				rev    string
+				prefix string
+			}{
+				{"master", ""},
+				{"v1.0.0", ""},
+				{"master", "sub/"},
+				{"v1.0.0", "sub/"},
+			} {
+				want, _ := expected.RecentTag(ctx, tt.rev, tt.prefix)
+				if AllHex(want) {
+					// git describe --always falls back to a hash
+					want = ""
+				}
+				have, err := r.RecentTag(ctx, tt.rev, tt.prefix)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if have != want {
+					t.Errorf("RecentTag(%s, %q): have %q, want %q", tt.rev, tt.prefix, have, want)
+				}
+			}
+
+			for _, subdir := range []string{"", "sub"} {
+				want := zipContent(t, expected, "v1.1.0", subdir)
+				have := zipContent(t, r, "v1.1.0", subdir)
+				if !reflect.DeepEqual(have, want) {
+					t.Errorf("ReadZip(v1.1.0, %q): have %v, want %v", subdir, have, want)
+				}
+			}
+			if _, _, err := r.ReadZip(ctx, "v1.1.0", "missing", MaxZipFile); !os.IsNotExist(err) {
+				t.Errorf("ReadZip(missing): not exist error expected, got %v", err)
+			}
+
+			// archives are spooled to the temporary directory and removed on close
+			rc, _, err := r.ReadZip(ctx, "v1.1.0", "", MaxZipFile)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if entries, _ := ioutil.ReadDir(tmp); len(entries) != 1 {
+				t.Errorf("ReadZip: one archive expected in the temporary directory, got %d", len(entries))
+			}
+			if err := rc.Close(); err != nil {
+				t.Fatal(err)
+			}
+			if entries, _ := ioutil.ReadDir(tmp); len(entries) != 0 {
+				t.Errorf("ReadZip: temporary directory is to be empty after close, got %d entries", len(entries))
+			}
+		})
+	}
+}
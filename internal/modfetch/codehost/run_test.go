@@ -0,0 +1,71 @@
+package codehost
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRunCancel(t *testing.T) {
+	if _, err := exec.LookPath("sleep"); err != nil {
+		t.Skip("sleep binary not found")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	start := time.Now()
+	if _, err := Run(ctx, "", "sleep", "10"); err != context.DeadlineExceeded {
+		t.Fatalf("Run: context deadline exceeded error expected, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Run: command was not stopped on cancellation, took %s", elapsed)
+	}
+}
+
+// TestCancelledStatIsNotCached checks a call cancelled by one caller doesn't break it for others
+func TestCancelledStatIsNotCached(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git binary not found")
+	}
+	dir, err := ioutil.TempDir("", "codehost-cancel-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	remote := makeLocalGitRepo(t, dir)
+	backends := []struct {
+		name    string
+		backend GitBackend
+	}{
+		{"binary", GitBinary},
+		{"inprocess", GitInProcess},
+	}
+	for _, b := range backends {
+		backend := b.name
+		h := NewHost(filepath.Join(dir, "work", backend))
+		h.SetGitBackend(b.backend)
+		r, err := h.GitRepo(remote)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		// the backend may have everything needed at hand already, otherwise it must give up
+		if _, err := r.Stat(ctx, "v1.0.0"); err != nil && err != context.Canceled {
+			t.Errorf("%s: Stat with cancelled context: unexpected error %v", backend, err)
+		}
+		info, err := r.Stat(context.Background(), "v1.0.0")
+		if err != nil {
+			t.Fatalf("%s: Stat: %v", backend, err)
+		}
+		if info.Version != "v1.0.0" {
+			t.Errorf("%s: Stat: unexpected version %s", backend, info.Version)
+		}
+	}
+}
@@ -12,6 +12,7 @@ import (
 	"archive/zip"
 	"bufio"
 	"bytes"
+	"context"
 	"flag"
 	"fmt"
 	"io/ioutil"
@@ -29,6 +30,7 @@ func usage() {
 }
 
 func main() {
+	ctx := context.Background()
 	codehost.WorkRoot = "/tmp/vcswork"
 	log.SetFlags(0)
 	log.SetPrefix("shell: ")
@@ -67,7 +69,7 @@ func main() {
 				fmt.Fprintf(os.Stderr, "?usage: tags [prefix]\n")
 				continue
 			}
-			tags, err := repo.Tags(prefix)
+			tags, err := repo.Tags(ctx, prefix)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "?%s\n", err)
 				continue
@@ -81,7 +83,7 @@ func main() {
 				fmt.Fprintf(os.Stderr, "?usage: stat rev\n")
 				continue
 			}
-			info, err := repo.Stat(f[1])
+			info, err := repo.Stat(ctx, f[1])
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "?%s\n", err)
 				continue
@@ -93,7 +95,7 @@ func main() {
 				fmt.Fprintf(os.Stderr, "?usage: read rev file\n")
 				continue
 			}
-			data, err := repo.ReadFile(f[1], f[2], 10<<20)
+			data, err := repo.ReadFile(ctx, f[1], f[2], 10<<20)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "?%s\n", err)
 				continue
@@ -109,7 +111,7 @@ func main() {
 			if subdir == "-" {
 				subdir = ""
 			}
-			rc, _, err := repo.ReadZip(f[1], subdir, 10<<20)
+			rc, _, err := repo.ReadZip(ctx, f[1], subdir, 10<<20)
 			if err != nil {
 				fmt.Fprintf(os.Stderr, "?%s\n", err)
 				continue
@@ -0,0 +1,197 @@
+package codehost
+
+import (
+	"archive/zip"
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirkon/goproxy/internal/semver"
+)
+
+// svnURL returns URL of the file (or the whole tree for an empty file) at revision rev.
+// Revisions are either svn revision numbers (possibly zero padded, like in pseudo-versions),
+// or tag names, which are directories under tags next to trunk, or "latest".
+func svnURL(remote, rev, file string) string {
+	base, peg := remote, ""
+	switch {
+	case rev == "latest":
+	case svnIsRevision(rev):
+		n := strings.TrimLeft(rev, "0")
+		if n == "" {
+			n = "0"
+		}
+		peg = "@" + n
+	default:
+		base = svnTagsURL(remote) + "/" + rev
+	}
+	if file != "" {
+		base += "/" + strings.TrimPrefix(file, "/")
+	}
+	return base + peg
+}
+
+// svnTagsURL returns URL of tags directory of the repository whose trunk is remote.
+func svnTagsURL(remote string) string {
+	return strings.TrimSuffix(strings.TrimSuffix(remote, "/"), "/trunk") + "/tags"
+}
+
+// svnIsRevision reports whether rev is an svn revision number.
+func svnIsRevision(rev string) bool {
+	if rev == "" {
+		return false
+	}
+	for _, c := range rev {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// svnRecentTag returns the semver tag with the given prefix having the highest version
+// among the ones created at or before rev. Tags are assumed to be created by copying the trunk,
+// so the revision a tag was created at is compared to rev.
+func (r *vcsRepo) svnRecentTag(ctx context.Context, rev, prefix string) (string, error) {
+	if rev == "" {
+		rev = "latest"
+	}
+	info, err := r.Stat(ctx, rev)
+	if err != nil {
+		return "", err
+	}
+	revNo, err := svnRevision(info.Name)
+	if err != nil {
+		return "", err
+	}
+
+	tags, err := r.Tags(ctx, prefix)
+	if err != nil {
+		return "", err
+	}
+	var best string
+	for _, tag := range tags {
+		v := strings.TrimPrefix(tag, prefix)
+		if !semver.IsValid(v) {
+			continue
+		}
+		if best != "" && semver.Compare(v, strings.TrimPrefix(best, prefix)) <= 0 {
+			continue
+		}
+		tagInfo, err := r.Stat(ctx, tag)
+		if err != nil {
+			return "", err
+		}
+		tagRevNo, err := svnRevision(tagInfo.Name)
+		if err != nil {
+			return "", err
+		}
+		if tagRevNo <= revNo {
+			best = tag
+		}
+	}
+	return best, nil
+}
+
+func svnRevision(name string) (int64, error) {
+	var n int64
+	if _, err := fmt.Sscanf(name, "%d", &n); err != nil {
+		return 0, fmt.Errorf("invalid svn revision %q", name)
+	}
+	return n, nil
+}
+
+// svnReadZip exports the tree at rev into a temporary directory and zips it
+// with the layout other version control systems produce: every file is under prefix/
+// and keeps its subdir.
+func (r *vcsRepo) svnReadZip(ctx context.Context, rev, subdir string, maxSize int64) (io.ReadCloser, string, error) {
+	dir, err := ioutil.TempDir("", "go-readzip-svn-")
+	if err != nil {
+		return nil, "", err
+	}
+	defer os.RemoveAll(dir)
+
+	export := filepath.Join(dir, "export")
+	if _, err := RunEnv(ctx, dir, r.env, "svn", "export", "-q", "--non-interactive", svnURL(r.remote, rev, subdir), export); err != nil {
+		if re, ok := err.(*RunError); ok && strings.Contains(string(re.Stderr), "E170000") {
+			// path doesn't exist at the revision
+			return nil, "", os.ErrNotExist
+		}
+		return nil, "", err
+	}
+
+	f, err := ioutil.TempFile("", "go-readzip-*.zip")
+	if err != nil {
+		return nil, "", err
+	}
+	prefix := "prefix/"
+	if subdir != "" {
+		prefix += strings.Trim(subdir, "/") + "/"
+	}
+	if err := zipDir(f, export, prefix, maxSize); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, "", err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return nil, "", err
+	}
+	return &deleteCloser{f}, "", nil
+}
+
+// zipDir writes files of dir into zip archive prefixing their names with prefix.
+// Symbolic links are stored as links, other special files are skipped.
+func zipDir(w io.Writer, dir, prefix string, maxSize int64) error {
+	zw := zip.NewWriter(w)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.Mode().IsRegular() && info.Mode()&os.ModeSymlink == 0 {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		header, err := zip.FileInfoHeader(info)
+		if err != nil {
+			return err
+		}
+		header.Name = prefix + filepath.ToSlash(rel)
+		header.Method = zip.Deflate
+
+		var data []byte
+		if info.Mode()&os.ModeSymlink != 0 {
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			data = []byte(target)
+		} else {
+			if data, err = ioutil.ReadFile(path); err != nil {
+				return err
+			}
+		}
+		maxSize -= int64(len(data))
+		if maxSize < 0 {
+			return fmt.Errorf("zip file too large")
+		}
+		fw, err := zw.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		_, err = fw.Write(data)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return zw.Close()
+}
@@ -0,0 +1,159 @@
+package codehost
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestSvnURL(t *testing.T) {
+	tests := []struct {
+		rev  string
+		file string
+		want string
+	}{
+		{"latest", "", "file:///repo/trunk"},
+		{"latest", "go.mod", "file:///repo/trunk/go.mod"},
+		{"42", "go.mod", "file:///repo/trunk/go.mod@42"},
+		{"000000000042", "", "file:///repo/trunk@42"},
+		{"000000000000", "", "file:///repo/trunk@0"},
+		{"v1.0.0", "sub/go.mod", "file:///repo/tags/v1.0.0/sub/go.mod"},
+	}
+	for _, tt := range tests {
+		if have := svnURL("file:///repo/trunk", tt.rev, tt.file); have != tt.want {
+			t.Errorf("svnURL(%q, %q): have %q, want %q", tt.rev, tt.file, have, tt.want)
+		}
+	}
+}
+
+func TestZipDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "codehost-zipdir-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(filepath.Join(dir, "pkg"), 0777); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte("module example.com/repo/sub\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "pkg", "pkg.go"), []byte("package pkg\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := zipDir(&buf, dir, "prefix/sub/", MaxZipFile); err != nil {
+		t.Fatal(err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	sort.Strings(names)
+	if want := []string{"prefix/sub/go.mod", "prefix/sub/pkg/pkg.go"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("have %v, want %v", names, want)
+	}
+
+	if err := zipDir(ioutil.Discard, dir, "prefix/", 10); err == nil {
+		t.Errorf("size limit error expected")
+	}
+}
+
+// TestSvnRepo checks svn repository served with file:// URL
+func TestSvnRepo(t *testing.T) {
+	ctx := context.Background()
+	for _, cmd := range []string{"svn", "svnadmin"} {
+		if _, err := exec.LookPath(cmd); err != nil {
+			t.Skipf("%s binary not found", cmd)
+		}
+	}
+	dir, err := ioutil.TempDir("", "codehost-svn-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	repoDir := filepath.Join(dir, "repo")
+	if _, err := Run(ctx, dir, "svnadmin", "create", repoDir); err != nil {
+		t.Fatal(err)
+	}
+	root := "file://" + filepath.ToSlash(repoDir)
+	work := filepath.Join(dir, "work")
+	svn := func(args ...string) {
+		t.Helper()
+		if _, err := Run(ctx, work, "svn", "--non-interactive", args); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.MkdirAll(work, 0777); err != nil {
+		t.Fatal(err)
+	}
+	svn("mkdir", "-q", "-m", "layout", root+"/trunk", root+"/tags") // r1
+	svn("checkout", "-q", root+"/trunk", "trunk")
+	work = filepath.Join(work, "trunk")
+	if err := ioutil.WriteFile(filepath.Join(work, "go.mod"), []byte("module example.com/repo\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	svn("add", "-q", "go.mod")
+	svn("commit", "-q", "-m", "go.mod")                                    // r2
+	svn("copy", "-q", "-m", "release", root+"/trunk", root+"/tags/v1.0.0") // r3
+	if err := ioutil.WriteFile(filepath.Join(work, "file.go"), []byte("package repo\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+	svn("add", "-q", "file.go")
+	svn("commit", "-q", "-m", "file.go") // r4
+
+	r, err := NewHost(filepath.Join(dir, "host")).NewRepo("svn", root+"/trunk")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	latest, err := r.Latest(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if latest.Name != "4" || latest.Short != "000000000004" {
+		t.Errorf("Latest: unexpected revision %+v", latest)
+	}
+	info, err := r.Stat(ctx, "000000000002")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name != "2" {
+		t.Errorf("Stat(000000000002): unexpected revision %+v", info)
+	}
+	tag, err := r.RecentTag(ctx, "4", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tag != "v1.0.0" {
+		t.Errorf("RecentTag(4): have %q, want v1.0.0", tag)
+	}
+	if tag, err = r.RecentTag(ctx, "2", ""); err != nil || tag != "" {
+		t.Errorf("RecentTag(2): have %q, %v, want no tag", tag, err)
+	}
+
+	want := map[string]string{
+		"prefix/go.mod":  "---------- module example.com/repo\n",
+		"prefix/file.go": "---------- package repo\n",
+	}
+	if have := zipContent(t, r, "000000000004", ""); !reflect.DeepEqual(have, want) {
+		t.Errorf("ReadZip(4): have %v, want %v", have, want)
+	}
+	delete(want, "prefix/file.go")
+	if have := zipContent(t, r, "v1.0.0", ""); !reflect.DeepEqual(have, want) {
+		t.Errorf("ReadZip(v1.0.0): have %v, want %v", have, want)
+	}
+}
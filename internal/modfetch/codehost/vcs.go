@@ -5,6 +5,7 @@
 package codehost
 
 import (
+	"context"
 	"encoding/xml"
 	"fmt"
 	"io"
@@ -15,7 +16,6 @@ import (
 	"sort"
 	"strconv"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/sirkon/goproxy/internal/par"
@@ -33,7 +33,13 @@ type VCSError struct {
 
 func (e *VCSError) Error() string { return e.Err.Error() }
 
+// NewRepo returns the code repository of the given version control system at remote.
 func NewRepo(vcs, remote string) (Repo, error) {
+	return defaultHost.NewRepo(vcs, remote)
+}
+
+// NewRepo returns the code repository of the host of the given version control system at remote.
+func (h *Host) NewRepo(vcs, remote string) (Repo, error) {
 	type key struct {
 		vcs    string
 		remote string
@@ -42,8 +48,8 @@ func NewRepo(vcs, remote string) (Repo, error) {
 		repo Repo
 		err  error
 	}
-	c := vcsRepoCache.Do(key{vcs, remote}, func() interface{} {
-		repo, err := newVCSRepo(vcs, remote)
+	c := h.vcsRepoCache.Do(key{vcs, remote}, func() interface{} {
+		repo, err := h.newVCSRepo(vcs, remote)
 		if err != nil {
 			err = &VCSError{err}
 		}
@@ -53,26 +59,30 @@ func NewRepo(vcs, remote string) (Repo, error) {
 	return c.repo, c.err
 }
 
-var vcsRepoCache par.Cache
-
 type vcsRepo struct {
 	remote string
 	cmd    *vcsCmd
 	dir    string
+	env    []string
 
-	tagsOnce sync.Once
-	tags     map[string]bool
-
-	branchesOnce sync.Once
-	branches     map[string]bool
+	// tagsCache, branchesCache and fetchCache keep results of loadTags,
+	// loadBranches and fetch, unless they were interrupted
+	tagsCache     par.Cache
+	branchesCache par.Cache
+	fetchCache    par.Cache
+}
 
-	fetchOnce sync.Once
-	fetchErr  error
+// Refresh drops cached tags and branches, the remote is fetched again when
+// needed.
+func (r *vcsRepo) Refresh() {
+	r.tagsCache.Clear()
+	r.branchesCache.Clear()
+	r.fetchCache.Clear()
 }
 
-func newVCSRepo(vcs, remote string) (Repo, error) {
+func (h *Host) newVCSRepo(vcs, remote string) (Repo, error) {
 	if vcs == "git" {
-		return newGitRepo(remote, false)
+		return h.newGitRepo(remote, false)
 	}
 	cmd := vcsCmds[vcs]
 	if cmd == nil {
@@ -81,17 +91,17 @@ func newVCSRepo(vcs, remote string) (Repo, error) {
 	if !strings.Contains(remote, "://") {
 		return nil, fmt.Errorf("invalid vcs remote: %s %s", vcs, remote)
 	}
-	r := &vcsRepo{remote: remote, cmd: cmd}
+	r := &vcsRepo{remote: remote, cmd: cmd, env: h.Env()}
 	if cmd.init == nil {
 		return r, nil
 	}
-	dir, err := WorkDir(vcsWorkDirType+vcs, r.remote)
+	dir, err := h.WorkDir(vcsWorkDirType+vcs, r.remote)
 	if err != nil {
 		return nil, err
 	}
 	r.dir = dir
 	if _, err := os.Stat(filepath.Join(dir, "."+vcs)); err != nil {
-		if _, err := Run(dir, cmd.init(r.remote)); err != nil {
+		if _, err := RunEnv(context.Background(), dir, r.env, cmd.init(r.remote)); err != nil {
 			os.RemoveAll(dir)
 			return nil, err
 		}
@@ -160,18 +170,14 @@ var vcsCmds = map[string]*vcsCmd{
 		},
 		tagRE: re(`(?m)^(.*?)/?$`),
 		statLocal: func(rev, remote string) []string {
-			suffix := "@" + rev
-			if rev == "latest" {
-				suffix = ""
-			}
-			return []string{"svn", "log", "-l1", "--xml", remote + suffix}
+			return []string{"svn", "log", "-l1", "--xml", svnURL(remote, rev, "")}
 		},
 		parseStat: svnParseStat,
 		latest:    "latest",
 		readFile: func(rev, file, remote string) []string {
-			return []string{"svn", "cat", remote + "/" + file + "@" + rev}
+			return []string{"svn", "cat", svnURL(remote, rev, file)}
 		},
-		// TODO: zip
+		// zip is made by svnReadZip as svn cannot archive
 	},
 
 	"bzr": {
@@ -234,46 +240,59 @@ var vcsCmds = map[string]*vcsCmd{
 	},
 }
 
-func (r *vcsRepo) loadTags() {
-	out, err := Run(r.dir, r.cmd.tags(r.remote))
-	if err != nil {
-		return
-	}
+func (r *vcsRepo) loadTags(ctx context.Context) map[string]bool {
+	v, _ := r.tagsCache.DoContext(ctx, "", func() interface{} {
+		out, err := RunEnv(ctx, r.dir, r.env, r.cmd.tags(r.remote))
+		if err != nil {
+			return map[string]bool(nil)
+		}
 
-	// Run tag-listing command and extract tags.
-	r.tags = make(map[string]bool)
-	for _, tag := range r.cmd.tagRE.FindAllString(string(out), -1) {
-		if r.cmd.badLocalRevRE != nil && r.cmd.badLocalRevRE.MatchString(tag) {
-			continue
+		// Run tag-listing command and extract tags.
+		tags := make(map[string]bool)
+		for _, tag := range r.cmd.tagRE.FindAllString(string(out), -1) {
+			if r.cmd.badLocalRevRE != nil && r.cmd.badLocalRevRE.MatchString(tag) {
+				continue
+			}
+			tags[tag] = true
 		}
-		r.tags[tag] = true
-	}
+		return tags
+	})
+	res, _ := v.(map[string]bool)
+	return res
 }
 
-func (r *vcsRepo) loadBranches() {
+func (r *vcsRepo) loadBranches(ctx context.Context) map[string]bool {
 	if r.cmd.branches == nil {
-		return
+		return nil
 	}
 
-	out, err := Run(r.dir, r.cmd.branches(r.remote))
-	if err != nil {
-		return
-	}
+	v, _ := r.branchesCache.DoContext(ctx, "", func() interface{} {
+		out, err := RunEnv(ctx, r.dir, r.env, r.cmd.branches(r.remote))
+		if err != nil {
+			return map[string]bool(nil)
+		}
 
-	r.branches = make(map[string]bool)
-	for _, branch := range r.cmd.branchRE.FindAllString(string(out), -1) {
-		if r.cmd.badLocalRevRE != nil && r.cmd.badLocalRevRE.MatchString(branch) {
-			continue
+		branches := make(map[string]bool)
+		for _, branch := range r.cmd.branchRE.FindAllString(string(out), -1) {
+			if r.cmd.badLocalRevRE != nil && r.cmd.badLocalRevRE.MatchString(branch) {
+				continue
+			}
+			branches[branch] = true
 		}
-		r.branches[branch] = true
-	}
+		return branches
+	})
+	res, _ := v.(map[string]bool)
+	return res
 }
 
-func (r *vcsRepo) Tags(prefix string) ([]string, error) {
-	r.tagsOnce.Do(r.loadTags)
+func (r *vcsRepo) Tags(ctx context.Context, prefix string) ([]string, error) {
+	loaded := r.loadTags(ctx)
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 
 	tags := []string{}
-	for tag := range r.tags {
+	for tag := range loaded {
 		if strings.HasPrefix(tag, prefix) {
 			tags = append(tags, tag)
 		}
@@ -282,23 +301,22 @@ func (r *vcsRepo) Tags(prefix string) ([]string, error) {
 	return tags, nil
 }
 
-func (r *vcsRepo) Stat(rev string) (*RevInfo, error) {
+func (r *vcsRepo) Stat(ctx context.Context, rev string) (*RevInfo, error) {
 	if rev == "latest" {
 		rev = r.cmd.latest
 	}
-	r.branchesOnce.Do(r.loadBranches)
-	revOK := (r.cmd.badLocalRevRE == nil || !r.cmd.badLocalRevRE.MatchString(rev)) && !r.branches[rev]
+	branches := r.loadBranches(ctx)
+	revOK := (r.cmd.badLocalRevRE == nil || !r.cmd.badLocalRevRE.MatchString(rev)) && !branches[rev]
 	if revOK {
-		if info, err := r.statLocal(rev); err == nil {
+		if info, err := r.statLocal(ctx, rev); err == nil {
 			return info, nil
 		}
 	}
 
-	r.fetchOnce.Do(r.fetch)
-	if r.fetchErr != nil {
-		return nil, r.fetchErr
+	if err := r.fetch(ctx); err != nil {
+		return nil, err
 	}
-	info, err := r.statLocal(rev)
+	info, err := r.statLocal(ctx, rev)
 	if err != nil {
 		return nil, err
 	}
@@ -308,49 +326,70 @@ func (r *vcsRepo) Stat(rev string) (*RevInfo, error) {
 	return info, nil
 }
 
-func (r *vcsRepo) fetch() {
-	_, r.fetchErr = Run(r.dir, r.cmd.fetch)
+// fetch fetches everything from the remote once, unless the fetch was interrupted.
+func (r *vcsRepo) fetch(ctx context.Context) error {
+	v, err := r.fetchCache.DoContext(ctx, "", func() interface{} {
+		_, err := RunEnv(ctx, r.dir, r.env, r.cmd.fetch)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	err, _ = v.(error)
+	return err
 }
 
-func (r *vcsRepo) statLocal(rev string) (*RevInfo, error) {
-	out, err := Run(r.dir, r.cmd.statLocal(rev, r.remote))
+func (r *vcsRepo) statLocal(ctx context.Context, rev string) (*RevInfo, error) {
+	out, err := RunEnv(ctx, r.dir, r.env, r.cmd.statLocal(rev, r.remote))
 	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
 		return nil, fmt.Errorf("unknown revision %s", rev)
 	}
 	return r.cmd.parseStat(rev, string(out))
 }
 
-func (r *vcsRepo) Latest() (*RevInfo, error) {
-	return r.Stat("latest")
+func (r *vcsRepo) Latest(ctx context.Context) (*RevInfo, error) {
+	return r.Stat(ctx, "latest")
 }
 
-func (r *vcsRepo) ReadFile(rev, file string, maxSize int64) ([]byte, error) {
+func (r *vcsRepo) ReadFile(ctx context.Context, rev, file string, maxSize int64) ([]byte, error) {
 	if rev == "latest" {
 		rev = r.cmd.latest
 	}
-	_, err := r.Stat(rev) // download rev into local repo
+	_, err := r.Stat(ctx, rev) // download rev into local repo
 	if err != nil {
 		return nil, err
 	}
-	out, err := Run(r.dir, r.cmd.readFile(rev, file, r.remote))
+	out, err := RunEnv(ctx, r.dir, r.env, r.cmd.readFile(rev, file, r.remote))
 	if err != nil {
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
 		return nil, os.ErrNotExist
 	}
 	return out, nil
 }
 
-func (r *vcsRepo) ReadFileRevs(revs []string, file string, maxSize int64) (map[string]*FileRev, error) {
+func (r *vcsRepo) ReadFileRevs(ctx context.Context, revs []string, file string, maxSize int64) (map[string]*FileRev, error) {
 	return nil, fmt.Errorf("ReadFileRevs not implemented")
 }
 
-func (r *vcsRepo) RecentTag(rev, prefix string) (tag string, err error) {
+func (r *vcsRepo) RecentTag(ctx context.Context, rev, prefix string) (tag string, err error) {
+	if r.cmd.vcs == "svn" {
+		return r.svnRecentTag(ctx, rev, prefix)
+	}
 	return "", fmt.Errorf("RecentTags not implemented")
 }
 
-func (r *vcsRepo) ReadZip(rev, subdir string, maxSize int64) (zip io.ReadCloser, actualSubdir string, err error) {
+func (r *vcsRepo) ReadZip(ctx context.Context, rev, subdir string, maxSize int64) (zip io.ReadCloser, actualSubdir string, err error) {
 	if rev == "latest" {
 		rev = r.cmd.latest
 	}
+	if r.cmd.vcs == "svn" {
+		return r.svnReadZip(ctx, rev, subdir, maxSize)
+	}
 	f, err := ioutil.TempFile("", "go-readzip-*.zip")
 	if err != nil {
 		return nil, "", err
@@ -367,9 +406,9 @@ func (r *vcsRepo) ReadZip(rev, subdir string, maxSize int64) (zip io.ReadCloser,
 				args[i] = filepath.Join(r.dir, ".fossil")
 			}
 		}
-		_, err = Run(filepath.Dir(f.Name()), args)
+		_, err = RunEnv(ctx, filepath.Dir(f.Name()), r.env, args)
 	} else {
-		_, err = Run(r.dir, r.cmd.readZip(rev, subdir, r.remote, f.Name()))
+		_, err = RunEnv(ctx, r.dir, r.env, r.cmd.readZip(rev, subdir, r.remote, f.Name()))
 	}
 	if err != nil {
 		f.Close()
@@ -444,6 +483,10 @@ func svnParseStat(rev, out string) (*RevInfo, error) {
 		Time:    t.UTC(),
 		Version: rev,
 	}
+	if rev != "latest" && !svnIsRevision(rev) {
+		// rev is a tag
+		info.Tags = []string{rev}
+	}
 	return info, nil
 }
 
@@ -6,6 +6,7 @@ package modfetch
 
 import (
 	"archive/zip"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -81,11 +82,18 @@ func newCodeRepo(code codehost.Repo, root, path string) (Repo, error) {
 	return r, nil
 }
 
+var _ codehost.Refresher = (*codeRepo)(nil)
+
+// Refresh refreshes the underlying code repository, see codehost.Refresher.
+func (r *codeRepo) Refresh() {
+	codehost.Refresh(r.code)
+}
+
 func (r *codeRepo) ModulePath() string {
 	return r.modPath
 }
 
-func (r *codeRepo) Versions(prefix string) ([]string, error) {
+func (r *codeRepo) Versions(ctx context.Context, prefix string) ([]string, error) {
 	// Special case: gopkg.in/macaroon-bakery.v2-unstable
 	// does not use the v2 tags (those are for macaroon-bakery.v2).
 	// It has no possible tags at all.
@@ -97,7 +105,7 @@ func (r *codeRepo) Versions(prefix string) ([]string, error) {
 	if r.codeDir != "" {
 		p = r.codeDir + "/" + p
 	}
-	tags, err := r.code.Tags(p)
+	tags, err := r.code.Tags(ctx, p)
 	if err != nil {
 		return nil, err
 	}
@@ -128,7 +136,7 @@ func (r *codeRepo) Versions(prefix string) ([]string, error) {
 		// Check for later versions that were created not following semantic import versioning,
 		// as indicated by the absence of a go.mod file. Those versions can be addressed
 		// by referring to them with a +incompatible suffix, as in v17.0.0+incompatible.
-		files, err := r.code.ReadFileRevs(incompatible, "go.mod", codehost.MaxGoMod)
+		files, err := r.code.ReadFileRevs(ctx, incompatible, "go.mod", codehost.MaxGoMod)
 		if err != nil {
 			return nil, err
 		}
@@ -144,30 +152,30 @@ func (r *codeRepo) Versions(prefix string) ([]string, error) {
 	return list, nil
 }
 
-func (r *codeRepo) Stat(rev string) (*RevInfo, error) {
+func (r *codeRepo) Stat(ctx context.Context, rev string) (*RevInfo, error) {
 	if rev == "latest" {
-		return r.Latest()
+		return r.Latest(ctx)
 	}
 	codeRev := r.revToRev(rev)
 	if semver.IsValid(codeRev) && r.codeDir != "" {
 		codeRev = r.codeDir + "/" + codeRev
 	}
-	info, err := r.code.Stat(codeRev)
+	info, err := r.code.Stat(ctx, codeRev)
 	if err != nil {
 		return nil, err
 	}
-	return r.convert(info, rev)
+	return r.convert(ctx, info, rev)
 }
 
-func (r *codeRepo) Latest() (*RevInfo, error) {
-	info, err := r.code.Latest()
+func (r *codeRepo) Latest(ctx context.Context) (*RevInfo, error) {
+	info, err := r.code.Latest(ctx)
 	if err != nil {
 		return nil, err
 	}
-	return r.convert(info, "")
+	return r.convert(ctx, info, "")
 }
 
-func (r *codeRepo) convert(info *codehost.RevInfo, statVers string) (*RevInfo, error) {
+func (r *codeRepo) convert(ctx context.Context, info *codehost.RevInfo, statVers string) (*RevInfo, error) {
 	info2 := &RevInfo{
 		Name:  info.Name,
 		Short: info.Short,
@@ -192,7 +200,7 @@ func (r *codeRepo) convert(info *codehost.RevInfo, statVers string) (*RevInfo, e
 		// then allow using the tag with a +incompatible suffix.
 		canUseIncompatible := false
 		if r.codeDir == "" && r.pathMajor == "" {
-			_, errGoMod := r.code.ReadFile(info.Name, "go.mod", codehost.MaxGoMod)
+			_, errGoMod := r.code.ReadFile(ctx, info.Name, "go.mod", codehost.MaxGoMod)
 			if errGoMod != nil {
 				canUseIncompatible = true
 			}
@@ -227,7 +235,7 @@ func (r *codeRepo) convert(info *codehost.RevInfo, statVers string) (*RevInfo, e
 			}
 			// Otherwise make a pseudo-version.
 			if info2.Version == "" {
-				tag, _ := r.code.RecentTag(statVers, p)
+				tag, _ := r.code.RecentTag(ctx, statVers, p)
 				v = tagToVersion(tag)
 				// TODO: Check that v is OK for r.pseudoMajor or else is OK for incompatible.
 				info2.Version = PseudoVersion(r.pseudoMajor, v, info.Time, info.Short)
@@ -238,7 +246,7 @@ func (r *codeRepo) convert(info *codehost.RevInfo, statVers string) (*RevInfo, e
 	// Do not allow a successful stat of a pseudo-version for a subdirectory
 	// unless the subdirectory actually does have a go.mod.
 	if IsPseudoVersion(info2.Version) && r.codeDir != "" {
-		_, _, _, err := r.findDir(info2.Version)
+		_, _, _, err := r.findDir(ctx, info2.Version)
 		if err != nil {
 			// TODO: It would be nice to return an error like "not a module".
 			// Right now we return "missing go.mod", which is a little confusing.
@@ -273,7 +281,7 @@ func (r *codeRepo) versionToRev(version string) (rev string, err error) {
 	return r.revToRev(version), nil
 }
 
-func (r *codeRepo) findDir(version string) (rev, dir string, gomod []byte, err error) {
+func (r *codeRepo) findDir(ctx context.Context, version string) (rev, dir string, gomod []byte, err error) {
 	rev, err = r.versionToRev(version)
 	if err != nil {
 		return "", "", nil, err
@@ -282,7 +290,7 @@ func (r *codeRepo) findDir(version string) (rev, dir string, gomod []byte, err e
 	// Load info about go.mod but delay consideration
 	// (except I/O error) until we rule out v2/go.mod.
 	file1 := path.Join(r.codeDir, "go.mod")
-	gomod1, err1 := r.code.ReadFile(rev, file1, codehost.MaxGoMod)
+	gomod1, err1 := r.code.ReadFile(ctx, rev, file1, codehost.MaxGoMod)
 	if err1 != nil && !os.IsNotExist(err1) {
 		return "", "", nil, fmt.Errorf("reading %s/%s at revision %s: %v", r.pathPrefix, file1, rev, err1)
 	}
@@ -300,7 +308,7 @@ func (r *codeRepo) findDir(version string) (rev, dir string, gomod []byte, err e
 		// a replace directive.
 		dir2 := path.Join(r.codeDir, r.pathMajor[1:])
 		file2 = path.Join(dir2, "go.mod")
-		gomod2, err2 := r.code.ReadFile(rev, file2, codehost.MaxGoMod)
+		gomod2, err2 := r.code.ReadFile(ctx, rev, file2, codehost.MaxGoMod)
 		if err2 != nil && !os.IsNotExist(err2) {
 			return "", "", nil, fmt.Errorf("reading %s/%s at revision %s: %v", r.pathPrefix, file2, rev, err2)
 		}
@@ -374,15 +382,15 @@ func isMajor(mpath, pathMajor string) bool {
 	return strings.HasSuffix(mpath, pathMajor)
 }
 
-func (r *codeRepo) GoMod(version string) (data []byte, err error) {
-	rev, dir, gomod, err := r.findDir(version)
+func (r *codeRepo) GoMod(ctx context.Context, version string) (data []byte, err error) {
+	rev, dir, gomod, err := r.findDir(ctx, version)
 	if err != nil {
 		return nil, err
 	}
 	if gomod != nil {
 		return gomod, nil
 	}
-	data, err = r.code.ReadFile(rev, path.Join(dir, "go.mod"), codehost.MaxGoMod)
+	data, err = r.code.ReadFile(ctx, rev, path.Join(dir, "go.mod"), codehost.MaxGoMod)
 	if err != nil {
 		if os.IsNotExist(err) {
 			return r.legacyGoMod(rev, dir), nil
@@ -407,12 +415,12 @@ func (r *codeRepo) modPrefix(rev string) string {
 	return r.modPath + "@" + rev
 }
 
-func (r *codeRepo) Zip(version string, tmpdir string) (tmpfile string, err error) {
-	rev, dir, _, err := r.findDir(version)
+func (r *codeRepo) Zip(ctx context.Context, version string, tmpdir string) (tmpfile string, err error) {
+	rev, dir, _, err := r.findDir(ctx, version)
 	if err != nil {
 		return "", err
 	}
-	dl, actualDir, err := r.code.ReadZip(rev, dir, codehost.MaxZipFile)
+	dl, actualDir, err := r.code.ReadZip(ctx, rev, dir, codehost.MaxZipFile)
 	if err != nil {
 		return "", err
 	}
@@ -555,7 +563,7 @@ func (r *codeRepo) Zip(version string, tmpdir string) (tmpfile string, err error
 	}
 
 	if !haveLICENSE && subdir != "" {
-		data, err := r.code.ReadFile(rev, "LICENSE", codehost.MaxLICENSE)
+		data, err := r.code.ReadFile(ctx, rev, "LICENSE", codehost.MaxLICENSE)
 		if err == nil {
 			w, err := zw.Create(r.modPrefix(version) + "/LICENSE")
 			if err != nil {
@@ -6,6 +6,7 @@ package modfetch
 
 import (
 	"archive/zip"
+	"context"
 	"github.com/sirkon/goproxy/internal/testenv"
 	"io"
 	"io/ioutil"
@@ -326,6 +327,7 @@ var codeRepoTests = []struct {
 }
 
 func TestCodeRepo(t *testing.T) {
+	ctx := context.Background()
 	testenv.MustHaveExternalNetwork(t)
 
 	tmpdir, err := ioutil.TempDir("", "vgo-modfetch-test-")
@@ -351,7 +353,7 @@ func TestCodeRepo(t *testing.T) {
 			if mpath := repo.ModulePath(); mpath != tt.mpath {
 				t.Errorf("repo.ModulePath() = %q, want %q", mpath, tt.mpath)
 			}
-			info, err := repo.Stat(tt.rev)
+			info, err := repo.Stat(ctx, tt.rev)
 			if err != nil {
 				if tt.err != "" {
 					if !strings.Contains(err.Error(), tt.err) {
@@ -359,10 +361,10 @@ func TestCodeRepo(t *testing.T) {
 					}
 					return
 				}
-				t.Fatalf("repo.Stat(%q): %v", tt.rev, err)
+				t.Fatalf("repo.Stat(ctx, %q): %v", tt.rev, err)
 			}
 			if tt.err != "" {
-				t.Errorf("repo.Stat(%q): success, wanted error", tt.rev)
+				t.Errorf("repo.Stat(ctx, %q): success, wanted error", tt.rev)
 			}
 			if info.Version != tt.version {
 				t.Errorf("info.Version = %q, want %q", info.Version, tt.version)
@@ -377,32 +379,32 @@ func TestCodeRepo(t *testing.T) {
 				t.Errorf("info.Time = %v, want %v", info.Time, tt.time)
 			}
 			if tt.gomod != "" || tt.gomoderr != "" {
-				data, err := repo.GoMod(tt.version)
+				data, err := repo.GoMod(ctx, tt.version)
 				if err != nil && tt.gomoderr == "" {
-					t.Errorf("repo.GoMod(%q): %v", tt.version, err)
+					t.Errorf("repo.GoMod(ctx, %q): %v", tt.version, err)
 				} else if err != nil && tt.gomoderr != "" {
 					if err.Error() != tt.gomoderr {
-						t.Errorf("repo.GoMod(%q): %v, want %q", tt.version, err, tt.gomoderr)
+						t.Errorf("repo.GoMod(ctx, %q): %v, want %q", tt.version, err, tt.gomoderr)
 					}
 				} else if tt.gomoderr != "" {
-					t.Errorf("repo.GoMod(%q) = %q, want error %q", tt.version, data, tt.gomoderr)
+					t.Errorf("repo.GoMod(ctx, %q) = %q, want error %q", tt.version, data, tt.gomoderr)
 				} else if string(data) != tt.gomod {
-					t.Errorf("repo.GoMod(%q) = %q, want %q", tt.version, data, tt.gomod)
+					t.Errorf("repo.GoMod(ctx, %q) = %q, want %q", tt.version, data, tt.gomod)
 				}
 			}
 			if tt.zip != nil || tt.ziperr != "" {
-				zipfile, err := repo.Zip(tt.version, tmpdir)
+				zipfile, err := repo.Zip(ctx, tt.version, tmpdir)
 				if err != nil {
 					if tt.ziperr != "" {
 						if err.Error() == tt.ziperr {
 							return
 						}
-						t.Fatalf("repo.Zip(%q): %v, want error %q", tt.version, err, tt.ziperr)
+						t.Fatalf("repo.Zip(ctx, %q): %v, want error %q", tt.version, err, tt.ziperr)
 					}
-					t.Fatalf("repo.Zip(%q): %v", tt.version, err)
+					t.Fatalf("repo.Zip(ctx, %q): %v", tt.version, err)
 				}
 				if tt.ziperr != "" {
-					t.Errorf("repo.Zip(%q): success, want error %q", tt.version, tt.ziperr)
+					t.Errorf("repo.Zip(ctx, %q): success, want error %q", tt.version, tt.ziperr)
 				}
 				prefix := tt.path + "@" + tt.version + "/"
 				z, err := zip.OpenReader(zipfile)
@@ -514,6 +516,7 @@ var codeRepoVersionsTests = []struct {
 }
 
 func TestCodeRepoVersions(t *testing.T) {
+	ctx := context.Background()
 	testenv.MustHaveExternalNetwork(t)
 
 	tmpdir, err := ioutil.TempDir("", "vgo-modfetch-test-")
@@ -527,7 +530,7 @@ func TestCodeRepoVersions(t *testing.T) {
 			if err != nil {
 				t.Fatalf("Lookup(%q): %v", tt.path, err)
 			}
-			list, err := repo.Versions(tt.prefix)
+			list, err := repo.Versions(ctx, tt.prefix)
 			if err != nil {
 				t.Fatalf("Versions(%q): %v", tt.prefix, err)
 			}
@@ -562,6 +565,7 @@ var latestTests = []struct {
 }
 
 func TestLatest(t *testing.T) {
+	ctx := context.Background()
 	testenv.MustHaveExternalNetwork(t)
 
 	tmpdir, err := ioutil.TempDir("", "vgo-modfetch-test-")
@@ -576,7 +580,7 @@ func TestLatest(t *testing.T) {
 			if err != nil {
 				t.Fatalf("Lookup(%q): %v", tt.path, err)
 			}
-			info, err := repo.Latest()
+			info, err := repo.Latest(ctx)
 			if err != nil {
 				if tt.err != "" {
 					if err.Error() == tt.err {
@@ -601,21 +605,28 @@ type fixedTagsRepo struct {
 	tags []string
 }
 
-func (ch *fixedTagsRepo) Tags(string) ([]string, error)                  { return ch.tags, nil }
-func (ch *fixedTagsRepo) Latest() (*codehost.RevInfo, error)             { panic("not impl") }
-func (ch *fixedTagsRepo) ReadFile(string, string, int64) ([]byte, error) { panic("not impl") }
-func (ch *fixedTagsRepo) ReadFileRevs([]string, string, int64) (map[string]*codehost.FileRev, error) {
+func (ch *fixedTagsRepo) Tags(context.Context, string) ([]string, error) { return ch.tags, nil }
+func (ch *fixedTagsRepo) Latest(context.Context) (*codehost.RevInfo, error) {
 	panic("not impl")
 }
-func (ch *fixedTagsRepo) ReadZip(string, string, int64) (io.ReadCloser, string, error) {
+func (ch *fixedTagsRepo) ReadFile(context.Context, string, string, int64) ([]byte, error) {
 	panic("not impl")
 }
-func (ch *fixedTagsRepo) RecentTag(string, string) (string, error) {
+func (ch *fixedTagsRepo) ReadFileRevs(context.Context, []string, string, int64) (map[string]*codehost.FileRev, error) {
+	panic("not impl")
+}
+func (ch *fixedTagsRepo) ReadZip(context.Context, string, string, int64) (io.ReadCloser, string, error) {
+	panic("not impl")
+}
+func (ch *fixedTagsRepo) RecentTag(context.Context, string, string) (string, error) {
+	panic("not impl")
+}
+func (ch *fixedTagsRepo) Stat(context.Context, string) (*codehost.RevInfo, error) {
 	panic("not impl")
 }
-func (ch *fixedTagsRepo) Stat(string) (*codehost.RevInfo, error) { panic("not impl") }
 
 func TestNonCanonicalSemver(t *testing.T) {
+	ctx := context.Background()
 	root := "golang.org/x/issue24476"
 	ch := &fixedTagsRepo{
 		tags: []string{
@@ -633,7 +644,7 @@ func TestNonCanonicalSemver(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	v, err := cr.Versions("")
+	v, err := cr.Versions(ctx, "")
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -7,6 +7,7 @@ package modfetch
 import (
 	"archive/zip"
 	"bytes"
+	"context"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -108,7 +109,7 @@ func downloadZip(mod module.Version, target string) error {
 	if err != nil {
 		return err
 	}
-	tmpfile, err := repo.Zip(mod.Version, os.TempDir())
+	tmpfile, err := repo.Zip(context.Background(), mod.Version, os.TempDir())
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,100 @@
+package modfetch
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/sirkon/goproxy/internal/dirhash"
+	"github.com/sirkon/goproxy/internal/modfetch/codehost"
+	"github.com/sirkon/goproxy/internal/module"
+	"github.com/sirkon/goproxy/internal/par"
+)
+
+// A Fetcher looks up module repositories keeping downloaded data in its own
+// module cache and code hosting work directories instead of the ones set by
+// PkgMod and codehost.WorkRoot package variables, so independent fetchers
+// can coexist in a single process. Package level functions use the default
+// fetcher which honors these variables.
+type Fetcher struct {
+	pkgMod string
+	quiet  bool
+	host   *codehost.Host
+	global bool // use PkgMod, QuietLookup and the default code host
+
+	lookupCache par.Cache
+}
+
+// NewFetcher returns a fetcher with module cache at pkgMod and code hosting
+// work directories at pkgMod/cache/vcs, just like the go command does for
+// $GOPATH/pkg/mod. The fetcher doesn't report lookups to stderr.
+func NewFetcher(pkgMod string) *Fetcher {
+	return NewFetcherHost(pkgMod, codehost.NewHost(filepath.Join(pkgMod, "cache", "vcs")))
+}
+
+// NewFetcherHost returns a fetcher with module cache at pkgMod using the given
+// code host. The fetcher doesn't report lookups to stderr.
+func NewFetcherHost(pkgMod string, host *codehost.Host) *Fetcher {
+	return &Fetcher{
+		pkgMod: pkgMod,
+		quiet:  true,
+		host:   host,
+	}
+}
+
+var defaultFetcher = &Fetcher{global: true}
+
+// PkgMod returns module cache root of the fetcher.
+func (f *Fetcher) PkgMod() string {
+	if f.global {
+		return PkgMod
+	}
+	return f.pkgMod
+}
+
+// Host returns code host of the fetcher.
+func (f *Fetcher) Host() *codehost.Host {
+	if f.global {
+		return codehost.DefaultHost()
+	}
+	return f.host
+}
+
+func (f *Fetcher) quietLookup() bool {
+	if f.global {
+		return QuietLookup
+	}
+	return f.quiet
+}
+
+// ZipFile returns the name of the zip file of the module version in the
+// download cache of the fetcher. The file may not exist.
+func (f *Fetcher) ZipFile(mod module.Version) (string, error) {
+	return cachePath(f.PkgMod(), mod, "zip")
+}
+
+// InstallZip moves the zip file made by Repo.Zip into the download cache
+// of the fetcher along with its hash, just like the go command keeps it,
+// and returns its new name. tmpfile must be on the same file system as
+// the cache.
+func (f *Fetcher) InstallZip(mod module.Version, tmpfile string) (string, error) {
+	zipfile, err := f.ZipFile(mod)
+	if err != nil {
+		return "", err
+	}
+	hash, err := dirhash.HashZip(tmpfile, dirhash.DefaultHash)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(zipfile), 0777); err != nil {
+		return "", err
+	}
+	// The hash goes first: once the zip file is there it is used as is.
+	if err := ioutil.WriteFile(zipfile+"hash", []byte(hash), 0666); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmpfile, zipfile); err != nil {
+		return "", err
+	}
+	return zipfile, nil
+}
@@ -0,0 +1,63 @@
+package modfetch
+
+import (
+	"archive/zip"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/sirkon/goproxy/internal/module"
+)
+
+func TestFetcherInstallZip(t *testing.T) {
+	tmpdir, err := ioutil.TempDir("", "go-installZip-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmpdir)
+
+	tmpfile := filepath.Join(tmpdir, "tmp.zip")
+	f, err := os.Create(tmpfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	w, err := zw.Create("example.com/Repo@v1.0.0/go.mod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("module example.com/Repo\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	fetcher := NewFetcher(filepath.Join(tmpdir, "pkg", "mod"))
+	mod := module.Version{Path: "example.com/Repo", Version: "v1.0.0"}
+	zipfile, err := fetcher.InstallZip(mod, tmpfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := filepath.Join(tmpdir, "pkg", "mod", "cache", "download", "example.com", "!repo", "@v", "v1.0.0.zip")
+	if zipfile != want {
+		t.Errorf("InstallZip: have %s, want %s", zipfile, want)
+	}
+	if name, err := fetcher.ZipFile(mod); err != nil || name != want {
+		t.Errorf("ZipFile: have %s, %v, want %s", name, err, want)
+	}
+	if _, err := os.Stat(tmpfile); !os.IsNotExist(err) {
+		t.Errorf("temporary file must be moved, got %v", err)
+	}
+	hash, err := ioutil.ReadFile(zipfile + "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(hash) == 0 {
+		t.Errorf("empty zip hash")
+	}
+}
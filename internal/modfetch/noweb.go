@@ -7,6 +7,7 @@
 package modfetch
 
 import (
+	"context"
 	"fmt"
 	"io"
 )
@@ -15,10 +16,10 @@ func webGetGoGet(url string, body *io.ReadCloser) error {
 	return fmt.Errorf("no network in go_bootstrap")
 }
 
-func webGetBytes(url string, body *[]byte) error {
+func webGetBytes(ctx context.Context, url string, body *[]byte) error {
 	return fmt.Errorf("no network in go_bootstrap")
 }
 
-func webGetBody(url string, body *io.ReadCloser) error {
+func webGetBody(ctx context.Context, url string, body *io.ReadCloser) error {
 	return fmt.Errorf("no network in go_bootstrap")
 }
@@ -5,6 +5,7 @@
 package modfetch
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -117,9 +118,9 @@ func (p *proxyRepo) ModulePath() string {
 	return p.path
 }
 
-func (p *proxyRepo) Versions(prefix string) ([]string, error) {
+func (p *proxyRepo) Versions(ctx context.Context, prefix string) ([]string, error) {
 	var data []byte
-	err := webGetBytes(p.url+"/@v/list", &data)
+	err := webGetBytes(ctx, p.url+"/@v/list", &data)
 	if err != nil {
 		return nil, err
 	}
@@ -134,9 +135,9 @@ func (p *proxyRepo) Versions(prefix string) ([]string, error) {
 	return list, nil
 }
 
-func (p *proxyRepo) latest() (*RevInfo, error) {
+func (p *proxyRepo) latest(ctx context.Context) (*RevInfo, error) {
 	var data []byte
-	err := webGetBytes(p.url+"/@v/list", &data)
+	err := webGetBytes(ctx, p.url+"/@v/list", &data)
 	if err != nil {
 		return nil, err
 	}
@@ -164,13 +165,13 @@ func (p *proxyRepo) latest() (*RevInfo, error) {
 	return info, nil
 }
 
-func (p *proxyRepo) Stat(rev string) (*RevInfo, error) {
+func (p *proxyRepo) Stat(ctx context.Context, rev string) (*RevInfo, error) {
 	var data []byte
 	encRev, err := module.EncodeVersion(rev)
 	if err != nil {
 		return nil, err
 	}
-	err = webGetBytes(p.url+"/@v/"+pathEscape(encRev)+".info", &data)
+	err = webGetBytes(ctx, p.url+"/@v/"+pathEscape(encRev)+".info", &data)
 	if err != nil {
 		return nil, err
 	}
@@ -181,13 +182,13 @@ func (p *proxyRepo) Stat(rev string) (*RevInfo, error) {
 	return info, nil
 }
 
-func (p *proxyRepo) Latest() (*RevInfo, error) {
+func (p *proxyRepo) Latest(ctx context.Context) (*RevInfo, error) {
 	var data []byte
 	u := p.url + "/@latest"
-	err := webGetBytes(u, &data)
+	err := webGetBytes(ctx, u, &data)
 	if err != nil {
 		// TODO return err if not 404
-		return p.latest()
+		return p.latest(ctx)
 	}
 	info := new(RevInfo)
 	if err := json.Unmarshal(data, info); err != nil {
@@ -196,26 +197,26 @@ func (p *proxyRepo) Latest() (*RevInfo, error) {
 	return info, nil
 }
 
-func (p *proxyRepo) GoMod(version string) ([]byte, error) {
+func (p *proxyRepo) GoMod(ctx context.Context, version string) ([]byte, error) {
 	var data []byte
 	encVer, err := module.EncodeVersion(version)
 	if err != nil {
 		return nil, err
 	}
-	err = webGetBytes(p.url+"/@v/"+pathEscape(encVer)+".mod", &data)
+	err = webGetBytes(ctx, p.url+"/@v/"+pathEscape(encVer)+".mod", &data)
 	if err != nil {
 		return nil, err
 	}
 	return data, nil
 }
 
-func (p *proxyRepo) Zip(version string, tmpdir string) (tmpfile string, err error) {
+func (p *proxyRepo) Zip(ctx context.Context, version string, tmpdir string) (tmpfile string, err error) {
 	var body io.ReadCloser
 	encVer, err := module.EncodeVersion(version)
 	if err != nil {
 		return "", err
 	}
-	err = webGetBody(p.url+"/@v/"+pathEscape(encVer)+".zip", &body)
+	err = webGetBody(ctx, p.url+"/@v/"+pathEscape(encVer)+".zip", &body)
 	if err != nil {
 		return "", err
 	}
@@ -5,6 +5,7 @@
 package modfetch
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"sort"
@@ -13,7 +14,6 @@ import (
 	"github.com/sirkon/goproxy/internal/cfg"
 	"github.com/sirkon/goproxy/internal/get"
 	"github.com/sirkon/goproxy/internal/modfetch/codehost"
-	"github.com/sirkon/goproxy/internal/par"
 	"github.com/sirkon/goproxy/internal/semver"
 	web "github.com/sirkon/goproxy/internal/web"
 )
@@ -22,6 +22,7 @@ const traceRepo = false // trace all repo actions, for debugging
 
 // A Repo represents a repository storing all versions of a single module.
 // It must be safe for simultaneous use by multiple goroutines.
+// Work done on behalf of a call is abandoned when its ctx is done.
 type Repo interface {
 	// ModulePath returns the module path.
 	ModulePath() string
@@ -30,26 +31,26 @@ type Repo interface {
 	// pseudo-versions are not included.
 	// Versions should be returned sorted in semver order
 	// (implementations can use SortVersions).
-	Versions(prefix string) (tags []string, err error)
+	Versions(ctx context.Context, prefix string) (tags []string, err error)
 
 	// Stat returns information about the revision rev.
 	// A revision can be any identifier known to the underlying service:
 	// commit hash, branch, tag, and so on.
-	Stat(rev string) (*RevInfo, error)
+	Stat(ctx context.Context, rev string) (*RevInfo, error)
 
 	// Latest returns the latest revision on the default branch,
 	// whatever that means in the underlying source code repository.
 	// It is only used when there are no tagged versions.
-	Latest() (*RevInfo, error)
+	Latest(ctx context.Context) (*RevInfo, error)
 
 	// GoMod returns the go.mod file for the given version.
-	GoMod(version string) (data []byte, err error)
+	GoMod(ctx context.Context, version string) (data []byte, err error)
 
 	// Zip downloads a zip file for the given version
 	// to a new file in a given temporary directory.
 	// It returns the name of the new file.
 	// The caller should remove the file when finished with it.
-	Zip(version, tmpdir string) (tmpfile string, err error)
+	Zip(ctx context.Context, version, tmpdir string) (tmpfile string, err error)
 }
 
 // A Rev describes a single revision in a module repository.
@@ -176,12 +177,17 @@ type RevInfo struct {
 // at either package or repository granularity, and most of the time they
 // recorded commit hashes, not tagged versions.
 
-var lookupCache par.Cache
-
 // Lookup returns the module with the given module path.
 // A successful return does not guarantee that the module
 // has any defined versions.
 func Lookup(path string) (Repo, error) {
+	return defaultFetcher.Lookup(path)
+}
+
+// Lookup returns the module of the fetcher with the given module path.
+// A successful return does not guarantee that the module
+// has any defined versions.
+func (f *Fetcher) Lookup(path string) (Repo, error) {
 	if traceRepo {
 		defer logCall("Lookup(%q)", path)()
 	}
@@ -190,13 +196,47 @@ func Lookup(path string) (Repo, error) {
 		r   Repo
 		err error
 	}
-	c := lookupCache.Do(path, func() interface{} {
-		r, err := lookup(path)
+	c := f.lookupCache.Do(path, func() interface{} {
+		r, err := f.lookup(path)
+		if err == nil {
+			if traceRepo {
+				r = newLoggingRepo(r)
+			}
+			r = newCachingRepo(f, r)
+		}
+		return cached{r, err}
+	}).(cached)
+
+	return c.r, c.err
+}
+
+// LookupRemote returns the module of the fetcher with the given module path
+// kept in the repository of the version control system vcs at remote.
+// root is the module path corresponding to the root of the repository.
+// Unlike Lookup, it doesn't discover the repository with go-get meta tags.
+func (f *Fetcher) LookupRemote(path, root, vcs, remote string) (Repo, error) {
+	if traceRepo {
+		defer logCall("LookupRemote(%q, %q, %q, %q)", path, root, vcs, remote)()
+	}
+
+	type key struct {
+		path, root, vcs, remote string
+	}
+	type cached struct {
+		r   Repo
+		err error
+	}
+	c := f.lookupCache.Do(key{path, root, vcs, remote}, func() interface{} {
+		code, err := f.lookupCodeRepo(&get.RepoRoot{Repo: remote, Root: root, VCS: vcs})
+		if err != nil {
+			return cached{nil, err}
+		}
+		r, err := newCodeRepo(code, root, path)
 		if err == nil {
 			if traceRepo {
 				r = newLoggingRepo(r)
 			}
-			r = newCachingRepo(r)
+			r = newCachingRepo(f, r)
 		}
 		return cached{r, err}
 	}).(cached)
@@ -205,7 +245,7 @@ func Lookup(path string) (Repo, error) {
 }
 
 // lookup returns the module with the given module path.
-func lookup(path string) (r Repo, err error) {
+func (f *Fetcher) lookup(path string) (r Repo, err error) {
 	if cfg.BuildMod == "vendor" {
 		return nil, fmt.Errorf("module lookup disabled by -mod=%s", cfg.BuildMod)
 	}
@@ -231,15 +271,15 @@ func lookup(path string) (r Repo, err error) {
 		return newProxyRepo(rr.Repo, path)
 	}
 
-	code, err := lookupCodeRepo(rr)
+	code, err := f.lookupCodeRepo(rr)
 	if err != nil {
 		return nil, err
 	}
 	return newCodeRepo(code, rr.Root, path)
 }
 
-func lookupCodeRepo(rr *get.RepoRoot) (codehost.Repo, error) {
-	code, err := codehost.NewRepo(rr.VCS, rr.Repo)
+func (f *Fetcher) lookupCodeRepo(rr *get.RepoRoot) (codehost.Repo, error) {
+	code, err := f.Host().NewRepo(rr.VCS, rr.Repo)
 	if err != nil {
 		if _, ok := err.(*codehost.VCSError); ok {
 			return nil, err
@@ -270,12 +310,13 @@ func ImportRepoRev(path, rev string) (Repo, *RevInfo, error) {
 		return nil, nil, err
 	}
 
-	code, err := lookupCodeRepo(rr)
+	code, err := defaultFetcher.lookupCodeRepo(rr)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	revInfo, err := code.Stat(rev)
+	ctx := context.Background()
+	revInfo, err := code.Stat(ctx, rev)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -289,7 +330,7 @@ func ImportRepoRev(path, rev string) (Repo, *RevInfo, error) {
 		return nil, nil, err
 	}
 
-	info, err := repo.(*codeRepo).convert(revInfo, "")
+	info, err := repo.(*codeRepo).convert(ctx, revInfo, "")
 	if err != nil {
 		return nil, nil, err
 	}
@@ -337,27 +378,27 @@ func (l *loggingRepo) ModulePath() string {
 	return l.r.ModulePath()
 }
 
-func (l *loggingRepo) Versions(prefix string) (tags []string, err error) {
+func (l *loggingRepo) Versions(ctx context.Context, prefix string) (tags []string, err error) {
 	defer logCall("Repo[%s]: Versions(%q)", l.r.ModulePath(), prefix)()
-	return l.r.Versions(prefix)
+	return l.r.Versions(ctx, prefix)
 }
 
-func (l *loggingRepo) Stat(rev string) (*RevInfo, error) {
+func (l *loggingRepo) Stat(ctx context.Context, rev string) (*RevInfo, error) {
 	defer logCall("Repo[%s]: Stat(%q)", l.r.ModulePath(), rev)()
-	return l.r.Stat(rev)
+	return l.r.Stat(ctx, rev)
 }
 
-func (l *loggingRepo) Latest() (*RevInfo, error) {
+func (l *loggingRepo) Latest(ctx context.Context) (*RevInfo, error) {
 	defer logCall("Repo[%s]: Latest()", l.r.ModulePath())()
-	return l.r.Latest()
+	return l.r.Latest(ctx)
 }
 
-func (l *loggingRepo) GoMod(version string) ([]byte, error) {
+func (l *loggingRepo) GoMod(ctx context.Context, version string) ([]byte, error) {
 	defer logCall("Repo[%s]: GoMod(%q)", l.r.ModulePath(), version)()
-	return l.r.GoMod(version)
+	return l.r.GoMod(ctx, version)
 }
 
-func (l *loggingRepo) Zip(version, tmpdir string) (string, error) {
+func (l *loggingRepo) Zip(ctx context.Context, version, tmpdir string) (string, error) {
 	defer logCall("Repo[%s]: Zip(%q, %q)", l.r.ModulePath(), version, tmpdir)()
-	return l.r.Zip(version, tmpdir)
+	return l.r.Zip(ctx, version, tmpdir)
 }
@@ -7,6 +7,7 @@
 package modfetch
 
 import (
+	"context"
 	"io"
 
 	web "github.com/sirkon/goproxy/internal/web2"
@@ -20,12 +21,12 @@ func webGetGoGet(url string, body *io.ReadCloser) error {
 
 // webGetBytes returns the body returned by an HTTP GET, as a []byte.
 // It insists on a 200 response.
-func webGetBytes(url string, body *[]byte) error {
-	return web.Get(url, web.ReadAllBody(body))
+func webGetBytes(ctx context.Context, url string, body *[]byte) error {
+	return web.Get(url, web.Context(ctx), web.ReadAllBody(body))
 }
 
 // webGetBody returns the body returned by an HTTP GET, as a io.ReadCloser.
 // It insists on a 200 response.
-func webGetBody(url string, body *io.ReadCloser) error {
-	return web.Get(url, web.Body(body))
+func webGetBody(ctx context.Context, url string, body *io.ReadCloser) error {
+	return web.Get(url, web.Context(ctx), web.Body(body))
 }
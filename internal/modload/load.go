@@ -6,6 +6,7 @@ package modload
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"go/build"
@@ -1015,7 +1016,7 @@ func versions(path string) ([]string, error) {
 	if err != nil {
 		return nil, err
 	}
-	return repo.Versions("")
+	return repo.Versions(context.TODO(), "")
 }
 
 // Previous returns the tagged version of m.Path immediately prior to
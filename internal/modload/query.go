@@ -5,6 +5,7 @@
 package modload
 
 import (
+	"context"
 	"github.com/sirkon/goproxy/internal/modfetch"
 	"github.com/sirkon/goproxy/internal/modfetch/codehost"
 	"github.com/sirkon/goproxy/internal/module"
@@ -136,7 +137,8 @@ func Query(path, query string, allowed func(module.Version) bool) (*modfetch.Rev
 	if err != nil {
 		return nil, err
 	}
-	versions, err := repo.Versions(prefix)
+	ctx := context.TODO()
+	versions, err := repo.Versions(ctx, prefix)
 	if err != nil {
 		return nil, err
 	}
@@ -144,25 +146,25 @@ func Query(path, query string, allowed func(module.Version) bool) (*modfetch.Rev
 	if preferOlder {
 		for _, v := range versions {
 			if semver.Prerelease(v) == "" && ok(module.Version{Path: path, Version: v}) {
-				return repo.Stat(v)
+				return repo.Stat(ctx, v)
 			}
 		}
 		for _, v := range versions {
 			if semver.Prerelease(v) != "" && ok(module.Version{Path: path, Version: v}) {
-				return repo.Stat(v)
+				return repo.Stat(ctx, v)
 			}
 		}
 	} else {
 		for i := len(versions) - 1; i >= 0; i-- {
 			v := versions[i]
 			if semver.Prerelease(v) == "" && ok(module.Version{Path: path, Version: v}) {
-				return repo.Stat(v)
+				return repo.Stat(ctx, v)
 			}
 		}
 		for i := len(versions) - 1; i >= 0; i-- {
 			v := versions[i]
 			if semver.Prerelease(v) != "" && ok(module.Version{Path: path, Version: v}) {
-				return repo.Stat(v)
+				return repo.Stat(ctx, v)
 			}
 		}
 	}
@@ -170,7 +172,7 @@ func Query(path, query string, allowed func(module.Version) bool) (*modfetch.Rev
 	if query == "latest" {
 		// Special case for "latest": if no tags match, use latest commit in repo,
 		// provided it is not excluded.
-		if info, err := repo.Latest(); err == nil && allowed(module.Version{Path: path, Version: info.Version}) {
+		if info, err := repo.Latest(ctx); err == nil && allowed(module.Version{Path: path, Version: info.Version}) {
 			return info, nil
 		}
 	}
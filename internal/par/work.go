@@ -6,6 +6,7 @@
 package par
 
 import (
+	"context"
 	"math/rand"
 	"sync"
 	"sync/atomic"
@@ -108,29 +109,82 @@ type Cache struct {
 }
 
 type cacheEntry struct {
-	done   uint32
-	mu     sync.Mutex
-	result interface{}
+	started   uint32
+	ready     chan struct{} // closed once result is set
+	result    interface{}
+	cancelled bool // result was computed under a context which was done by then
+}
+
+// entry returns the entry for key, it is created if there is none.
+func (c *Cache) entry(key interface{}) *cacheEntry {
+	entryIface, ok := c.m.Load(key)
+	if !ok {
+		entryIface, _ = c.m.LoadOrStore(key, &cacheEntry{ready: make(chan struct{})})
+	}
+	return entryIface.(*cacheEntry)
 }
 
 // Do calls the function f if and only if Do is being called for the first time with this key.
 // No call to Do with a given key returns until the one call to f returns.
 // Do returns the value returned by the one call to f.
 func (c *Cache) Do(key interface{}, f func() interface{}) interface{} {
-	entryIface, ok := c.m.Load(key)
-	if !ok {
-		entryIface, _ = c.m.LoadOrStore(key, new(cacheEntry))
+	e := c.entry(key)
+	if atomic.CompareAndSwapUint32(&e.started, 0, 1) {
+		e.result = f()
+		close(e.ready)
+	} else {
+		<-e.ready
 	}
-	e := entryIface.(*cacheEntry)
-	if atomic.LoadUint32(&e.done) == 0 {
-		e.mu.Lock()
-		if atomic.LoadUint32(&e.done) == 0 {
+	return e.result
+}
+
+// DoContext is like Do, but the result of f computed by a caller whose ctx
+// was done by the time f returned is not kept: other callers waiting for it
+// run f again with their own contexts instead of getting an error caused by
+// somebody else's cancellation. f is expected to use ctx.
+// Callers waiting for the result computed by another call stop waiting once
+// their ctx is done, ctx.Err() is returned then.
+func (c *Cache) DoContext(ctx context.Context, key interface{}, f func() interface{}) (interface{}, error) {
+	for {
+		e := c.entry(key)
+		if atomic.CompareAndSwapUint32(&e.started, 0, 1) {
 			e.result = f()
-			atomic.StoreUint32(&e.done, 1)
+			e.cancelled = ctx.Err() != nil
+			close(e.ready)
+			if e.cancelled {
+				c.m.CompareAndDelete(key, e)
+			}
+			// the caller gets the result of its own f, cancelled or not
+			return e.result, nil
+		}
+
+		// the result which is there already is preferred to ctx.Done
+		select {
+		case <-e.ready:
+		default:
+			select {
+			case <-e.ready:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		if !e.cancelled {
+			return e.result, nil
+		}
+		c.m.CompareAndDelete(key, e)
+		if err := ctx.Err(); err != nil {
+			return nil, err
 		}
-		e.mu.Unlock()
 	}
-	return e.result
+}
+
+// Clear drops all cached results, they are computed again by the next calls of Do.
+// Calls in progress are not affected.
+func (c *Cache) Clear() {
+	c.m.Range(func(key, _ interface{}) bool {
+		c.m.Delete(key)
+		return true
+	})
 }
 
 // Get returns the cached result associated with key.
@@ -142,8 +196,10 @@ func (c *Cache) Get(key interface{}) interface{} {
 		return nil
 	}
 	e := entryIface.(*cacheEntry)
-	if atomic.LoadUint32(&e.done) == 0 {
+	select {
+	case <-e.ready:
+		return e.result
+	default:
 		return nil
 	}
-	return e.result
 }
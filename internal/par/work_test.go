@@ -5,6 +5,7 @@
 package par
 
 import (
+	"context"
 	"sync/atomic"
 	"testing"
 	"time"
@@ -75,3 +76,52 @@ func TestCache(t *testing.T) {
 		t.Fatalf("cache.Do(1) did not returned saved value from original cache.Do(1)")
 	}
 }
+
+func TestCacheDoContext(t *testing.T) {
+	var cache Cache
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	v, err := cache.DoContext(ctx, 1, func() interface{} { return "cancelled" })
+	if v != "cancelled" || err != nil {
+		t.Fatalf("cache.DoContext(1) did not run f")
+	}
+	v, _ = cache.DoContext(context.Background(), 1, func() interface{} { return "done" })
+	if v != "done" {
+		t.Fatalf("cache.DoContext(1) kept result computed under cancelled context")
+	}
+	v, _ = cache.DoContext(context.Background(), 1, func() interface{} { return "again" })
+	if v != "done" {
+		t.Fatalf("cache.DoContext(1) ran f again!")
+	}
+	v, err = cache.DoContext(ctx, 1, func() interface{} { return "again" })
+	if v != "done" || err != nil {
+		t.Fatalf("cache.DoContext(1) did not return saved value for cancelled context")
+	}
+}
+
+func TestCacheDoContextWaiter(t *testing.T) {
+	var cache Cache
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	go cache.DoContext(context.Background(), 1, func() interface{} {
+		close(started)
+		<-release
+		return "slow"
+	})
+	<-started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	v, err := cache.DoContext(ctx, 1, func() interface{} { return "again" })
+	if v != nil || err != context.DeadlineExceeded {
+		t.Fatalf("cache.DoContext(1) = %v, %v, waiter did not stop on its own context", v, err)
+	}
+
+	close(release)
+	v, err = cache.DoContext(context.Background(), 1, func() interface{} { return "again" })
+	if v != "slow" || err != nil {
+		t.Fatalf("cache.DoContext(1) = %v, %v, want slow", v, err)
+	}
+}
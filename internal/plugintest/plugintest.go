@@ -0,0 +1,167 @@
+// Package plugintest provides stub upstreams and caches for tests of plugins
+package plugintest
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sirkon/goproxy"
+)
+
+// Plugin upstream serving any module with the same versions. The master revision is resolved to Master. Zips of
+// versions having Files are archives of these files, other zips are placeholders which are not archives
+type Plugin struct {
+	Versions []string
+	Master   string
+	Files    map[string]map[string]string
+}
+
+// Module returns the module of the request
+func (p *Plugin) Module(req *http.Request, prefix string) (goproxy.Module, error) {
+	path, _, err := goproxy.GetModInfo(req, prefix)
+	if err != nil {
+		return nil, err
+	}
+	return &module{path: path, plugin: p}, nil
+}
+
+// Leave does nothing
+func (p *Plugin) Leave(source goproxy.Module) error { return nil }
+
+// Close does nothing
+func (p *Plugin) Close() error { return nil }
+
+func (p *Plugin) String() string { return "upstream" }
+
+type module struct {
+	path   string
+	plugin *Plugin
+}
+
+func (m *module) ModulePath() string {
+	return m.path
+}
+
+func (m *module) Versions(ctx context.Context, prefix string) ([]string, error) {
+	var res []string
+	for _, version := range m.plugin.Versions {
+		if strings.HasPrefix(version, prefix) {
+			res = append(res, version)
+		}
+	}
+	return res, nil
+}
+
+func (m *module) Stat(ctx context.Context, rev string) (*goproxy.RevInfo, error) {
+	if rev == "master" && len(m.plugin.Master) > 0 {
+		rev = m.plugin.Master
+	}
+	return &goproxy.RevInfo{Version: rev}, nil
+}
+
+func (m *module) GoMod(ctx context.Context, version string) ([]byte, error) {
+	return []byte("module " + m.path + "\n"), nil
+}
+
+func (m *module) Zip(ctx context.Context, version string) (io.ReadCloser, error) {
+	files, ok := m.plugin.Files[version]
+	if !ok {
+		return ioutil.NopCloser(strings.NewReader("zip")), nil
+	}
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for name, content := range files {
+		w, err := archive.Create(m.path + "@" + version + "/" + name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(w, content); err != nil {
+			return nil, err
+		}
+	}
+	if err := archive.Close(); err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(&buf), nil
+}
+
+// GetModule returns the module with the path of the plugin
+func GetModule(t *testing.T, p goproxy.Plugin, path string) goproxy.Module {
+	t.Helper()
+	mod, err := p.Module(httptest.NewRequest("GET", "/"+path+"/@v/list", nil), "")
+	require.NoError(t, err)
+	return mod
+}
+
+// Cache cache keeping items in memory
+type Cache struct {
+	lock  sync.Mutex
+	items map[string][]byte
+}
+
+// NewCache creates an empty cache
+func NewCache() *Cache {
+	return &Cache{items: map[string][]byte{}}
+}
+
+// Get returns the item, the error satisfies os.IsNotExist if there is no such item
+func (c *Cache) Get(name string) (io.ReadCloser, error) {
+	data, ok := c.Item(name)
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+// Set sets the item
+func (c *Cache) Set(name string, data io.Reader) error {
+	res, err := ioutil.ReadAll(data)
+	if err != nil {
+		return err
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.items[name] = res
+	return nil
+}
+
+// Item returns the content of the item
+func (c *Cache) Item(name string) ([]byte, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	data, ok := c.items[name]
+	return data, ok
+}
+
+// Len returns the number of items
+func (c *Cache) Len() int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return len(c.items)
+}
+
+// WriteVersion writes .info, .mod and .zip files of the version of example.com/lib into dir, the way they are kept
+// in a module cache
+func WriteVersion(t *testing.T, dir, version string) {
+	t.Helper()
+	files := map[string]string{
+		version + ".info": `{"Version":"` + version + `","Time":"2019-01-02T03:04:05Z"}`,
+		version + ".mod":  "module example.com/lib\n",
+		version + ".zip":  "zip " + version,
+	}
+	for name, content := range files {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+}
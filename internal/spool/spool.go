@@ -0,0 +1,70 @@
+// Package spool keeps data which may be too large for memory, like module zips, in temporary files
+package spool
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/sirkon/goproxy/internal/errors"
+)
+
+// File temporary file holding spooled data, it is removed on Close
+type File struct {
+	*os.File
+	size int64
+}
+
+// New copies src into a temporary file in dir, the default directory for temporary files is used with empty dir.
+// The file is positioned at the start of the data
+func New(dir string, src io.Reader) (*File, error) {
+	res, err := Create(dir)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(res, src); err != nil {
+		_ = res.Close()
+		return nil, errors.Wrap(err, "spool copying data")
+	}
+	if err := res.Rewind(); err != nil {
+		_ = res.Close()
+		return nil, err
+	}
+	return res, nil
+}
+
+// Create creates an empty temporary file in dir to write data into, call Rewind to read them then
+func Create(dir string) (*File, error) {
+	f, err := ioutil.TempFile(dir, "goproxy-spool-")
+	if err != nil {
+		return nil, errors.Wrap(err, "spool creating temporary file")
+	}
+	return &File{File: f}, nil
+}
+
+// Rewind positions the file at the start of the data written so far
+func (f *File) Rewind() error {
+	size, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return errors.Wrap(err, "spool getting data size")
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return errors.Wrap(err, "spool rewinding data")
+	}
+	f.size = size
+	return nil
+}
+
+// Size returns the size of the data, it is known after Rewind
+func (f *File) Size() int64 {
+	return f.size
+}
+
+// Close closes and removes the file
+func (f *File) Close() error {
+	closeErr := f.File.Close()
+	if err := os.Remove(f.Name()); err != nil {
+		return errors.Wrap(err, "spool removing temporary file")
+	}
+	return closeErr
+}
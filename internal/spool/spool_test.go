@@ -0,0 +1,64 @@
+package spool
+
+import (
+	"archive/zip"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNew(t *testing.T) {
+	dir, err := ioutil.TempDir("", "spool-test-")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	w, err := archive.Create("example.com/lib@v1.0.0/lib.go")
+	require.NoError(t, err)
+	_, err = w.Write([]byte("package lib\n"))
+	require.NoError(t, err)
+	require.NoError(t, archive.Close())
+	data := buf.Bytes()
+
+	f, err := New(dir, bytes.NewReader(data))
+	require.NoError(t, err)
+	require.Equal(t, int64(len(data)), f.Size())
+	files, err := ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+
+	zipReader, err := zip.NewReader(f, f.Size())
+	require.NoError(t, err)
+	require.Len(t, zipReader.File, 1)
+	read, err := ioutil.ReadAll(f)
+	require.NoError(t, err)
+	require.Equal(t, data, read)
+
+	require.NoError(t, f.Close())
+	files, err = ioutil.ReadDir(dir)
+	require.NoError(t, err)
+	require.Empty(t, files)
+}
+
+func TestCreate(t *testing.T) {
+	f, err := Create("")
+	require.NoError(t, err)
+	defer f.Close()
+	_, err = f.WriteString("spooled data")
+	require.NoError(t, err)
+	require.NoError(t, f.Rewind())
+	require.Equal(t, int64(len("spooled data")), f.Size())
+	data, err := ioutil.ReadAll(f)
+	require.NoError(t, err)
+	require.Equal(t, "spooled data", string(data))
+}
+
+func TestNewFailure(t *testing.T) {
+	_, err := New(string([]byte{0}), strings.NewReader("data"))
+	require.Error(t, err)
+}
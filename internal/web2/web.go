@@ -6,6 +6,7 @@ package web2
 
 import (
 	"bytes"
+	"context"
 	"github.com/sirkon/goproxy/internal/base"
 	"encoding/json"
 	"flag"
@@ -144,6 +145,16 @@ func Body(body *io.ReadCloser) Option {
 	})
 }
 
+// Context makes the request with the given context.
+func Context(ctx context.Context) Option {
+	return optionFunc(func(g *getState) error {
+		if g.resp == nil {
+			g.req = g.req.WithContext(ctx)
+		}
+		return nil
+	})
+}
+
 func Header(hdr *http.Header) Option {
 	return optionFunc(func(g *getState) error {
 		if g.resp != nil {
@@ -239,7 +250,7 @@ func Get(url string, options ...Option) error {
 			StatusCode: 200,
 		}
 	} else if e.resp == nil {
-		resp, err := httpDo(req)
+		resp, err := httpDo(g.req)
 		if err != nil {
 			e.mu.Unlock()
 			return err
@@ -0,0 +1,191 @@
+// Package metrics instrumentation of the proxy in terms of Prometheus. Collectors are registered in the package
+// registry served by Handler, use Register to get them into another one
+package metrics
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "goproxy"
+
+// Endpoint types of the proxy protocol used as endpoint and operation labels
+const (
+	EndpointList    = "list"
+	EndpointInfo    = "info"
+	EndpointMod     = "mod"
+	EndpointZip     = "zip"
+	EndpointLatest  = "latest"
+	EndpointUnknown = "unknown"
+)
+
+var (
+	// Requests served by the proxy by plugin, endpoint and status
+	Requests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "requests_total",
+		Help:      "Requests served by plugin, endpoint type and response status.",
+	}, []string{"plugin", "endpoint", "status"})
+
+	// RequestDuration latency of requests by plugin, endpoint and status
+	RequestDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "request_duration_seconds",
+		Help:      "Latency of requests by plugin, endpoint type and response status.",
+		Buckets:   []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120},
+	}, []string{"plugin", "endpoint", "status"})
+
+	// ResponseBytes bytes served by plugin and endpoint
+	ResponseBytes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "response_bytes_total",
+		Help:      "Bytes served by plugin and endpoint type.",
+	}, []string{"plugin", "endpoint"})
+
+	// UpstreamDuration latency of calls plugins make to their upstreams: gitlab API, other proxies, VCS repositories
+	UpstreamDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "upstream_duration_seconds",
+		Help:      "Latency of calls to upstreams by plugin, operation and result.",
+		Buckets:   []float64{.01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 120, 300},
+	}, []string{"plugin", "operation", "result"})
+
+	// CacheRequests cache lookups by cache and result, hit or miss
+	CacheRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_requests_total",
+		Help:      "Cache lookups by cache and result.",
+	}, []string{"cache", "result"})
+
+	cacheSizes = &cacheSizeCollector{
+		desc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "", "cache_size_bytes"),
+			"Size of caches which know it.",
+			[]string{"cache"}, nil,
+		),
+		sizes: map[*cacheSize]struct{}{},
+	}
+)
+
+var registry = prometheus.NewRegistry()
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	if err := Register(registry); err != nil {
+		panic(err)
+	}
+}
+
+// Register registers collectors of the proxy in r
+func Register(r prometheus.Registerer) error {
+	for _, c := range []prometheus.Collector{
+		Requests, RequestDuration, ResponseBytes, UpstreamDuration, CacheRequests, cacheSizes,
+	} {
+		if err := r.Register(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Handler serves metrics of the package registry in Prometheus format, mount it at /metrics
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// Endpoint returns endpoint type of a proxy protocol path suffix, e.g. list for /@v/list and zip for v1.2.3.zip
+func Endpoint(suffix string) string {
+	if pos := strings.LastIndexByte(suffix, '/'); pos >= 0 {
+		suffix = suffix[pos+1:]
+	}
+	switch {
+	case suffix == "list":
+		return EndpointList
+	case suffix == "latest" || suffix == "@latest":
+		return EndpointLatest
+	case strings.HasSuffix(suffix, ".info"):
+		return EndpointInfo
+	case strings.HasSuffix(suffix, ".mod"):
+		return EndpointMod
+	case strings.HasSuffix(suffix, ".zip"):
+		return EndpointZip
+	default:
+		return EndpointUnknown
+	}
+}
+
+// ObserveUpstream records the latency of a call of the plugin to its upstream which has started at start and ended
+// with err
+func ObserveUpstream(plugin, operation string, start time.Time, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	UpstreamDuration.WithLabelValues(plugin, operation, result).Observe(time.Since(start).Seconds())
+}
+
+// ObserveCache records a cache lookup
+func ObserveCache(cache string, hit bool) {
+	result := "miss"
+	if hit {
+		result = "hit"
+	}
+	CacheRequests.WithLabelValues(cache, result).Inc()
+}
+
+// CacheSize reports size of a cache in bytes, sizes of caches with the same name are summed up. The returned function
+// stops reporting
+func CacheSize(cache string, size func() int64) (remove func()) {
+	item := &cacheSize{cache: cache, size: size}
+	cacheSizes.lock.Lock()
+	cacheSizes.sizes[item] = struct{}{}
+	cacheSizes.lock.Unlock()
+	return func() {
+		cacheSizes.lock.Lock()
+		delete(cacheSizes.sizes, item)
+		cacheSizes.lock.Unlock()
+	}
+}
+
+type cacheSize struct {
+	cache string
+	size  func() int64
+}
+
+// cacheSizeCollector collects sizes of caches when metrics are scraped
+type cacheSizeCollector struct {
+	desc *prometheus.Desc
+
+	lock  sync.Mutex
+	sizes map[*cacheSize]struct{}
+}
+
+func (c *cacheSizeCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.desc
+}
+
+func (c *cacheSizeCollector) Collect(ch chan<- prometheus.Metric) {
+	c.lock.Lock()
+	items := make([]*cacheSize, 0, len(c.sizes))
+	for item := range c.sizes {
+		items = append(items, item)
+	}
+	c.lock.Unlock()
+
+	totals := map[string]int64{}
+	for _, item := range items {
+		totals[item.cache] += item.size()
+	}
+	for cache, total := range totals {
+		ch <- prometheus.MustNewConstMetric(c.desc, prometheus.GaugeValue, float64(total), cache)
+	}
+}
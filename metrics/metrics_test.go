@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func scrape(t *testing.T) string {
+	t.Helper()
+	w := httptest.NewRecorder()
+	Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	data, err := ioutil.ReadAll(w.Body)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func TestEndpoint(t *testing.T) {
+	tests := []struct {
+		suffix string
+		want   string
+	}{
+		{suffix: "list", want: EndpointList},
+		{suffix: "/@v/list", want: EndpointList},
+		{suffix: "latest", want: EndpointLatest},
+		{suffix: "/@latest", want: EndpointLatest},
+		{suffix: "v1.2.3.info", want: EndpointInfo},
+		{suffix: "/@v/v1.2.3.mod", want: EndpointMod},
+		{suffix: "v1.2.3.zip", want: EndpointZip},
+		{suffix: "v1.2.3", want: EndpointUnknown},
+	}
+	for _, tt := range tests {
+		t.Run(tt.suffix, func(t *testing.T) {
+			require.Equal(t, tt.want, Endpoint(tt.suffix))
+		})
+	}
+}
+
+func TestHandler(t *testing.T) {
+	ObserveUpstream("test", EndpointZip, time.Now(), nil)
+	ObserveUpstream("test", EndpointZip, time.Now(), errors.New("error"))
+	ObserveCache("test", true)
+	ObserveCache("test", true)
+	ObserveCache("test", false)
+	stop1 := CacheSize("test", func() int64 { return 100 })
+	stop2 := CacheSize("test", func() int64 { return 20 })
+
+	out := scrape(t)
+	for _, line := range []string{
+		`goproxy_upstream_duration_seconds_count{operation="zip",plugin="test",result="ok"} 1`,
+		`goproxy_upstream_duration_seconds_count{operation="zip",plugin="test",result="error"} 1`,
+		`goproxy_cache_requests_total{cache="test",result="hit"} 2`,
+		`goproxy_cache_requests_total{cache="test",result="miss"} 1`,
+		`goproxy_cache_size_bytes{cache="test"} 120`,
+		`go_goroutines`,
+	} {
+		require.Contains(t, out, line)
+	}
+
+	stop1()
+	stop2()
+	require.False(t, strings.Contains(scrape(t), `goproxy_cache_size_bytes{cache="test"}`))
+}
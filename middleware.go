@@ -1,6 +1,8 @@
 package goproxy
 
 import (
+	"context"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -11,19 +13,36 @@ import (
 
 	"github.com/rs/zerolog"
 	"github.com/spaolacci/murmur3"
+	"go.opentelemetry.io/otel/attribute"
 
+	"github.com/sirkon/goproxy/accesslog"
+	"github.com/sirkon/goproxy/auth"
 	"github.com/sirkon/goproxy/internal/errors"
+	"github.com/sirkon/goproxy/internal/module"
+	"github.com/sirkon/goproxy/metrics"
 	"github.com/sirkon/goproxy/semver"
+	"github.com/sirkon/goproxy/tracing"
 )
 
 // Middleware acts as go proxy with given router.
 //   transportPrefix is a head part of URL path which refers to address of go proxy before the module info. For example,
 // if we serving go proxy at https://0.0.0.0:8081/goproxy/..., transportPrefix will be "/goproxy"
+// No access log is written, use MiddlewareAccessLog to have one
 func Middleware(r *Router, transportPrefix string, logger *zerolog.Logger) http.Handler {
+	return MiddlewareAccessLog(r, transportPrefix, logger, accesslog.Discard)
+}
+
+// MiddlewareAccessLog acts as Middleware writing a record of each request into the access log sink, use
+// accesslog.Zerolog to have records in the logger. Access log is not written if the sink is nil
+func MiddlewareAccessLog(r *Router, transportPrefix string, logger *zerolog.Logger, access accesslog.Sink) http.Handler {
+	if access == nil {
+		access = accesslog.Discard
+	}
 	return &middleware{
 		prefix: transportPrefix,
 		router: r,
 		logger: logger,
+		access: access,
 	}
 }
 
@@ -32,6 +51,7 @@ type middleware struct {
 	prefix string
 	router *Router
 	logger *zerolog.Logger
+	access accesslog.Sink
 }
 
 const latestSuffix = "/@latest"
@@ -57,18 +77,62 @@ func errRespf(w http.ResponseWriter, logger zerolog.Logger, code int, err error,
 }
 
 func (m *middleware) ServeHTTP(w http.ResponseWriter, req *http.Request) {
-	hasher := murmur3.New64()
-	_, _ = io.WriteString(hasher, req.URL.String())
-	_, _ = io.WriteString(hasher, time.Now().Format(time.RFC3339Nano))
-	logger := m.logger.With().Hex("request-id", hasher.Sum(nil)).Str("request", req.URL.String()).Logger()
+	start := time.Now()
+	requestID := accesslog.IncomingRequestID(req)
+	if len(requestID) == 0 {
+		hasher := murmur3.New64()
+		_, _ = io.WriteString(hasher, req.URL.String())
+		_, _ = io.WriteString(hasher, start.Format(time.RFC3339Nano))
+		requestID = hex.EncodeToString(hasher.Sum(nil))
+	}
+	w.Header().Set(accesslog.RequestIDHeader, requestID)
+	req = req.WithContext(accesslog.WithRequestID(req.Context(), requestID))
+	logger := m.logger.With().Str("request-id", requestID).Str("request", req.URL.String()).Logger()
+
+	rec := &responseRecorder{ResponseWriter: w}
+	w = rec
+	req, span := tracing.StartServer(req, "goproxy")
+	record := &accesslog.Record{
+		Start:     start,
+		RequestID: requestID,
+		Remote:    req.RemoteAddr,
+		Method:    req.Method,
+		Path:      req.URL.Path,
+		Endpoint:  metrics.EndpointUnknown,
+	}
+	defer func() {
+		record.Status = rec.code()
+		record.Bytes = rec.size
+		record.Duration = time.Since(start)
+		rec.observe(record.Plugin, record.Endpoint, start)
+		tracing.EndHTTP(span, record.Status)
+		m.access.Log(record)
+	}()
 
 	path, suffix, err := GetModInfo(req, m.prefix)
 	if err != nil {
 		errResp(w, logger, http.StatusBadRequest, err, "getting mod info")
 		return
 	}
+	record.Module = path
+	record.Endpoint = metrics.Endpoint(suffix)
+	span.SetName("goproxy " + record.Endpoint)
+	span.SetAttributes(attribute.String("goproxy.module", path))
 
 	logger = logger.With().Str("module", path).Logger()
+	if p := auth.FromContext(req.Context()); p != nil {
+		logger = logger.With().Str("principal", p.Name).Logger()
+		record.Principal = p.Name
+	}
+
+	if err := m.router.authorize(req, path); err != nil {
+		code := errStatus(err)
+		if code == http.StatusUnauthorized {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Basic realm="%s"`, auth.Realm))
+		}
+		errResp(w, logger, code, err, "authorization")
+		return
+	}
 
 	factory := m.router.Factory(path)
 	if factory == nil {
@@ -76,13 +140,16 @@ func (m *middleware) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	logger = logger.With().Str("plugin", factory.String()).Logger()
+	record.Plugin = factory.String()
+	logger = logger.With().Str("plugin", record.Plugin).Logger()
+	span.SetAttributes(attribute.String("goproxy.plugin", record.Plugin))
 
 	src, err := factory.Module(req, m.prefix)
 	if err != nil {
-		errResp(w, logger, http.StatusBadRequest, err, "failed to get a source from plugin")
+		errResp(w, logger, errStatus(err), err, "failed to get a source from plugin")
 		return
 	}
+	src = traceModule(src)
 
 	switch {
 	case suffix == "list":
@@ -90,7 +157,7 @@ func (m *middleware) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		logger.Debug().Msg("version list requested")
 		version, err := src.Versions(ctx, "")
 		if err != nil {
-			errResp(w, logger, http.StatusBadRequest, err, "getting version list")
+			errResp(w, logger, errStatus(err), err, "getting version list")
 			return
 		}
 		w.WriteHeader(http.StatusOK)
@@ -102,12 +169,13 @@ func (m *middleware) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 
 	case strings.HasSuffix(suffix, ".info"):
 		version := getVersion(suffix)
+		record.Version = version
 		tmpLogger := logger.With().Str("version", version).Logger()
 		ctx := tmpLogger.WithContext(req.Context())
 		tmpLogger.Debug().Msg("version info requested")
 		info, err := src.Stat(ctx, version)
 		if err != nil {
-			errResp(w, tmpLogger, http.StatusBadRequest, err, "getting revision info from source beneath")
+			errResp(w, tmpLogger, errStatus(err), err, "getting revision info from source beneath")
 			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
@@ -120,12 +188,13 @@ func (m *middleware) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 
 	case strings.HasSuffix(suffix, ".mod"):
 		version := getVersion(suffix)
+		record.Version = version
 		tmpLogger := logger.With().Str("version", version).Logger()
 		ctx := tmpLogger.WithContext(req.Context())
 		tmpLogger.Debug().Msg("go.mod requested")
 		gomod, err := src.GoMod(ctx, version)
 		if err != nil {
-			errResp(w, tmpLogger, http.StatusBadRequest, err, "getting go.mod from a source beneath")
+			errResp(w, tmpLogger, errStatus(err), err, "getting go.mod from a source beneath")
 			return
 		}
 		if _, err := w.Write(gomod); err != nil {
@@ -137,12 +206,13 @@ func (m *middleware) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 
 	case strings.HasSuffix(suffix, ".zip"):
 		version := getVersion(suffix)
+		record.Version = version
 		tmpLogger := logger.With().Str("version", version).Logger()
 		ctx := tmpLogger.WithContext(req.Context())
 		tmpLogger.Debug().Msg("zip archive requested")
 		archiveReader, err := src.Zip(ctx, version)
 		if err != nil {
-			errResp(w, tmpLogger, http.StatusBadRequest, err, "getting zip archive")
+			errResp(w, tmpLogger, errStatus(err), err, "getting zip archive")
 			return
 		}
 		defer func() {
@@ -159,28 +229,13 @@ func (m *middleware) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	case suffix == "latest":
 		ctx := logger.WithContext(req.Context())
 		logger.Debug().Msg("latest")
-		version, err := src.Versions(ctx, "")
-		var revision string
-		if err != nil {
-			logger.Error().Err(err).Msg("getting version list for @latest")
-			revision = "master"
-		} else {
-			for _, v := range version {
-				if semver.IsValid(v) && (len(revision) == 0 || semver.Compare(v, revision) > 0) {
-					revision = v
-				}
-			}
-			if len(revision) == 0 {
-				revision = "master"
-			}
-		}
-		tmpLogger := logger.With().Str("version", revision).Logger()
-		tmpLogger.Debug().Msg("version info requested")
-		info, err := src.Stat(ctx, revision)
+		info, err := latest(ctx, src)
 		if err != nil {
-			errResp(w, tmpLogger, http.StatusBadRequest, err, "getting revision info from source beneath for @latest")
+			errResp(w, logger, errStatus(err), err, "getting revision info from source beneath for @latest")
 			return
 		}
+		record.Version = info.Version
+		tmpLogger := logger.With().Str("version", info.Version).Logger()
 		je := json.NewEncoder(w)
 		if err := je.Encode(info); err != nil {
 			tmpLogger.Error().Err(err).Msg("writing version info response for @latest")
@@ -194,6 +249,50 @@ func (m *middleware) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 	}
 }
 
+// latest returns revision info of the latest version of a module. It is the module's own choice if it implements
+// LatestModule, the highest version out of the list matching major version of the module path otherwise. It falls back
+// to master when there are no versions
+func latest(ctx context.Context, src Module) (*RevInfo, error) {
+	if l, ok := src.(LatestModule); ok {
+		return l.Latest(ctx)
+	}
+
+	logger := zerolog.Ctx(ctx)
+	prefix := majorPrefix(src.ModulePath())
+	versions, err := src.Versions(ctx, prefix)
+	var revision string
+	if err != nil {
+		logger.Error().Err(err).Msg("getting version list for @latest")
+	} else {
+		var candidates []string
+		for _, v := range versions {
+			if !semver.IsValid(v) {
+				logger.Warn().Str("version", v).Msg("invalid semver value ignored for @latest")
+				continue
+			}
+			if strings.HasPrefix(v, prefix) {
+				candidates = append(candidates, v)
+			}
+		}
+		revision = semver.Latest(candidates)
+	}
+	if len(revision) == 0 {
+		revision = "master"
+	}
+	logger.Debug().Str("version", revision).Msg("version info requested")
+	return src.Stat(ctx, revision)
+}
+
+// majorPrefix returns version prefix defined by major version suffix of a module path, i.e. "v2." for
+// example.com/project/v2 and gopkg.in/yaml.v2. Returns empty string when there's no major version suffix
+func majorPrefix(path string) string {
+	_, pathMajor, ok := module.SplitPathVersion(path)
+	if !ok || len(pathMajor) == 0 {
+		return ""
+	}
+	return pathMajor[1:] + "."
+}
+
 // getVersion we have something like v0.1.2.zip or v0.1.2.info or v0.1.2.zip in the suffix and need to cut the
 func getVersion(suffix string) string {
 	off := strings.LastIndex(suffix, ".")
@@ -1,6 +1,11 @@
 package goproxy
 
-import "testing"
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+)
 
 func Test_getVersion(t *testing.T) {
 	type args struct {
@@ -35,3 +40,90 @@ func Test_getVersion(t *testing.T) {
 		})
 	}
 }
+
+func Test_majorPrefix(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		want string
+	}{
+		{
+			name: "no-suffix",
+			path: "github.com/user/project",
+			want: "",
+		},
+		{
+			name: "major-suffix",
+			path: "github.com/user/project/v2",
+			want: "v2.",
+		},
+		{
+			name: "gopkg.in",
+			path: "gopkg.in/yaml.v2",
+			want: "v2.",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := majorPrefix(tt.path); got != tt.want {
+				t.Errorf("majorPrefix() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+type versionsModule []string
+
+func (m versionsModule) ModulePath() string { return "github.com/user/project" }
+func (m versionsModule) Versions(ctx context.Context, prefix string) (res []string, err error) {
+	for _, v := range m {
+		if strings.HasPrefix(v, prefix) {
+			res = append(res, v)
+		}
+	}
+	return res, nil
+}
+func (m versionsModule) Stat(ctx context.Context, rev string) (*RevInfo, error) {
+	return &RevInfo{Version: rev}, nil
+}
+func (m versionsModule) GoMod(ctx context.Context, version string) ([]byte, error) {
+	return nil, io.EOF
+}
+func (m versionsModule) Zip(ctx context.Context, version string) (io.ReadCloser, error) {
+	return nil, io.EOF
+}
+
+func Test_latest(t *testing.T) {
+	tests := []struct {
+		name     string
+		versions versionsModule
+		want     string
+	}{
+		{
+			name:     "no-versions",
+			versions: nil,
+			want:     "master",
+		},
+		{
+			name:     "compatible-over-incompatible",
+			versions: versionsModule{"v0.1.0", "v1.2.0", "v2.0.0+incompatible", "v3.0.0+incompatible"},
+			want:     "v1.2.0",
+		},
+		{
+			name:     "incompatible-only",
+			versions: versionsModule{"v2.0.0+incompatible", "v3.0.0+incompatible"},
+			want:     "v3.0.0+incompatible",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := latest(context.Background(), tt.versions)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Version != tt.want {
+				t.Errorf("latest() = %v, want %v", got.Version, tt.want)
+			}
+		})
+	}
+}
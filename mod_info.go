@@ -1,6 +1,7 @@
 package goproxy
 
 import (
+	"context"
 	"net/http"
 	"strings"
 
@@ -114,3 +115,17 @@ func GetModInfo(req *http.Request, prefix string) (path string, suffix string, e
 func PathEncoding(path string) (string, error) {
 	return module.EncodePath(path)
 }
+
+// NewModuleRequest builds go proxy request for the list of versions of a module with given path. It is meant for
+// those who need to get a Module from a Plugin outside of an HTTP handler: plugins only need a module path out of it
+func NewModuleRequest(ctx context.Context, path string) (*http.Request, error) {
+	enc, err := module.EncodePath(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "encoding module path %s", path)
+	}
+	req, err := http.NewRequest(http.MethodGet, "/"+enc+"/@v/list", nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "making request for module %s", path)
+	}
+	return req.WithContext(ctx), nil
+}
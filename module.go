@@ -38,3 +38,12 @@ type Module interface {
 	// Zip returns file reader of ZIP file for the given version of the module
 	Zip(ctx context.Context, version string) (file io.ReadCloser, err error)
 }
+
+// LatestModule is an optional interface for modules which know their latest version by themselves. Middleware uses it
+// for @latest requests instead of picking the highest version out of the list
+type LatestModule interface {
+	Module
+
+	// Latest returns information about the latest version of the module
+	Latest(ctx context.Context) (*RevInfo, error)
+}
@@ -11,3 +11,17 @@ type Plugin interface {
 	Close() error
 	String() string
 }
+
+// Invalidator is a Plugin keeping data of modules which can go stale, such as version lists. Invalidate makes it forget
+// what it knows of the module, so the data is requested from upstreams again
+type Invalidator interface {
+	Invalidate(path string)
+}
+
+// Invalidate invalidates data of the module kept by the plugin if it is an Invalidator. Wrapper plugins pass
+// invalidation to their upstreams with it
+func Invalidate(p Plugin, path string) {
+	if i, ok := p.(Invalidator); ok {
+		i.Invalidate(path)
+	}
+}
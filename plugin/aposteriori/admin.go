@@ -0,0 +1,337 @@
+package aposteriori
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/sirkon/goproxy"
+	"github.com/sirkon/goproxy/internal/errors"
+	"github.com/sirkon/goproxy/internal/spool"
+	"github.com/sirkon/goproxy/semver"
+)
+
+// CachedVersion cached module version
+type CachedVersion struct {
+	Version string    `json:"version"`
+	Items   []string  `json:"items"`
+	Size    int64     `json:"size"`
+	Fetched time.Time `json:"fetched"` // the time of the latest saved item
+}
+
+// CachedModule cached module with its versions
+type CachedModule struct {
+	Path     string          `json:"path"`
+	Size     int64           `json:"size"`
+	Versions []CachedVersion `json:"versions"`
+}
+
+// Admin administration of the cache of aposteriori plugin
+type Admin struct {
+	plugin *plugin
+	cache  ManagedFileCache
+}
+
+// NewAdmin returns administration of the cache of aposteriori plugin p, the cache must be a ManagedFileCache
+func NewAdmin(p goproxy.Plugin) (*Admin, error) {
+	plug, ok := p.(*plugin)
+	if !ok {
+		return nil, errors.Newf("aposteriori admin: %s is not aposteriori plugin", p)
+	}
+	cache, ok := plug.cache.(ManagedFileCache)
+	if !ok {
+		return nil, errors.New("aposteriori admin: cache cannot list and delete items")
+	}
+	return &Admin{plugin: plug, cache: cache}, nil
+}
+
+// splitName splits name of cached item made with CachePath
+func splitName(name string) (mod, version, item string, ok bool) {
+	pos := strings.LastIndexByte(name, '/')
+	if pos < 0 {
+		return "", "", "", false
+	}
+	item = name[pos+1:]
+	name = name[:pos]
+	pos = strings.LastIndexByte(name, '/')
+	if pos < 0 {
+		return "", "", "", false
+	}
+	return name[:pos], name[pos+1:], item, true
+}
+
+// items returns cached items of the module, of the given version only if it is not empty. Items of all modules are
+// returned if path is empty
+func (a *Admin) items(path, version string) ([]CacheItem, error) {
+	var prefix string
+	if len(path) > 0 {
+		prefix = path + "/"
+	}
+	items, err := a.cache.List(prefix)
+	if err != nil {
+		return nil, errors.Wrap(err, "aposteriori listing cache")
+	}
+	var res []CacheItem
+	for _, item := range items {
+		mod, v, _, ok := splitName(item.Name)
+		if !ok || (len(path) > 0 && mod != path) || (len(version) > 0 && v != version) {
+			continue
+		}
+		res = append(res, item)
+	}
+	return res, nil
+}
+
+// Modules returns cached modules, only the one with given path if it is not empty
+func (a *Admin) Modules(path string) ([]CachedModule, error) {
+	items, err := a.items(path, "")
+	if err != nil {
+		return nil, err
+	}
+
+	modules := map[string]map[string]*CachedVersion{}
+	for _, item := range items {
+		mod, version, name, _ := splitName(item.Name)
+		versions, ok := modules[mod]
+		if !ok {
+			versions = map[string]*CachedVersion{}
+			modules[mod] = versions
+		}
+		v, ok := versions[version]
+		if !ok {
+			v = &CachedVersion{Version: version}
+			versions[version] = v
+		}
+		v.Items = append(v.Items, name)
+		v.Size += item.Size
+		if item.ModTime.After(v.Fetched) {
+			v.Fetched = item.ModTime
+		}
+	}
+
+	res := make([]CachedModule, 0, len(modules))
+	for mod, versions := range modules {
+		m := CachedModule{Path: mod}
+		for _, v := range versions {
+			sort.Strings(v.Items)
+			m.Size += v.Size
+			m.Versions = append(m.Versions, *v)
+		}
+		sort.Slice(m.Versions, func(i, j int) bool {
+			return semver.Compare(m.Versions[i].Version, m.Versions[j].Version) < 0
+		})
+		res = append(res, m)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Path < res[j].Path
+	})
+	return res, nil
+}
+
+// Purge deletes cached items of the module version or of the whole module if version is empty. Returns the number of
+// deleted items
+func (a *Admin) Purge(path, version string) (int, error) {
+	if len(path) == 0 {
+		return 0, errors.New("aposteriori purge: module path is required")
+	}
+	items, err := a.items(path, version)
+	if err != nil {
+		return 0, err
+	}
+
+	// versions are removed from the registry first, so they are not announced while their items are being deleted
+	if a.plugin.registry != nil {
+		a.plugin.Lock()
+		if len(version) == 0 {
+			delete(a.plugin.registry, path)
+		} else {
+			delete(a.plugin.registry[path], version)
+		}
+		a.plugin.Unlock()
+	}
+	for i, item := range items {
+		if err := a.cache.Delete(item.Name); err != nil {
+			return i, errors.Wrapf(err, "aposteriori deleting %s", item.Name)
+		}
+	}
+	return len(items), nil
+}
+
+// Refetch fetches the module version from the upstream and replaces its cached items. The cache is left as is if
+// fetching fails
+func (a *Admin) Refetch(ctx context.Context, path, version string) (*goproxy.RevInfo, error) {
+	if len(version) == 0 {
+		return nil, errors.New("aposteriori refetch: version is required")
+	}
+
+	fetched, err := a.fetch(ctx, path, version)
+	if err != nil {
+		return nil, err
+	}
+	info, items := fetched.info, fetched.items
+	defer func() {
+		if err := fetched.zip.Close(); err != nil {
+			zerolog.Ctx(ctx).Error().Err(err).Msg("aposteriori closing refetched source archive")
+		}
+	}()
+
+	// the source archive goes last, the version is served from the cache once it is there
+	for _, name := range []string{RevInfoName, GoModName, ZipName} {
+		p := CachePath(path, info.Version, name)
+		if err := a.cache.Set(p, items[name]); err != nil {
+			return nil, errors.Wrapf(err, "aposteriori refetch saving %s", p)
+		}
+	}
+	// drop whatever else was cached for the version
+	cached, err := a.items(path, info.Version)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range cached {
+		if _, _, name, _ := splitName(item.Name); items[name] != nil {
+			continue
+		}
+		if err := a.cache.Delete(item.Name); err != nil {
+			return nil, errors.Wrapf(err, "aposteriori deleting %s", item.Name)
+		}
+	}
+
+	if a.plugin.registry != nil {
+		a.plugin.Lock()
+		versions, ok := a.plugin.registry[path]
+		if !ok {
+			versions = map[string]struct{}{}
+			a.plugin.registry[path] = versions
+		}
+		versions[info.Version] = struct{}{}
+		a.plugin.Unlock()
+	}
+	return info, nil
+}
+
+// refetched module version got from the upstream, items are by their names. The source archive is kept in a
+// temporary file which is to be closed
+type refetched struct {
+	info  *goproxy.RevInfo
+	items map[string]io.Reader
+	zip   *spool.File
+}
+
+// fetch gets the module version from the upstream bypassing the cache
+func (a *Admin) fetch(ctx context.Context, path, version string) (*refetched, error) {
+	req, err := goproxy.NewModuleRequest(ctx, path)
+	if err != nil {
+		return nil, err
+	}
+	mod, err := a.plugin.next.Module(req, "")
+	if err != nil {
+		return nil, errors.Wrapf(err, "aposteriori refetch of %s", path)
+	}
+	defer func() {
+		if err := a.plugin.next.Leave(mod); err != nil {
+			zerolog.Ctx(ctx).Error().Err(err).Msg("aposteriori leaving refetched module")
+		}
+	}()
+
+	info, err := mod.Stat(ctx, version)
+	if err != nil {
+		return nil, err
+	}
+	revInfo, err := json.Marshal(info)
+	if err != nil {
+		return nil, errors.Wrap(err, "aposteriori refetch marshaling revision info")
+	}
+	goMod, err := mod.GoMod(ctx, info.Version)
+	if err != nil {
+		return nil, err
+	}
+	archive, err := mod.Zip(ctx, info.Version)
+	if err != nil {
+		return nil, err
+	}
+	zip, err := spool.New("", archive)
+	if err != nil {
+		_ = archive.Close()
+		return nil, errors.Wrapf(err, "aposteriori refetch reading source archive of %s@%s", path, info.Version)
+	}
+	if err := archive.Close(); err != nil {
+		_ = zip.Close()
+		return nil, errors.Wrapf(err, "aposteriori refetch closing source archive of %s@%s", path, info.Version)
+	}
+	return &refetched{
+		info: info,
+		items: map[string]io.Reader{
+			RevInfoName: bytes.NewReader(revInfo),
+			GoModName:   bytes.NewReader(goMod),
+			ZipName:     zip,
+		},
+		zip: zip,
+	}, nil
+}
+
+// ServeHTTP serves cache administration API, mount it with http.StripPrefix apart from the proxy:
+//
+//	GET    /modules?module=path                 cached modules, all of them if module is not set
+//	DELETE /modules?module=path&version=v1.0.0  purge the version, the whole module if version is not set
+//	POST   /refetch?module=path&version=v1.0.0  fetch the version again and replace its cached items
+func (a *Admin) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	logger := zerolog.Ctx(req.Context())
+	path, version := req.URL.Query().Get("module"), req.URL.Query().Get("version")
+
+	var res interface{}
+	var err error
+	switch endpoint := strings.Trim(req.URL.Path, "/"); {
+	case endpoint == "modules" && req.Method == http.MethodGet:
+		res, err = a.Modules(path)
+	case endpoint == "modules" && req.Method == http.MethodDelete:
+		if len(path) == 0 {
+			http.Error(w, "module is required", http.StatusBadRequest)
+			return
+		}
+		var deleted int
+		deleted, err = a.Purge(path, version)
+		if err == nil && deleted == 0 {
+			http.Error(w, "nothing cached for "+path, http.StatusNotFound)
+			return
+		}
+		logger.Info().Str("module", path).Str("version", version).Int("deleted", deleted).Msg("aposteriori purged")
+		res = struct {
+			Deleted int `json:"deleted"`
+		}{Deleted: deleted}
+	case endpoint == "refetch" && req.Method == http.MethodPost:
+		if len(path) == 0 || len(version) == 0 {
+			http.Error(w, "module and version are required", http.StatusBadRequest)
+			return
+		}
+		res, err = a.Refetch(req.Context(), path, version)
+		if err == nil {
+			logger.Info().Str("module", path).Str("version", version).Msg("aposteriori refetched")
+		}
+	case endpoint == "modules" || endpoint == "refetch":
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	default:
+		http.NotFound(w, req)
+		return
+	}
+	if err != nil {
+		logger.Error().Err(err).Str("module", path).Str("version", version).Msg("aposteriori admin")
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data, err := json.Marshal(res)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
@@ -0,0 +1,245 @@
+package aposteriori
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sirkon/goproxy/internal/plugintest"
+	"github.com/sirkon/goproxy/plugin/apriori"
+)
+
+// managedCache ManagedFileCache in memory
+type managedCache struct {
+	sync.Mutex
+	items map[string][]byte
+}
+
+func (c *managedCache) Get(name string) (io.ReadCloser, error) {
+	c.Lock()
+	defer c.Unlock()
+	data, ok := c.items[name]
+	if !ok {
+		return nil, os.ErrNotExist
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (c *managedCache) Set(name string, data io.Reader) error {
+	res, err := ioutil.ReadAll(data)
+	if err != nil {
+		return err
+	}
+	c.Lock()
+	defer c.Unlock()
+	c.items[name] = res
+	return nil
+}
+
+func (c *managedCache) List(prefix string) ([]CacheItem, error) {
+	c.Lock()
+	defer c.Unlock()
+	var res []CacheItem
+	for name, data := range c.items {
+		if strings.HasPrefix(name, prefix) {
+			res = append(res, CacheItem{Name: name, Size: int64(len(data)), ModTime: time.Unix(1, 0)})
+		}
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res, nil
+}
+
+func (c *managedCache) Delete(name string) error {
+	c.Lock()
+	defer c.Unlock()
+	delete(c.items, name)
+	return nil
+}
+
+func TestAdmin(t *testing.T) {
+	root, err := ioutil.TempDir("", "aposteriori-admin")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+	dir := filepath.Join(root, "example.com", "lib", "@v")
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	plugintest.WriteVersion(t, dir, "v1.0.0")
+	plugintest.WriteVersion(t, dir, "v1.1.0")
+	upstream, err := apriori.NewDirPlugin(root)
+	require.NoError(t, err)
+
+	cache := &managedCache{items: map[string][]byte{
+		CachePath("example.com/lib/v2", "v2.0.0", GoModName): []byte("module example.com/lib/v2\n"),
+	}}
+	registry := map[string]map[string]struct{}{}
+	plug := NewCachePriority(upstream, cache, registry)
+	admin, err := NewAdmin(plug)
+	require.NoError(t, err)
+
+	_, err = NewAdmin(upstream)
+	require.Error(t, err)
+
+	ctx := context.Background()
+	for _, version := range []string{"v1.0.0", "v1.1.0"} {
+		info, err := admin.Refetch(ctx, "example.com/lib", version)
+		require.NoError(t, err)
+		require.Equal(t, version, info.Version)
+	}
+	require.Equal(t, map[string]map[string]struct{}{
+		"example.com/lib": {"v1.0.0": {}, "v1.1.0": {}},
+	}, registry)
+
+	modules, err := admin.Modules("example.com/lib")
+	require.NoError(t, err)
+	require.Len(t, modules, 1)
+	require.Equal(t, "example.com/lib", modules[0].Path)
+	require.Len(t, modules[0].Versions, 2)
+	require.Equal(t, CachedVersion{
+		Version: "v1.0.0",
+		Items:   []string{GoModName, RevInfoName, ZipName},
+		Size:    int64(len("module example.com/lib\n") + len("zip v1.0.0") + len(cache.items[CachePath("example.com/lib", "v1.0.0", RevInfoName)])),
+		Fetched: time.Unix(1, 0),
+	}, modules[0].Versions[0])
+
+	modules, err = admin.Modules("")
+	require.NoError(t, err)
+	require.Len(t, modules, 2)
+	require.Equal(t, "example.com/lib/v2", modules[1].Path)
+
+	tests := []struct {
+		name    string
+		method  string
+		url     string
+		status  int
+		body    string
+		remains []string
+	}{
+		{
+			name:   "no-module",
+			method: http.MethodDelete,
+			url:    "/modules",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "method",
+			method: http.MethodPut,
+			url:    "/modules",
+			status: http.StatusMethodNotAllowed,
+		},
+		{
+			name:    "purge-version",
+			method:  http.MethodDelete,
+			url:     "/modules?module=example.com/lib&version=v1.0.0",
+			status:  http.StatusOK,
+			body:    `{"deleted":3}`,
+			remains: []string{"v1.1.0"},
+		},
+		{
+			name:   "purge-missing",
+			method: http.MethodDelete,
+			url:    "/modules?module=example.com/lib&version=v1.0.0",
+			status: http.StatusNotFound,
+		},
+		{
+			name:    "refetch",
+			method:  http.MethodPost,
+			url:     "/refetch?module=example.com/lib&version=v1.0.0",
+			status:  http.StatusOK,
+			body:    `{"Version":"v1.0.0","Time":"2019-01-02T03:04:05Z"}`,
+			remains: []string{"v1.0.0", "v1.1.0"},
+		},
+		{
+			name:   "purge-module",
+			method: http.MethodDelete,
+			url:    "/modules?module=example.com/lib",
+			status: http.StatusOK,
+			body:   `{"deleted":6}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			admin.ServeHTTP(w, httptest.NewRequest(tt.method, tt.url, nil))
+			require.Equal(t, tt.status, w.Code, w.Body.String())
+			if len(tt.body) > 0 {
+				require.JSONEq(t, tt.body, w.Body.String())
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+			var remains []string
+			for version := range registry["example.com/lib"] {
+				remains = append(remains, version)
+			}
+			sort.Strings(remains)
+			require.Equal(t, tt.remains, remains)
+		})
+	}
+
+	// other modules are left intact
+	modules, err = admin.Modules("")
+	require.NoError(t, err)
+	require.Len(t, modules, 1)
+	require.Equal(t, "example.com/lib/v2", modules[0].Path)
+}
+
+func TestAdminRefetchFailure(t *testing.T) {
+	root, err := ioutil.TempDir("", "aposteriori-admin")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+	dir := filepath.Join(root, "example.com", "lib", "@v")
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	plugintest.WriteVersion(t, dir, "v1.0.0")
+	upstream, err := apriori.NewDirPlugin(root)
+	require.NoError(t, err)
+
+	cache, err := NewDirCache(filepath.Join(root, "cache"))
+	require.NoError(t, err)
+	registry := map[string]map[string]struct{}{}
+	admin, err := NewAdmin(NewCachePriority(upstream, cache, registry))
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	_, err = admin.Refetch(ctx, "example.com/lib", "v1.0.0")
+	require.NoError(t, err)
+
+	// the upstream lost the version, what is cached stays there
+	for _, ext := range []string{".info", ".mod", ".zip"} {
+		require.NoError(t, os.Remove(filepath.Join(dir, "v1.0.0"+ext)))
+	}
+	_, err = admin.Refetch(ctx, "example.com/lib", "v1.0.0")
+	require.Error(t, err)
+	modules, err := admin.Modules("example.com/lib")
+	require.NoError(t, err)
+	require.Len(t, modules, 1)
+	require.Len(t, modules[0].Versions, 1)
+	require.Equal(t, []string{GoModName, RevInfoName, ZipName}, modules[0].Versions[0].Items)
+	require.Contains(t, registry["example.com/lib"], "v1.0.0")
+
+	// stale items are replaced once the upstream has the version again
+	plugintest.WriteVersion(t, dir, "v1.0.0")
+	require.NoError(t, cache.Set(CachePath("example.com/lib", "v1.0.0", ZipName), strings.NewReader("stale")))
+	require.NoError(t, cache.Set(CachePath("example.com/lib", "v1.0.0", "extra"), strings.NewReader("extra")))
+	_, err = admin.Refetch(ctx, "example.com/lib", "v1.0.0")
+	require.NoError(t, err)
+	file, err := cache.Get(CachePath("example.com/lib", "v1.0.0", ZipName))
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(file)
+	require.NoError(t, file.Close())
+	require.NoError(t, err)
+	require.Equal(t, "zip v1.0.0", string(data))
+	items, err := cache.List("example.com/lib/v1.0.0/")
+	require.NoError(t, err)
+	require.Len(t, items, 3)
+}
@@ -0,0 +1,215 @@
+package aposteriori
+
+import (
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/sirkon/goproxy/internal/errors"
+	module2 "github.com/sirkon/goproxy/internal/module"
+)
+
+// tmpPrefix prefix of files being written, they are not items yet
+const tmpPrefix = ".tmp-"
+
+// dirCache cache keeping items in files of a directory, module paths and versions are encoded like in the module
+// cache, so items of modules differing in case only do not clash on case-insensitive file systems
+type dirCache struct {
+	root string
+
+	lock sync.Mutex
+	size int64
+}
+
+// NewDirCache returns a cache keeping items in files under root, the directory is created if there is none. Items
+// are named with CachePath. The cache can be listed and deleted from, so it fits NewAdmin, and its size is reported in
+// metrics
+func NewDirCache(root string) (ManagedFileCache, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, errors.Wrapf(err, "aposteriori creating cache directory %s", root)
+	}
+	res := &dirCache{root: filepath.Clean(root)}
+	items, err := res.List("")
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		res.size += item.Size
+	}
+	return res, nil
+}
+
+// fileName returns name of the file of the item
+func (c *dirCache) fileName(name string) (string, error) {
+	mod, version, item, ok := splitName(name)
+	if !ok || strings.HasPrefix(item, tmpPrefix) {
+		return "", errors.Newf("aposteriori invalid cache item name %s", name)
+	}
+	encMod, err := module2.EncodePath(mod)
+	if err != nil {
+		return "", errors.Wrapf(err, "aposteriori invalid cache item name %s", name)
+	}
+	encVersion, err := module2.EncodeVersion(version)
+	if err != nil {
+		return "", errors.Wrapf(err, "aposteriori invalid cache item name %s", name)
+	}
+	return filepath.Join(c.root, filepath.FromSlash(encMod), encVersion, item), nil
+}
+
+// Get opens the item, the error satisfies os.IsNotExist if there is no such item
+func (c *dirCache) Get(name string) (io.ReadCloser, error) {
+	fileName, err := c.fileName(name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(fileName)
+}
+
+// Set writes the item, it is replaced at once, so readers get either the previous or the new content
+func (c *dirCache) Set(name string, data io.Reader) error {
+	fileName, err := c.fileName(name)
+	if err != nil {
+		return err
+	}
+	tmp, err := c.tempFile(filepath.Dir(fileName))
+	if err != nil {
+		return errors.Wrapf(err, "aposteriori creating file for %s", name)
+	}
+	size, err := io.Copy(tmp, data)
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cErr := tmp.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+		return errors.Wrapf(err, "aposteriori writing %s", name)
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	var prev int64
+	if stat, err := os.Stat(fileName); err == nil {
+		prev = stat.Size()
+	}
+	if err := os.Rename(tmp.Name(), fileName); err != nil {
+		_ = os.Remove(tmp.Name())
+		return errors.Wrapf(err, "aposteriori saving %s", name)
+	}
+	c.size += size - prev
+	return nil
+}
+
+// tempFile creates a file to write an item into in the directory, the directory is created if there is none. It is
+// done under the lock, so the directory is not removed by Delete in the meantime
+func (c *dirCache) tempFile(dir string) (*os.File, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return ioutil.TempFile(dir, tmpPrefix)
+}
+
+// List returns items with names starting with prefix
+func (c *dirCache) List(prefix string) ([]CacheItem, error) {
+	var res []CacheItem
+	err := filepath.Walk(c.walkRoot(prefix), func(fileName string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				// deleted while walking
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || strings.HasPrefix(info.Name(), tmpPrefix) {
+			return nil
+		}
+		name, ok := c.itemName(fileName)
+		if !ok || !strings.HasPrefix(name, prefix) {
+			return nil
+		}
+		res = append(res, CacheItem{Name: name, Size: info.Size(), ModTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "aposteriori listing %s", c.root)
+	}
+	return res, nil
+}
+
+// walkRoot returns the directory keeping all items with names starting with prefix, e.g. the directory of a module
+// for a prefix made of its path and a slash. It is the root for prefixes which are not made of whole path elements
+func (c *dirCache) walkRoot(prefix string) string {
+	pos := strings.LastIndexByte(prefix, '/')
+	if pos <= 0 {
+		return c.root
+	}
+	enc, err := module2.EncodePath(prefix[:pos])
+	if err != nil {
+		return c.root
+	}
+	return filepath.Join(c.root, filepath.FromSlash(enc))
+}
+
+// itemName returns name of the item kept in the file, ok is false for files which are not items
+func (c *dirCache) itemName(fileName string) (name string, ok bool) {
+	rel, err := filepath.Rel(c.root, fileName)
+	if err != nil {
+		return "", false
+	}
+	encMod, encVersion, item, ok := splitName(filepath.ToSlash(rel))
+	if !ok {
+		return "", false
+	}
+	mod, err := module2.DecodePath(encMod)
+	if err != nil {
+		return "", false
+	}
+	version, err := module2.DecodeVersion(encVersion)
+	if err != nil {
+		return "", false
+	}
+	return path.Join(mod, version, item), true
+}
+
+// Delete deletes the item and the directories left empty after it
+func (c *dirCache) Delete(name string) error {
+	fileName, err := c.fileName(name)
+	if err != nil {
+		return err
+	}
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	stat, err := os.Stat(fileName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Wrapf(err, "aposteriori deleting %s", name)
+	}
+	if err := os.Remove(fileName); err != nil {
+		return errors.Wrapf(err, "aposteriori deleting %s", name)
+	}
+	c.size -= stat.Size()
+	for dir := filepath.Dir(fileName); dir != c.root && strings.HasPrefix(dir, c.root); dir = filepath.Dir(dir) {
+		// fails on directories which are not empty
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
+
+// Size returns the number of bytes in items
+func (c *dirCache) Size() int64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.size
+}
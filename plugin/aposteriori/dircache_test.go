@@ -0,0 +1,138 @@
+package aposteriori
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDirCache(t *testing.T) {
+	root, err := ioutil.TempDir("", "aposteriori-dircache")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	cache, err := NewDirCache(root)
+	require.NoError(t, err)
+	require.Implements(t, (*SizedFileCache)(nil), cache)
+
+	items := map[string]string{
+		CachePath("example.com/lib", "v1.0.0", GoModName):  "module example.com/lib\n",
+		CachePath("example.com/lib", "v1.0.0", ZipName):    "zip",
+		CachePath("example.com/Lib", "v1.0.0", ZipName):    "other zip",
+		CachePath("example.com/lib/v2", "v2.0.0", ZipName): "zip v2",
+	}
+	var size int64
+	for name, content := range items {
+		require.NoError(t, cache.Set(name, strings.NewReader(content)))
+		size += int64(len(content))
+	}
+	require.Equal(t, size, cache.(SizedFileCache).Size())
+
+	// module paths differing in case only are kept apart
+	_, err = os.Stat(filepath.Join(root, "example.com", "!lib", "v1.0.0", ZipName))
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		prefix string
+		want   []string
+	}{
+		{
+			name:   "all",
+			prefix: "",
+			want: []string{
+				CachePath("example.com/Lib", "v1.0.0", ZipName),
+				CachePath("example.com/lib", "v1.0.0", GoModName),
+				CachePath("example.com/lib", "v1.0.0", ZipName),
+				CachePath("example.com/lib/v2", "v2.0.0", ZipName),
+			},
+		},
+		{
+			name:   "module",
+			prefix: "example.com/lib/",
+			want: []string{
+				CachePath("example.com/lib", "v1.0.0", GoModName),
+				CachePath("example.com/lib", "v1.0.0", ZipName),
+				CachePath("example.com/lib/v2", "v2.0.0", ZipName),
+			},
+		},
+		{
+			name:   "module-case",
+			prefix: "example.com/Lib/",
+			want:   []string{CachePath("example.com/Lib", "v1.0.0", ZipName)},
+		},
+		{
+			name:   "version",
+			prefix: "example.com/lib/v1.0.0/",
+			want: []string{
+				CachePath("example.com/lib", "v1.0.0", GoModName),
+				CachePath("example.com/lib", "v1.0.0", ZipName),
+			},
+		},
+		{
+			name:   "partial-element",
+			prefix: "example.com/li",
+			want: []string{
+				CachePath("example.com/lib", "v1.0.0", GoModName),
+				CachePath("example.com/lib", "v1.0.0", ZipName),
+				CachePath("example.com/lib/v2", "v2.0.0", ZipName),
+			},
+		},
+		{
+			name:   "none",
+			prefix: "example.org/",
+		},
+	}
+	// only the directory of the prefix is walked
+	require.Equal(t, filepath.Join(root, "example.com", "!lib"), cache.(*dirCache).walkRoot("example.com/Lib/"))
+	require.Equal(t, filepath.Join(root, "example.com"), cache.(*dirCache).walkRoot("example.com/li"))
+	require.Equal(t, root, cache.(*dirCache).walkRoot("exam"))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, err := cache.List(tt.prefix)
+			require.NoError(t, err)
+			var names []string
+			for _, item := range list {
+				names = append(names, item.Name)
+				require.Equal(t, int64(len(items[item.Name])), item.Size)
+			}
+			require.Equal(t, tt.want, names)
+		})
+	}
+
+	// replaced items are accounted once
+	name := CachePath("example.com/lib", "v1.0.0", ZipName)
+	require.NoError(t, cache.Set(name, strings.NewReader("longer zip")))
+	size += int64(len("longer zip") - len("zip"))
+	require.Equal(t, size, cache.(SizedFileCache).Size())
+	file, err := cache.Get(name)
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(file)
+	require.NoError(t, file.Close())
+	require.NoError(t, err)
+	require.Equal(t, "longer zip", string(data))
+
+	// the size is restored on reopening
+	reopened, err := NewDirCache(root)
+	require.NoError(t, err)
+	require.Equal(t, size, reopened.(SizedFileCache).Size())
+
+	// empty directories go with the last item
+	name = CachePath("example.com/lib/v2", "v2.0.0", ZipName)
+	require.NoError(t, cache.Delete(name))
+	require.NoError(t, cache.Delete(name))
+	_, err = cache.Get(name)
+	require.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(root, "example.com", "lib", "v2"))
+	require.True(t, os.IsNotExist(err))
+	_, err = os.Stat(filepath.Join(root, "example.com", "lib", "v1.0.0"))
+	require.NoError(t, err)
+	require.Equal(t, size-int64(len("zip v2")), cache.(SizedFileCache).Size())
+
+	require.Error(t, cache.Set("go.mod", strings.NewReader("")))
+	require.Error(t, cache.Set(CachePath("example.com/../lib", "v1.0.0", ZipName), strings.NewReader("")))
+}
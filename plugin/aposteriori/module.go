@@ -6,17 +6,22 @@ import (
 	"encoding/json"
 	"io"
 	"io/ioutil"
-	"path"
 	"sort"
 	"strings"
 
 	"github.com/rs/zerolog"
 	"github.com/sirkon/goproxy/internal/errors"
+	"go.opentelemetry.io/otel/attribute"
 
 	"github.com/sirkon/goproxy"
+	"github.com/sirkon/goproxy/metrics"
 	"github.com/sirkon/goproxy/semver"
+	"github.com/sirkon/goproxy/tracing"
 )
 
+// cacheHit span attribute telling if the data was found in the cache
+const cacheHit = "goproxy.cache.hit"
+
 type module struct {
 	parent *plugin
 	next   goproxy.Module
@@ -27,30 +32,81 @@ func (m *module) ModulePath() string {
 }
 
 func (m *module) Versions(ctx context.Context, prefix string) (tags []string, err error) {
-	if m.parent.registry != nil {
-		m.parent.Lock()
-		defer m.parent.Unlock()
-		versions, ok := m.parent.registry[m.ModulePath()]
+	ctx, span := tracing.Start(ctx, "aposteriori.Versions")
+	defer func() { tracing.End(span, err) }()
+
+	if m.parent.registry == nil {
+		return m.next.Versions(ctx, prefix)
+	}
+
+	tags, ok, stale := m.cachedVersions(prefix)
+	if !stale {
+		metrics.ObserveCache("aposteriori", ok)
+		span.SetAttributes(attribute.Bool(cacheHit, ok))
 		if ok {
 			zerolog.Ctx(ctx).Info().Msg("module versions list detected in a cache")
-			for version := range versions {
-				if strings.HasPrefix(version, prefix) {
-					tags = append(tags, version)
-				}
-			}
-			sort.Slice(tags, func(i, j int) bool {
-				return semver.Compare(tags[i], tags[j]) < 0
-			})
 		}
 		return tags, nil
 	}
-	return m.next.Versions(ctx, prefix)
+
+	metrics.ObserveCache("aposteriori", false)
+	span.SetAttributes(attribute.Bool(cacheHit, false))
+	upstream, err := m.next.Versions(ctx, prefix)
+	if err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("aposteriori getting versions of invalidated module, cached ones are served")
+		return tags, nil
+	}
+	merged := map[string]struct{}{}
+	for _, version := range append(tags, upstream...) {
+		merged[version] = struct{}{}
+	}
+
+	// upstream versions get into the registry once they are cached, the module is listed from the registry again
+	// after the full list is seen. A list with prefix may miss some versions
+	if len(prefix) == 0 {
+		m.parent.Lock()
+		delete(m.parent.stale, m.ModulePath())
+		m.parent.Unlock()
+	}
+	return sortedVersions(merged), nil
+}
+
+// cachedVersions returns versions of the module in the registry, ok tells if the module is there at all, stale
+// if it was invalidated
+func (m *module) cachedVersions(prefix string) (tags []string, ok, stale bool) {
+	m.parent.Lock()
+	defer m.parent.Unlock()
+	_, stale = m.parent.stale[m.ModulePath()]
+	versions, ok := m.parent.registry[m.ModulePath()]
+	matching := map[string]struct{}{}
+	for version := range versions {
+		if strings.HasPrefix(version, prefix) {
+			matching[version] = struct{}{}
+		}
+	}
+	return sortedVersions(matching), ok, stale
 }
 
-func (m *module) Stat(ctx context.Context, rev string) (*goproxy.RevInfo, error) {
+func sortedVersions(versions map[string]struct{}) []string {
+	var res []string
+	for version := range versions {
+		res = append(res, version)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return semver.Compare(res[i], res[j]) < 0
+	})
+	return res
+}
+
+func (m *module) Stat(ctx context.Context, rev string) (info *goproxy.RevInfo, err error) {
+	ctx, span := tracing.Start(ctx, "aposteriori.Stat")
+	defer func() { tracing.End(span, err) }()
+
 	if semver.IsValid(rev) {
-		p := m.relPath(rev, "revinfo.json")
+		p := m.relPath(rev, RevInfoName)
 		res, err := m.parent.cache.Get(p)
+		metrics.ObserveCache("aposteriori", err == nil)
+		span.SetAttributes(attribute.Bool(cacheHit, err == nil))
 		if err == nil {
 			zerolog.Ctx(ctx).Info().Msg("module revision info for given version detected in a cache")
 			defer func() {
@@ -61,7 +117,7 @@ func (m *module) Stat(ctx context.Context, rev string) (*goproxy.RevInfo, error)
 			var dst goproxy.RevInfo
 			unmr := json.NewDecoder(res)
 			if err := unmr.Decode(&dst); err != nil {
-				return nil, errors.Wrapf(err, "getting revision info: %s")
+				return nil, errors.Wrap(err, "getting revision info")
 			}
 			return &dst, nil
 		}
@@ -76,7 +132,7 @@ func (m *module) Stat(ctx context.Context, rev string) (*goproxy.RevInfo, error)
 	if err := mrsr.Encode(res); err != nil {
 		return nil, errors.Wrapf(err, "marshaling revision info")
 	}
-	p := m.relPath(res.Version, "revinfo.json")
+	p := m.relPath(res.Version, RevInfoName)
 	if err := m.parent.cache.Set(p, &dst); err != nil {
 		zerolog.Ctx(ctx).Error().Err(err).Msg("aposteriori failed to cache revision info")
 	}
@@ -84,12 +140,17 @@ func (m *module) Stat(ctx context.Context, rev string) (*goproxy.RevInfo, error)
 }
 
 func (m *module) relPath(version, name string) string {
-	return path.Join(m.next.ModulePath(), version, name)
+	return CachePath(m.next.ModulePath(), version, name)
 }
 
 func (m *module) GoMod(ctx context.Context, version string) (data []byte, err error) {
-	p := m.relPath(version, "go.mod")
+	ctx, span := tracing.Start(ctx, "aposteriori.GoMod")
+	defer func() { tracing.End(span, err) }()
+
+	p := m.relPath(version, GoModName)
 	res, err := m.parent.cache.Get(p)
+	metrics.ObserveCache("aposteriori", err == nil)
+	span.SetAttributes(attribute.Bool(cacheHit, err == nil))
 	if err == nil {
 		zerolog.Ctx(ctx).Info().Msg("module go.mod for given version detected in a cache")
 		defer func() {
@@ -159,12 +220,17 @@ func (r *cachingReadCloser) Close() error {
 	return err
 }
 
-func (m *module) Zip(ctx context.Context, version string) (io.ReadCloser, error) {
-	p := m.relPath(version, "src.zip")
-	file, err := m.parent.cache.Get(p)
+func (m *module) Zip(ctx context.Context, version string) (file io.ReadCloser, err error) {
+	ctx, span := tracing.Start(ctx, "aposteriori.Zip")
+	defer func() { tracing.End(span, err) }()
+
+	p := m.relPath(version, ZipName)
+	file, err = m.parent.cache.Get(p)
+	metrics.ObserveCache("aposteriori", err == nil)
+	span.SetAttributes(attribute.Bool(cacheHit, err == nil))
 	if err == nil {
 		zerolog.Ctx(ctx).Info().Msg("module source archive for given version detected in a cache")
-		return file, err
+		return file, nil
 	}
 	zerolog.Ctx(ctx).Debug().Err(err).Msg("no cached module source found")
 
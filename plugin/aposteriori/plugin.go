@@ -3,11 +3,14 @@ package aposteriori
 import (
 	"io"
 	"net/http"
+	"path"
 	"sync"
+	"time"
 
 	"github.com/sirkon/goproxy/internal/errors"
 
 	"github.com/sirkon/goproxy"
+	"github.com/sirkon/goproxy/metrics"
 )
 
 // FileCache caching primitive
@@ -16,14 +19,56 @@ type FileCache interface {
 	Set(name string, data io.Reader) error
 }
 
+// SizedFileCache FileCache knowing how many bytes it keeps, the size is reported in metrics
+type SizedFileCache interface {
+	FileCache
+	Size() int64
+}
+
+// CacheItem cached item with its size and the time it was saved
+type CacheItem struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
+}
+
+// ManagedFileCache FileCache which can enumerate and delete its items, it is needed for the cache administration
+type ManagedFileCache interface {
+	FileCache
+	// List returns items with names starting with prefix
+	List(prefix string) ([]CacheItem, error)
+	// Delete deletes the item, it is not an error to delete an item which is not there
+	Delete(name string) error
+}
+
+// Names of cached items of a module version
+const (
+	RevInfoName = "revinfo.json"
+	GoModName   = "go.mod"
+	ZipName     = "src.zip"
+)
+
+// CachePath returns name of the cached item with given name for module version
+func CachePath(mod, version, name string) string {
+	return path.Join(mod, version, name)
+}
+
 // New aposteriori plugin constructor
 func New(next goproxy.Plugin, cache FileCache) goproxy.Plugin {
-	return &plugin{next: next, cache: cache}
+	return newPlugin(next, cache, nil)
 }
 
 // NewCachePriority aposteriori plugin constructor with cache-priority behavior
 func NewCachePriority(next goproxy.Plugin, cache FileCache, availablity map[string]map[string]struct{}) goproxy.Plugin {
-	return &plugin{next: next, cache: cache, registry: availablity}
+	return newPlugin(next, cache, availablity)
+}
+
+func newPlugin(next goproxy.Plugin, cache FileCache, registry map[string]map[string]struct{}) *plugin {
+	res := &plugin{next: next, cache: cache, registry: registry, stale: map[string]struct{}{}}
+	if sized, ok := cache.(SizedFileCache); ok {
+		res.stopSize = metrics.CacheSize("aposteriori", sized.Size)
+	}
+	return res
 }
 
 type plugin struct {
@@ -31,6 +76,8 @@ type plugin struct {
 	next     goproxy.Plugin
 	cache    FileCache
 	registry map[string]map[string]struct{} // registry is <module path> → <version>
+	stale    map[string]struct{}            // invalidated modules, they may have versions missing in the registry
+	stopSize func()
 }
 
 func (p *plugin) Module(req *http.Request, prefix string) (goproxy.Module, error) {
@@ -50,9 +97,24 @@ func (p *plugin) Leave(source goproxy.Module) error {
 }
 
 func (p *plugin) Close() error {
+	if p.stopSize != nil {
+		p.stopSize()
+	}
 	return nil
 }
 
+// Invalidate makes the next version list of the module to be asked from upstream and merged with cached versions.
+// Versions upstream has are added into the registry once they are cached. The invalidation is passed to upstream as
+// well
+func (p *plugin) Invalidate(path string) {
+	if p.registry != nil {
+		p.Lock()
+		p.stale[path] = struct{}{}
+		p.Unlock()
+	}
+	goproxy.Invalidate(p.next, path)
+}
+
 func (p *plugin) String() string {
 	return "aposteriori"
 }
@@ -0,0 +1,82 @@
+package aposteriori
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sirkon/goproxy"
+	"github.com/sirkon/goproxy/internal/plugintest"
+	"github.com/sirkon/goproxy/plugin/apriori"
+)
+
+func TestInvalidate(t *testing.T) {
+	root, err := ioutil.TempDir("", "aposteriori-invalidate")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+	dir := filepath.Join(root, "example.com", "lib", "@v")
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	plugintest.WriteVersion(t, dir, "v1.0.0")
+	plugintest.WriteVersion(t, dir, "v1.1.0")
+	upstream, err := apriori.NewDirPlugin(root)
+	require.NoError(t, err)
+
+	cache := &managedCache{items: map[string][]byte{}}
+	registry := map[string]map[string]struct{}{
+		"example.com/lib": {"v1.0.0": {}},
+	}
+	plug := NewCachePriority(upstream, cache, registry)
+
+	ctx := context.Background()
+	req, err := goproxy.NewModuleRequest(ctx, "example.com/lib")
+	require.NoError(t, err)
+	mod, err := plug.Module(req, "")
+	require.NoError(t, err)
+
+	versions, err := mod.Versions(ctx, "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"v1.0.0"}, versions)
+
+	// invalidated module gets versions from upstream once
+	goproxy.Invalidate(plug, "example.com/lib")
+	versions, err = mod.Versions(ctx, "v1.")
+	require.NoError(t, err)
+	require.Equal(t, []string{"v1.0.0", "v1.1.0"}, versions)
+	require.NotEmpty(t, plug.(*plugin).stale)
+	versions, err = mod.Versions(ctx, "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"v1.0.0", "v1.1.0"}, versions)
+	require.Empty(t, plug.(*plugin).stale)
+	// upstream versions are not in the registry until they are cached
+	require.Equal(t, map[string]struct{}{"v1.0.0": {}}, registry["example.com/lib"])
+	versions, err = mod.Versions(ctx, "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"v1.0.0"}, versions)
+
+	// versions listed are fetched from upstream and cached
+	archive, err := mod.Zip(ctx, "v1.1.0")
+	require.NoError(t, err)
+	_, err = ioutil.ReadAll(archive)
+	require.NoError(t, err)
+	require.NoError(t, archive.Close())
+	require.Contains(t, cache.items, CachePath("example.com/lib", "v1.1.0", ZipName))
+	versions, err = mod.Versions(ctx, "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"v1.0.0", "v1.1.0"}, versions)
+
+	plugintest.WriteVersion(t, dir, "v1.2.0")
+	versions, err = mod.Versions(ctx, "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"v1.0.0", "v1.1.0"}, versions)
+
+	goproxy.Invalidate(plug, "example.com/lib")
+	versions, err = mod.Versions(ctx, "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"v1.0.0", "v1.1.0", "v1.2.0"}, versions)
+	require.Empty(t, plug.(*plugin).stale)
+	require.NotContains(t, registry["example.com/lib"], "v1.2.0")
+}
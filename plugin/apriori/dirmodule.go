@@ -0,0 +1,212 @@
+package apriori
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog"
+
+	"github.com/sirkon/goproxy/internal/errors"
+
+	"github.com/sirkon/goproxy"
+	"github.com/sirkon/goproxy/internal/module"
+	"github.com/sirkon/goproxy/semver"
+)
+
+var _ goproxy.LatestModule = &dirModule{}
+
+// dirModule module served from <root>/<escaped module path>/@v
+type dirModule struct {
+	path string
+	dir  string
+}
+
+func (s *dirModule) ModulePath() string {
+	return s.path
+}
+
+// Versions returns listed versions, retracted ones excluded
+func (s *dirModule) Versions(ctx context.Context, prefix string) (tags []string, err error) {
+	versions, err := s.readList()
+	if err != nil {
+		return nil, err
+	}
+	retracted, err := s.readRetracted()
+	if err != nil {
+		return nil, err
+	}
+	for _, version := range versions {
+		if retracted[version] {
+			continue
+		}
+		if !semver.IsValid(version) {
+			zerolog.Ctx(ctx).Warn().Str("version", version).Msg(s.errMsg("apriori invalid semver value ignored"))
+			continue
+		}
+		if !strings.HasPrefix(version, prefix) {
+			continue
+		}
+		tags = append(tags, version)
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		return semver.Compare(tags[i], tags[j]) < 0
+	})
+	return tags, nil
+}
+
+// readLines reads non-empty lines of the given file in the module directory. Returns os.IsNotExist error if there's
+// no such file
+func (s *dirModule) readLines(name string) ([]string, error) {
+	file, err := os.Open(filepath.Join(s.dir, name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, err
+		}
+		return nil, errors.Wrap(err, s.errMsg("apriori opening %s file", name))
+	}
+	defer file.Close()
+
+	var res []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) > 0 {
+			res = append(res, line)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrap(err, s.errMsg("apriori reading %s file", name))
+	}
+	return res, nil
+}
+
+// readRetracted reads versions from the optional retracted file
+func (s *dirModule) readRetracted() (map[string]bool, error) {
+	versions, err := s.readLines("retracted")
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	res := make(map[string]bool, len(versions))
+	for _, version := range versions {
+		res[version] = true
+	}
+	return res, nil
+}
+
+// readList reads versions from the list file. Versions are taken from .info files names if there's no list file
+func (s *dirModule) readList() ([]string, error) {
+	res, err := s.readLines("list")
+	if err == nil {
+		return res, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	items, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return nil, errors.Wrap(err, s.errMsg("apriori reading module directory"))
+	}
+	for _, item := range items {
+		name := item.Name()
+		if item.IsDir() || !strings.HasSuffix(name, ".info") {
+			continue
+		}
+		version, err := module.DecodeVersion(strings.TrimSuffix(name, ".info"))
+		if err != nil {
+			continue
+		}
+		res = append(res, version)
+	}
+	return res, nil
+}
+
+// Latest returns revision info stored in <root>/<escaped module path>/@latest if there's one, the highest listed
+// version which is not retracted is used otherwise
+func (s *dirModule) Latest(ctx context.Context) (*goproxy.RevInfo, error) {
+	file, err := os.Open(filepath.Join(filepath.Dir(s.dir), "@latest"))
+	if err == nil {
+		defer file.Close()
+		var res goproxy.RevInfo
+		decoder := json.NewDecoder(file)
+		if err := decoder.Decode(&res); err != nil {
+			return nil, errors.Wrap(err, s.errMsg("apriori decoding latest revision info"))
+		}
+		return &res, nil
+	}
+	if !os.IsNotExist(err) {
+		return nil, errors.Wrap(err, s.errMsg("apriori opening latest revision info"))
+	}
+
+	tags, err := s.Versions(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	latest := semver.Latest(tags)
+	if len(latest) == 0 {
+		return nil, errors.New(s.errMsg("apriori no versions available"))
+	}
+	return s.Stat(ctx, latest)
+}
+
+func (s *dirModule) Stat(ctx context.Context, rev string) (*goproxy.RevInfo, error) {
+	file, err := s.open(rev, ".info")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var res goproxy.RevInfo
+	decoder := json.NewDecoder(file)
+	if err := decoder.Decode(&res); err != nil {
+		return nil, errors.Wrap(err, s.errMsg("apriori decoding revision info for version %s", rev))
+	}
+	return &res, nil
+}
+
+func (s *dirModule) GoMod(ctx context.Context, version string) (data []byte, err error) {
+	file, err := s.open(version, ".mod")
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	data, err = ioutil.ReadAll(file)
+	if err != nil {
+		return nil, errors.Wrap(err, s.errMsg("getting go.mod file for version %s", version))
+	}
+	return
+}
+
+func (s *dirModule) Zip(ctx context.Context, version string) (file io.ReadCloser, err error) {
+	return s.open(version, ".zip")
+}
+
+// open opens <dir>/<escaped version><ext>
+func (s *dirModule) open(version, ext string) (*os.File, error) {
+	enc, err := module.EncodeVersion(version)
+	if err != nil {
+		return nil, errors.Wrap(err, s.errMsg("apriori encoding version %s", version))
+	}
+	file, err := os.Open(filepath.Join(s.dir, enc+ext))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.New(s.errMsg("apriori version %s not found", version))
+		}
+		return nil, errors.Wrap(err, s.errMsg("apriori opening %s file for version %s", ext, version))
+	}
+	return file, nil
+}
+
+func (s *dirModule) errMsg(format string, a ...interface{}) string {
+	head := "module " + s.path + ": "
+	return fmt.Sprintf(head+format, a...)
+}
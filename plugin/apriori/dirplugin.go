@@ -0,0 +1,67 @@
+package apriori
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/sirkon/goproxy/internal/errors"
+
+	"github.com/sirkon/goproxy"
+	"github.com/sirkon/goproxy/internal/module"
+)
+
+// NewDirPlugin "apriori" plugin which serves modules straight from a directory tree shaped like
+// $GOPATH/pkg/mod/cache/download, i.e. <escaped module path>/@v/<escaped version>.{info,mod,zip} plus the
+// <escaped module path>/@v/list file and optional <escaped module path>/@latest revision info. Versions listed one per
+// line in the optional <escaped module path>/@v/retracted file are neither listed nor chosen as latest, but are still
+// served when requested directly. Nothing is loaded in advance, so files put into the directory are served immediately
+func NewDirPlugin(root string) (goproxy.Plugin, error) {
+	stat, err := os.Stat(root)
+	if err != nil {
+		return nil, errors.Wrapf(err, "apriori getting directory %s", root)
+	}
+	if !stat.IsDir() {
+		return nil, errors.Newf("apriori %s is not a directory", root)
+	}
+	return &dirPlugin{root: root}, nil
+}
+
+type dirPlugin struct {
+	root string
+}
+
+func (p *dirPlugin) Module(req *http.Request, prefix string) (goproxy.Module, error) {
+	mod, _, err := goproxy.GetModInfo(req, prefix)
+	if err != nil {
+		return nil, err
+	}
+	enc, err := module.EncodePath(mod)
+	if err != nil {
+		return nil, errors.Wrapf(err, "apriori encoding module path %s", mod)
+	}
+	dir := filepath.Join(p.root, filepath.FromSlash(enc), "@v")
+	stat, err := os.Stat(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, errors.Newf("no module %s found in %s", mod, p.root)
+		}
+		return nil, errors.Wrapf(err, "apriori looking for module %s", mod)
+	}
+	if !stat.IsDir() {
+		return nil, errors.Newf("apriori %s is not a directory", dir)
+	}
+	return &dirModule{path: mod, dir: dir}, nil
+}
+
+func (p *dirPlugin) Leave(source goproxy.Module) error {
+	return nil
+}
+
+func (p *dirPlugin) Close() error {
+	return nil
+}
+
+func (p *dirPlugin) String() string {
+	return "apriori-dir"
+}
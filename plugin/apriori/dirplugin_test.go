@@ -0,0 +1,91 @@
+package apriori
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sirkon/goproxy"
+)
+
+func TestDirPlugin(t *testing.T) {
+	root, err := ioutil.TempDir("", "apriori-dir")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	dir := filepath.Join(root, "github.com", "!user", "project", "@v")
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	files := map[string]string{
+		"list":        "v0.1.0\nv0.2.0\nv1.0.0\ngarbage\n",
+		"v0.2.0.info": `{"Version":"v0.2.0","Time":"2019-01-02T03:04:05Z"}`,
+		"v0.2.0.mod":  "module github.com/User/project\n",
+		"v0.2.0.zip":  "zip",
+	}
+	for name, content := range files {
+		require.NoError(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+
+	p, err := NewDirPlugin(root)
+	require.NoError(t, err)
+
+	_, err = p.Module(httptest.NewRequest("GET", "/github.com/user/project/@v/list", nil), "")
+	require.Error(t, err)
+
+	mod, err := p.Module(httptest.NewRequest("GET", "/github.com/!user/project/@v/list", nil), "")
+	require.NoError(t, err)
+	require.Equal(t, "github.com/User/project", mod.ModulePath())
+
+	ctx := context.Background()
+	versions, err := mod.Versions(ctx, "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"v0.1.0", "v0.2.0", "v1.0.0"}, versions)
+
+	versions, err = mod.Versions(ctx, "v0.")
+	require.NoError(t, err)
+	require.Equal(t, []string{"v0.1.0", "v0.2.0"}, versions)
+
+	info, err := mod.Stat(ctx, "v0.2.0")
+	require.NoError(t, err)
+	require.Equal(t, "v0.2.0", info.Version)
+	require.Equal(t, "2019-01-02T03:04:05Z", info.Time)
+
+	gomod, err := mod.GoMod(ctx, "v0.2.0")
+	require.NoError(t, err)
+	require.Equal(t, files["v0.2.0.mod"], string(gomod))
+
+	zip, err := mod.Zip(ctx, "v0.2.0")
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(zip)
+	require.NoError(t, err)
+	require.NoError(t, zip.Close())
+	require.Equal(t, "zip", string(data))
+
+	_, err = mod.Stat(ctx, "v0.1.0")
+	require.Error(t, err)
+
+	// new versions appear without restart
+	require.NoError(t, os.Remove(filepath.Join(dir, "list")))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "v0.3.0.info"), []byte(`{"Version":"v0.3.0"}`), 0644))
+	versions, err = mod.Versions(ctx, "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"v0.2.0", "v0.3.0"}, versions)
+
+	// retracted versions are hidden from the list and latest but still served
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "retracted"), []byte("v0.3.0\n"), 0644))
+	versions, err = mod.Versions(ctx, "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"v0.2.0"}, versions)
+
+	latest, err := mod.(goproxy.LatestModule).Latest(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "v0.2.0", latest.Version)
+
+	info, err = mod.Stat(ctx, "v0.3.0")
+	require.NoError(t, err)
+	require.Equal(t, "v0.3.0", info.Version)
+}
@@ -7,6 +7,9 @@ import (
 	"io/ioutil"
 	"os"
 	"sort"
+	"strings"
+
+	"github.com/rs/zerolog"
 
 	"github.com/sirkon/goproxy/internal/errors"
 
@@ -14,6 +17,8 @@ import (
 	"github.com/sirkon/goproxy/semver"
 )
 
+var _ goproxy.LatestModule = &aprioriModule{}
+
 type aprioriModule struct {
 	path string
 	mod  map[string]ModuleInfo
@@ -24,13 +29,15 @@ func (s *aprioriModule) ModulePath() string {
 }
 
 func (s *aprioriModule) Versions(ctx context.Context, prefix string) (tags []string, err error) {
-	for version := range s.mod {
-		tags = append(tags, version)
-	}
-	for _, tag := range tags {
-		if !semver.IsValid(tag) {
-			return nil, errors.Newf("apriori invalid semver value %s", tag)
+	for version, info := range s.mod {
+		if !semver.IsValid(version) {
+			zerolog.Ctx(ctx).Warn().Str("version", version).Msg(s.errMsg("apriori invalid semver value ignored"))
+			continue
 		}
+		if info.Retracted || !strings.HasPrefix(version, prefix) {
+			continue
+		}
+		tags = append(tags, version)
 	}
 	sort.Slice(tags, func(i, j int) bool {
 		return semver.Compare(tags[i], tags[j]) < 0
@@ -38,6 +45,24 @@ func (s *aprioriModule) Versions(ctx context.Context, prefix string) (tags []str
 	return
 }
 
+func (s *aprioriModule) Latest(ctx context.Context) (*goproxy.RevInfo, error) {
+	for _, info := range s.mod {
+		if info.Latest {
+			res := info.RevInfo
+			return &res, nil
+		}
+	}
+	tags, err := s.Versions(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	latest := semver.Latest(tags)
+	if len(latest) == 0 {
+		return nil, errors.New(s.errMsg("apriori no versions available"))
+	}
+	return s.Stat(ctx, latest)
+}
+
 func (s *aprioriModule) Stat(ctx context.Context, rev string) (*goproxy.RevInfo, error) {
 	res, ok := s.mod[rev]
 	if !ok {
@@ -0,0 +1,66 @@
+package apriori
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sirkon/goproxy"
+)
+
+func TestAprioriModule(t *testing.T) {
+	info := func(version string) ModuleInfo {
+		return ModuleInfo{RevInfo: goproxy.RevInfo{Version: version}}
+	}
+	mod := &aprioriModule{
+		path: "github.com/user/project",
+		mod: map[string]ModuleInfo{
+			"v0.1.0": info("v0.1.0"),
+			"v0.2.0": info("v0.2.0"),
+			"v1.0.0": info("v1.0.0"),
+			"v1.1.0": {
+				RevInfo:   goproxy.RevInfo{Version: "v1.1.0"},
+				Retracted: true,
+			},
+			"master": info("master"),
+		},
+	}
+
+	ctx := context.Background()
+	versions, err := mod.Versions(ctx, "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"v0.1.0", "v0.2.0", "v1.0.0"}, versions)
+
+	versions, err = mod.Versions(ctx, "v0.")
+	require.NoError(t, err)
+	require.Equal(t, []string{"v0.1.0", "v0.2.0"}, versions)
+
+	latest, err := mod.Latest(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "v1.0.0", latest.Version)
+
+	// retracted versions are still served
+	retracted, err := mod.Stat(ctx, "v1.1.0")
+	require.NoError(t, err)
+	require.Equal(t, "v1.1.0", retracted.Version)
+
+	explicit := mod.mod["v0.2.0"]
+	explicit.Latest = true
+	mod.mod["v0.2.0"] = explicit
+	latest, err = mod.Latest(ctx)
+	require.NoError(t, err)
+	require.Equal(t, "v0.2.0", latest.Version)
+}
+
+func TestMappingCheck(t *testing.T) {
+	require.NoError(t, Mapping{
+		"a": {"v1.0.0": {Latest: true}, "v1.1.0": {}},
+	}.check())
+	require.Error(t, Mapping{
+		"a": {"v1.0.0": {Latest: true}, "v1.1.0": {Latest: true}},
+	}.check())
+	require.Error(t, Mapping{
+		"a": {"v1.0.0": {Latest: true, Retracted: true}},
+	}.check())
+}
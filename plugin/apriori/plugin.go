@@ -15,6 +15,12 @@ type ModuleInfo struct {
 	RevInfo     goproxy.RevInfo
 	GoModPath   string
 	ArchivePath string
+
+	// Latest marks the version to be served for @latest requests. Only one version of a module can be marked
+	Latest bool `json:",omitempty"`
+
+	// Retracted versions are neither listed nor picked as the latest, they are still served when requested directly
+	Retracted bool `json:",omitempty"`
 }
 
 // Mapping maps path → (version → module info)
@@ -32,9 +38,32 @@ func NewPlugin(path string) (goproxy.Plugin, error) {
 	if err := json.Unmarshal(data, &res.mapping); err != nil {
 		return nil, errors.Wrapf(err, "parsing apriori file %s", path)
 	}
+	if err := res.mapping.check(); err != nil {
+		return nil, errors.Wrapf(err, "checking apriori file %s", path)
+	}
 	return &res, nil
 }
 
+// check checks latest version declarations
+func (m Mapping) check() error {
+	for path, versions := range m {
+		var latest string
+		for version, info := range versions {
+			if !info.Latest {
+				continue
+			}
+			if info.Retracted {
+				return errors.Newf("module %s: retracted version %s cannot be the latest", path, version)
+			}
+			if len(latest) > 0 {
+				return errors.Newf("module %s: both %s and %s are declared as the latest", path, latest, version)
+			}
+			latest = version
+		}
+	}
+	return nil
+}
+
 type plugin struct {
 	mapping Mapping
 }
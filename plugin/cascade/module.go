@@ -3,16 +3,18 @@ package cascade
 import (
 	"context"
 	"encoding/json"
-	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/sirkon/goproxy/internal/errors"
 
 	"github.com/sirkon/goproxy"
+	"github.com/sirkon/goproxy/accesslog"
+	"github.com/sirkon/goproxy/metrics"
 )
 
 var _ goproxy.Module = &cascadeModule{}
@@ -20,7 +22,7 @@ var _ goproxy.Module = &cascadeModule{}
 type cascadeModule struct {
 	mod       string
 	reqMod    string
-	url       string
+	upstreams []*upstream
 	client    *http.Client
 	basicAuth struct {
 		ok       bool
@@ -34,7 +36,7 @@ func (s *cascadeModule) ModulePath() string {
 }
 
 func (s *cascadeModule) Versions(ctx context.Context, prefix string) (tags []string, err error) {
-	resp, err := s.makeRequest(ctx, fmt.Sprintf("%s/%s/@v/list", s.url, s.reqMod))
+	resp, err := s.makeRequest(ctx, "/@v/list")
 	if err != nil {
 		return nil, err
 	}
@@ -61,7 +63,7 @@ func (s *cascadeModule) Versions(ctx context.Context, prefix string) (tags []str
 }
 
 func (s *cascadeModule) Stat(ctx context.Context, rev string) (*goproxy.RevInfo, error) {
-	resp, err := s.makeRequest(ctx, fmt.Sprintf("%s/%s/@v/%s.info", s.url, s.reqMod, rev))
+	resp, err := s.makeRequest(ctx, "/@v/"+rev+".info")
 	if err != nil {
 		return nil, err
 	}
@@ -82,7 +84,7 @@ func (s *cascadeModule) Stat(ctx context.Context, rev string) (*goproxy.RevInfo,
 }
 
 func (s *cascadeModule) GoMod(ctx context.Context, version string) (data []byte, err error) {
-	resp, err := s.makeRequest(ctx, fmt.Sprintf("%s/%s/@v/%s.mod", s.url, s.reqMod, version))
+	resp, err := s.makeRequest(ctx, "/@v/"+version+".mod")
 	if err != nil {
 		return nil, err
 	}
@@ -102,7 +104,7 @@ func (s *cascadeModule) GoMod(ctx context.Context, version string) (data []byte,
 }
 
 func (s *cascadeModule) Zip(ctx context.Context, version string) (file io.ReadCloser, err error) {
-	resp, err := s.makeRequest(ctx, fmt.Sprintf("%s/%s/@v/%s.zip", s.url, s.reqMod, version))
+	resp, err := s.makeRequest(ctx, "/@v/"+version+".zip")
 	if err != nil {
 		return nil, err
 	}
@@ -110,15 +112,56 @@ func (s *cascadeModule) Zip(ctx context.Context, version string) (file io.ReadCl
 	return resp.Body, nil
 }
 
-func (s *cascadeModule) makeRequest(ctx context.Context, url string) (*http.Response, error) {
+// makeRequest requests upstreams one by one with the given suffix of module path until success. The next upstream is
+// tried on 404 and 410 or on any error if the upstream is followed by | in the list. Unhealthy upstreams are skipped
+// unless it is the last one
+func (s *cascadeModule) makeRequest(ctx context.Context, suffix string) (*http.Response, error) {
+	var errs []string
+	var lastErr error
+	for i, up := range s.upstreams {
+		if i < len(s.upstreams)-1 && !up.healthy() {
+			zerolog.Ctx(ctx).Debug().Str("upstream", up.url).Msg("cascade skipping unhealthy upstream")
+			errs = append(errs, up.url+" skipped as unhealthy")
+			continue
+		}
+
+		start := time.Now()
+		resp, err := s.request(ctx, up, up.url+"/"+s.reqMod+suffix)
+		metrics.ObserveUpstream("cascade", metrics.Endpoint(suffix), start, err)
+		// requests given up by the client tell nothing about the upstream
+		if ctx.Err() == nil {
+			up.report(err)
+		}
+		if err == nil {
+			return resp, nil
+		}
+		if len(s.upstreams) == 1 {
+			return nil, err
+		}
+		zerolog.Ctx(ctx).Warn().Err(err).Str("upstream", up.url).Msg("cascade upstream failed")
+		errs = append(errs, err.Error())
+		lastErr = err
+		if ctx.Err() != nil || (!isNotFound(err) && !up.fallThroughAny) {
+			break
+		}
+	}
+	if lastErr == nil {
+		lastErr = errors.New("no upstream requested")
+	}
+	return nil, errors.Wrapf(lastErr, "cascade all upstreams failed (%s)", strings.Join(errs, "; "))
+}
+
+// request requests the url of the upstream, credentials are set only if the upstream is to get them
+func (s *cascadeModule) request(ctx context.Context, up *upstream, url string) (*http.Response, error) {
 	req, err := http.NewRequest(http.MethodGet, url, nil)
 	if err != nil {
 		return nil, errors.Wrapf(err, "cascade making new request to %s", url)
 	}
-	if s.basicAuth.ok {
+	if s.basicAuth.ok && up.passCreds {
 		req.SetBasicAuth(s.basicAuth.user, s.basicAuth.password)
 	}
 	req = req.WithContext(ctx)
+	accesslog.SetRequestID(req)
 
 	resp, err := s.client.Do(req)
 	if err != nil {
@@ -135,7 +178,11 @@ func (s *cascadeModule) makeRequest(ctx context.Context, url string) (*http.Resp
 		if err != nil {
 			return nil, errors.Wrapf(err, "cascade getting a response from %s", url)
 		}
-		return nil, errors.Newf("cascade unexpected status code %d (%s)", resp.StatusCode, string(data))
+		return nil, &statusError{
+			url:  url,
+			code: resp.StatusCode,
+			body: string(data),
+		}
 	}
 
 	return resp, nil
@@ -0,0 +1,166 @@
+package cascade
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sirkon/goproxy"
+	"github.com/sirkon/goproxy/accesslog"
+)
+
+func upstreamServer(code int, body string, hits *int) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		*hits++
+		w.WriteHeader(code)
+		_, _ = io.WriteString(w, body)
+	}))
+}
+
+func TestParseUpstreams(t *testing.T) {
+	ups, err := parseUpstreams("https://a/, creds+https://b|https://c")
+	require.NoError(t, err)
+	require.Len(t, ups, 3)
+	require.Equal(t, "https://a", ups[0].url)
+	require.Equal(t, "https://b", ups[1].url)
+	require.False(t, ups[0].fallThroughAny)
+	require.True(t, ups[1].fallThroughAny)
+	require.False(t, ups[2].fallThroughAny)
+	require.False(t, ups[0].passCreds)
+	require.True(t, ups[1].passCreds)
+	require.False(t, ups[2].passCreds)
+
+	_, err = parseUpstreams("https://a,direct")
+	require.Error(t, err)
+	_, err = parseUpstreams(" , ")
+	require.Error(t, err)
+}
+
+func TestCascadeFailover(t *testing.T) {
+	var notFoundHits, brokenHits, okHits int
+	notFound := upstreamServer(http.StatusNotFound, "not found", &notFoundHits)
+	defer notFound.Close()
+	broken := upstreamServer(http.StatusInternalServerError, "broken", &brokenHits)
+	defer broken.Close()
+	ok := upstreamServer(http.StatusOK, "v1.0.0\nv1.1.0\n", &okHits)
+	defer ok.Close()
+
+	versions := func(list string) ([]string, error) {
+		p, err := NewPluginList(list)
+		require.NoError(t, err)
+		ctx := context.Background()
+		req, err := goproxy.NewModuleRequest(ctx, "example.com/lib")
+		require.NoError(t, err)
+		mod, err := p.Module(req, "")
+		require.NoError(t, err)
+		return mod.Versions(ctx, "")
+	}
+
+	// , falls through on 404
+	res, err := versions(notFound.URL + "," + ok.URL)
+	require.NoError(t, err)
+	require.Equal(t, []string{"v1.0.0", "v1.1.0"}, res)
+
+	// , stops on other errors
+	_, err = versions(broken.URL + "," + ok.URL)
+	require.Error(t, err)
+
+	// | falls through on any error
+	res, err = versions(broken.URL + "|" + ok.URL)
+	require.NoError(t, err)
+	require.Equal(t, []string{"v1.0.0", "v1.1.0"}, res)
+
+	// failing upstream is skipped after several failures
+	p, err := NewPluginList(broken.URL + "|" + ok.URL)
+	require.NoError(t, err)
+	ctx := context.Background()
+	req, err := goproxy.NewModuleRequest(ctx, "example.com/lib")
+	require.NoError(t, err)
+	mod, err := p.Module(req, "")
+	require.NoError(t, err)
+	brokenHits = 0
+	for i := 0; i < failureThreshold+2; i++ {
+		_, err := mod.Versions(ctx, "")
+		require.NoError(t, err)
+	}
+	require.Equal(t, failureThreshold, brokenHits)
+}
+
+func TestCascadeRequestID(t *testing.T) {
+	var requestID string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requestID = req.Header.Get(accesslog.RequestIDHeader)
+		_, _ = io.WriteString(w, "v1.0.0\n")
+	}))
+	defer server.Close()
+
+	ctx := accesslog.WithRequestID(context.Background(), "request-1")
+	req, err := goproxy.NewModuleRequest(ctx, "example.com/lib")
+	require.NoError(t, err)
+	mod, err := NewPlugin(server.URL).Module(req, "")
+	require.NoError(t, err)
+	_, err = mod.Versions(ctx, "")
+	require.NoError(t, err)
+	require.Equal(t, "request-1", requestID)
+}
+
+func TestCascadePassCreds(t *testing.T) {
+	var privateUser, publicUser string
+	private := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		privateUser, _, _ = req.BasicAuth()
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	defer private.Close()
+	public := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		publicUser, _, _ = req.BasicAuth()
+		_, _ = io.WriteString(w, "v1.0.0\n")
+	}))
+	defer public.Close()
+
+	always := func(*http.Request) bool { return true }
+	_, err := NewPluginListPassCreds(private.URL+","+public.URL, always)
+	require.Error(t, err)
+
+	p, err := NewPluginListPassCreds(credsPrefix+private.URL+","+public.URL, always)
+	require.NoError(t, err)
+	ctx := context.Background()
+	req, err := goproxy.NewModuleRequest(ctx, "example.com/lib")
+	require.NoError(t, err)
+	req.SetBasicAuth("user", "password")
+	mod, err := p.Module(req, "")
+	require.NoError(t, err)
+	_, err = mod.Versions(ctx, "")
+	require.NoError(t, err)
+	require.Equal(t, "user", privateUser)
+	require.Empty(t, publicUser)
+}
+
+func TestCascadeClientCancel(t *testing.T) {
+	slow := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		<-req.Context().Done()
+	}))
+	defer slow.Close()
+	var okHits int
+	ok := upstreamServer(http.StatusOK, "v1.0.0\n", &okHits)
+	defer ok.Close()
+
+	p, err := NewPluginList(slow.URL + "|" + ok.URL)
+	require.NoError(t, err)
+	req, err := goproxy.NewModuleRequest(context.Background(), "example.com/lib")
+	require.NoError(t, err)
+	mod, err := p.Module(req, "")
+	require.NoError(t, err)
+	for i := 0; i < failureThreshold+1; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		_, err := mod.Versions(ctx, "")
+		cancel()
+		require.Error(t, err)
+	}
+	require.True(t, p.(*plugin).upstreams[0].healthy())
+	require.Zero(t, okHits)
+}
@@ -6,23 +6,57 @@ import (
 	"github.com/sirkon/goproxy/internal/errors"
 
 	"github.com/sirkon/goproxy"
+	"github.com/sirkon/goproxy/auth"
 	"github.com/sirkon/goproxy/internal/module"
+	"github.com/sirkon/goproxy/tracing"
 )
 
+// newClient client of upstream proxies, it passes trace context to them
+func newClient() *http.Client {
+	return &http.Client{Transport: tracing.Transport(nil)}
+}
+
 // NewPlugin plugin returning source pointing to another proxy
 func NewPlugin(url string) goproxy.Plugin {
-	return &plugin{url: url, client: &http.Client{}, passCreds: nil}
+	return &plugin{upstreams: []*upstream{{url: url}}, client: newClient(), passCreds: nil}
 }
 
-// NewPluginPassCreds this gets a function deciding is it worth to pass BasicAuth further
+// NewPluginPassCreds this gets a function deciding is it worth to pass credentials further, see auth.Credentials
 func NewPluginPassCreds(url string, passCreds func(r *http.Request) bool) goproxy.Plugin {
-	return &plugin{url: url, client: &http.Client{}, passCreds: passCreds}
+	return &plugin{upstreams: []*upstream{{url: url, passCreds: true}}, client: newClient(), passCreds: passCreds}
+}
+
+// NewPluginList plugin returning source pointing to a list of proxies with GOPROXY semantics: proxy URLs are separated
+// with , or |, the next proxy is tried after 404 and 410 responses in case of , and after any error in case of |.
+// Proxies failing again and again are skipped for a while
+func NewPluginList(list string) (goproxy.Plugin, error) {
+	return NewPluginListPassCreds(list, nil)
+}
+
+// NewPluginListPassCreds NewPluginList with a function deciding is it worth to pass credentials further. Credentials
+// are passed only to upstreams marked with creds+ prefix, e.g. creds+https://proxy.corp.example.com,https://proxy.golang.org
+// passes them to the corporate proxy and never to the public one
+func NewPluginListPassCreds(list string, passCreds func(r *http.Request) bool) (goproxy.Plugin, error) {
+	upstreams, err := parseUpstreams(list)
+	if err != nil {
+		return nil, err
+	}
+	if passCreds != nil {
+		var marked bool
+		for _, up := range upstreams {
+			marked = marked || up.passCreds
+		}
+		if !marked {
+			return nil, errors.Newf("cascade no upstream is marked with %s to pass credentials to", credsPrefix)
+		}
+	}
+	return &plugin{upstreams: upstreams, client: newClient(), passCreds: passCreds}, nil
 }
 
 // plugin of sources for another go proxy
 type plugin struct {
 	client    *http.Client
-	url       string
+	upstreams []*upstream
 	passCreds func(req *http.Request) bool
 }
 
@@ -41,13 +75,13 @@ func (f *plugin) Module(req *http.Request, prefix string) (goproxy.Module, error
 	}
 
 	res := &cascadeModule{
-		mod:    path,
-		reqMod: reqPath,
-		url:    f.url,
-		client: f.client,
+		mod:       path,
+		reqMod:    reqPath,
+		upstreams: f.upstreams,
+		client:    f.client,
 	}
 	if f.passCreds != nil {
-		if user, pass, ok := req.BasicAuth(); ok && f.passCreds(req) {
+		if user, pass, ok := auth.Credentials(req); ok && f.passCreds(req) {
 			res.basicAuth.ok = true
 			res.basicAuth.user = user
 			res.basicAuth.password = pass
@@ -0,0 +1,121 @@
+package cascade
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirkon/goproxy/internal/errors"
+)
+
+// credsPrefix marks upstreams of a list credentials of requests are passed to
+const credsPrefix = "creds+"
+
+var (
+	// failureThreshold is a number of consecutive failures after which an upstream is considered unhealthy
+	failureThreshold = 3
+
+	// cooldown is how long an unhealthy upstream is skipped
+	cooldown = 30 * time.Second
+)
+
+// upstream is a go proxy cascade falls back to
+type upstream struct {
+	url string
+
+	// fallThroughAny is true for upstreams followed by | in the list: the next upstream is tried on any error,
+	// not just on 404 and 410
+	fallThroughAny bool
+
+	// passCreds is true for upstreams credentials of requests are passed to, these are marked with creds+ in the list
+	passCreds bool
+
+	lock     sync.Mutex
+	failures int
+	skipTill time.Time
+}
+
+// parseUpstreams parses GOPROXY-like list of proxy URLs separated by , or |. URLs may be prefixed with creds+ to pass
+// credentials of requests to them
+func parseUpstreams(list string) ([]*upstream, error) {
+	var res []*upstream
+	for len(list) > 0 {
+		var item string
+		var fallThroughAny bool
+		pos := strings.IndexAny(list, ",|")
+		if pos >= 0 {
+			item, fallThroughAny, list = list[:pos], list[pos] == '|', list[pos+1:]
+		} else {
+			item, list = list, ""
+		}
+		item = strings.TrimRight(strings.TrimSpace(item), "/")
+		passCreds := strings.HasPrefix(item, credsPrefix)
+		item = strings.TrimPrefix(item, credsPrefix)
+		switch item {
+		case "":
+			continue
+		case "direct", "off":
+			return nil, errors.Newf("cascade %s is not supported in upstream list", item)
+		}
+		res = append(res, &upstream{
+			url:            item,
+			fallThroughAny: fallThroughAny,
+			passCreds:      passCreds,
+		})
+	}
+	if len(res) == 0 {
+		return nil, errors.New("cascade no upstreams given")
+	}
+	return res, nil
+}
+
+// healthy checks if upstream is not in a cooldown
+func (u *upstream) healthy() bool {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	return time.Now().After(u.skipTill)
+}
+
+// report records an outcome of a request to the upstream. Only failures which are not the upstream's legit answer
+// (network errors, 5xx, etc) count
+func (u *upstream) report(err error) {
+	u.lock.Lock()
+	defer u.lock.Unlock()
+	if err == nil || isNotFound(err) {
+		u.failures = 0
+		return
+	}
+	u.failures++
+	if u.failures >= failureThreshold {
+		u.skipTill = time.Now().Add(cooldown)
+		u.failures = 0
+	}
+}
+
+// statusError is an error of unexpected response status
+type statusError struct {
+	url  string
+	code int
+	body string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("cascade unexpected status code %d from %s (%s)", e.code, e.url, e.body)
+}
+
+// isNotFound checks if err is 404 or 410 response, these are the ones to fall through on for , separator
+func isNotFound(err error) bool {
+	for err != nil {
+		if v, ok := err.(*statusError); ok {
+			return v.code == http.StatusNotFound || v.code == http.StatusGone
+		}
+		u, ok := err.(interface{ Unwrap() error })
+		if !ok {
+			return false
+		}
+		err = u.Unwrap()
+	}
+	return false
+}
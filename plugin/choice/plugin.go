@@ -6,8 +6,10 @@ import (
 	"strings"
 
 	"github.com/sirkon/goproxy/internal/errors"
+	"go.opentelemetry.io/otel/attribute"
 
 	"github.com/sirkon/goproxy"
+	"github.com/sirkon/goproxy/tracing"
 )
 
 // New plugin which tries to return a source with each plugin consequently until success. Made specially for
@@ -32,7 +34,9 @@ func (c *choice) String() string {
 
 func (c *choice) Module(req *http.Request, prefix string) (goproxy.Module, error) {
 	for _, plug := range c.plugs {
-		src, err := plug.Module(req, prefix)
+		ctx, span := tracing.Start(req.Context(), "choice.Module", attribute.String("goproxy.plugin", plug.String()))
+		src, err := plug.Module(req.WithContext(ctx), prefix)
+		tracing.End(span, err)
 		if err != nil {
 			continue
 		}
@@ -48,3 +52,9 @@ func (c *choice) Leave(source goproxy.Module) error {
 func (c *choice) Close() error {
 	return nil
 }
+
+func (c *choice) Invalidate(path string) {
+	for _, plug := range c.plugs {
+		goproxy.Invalidate(plug, path)
+	}
+}
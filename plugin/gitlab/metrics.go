@@ -0,0 +1,67 @@
+package gitlab
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/sirkon/gitlab"
+	"github.com/sirkon/gitlab/gitlabdata"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/sirkon/goproxy/metrics"
+	"github.com/sirkon/goproxy/tracing"
+)
+
+// instrumentedClient records latencies of gitlab API calls and makes spans of them. Plugins made with NewPluginURL and
+// NewPluginURLToken also pass trace context to the gitlab itself
+type instrumentedClient struct {
+	client gitlab.Client
+}
+
+// call is a running call of gitlab API
+type call struct {
+	operation string
+	start     time.Time
+	span      trace.Span
+}
+
+func startCall(ctx context.Context, operation string) (context.Context, *call) {
+	ctx, span := tracing.Start(ctx, "gitlab."+operation)
+	return ctx, &call{operation: operation, start: time.Now(), span: span}
+}
+
+func (c *call) end(err error) {
+	metrics.ObserveUpstream("gitlab", c.operation, c.start, err)
+	tracing.End(c.span, err)
+}
+
+func (c instrumentedClient) Tags(ctx context.Context, project, tagPrefix string) (res []*gitlabdata.Tag, err error) {
+	ctx, cl := startCall(ctx, "tags")
+	defer func() { cl.end(err) }()
+	return c.client.Tags(ctx, project, tagPrefix)
+}
+
+func (c instrumentedClient) File(ctx context.Context, project, path, ref string) (res []byte, err error) {
+	ctx, cl := startCall(ctx, "file")
+	defer func() { cl.end(err) }()
+	return c.client.File(ctx, project, path, ref)
+}
+
+func (c instrumentedClient) ProjectInfo(ctx context.Context, project string) (res *gitlabdata.Project, err error) {
+	ctx, cl := startCall(ctx, "project")
+	defer func() { cl.end(err) }()
+	return c.client.ProjectInfo(ctx, project)
+}
+
+func (c instrumentedClient) Archive(ctx context.Context, projectID int, ref string) (res io.ReadCloser, err error) {
+	ctx, cl := startCall(ctx, "archive")
+	defer func() { cl.end(err) }()
+	return c.client.Archive(ctx, projectID, ref)
+}
+
+func (c instrumentedClient) Commits(ctx context.Context, project string, ref string) (res []*gitlabdata.Commit, err error) {
+	ctx, cl := startCall(ctx, "commits")
+	defer func() { cl.end(err) }()
+	return c.client.Commits(ctx, project, ref)
+}
@@ -12,6 +12,7 @@ import (
 	"github.com/rs/zerolog"
 	"github.com/sirkon/gitlab"
 	"github.com/sirkon/gitlab/gitlabdata"
+	"go.opentelemetry.io/otel/attribute"
 
 	"github.com/sirkon/goproxy/internal/errors"
 
@@ -19,6 +20,7 @@ import (
 	"github.com/sirkon/goproxy/fsrepack"
 	"github.com/sirkon/goproxy/gomod"
 	"github.com/sirkon/goproxy/semver"
+	"github.com/sirkon/goproxy/tracing"
 )
 
 type gitlabModule struct {
@@ -252,7 +254,7 @@ func (s *gitlabModule) Zip(ctx context.Context, version string) (io.ReadCloser,
 	return s.getZip(ctx, version, version)
 }
 
-func (s *gitlabModule) getZip(ctx context.Context, revision, version string) (io.ReadCloser, error) {
+func (s *gitlabModule) getZip(ctx context.Context, revision, version string) (_ io.ReadCloser, err error) {
 	modInfo, err := s.client.ProjectInfo(ctx, s.pathUnversioned)
 	if err != nil {
 		modInfo, err = s.client.ProjectInfo(ctx, s.path)
@@ -265,6 +267,8 @@ func (s *gitlabModule) getZip(ctx context.Context, revision, version string) (io
 	if err != nil {
 		return nil, errors.Wrap(err, "getting zipped archive data")
 	}
+	_, span := tracing.Start(ctx, "gitlab.repack", attribute.String("goproxy.revision", revision))
+	defer func() { tracing.End(span, err) }()
 
 	repacker, err := fsrepack.Gitlab(s.fullPath, version)
 	if err != nil {
@@ -11,6 +11,8 @@ import (
 	"github.com/sirkon/goproxy/internal/errors"
 
 	"github.com/sirkon/goproxy"
+	"github.com/sirkon/goproxy/auth"
+	"github.com/sirkon/goproxy/tracing"
 )
 
 // plugin of sources for gitlab
@@ -58,6 +60,21 @@ func NewPluginGitlabTokenClient(token string, access gitlab.APIAccess) goproxy.P
 	}
 }
 
+// newClient client of gitlab API, it passes trace context to the gitlab
+func newClient() *http.Client {
+	return &http.Client{Transport: tracing.Transport(nil)}
+}
+
+// NewPluginURL constructor with access to gitlab API at url
+func NewPluginURL(url string, needAuth bool) goproxy.Plugin {
+	return NewPlugin(gitlab.NewAPIAccess(newClient(), url), needAuth)
+}
+
+// NewPluginURLToken constructor with access to gitlab API at url
+func NewPluginURLToken(url string, token string) goproxy.Plugin {
+	return NewPluginToken(gitlab.NewAPIAccess(newClient(), url), token)
+}
+
 func getGitlabPath(fullPath string) string {
 	pos := strings.IndexByte(fullPath, '/')
 	if pos >= 0 {
@@ -77,20 +94,27 @@ func (f *plugin) Module(req *http.Request, prefix string) (goproxy.Module, error
 
 	var token string
 	if f.needAuth && len(f.token) == 0 {
-		var ok bool
-		token, _, ok = req.BasicAuth()
-		if !ok || len(token) == 0 {
+		// the forwardable secret of an authenticated principal is the token, basic auth user name is if there is no
+		// principal. Credentials of principals of the proxy itself are never passed to gitlab
+		if p := auth.FromContext(req.Context()); p == nil {
+			token, _, _ = req.BasicAuth()
+		} else if p.Forwardable {
+			token = p.Secret
+		}
+		if len(token) == 0 {
 			return nil, errors.New("gitlab authorization info required")
 		}
 	} else if f.needAuth {
 		token = f.token
 	}
 
+	client := instrumentedClient{client: f.apiAccess.Client(token)}
+
 	// cut the tail and see if it denounces version suffix (vXYZ)
 	pos := strings.LastIndexByte(fullPath, '/')
 	if pos < 0 {
 		return &gitlabModule{
-			client:          f.apiAccess.Client(token),
+			client:          client,
 			fullPath:        fullPath,
 			path:            path,
 			pathUnversioned: path,
@@ -102,7 +126,7 @@ func (f *plugin) Module(req *http.Request, prefix string) (goproxy.Module, error
 	var ve pathVersionExtractor
 	if ok, _ := ve.Extract(tail); !ok {
 		return &gitlabModule{
-			client:          f.apiAccess.Client(token),
+			client:          client,
 			fullPath:        fullPath,
 			path:            path,
 			pathUnversioned: path,
@@ -113,7 +137,7 @@ func (f *plugin) Module(req *http.Request, prefix string) (goproxy.Module, error
 	unversionedPath, base := path2.Split(path)
 	if isVersion(base) {
 		return &gitlabModule{
-			client:          f.apiAccess.Client(token),
+			client:          client,
 			fullPath:        fullPath,
 			path:            path,
 			pathUnversioned: strings.Trim(unversionedPath, "/"),
@@ -121,7 +145,7 @@ func (f *plugin) Module(req *http.Request, prefix string) (goproxy.Module, error
 		}, nil
 	} else {
 		return &gitlabModule{
-			client:          f.apiAccess.Client(token),
+			client:          client,
 			fullPath:        fullPath,
 			path:            path,
 			pathUnversioned: path,
@@ -0,0 +1,87 @@
+package gitlab
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+
+	"github.com/sirkon/goproxy/auth"
+	"github.com/sirkon/goproxy/tracing"
+)
+
+func TestNewPluginURLTraceContext(t *testing.T) {
+	provider := sdktrace.NewTracerProvider()
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		_ = provider.Shutdown(context.Background())
+	})
+
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		traceparent = req.Header.Get("traceparent")
+		_, _ = w.Write([]byte("[]"))
+	}))
+	defer server.Close()
+
+	f := NewPluginURLToken(server.URL, "token").(*plugin)
+	ctx, span := tracing.Start(context.Background(), "test")
+	client := instrumentedClient{client: f.apiAccess.Client(f.token)}
+	_, err := client.Tags(ctx, "user/project", "")
+	span.End()
+	require.NoError(t, err)
+	require.NotEmpty(t, traceparent)
+	require.Contains(t, traceparent, span.SpanContext().TraceID().String())
+}
+
+func TestPluginToken(t *testing.T) {
+	tests := []struct {
+		name      string
+		principal *auth.Principal
+		user      string
+		wantErr   bool
+	}{
+		{
+			name: "anonymous-basic-auth",
+			user: "token",
+		},
+		{
+			name:    "anonymous",
+			wantErr: true,
+		},
+		{
+			name:      "forwardable",
+			principal: &auth.Principal{Name: "ci", Secret: "token", Forwardable: true},
+		},
+		{
+			name:      "proxy-principal",
+			principal: &auth.Principal{Name: "alice", Secret: "password"},
+			user:      "alice",
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := NewPluginURL("http://gitlab.example.com/api/v4", true)
+			req := httptest.NewRequest(http.MethodGet, "/gitlab.example.com/group/project/@v/list", nil)
+			if len(tt.user) > 0 {
+				req.SetBasicAuth(tt.user, "password")
+			}
+			if tt.principal != nil {
+				req = req.WithContext(auth.WithPrincipal(req.Context(), tt.principal))
+			}
+			_, err := f.Module(req, "")
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,237 @@
+package gitlab
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/rs/zerolog"
+
+	"github.com/sirkon/goproxy"
+	"github.com/sirkon/goproxy/internal/errors"
+	"github.com/sirkon/goproxy/semver"
+)
+
+// Events of GitLab webhooks the receiver handles, they come in X-Gitlab-Event header
+const (
+	PushEvent    = "Push Hook"
+	TagPushEvent = "Tag Push Hook"
+)
+
+const (
+	tokenHeader = "X-Gitlab-Token"
+	eventHeader = "X-Gitlab-Event"
+
+	tagRefPrefix = "refs/tags/"
+	zeroSHA      = "0000000000000000000000000000000000000000"
+)
+
+// maxPayloadSize push events of big pushes carry lots of commits, they are not needed though
+const maxPayloadSize = 16 << 20
+
+// maxPrefetches prefetches running at once, versions pushed while there are that many are not prefetched
+const maxPrefetches = 4
+
+// pushPayload fields of push and tag push events the receiver needs
+type pushPayload struct {
+	ObjectKind string `json:"object_kind"`
+	Ref        string `json:"ref"`
+	After      string `json:"after"`
+	Project    struct {
+		WebURL string `json:"web_url"`
+	} `json:"project"`
+}
+
+// Webhook receives GitLab push and tag push events. Modules of the pushed project are invalidated in the router, so
+// their new versions are seen, see goproxy.Invalidator. Versions of pushed tags are fetched through the router right
+// away if prefetching is on. Module paths are made of project web URLs: https://gitlab.example.com/group/project is
+// gitlab.example.com/group/project, tag sub/v1.2.0 is of gitlab.example.com/group/project/sub module, tag v2.0.0 of
+// gitlab.example.com/group/project/v2
+type Webhook struct {
+	router   *goproxy.Router
+	secret   string
+	prefetch bool
+	token    string
+
+	prefetches chan struct{}
+	wg         sync.WaitGroup
+}
+
+// NewWebhook creates webhook receiver of events with the secret token, the secret is required
+func NewWebhook(router *goproxy.Router, secret string, prefetch bool) (*Webhook, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("gitlab webhook secret token is required")
+	}
+	return &Webhook{
+		router:     router,
+		secret:     secret,
+		prefetch:   prefetch,
+		prefetches: make(chan struct{}, maxPrefetches),
+	}, nil
+}
+
+// SetToken sets GitLab token versions are prefetched with. It is passed the way go clients do: as a basic auth user
+// name. Prefetches of modules served by plugins requiring authorization fail without it, see NewPlugin
+func (h *Webhook) SetToken(token string) {
+	h.token = token
+}
+
+// Close waits for prefetches in progress
+func (h *Webhook) Close() error {
+	h.wg.Wait()
+	return nil
+}
+
+// pushedModule module and version of a pushed ref, version is empty for branches and deleted tags
+func pushedModule(payload *pushPayload) (mod, version string, err error) {
+	web, err := url.Parse(payload.Project.WebURL)
+	if err != nil || len(web.Host) == 0 {
+		return "", "", errors.Newf("invalid project web url %q", payload.Project.WebURL)
+	}
+	mod = path.Join(web.Host, web.Path)
+	if !strings.HasPrefix(payload.Ref, tagRefPrefix) {
+		return mod, "", nil
+	}
+
+	tag := strings.TrimPrefix(payload.Ref, tagRefPrefix)
+	if pos := strings.LastIndexByte(tag, '/'); pos >= 0 {
+		mod = path.Join(mod, tag[:pos])
+		tag = tag[pos+1:]
+	}
+	if !semver.IsValid(tag) || semver.Canonical(tag) != tag {
+		// not a version tag, the module is invalidated still as it may be resolved by the tag name
+		return mod, "", nil
+	}
+	if major := semver.Major(tag); major > 1 {
+		mod = path.Join(mod, "v"+strconv.Itoa(major))
+	}
+	if payload.After == zeroSHA {
+		// tag deletion
+		return mod, "", nil
+	}
+	return mod, tag, nil
+}
+
+// ServeHTTP handles webhook events, it responds with the invalidated module
+func (h *Webhook) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	logger := zerolog.Ctx(req.Context())
+	if req.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(req.Header.Get(tokenHeader)), []byte(h.secret)) != 1 {
+		logger.Warn().Str("remote", req.RemoteAddr).Msg("gitlab webhook with invalid token")
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+	event := req.Header.Get(eventHeader)
+	if event != PushEvent && event != TagPushEvent {
+		// GitLab disables hooks failing for long, other events are just ignored
+		logger.Debug().Str("event", event).Msg("gitlab webhook event ignored")
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	var payload pushPayload
+	if err := json.NewDecoder(io.LimitReader(req.Body, maxPayloadSize)).Decode(&payload); err != nil {
+		http.Error(w, "invalid payload: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	mod, version, err := pushedModule(&payload)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	eventLogger := logger.With().Str("event", event).Str("module", mod).Str("version", version).Logger()
+	logger = &eventLogger
+	h.router.Invalidate(mod)
+	logger.Info().Msg("gitlab webhook invalidated module")
+	prefetch := h.prefetch && len(version) > 0
+	if prefetch {
+		select {
+		case h.prefetches <- struct{}{}:
+			h.wg.Add(1)
+			go func() {
+				defer func() {
+					<-h.prefetches
+					h.wg.Done()
+				}()
+				// the request context is over once the response is sent
+				if err := h.fetch(logger.WithContext(context.Background()), mod, version); err != nil {
+					logger.Error().Err(err).Msg("gitlab webhook prefetch")
+					return
+				}
+				logger.Info().Msg("gitlab webhook prefetched version")
+			}()
+		default:
+			// the version is fetched on the first request for it then
+			prefetch = false
+			logger.Warn().Msg("gitlab webhook prefetch skipped as too many are in progress")
+		}
+	}
+
+	data, err := json.Marshal(struct {
+		Module   string `json:"module"`
+		Version  string `json:"version,omitempty"`
+		Prefetch bool   `json:"prefetch"`
+	}{
+		Module:   mod,
+		Version:  version,
+		Prefetch: prefetch,
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
+
+// fetch requests .info, .mod and .zip of the version through the router, caching plugins keep them
+func (h *Webhook) fetch(ctx context.Context, mod, version string) error {
+	factory := h.router.Factory(mod)
+	if factory == nil {
+		return errors.Newf("no plugin registered for %s", mod)
+	}
+	req, err := goproxy.NewModuleRequest(ctx, mod)
+	if err != nil {
+		return err
+	}
+	if len(h.token) > 0 {
+		req.SetBasicAuth(h.token, "")
+	}
+	src, err := factory.Module(req, "")
+	if err != nil {
+		return errors.Wrapf(err, "getting module %s", mod)
+	}
+	defer func() {
+		if err := factory.Leave(src); err != nil {
+			zerolog.Ctx(ctx).Error().Err(err).Msg("leaving prefetched module")
+		}
+	}()
+
+	if _, err := src.Stat(ctx, version); err != nil {
+		return errors.Wrap(err, "getting revision info")
+	}
+	if _, err := src.GoMod(ctx, version); err != nil {
+		return errors.Wrap(err, "getting go.mod")
+	}
+	archive, err := src.Zip(ctx, version)
+	if err != nil {
+		return errors.Wrap(err, "getting source archive")
+	}
+	if _, err := io.Copy(ioutil.Discard, archive); err != nil {
+		_ = archive.Close()
+		return errors.Wrap(err, "reading source archive")
+	}
+	return archive.Close()
+}
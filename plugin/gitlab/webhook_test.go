@@ -0,0 +1,296 @@
+package gitlab
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sirkon/goproxy"
+)
+
+func TestPushedModule(t *testing.T) {
+	tests := []struct {
+		name    string
+		ref     string
+		after   string
+		mod     string
+		version string
+	}{
+		{
+			name: "branch",
+			ref:  "refs/heads/master",
+			mod:  "gitlab.example.com/group/project",
+		},
+		{
+			name:    "tag",
+			ref:     "refs/tags/v1.2.0",
+			mod:     "gitlab.example.com/group/project",
+			version: "v1.2.0",
+		},
+		{
+			name:    "major",
+			ref:     "refs/tags/v2.0.1",
+			mod:     "gitlab.example.com/group/project/v2",
+			version: "v2.0.1",
+		},
+		{
+			name:    "submodule",
+			ref:     "refs/tags/sub/dir/v0.1.0",
+			mod:     "gitlab.example.com/group/project/sub/dir",
+			version: "v0.1.0",
+		},
+		{
+			name: "non-version",
+			ref:  "refs/tags/release-1",
+			mod:  "gitlab.example.com/group/project",
+		},
+		{
+			name:  "deleted",
+			ref:   "refs/tags/v1.2.0",
+			after: zeroSHA,
+			mod:   "gitlab.example.com/group/project",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			payload := &pushPayload{Ref: tt.ref, After: tt.after}
+			payload.Project.WebURL = "https://gitlab.example.com/group/project"
+			mod, version, err := pushedModule(payload)
+			require.NoError(t, err)
+			require.Equal(t, tt.mod, mod)
+			require.Equal(t, tt.version, version)
+		})
+	}
+
+	_, _, err := pushedModule(&pushPayload{Ref: "refs/tags/v1.0.0"})
+	require.Error(t, err)
+}
+
+// hookPlugin records invalidations, fetches and tokens they are made with. Fetches wait for release if it is set
+type hookPlugin struct {
+	lock        sync.Mutex
+	invalidated []string
+	fetched     []string
+	tokens      []string
+	release     chan struct{}
+}
+
+func (p *hookPlugin) Module(req *http.Request, prefix string) (goproxy.Module, error) {
+	path, _, err := goproxy.GetModInfo(req, prefix)
+	if err != nil {
+		return nil, err
+	}
+	token, _, _ := req.BasicAuth()
+	p.lock.Lock()
+	p.tokens = append(p.tokens, token)
+	p.lock.Unlock()
+	return &hookModule{path: path, plugin: p}, nil
+}
+
+func (p *hookPlugin) Leave(source goproxy.Module) error { return nil }
+func (p *hookPlugin) Close() error                      { return nil }
+func (p *hookPlugin) String() string                    { return "hook" }
+
+func (p *hookPlugin) Invalidate(path string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.invalidated = append(p.invalidated, path)
+}
+
+func (p *hookPlugin) fetch(item string) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.fetched = append(p.fetched, item)
+}
+
+type hookModule struct {
+	path   string
+	plugin *hookPlugin
+}
+
+func (m *hookModule) ModulePath() string { return m.path }
+
+func (m *hookModule) Versions(ctx context.Context, prefix string) ([]string, error) {
+	return nil, nil
+}
+
+func (m *hookModule) Stat(ctx context.Context, rev string) (*goproxy.RevInfo, error) {
+	if m.plugin.release != nil {
+		<-m.plugin.release
+	}
+	m.plugin.fetch(m.path + "@" + rev + ".info")
+	return &goproxy.RevInfo{Version: rev}, nil
+}
+
+func (m *hookModule) GoMod(ctx context.Context, version string) ([]byte, error) {
+	m.plugin.fetch(m.path + "@" + version + ".mod")
+	return []byte("module " + m.path + "\n"), nil
+}
+
+func (m *hookModule) Zip(ctx context.Context, version string) (io.ReadCloser, error) {
+	m.plugin.fetch(m.path + "@" + version + ".zip")
+	return ioutil.NopCloser(strings.NewReader("zip")), nil
+}
+
+func TestWebhook(t *testing.T) {
+	tests := []struct {
+		name        string
+		token       string
+		event       string
+		body        string
+		status      int
+		invalidated []string
+		fetched     []string
+	}{
+		{
+			name:   "invalid-token",
+			token:  "wrong",
+			event:  TagPushEvent,
+			body:   `{"ref":"refs/tags/v1.0.0","project":{"web_url":"https://gitlab.example.com/group/project"}}`,
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "no-token",
+			event:  TagPushEvent,
+			body:   `{"ref":"refs/tags/v1.0.0","project":{"web_url":"https://gitlab.example.com/group/project"}}`,
+			status: http.StatusUnauthorized,
+		},
+		{
+			name:   "other-event",
+			token:  "secret",
+			event:  "Issue Hook",
+			body:   `{}`,
+			status: http.StatusNoContent,
+		},
+		{
+			name:   "invalid-payload",
+			token:  "secret",
+			event:  TagPushEvent,
+			body:   `{"ref":`,
+			status: http.StatusBadRequest,
+		},
+		{
+			name:        "push",
+			token:       "secret",
+			event:       PushEvent,
+			body:        `{"ref":"refs/heads/master","project":{"web_url":"https://gitlab.example.com/group/project"}}`,
+			status:      http.StatusOK,
+			invalidated: []string{"gitlab.example.com/group/project"},
+		},
+		{
+			name:        "tag-push",
+			token:       "secret",
+			event:       TagPushEvent,
+			body:        `{"ref":"refs/tags/v1.1.0","after":"4b825dc642cb6eb9a060e54bf8d69288fbee4904","project":{"web_url":"https://gitlab.example.com/group/project"}}`,
+			status:      http.StatusOK,
+			invalidated: []string{"gitlab.example.com/group/project"},
+			fetched: []string{
+				"gitlab.example.com/group/project@v1.1.0.info",
+				"gitlab.example.com/group/project@v1.1.0.mod",
+				"gitlab.example.com/group/project@v1.1.0.zip",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plug := &hookPlugin{}
+			router, err := goproxy.NewRouter()
+			require.NoError(t, err)
+			require.NoError(t, router.AddRoute("gitlab.example.com", plug))
+			hook, err := NewWebhook(router, "secret", true)
+			require.NoError(t, err)
+
+			req := httptest.NewRequest(http.MethodPost, "/hook", bytes.NewBufferString(tt.body))
+			req.Header.Set(tokenHeader, tt.token)
+			req.Header.Set(eventHeader, tt.event)
+			w := httptest.NewRecorder()
+			hook.ServeHTTP(w, req)
+			require.NoError(t, hook.Close())
+
+			require.Equal(t, tt.status, w.Code, w.Body.String())
+			require.Equal(t, tt.invalidated, plug.invalidated)
+			require.Equal(t, tt.fetched, plug.fetched)
+		})
+	}
+}
+
+func TestNewWebhookSecret(t *testing.T) {
+	router, err := goproxy.NewRouter()
+	require.NoError(t, err)
+	_, err = NewWebhook(router, "", true)
+	require.Error(t, err)
+}
+
+// tagPush sends tag push event of the version to the webhook, it returns whether the version is prefetched
+func tagPush(t *testing.T, hook *Webhook, version string) bool {
+	t.Helper()
+	body := `{"ref":"refs/tags/` + version + `","after":"4b825dc642cb6eb9a060e54bf8d69288fbee4904",` +
+		`"project":{"web_url":"https://gitlab.example.com/group/project"}}`
+	req := httptest.NewRequest(http.MethodPost, "/hook", bytes.NewBufferString(body))
+	req.Header.Set(tokenHeader, "secret")
+	req.Header.Set(eventHeader, TagPushEvent)
+	w := httptest.NewRecorder()
+	hook.ServeHTTP(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var res struct {
+		Prefetch bool `json:"prefetch"`
+	}
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+	return res.Prefetch
+}
+
+func TestWebhookToken(t *testing.T) {
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{name: "anonymous"},
+		{name: "token", token: "gitlab-token"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plug := &hookPlugin{}
+			router, err := goproxy.NewRouter()
+			require.NoError(t, err)
+			require.NoError(t, router.AddRoute("gitlab.example.com", plug))
+			hook, err := NewWebhook(router, "secret", true)
+			require.NoError(t, err)
+			hook.SetToken(tt.token)
+
+			require.True(t, tagPush(t, hook, "v1.0.0"))
+			require.NoError(t, hook.Close())
+			require.Equal(t, []string{tt.token}, plug.tokens)
+		})
+	}
+}
+
+func TestWebhookPrefetchLimit(t *testing.T) {
+	plug := &hookPlugin{release: make(chan struct{})}
+	router, err := goproxy.NewRouter()
+	require.NoError(t, err)
+	require.NoError(t, router.AddRoute("gitlab.example.com", plug))
+	hook, err := NewWebhook(router, "secret", true)
+	require.NoError(t, err)
+
+	for i := 0; i < maxPrefetches; i++ {
+		require.True(t, tagPush(t, hook, fmt.Sprintf("v1.%d.0", i)))
+	}
+	require.False(t, tagPush(t, hook, "v2.0.0"))
+	close(plug.release)
+	require.NoError(t, hook.Close())
+	require.Len(t, plug.fetched, 3*maxPrefetches)
+
+	// prefetches are taken again once those in progress are over
+	require.True(t, tagPush(t, hook, "v1.9.0"))
+	require.NoError(t, hook.Close())
+}
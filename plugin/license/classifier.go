@@ -0,0 +1,128 @@
+package license
+
+import (
+	"embed"
+	"path"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+const (
+	// Unknown is recorded for license files whose text matches none of bundled licenses
+	Unknown = "NOASSERTION"
+
+	// None is recorded for modules without license files
+	None = "NONE"
+)
+
+// minScore share of word trigrams of a license text which must be found in a file to consider it the license
+const minScore = 0.8
+
+// tieScore scores differing less than this are considered equal
+const tieScore = 0.05
+
+// templates SPDX license texts, names are SPDX identifiers. Long licenses (Apache, GPL, LGPL, AGPL, MPL) are only
+// represented with their distinctive opening parts: the title, the version and the preamble. So a file having the
+// opening part of such a license is classified as the license, the rest of its text is not looked into. A suffix
+// after ~ marks alternative texts of the same license, e.g. a notice referring to it
+//
+//go:embed templates/*.txt
+var templates embed.FS
+
+type template struct {
+	id       string
+	trigrams map[string]struct{}
+}
+
+var known = loadTemplates()
+
+func loadTemplates() []template {
+	entries, err := templates.ReadDir("templates")
+	if err != nil {
+		panic(err)
+	}
+	var res []template
+	for _, entry := range entries {
+		data, err := templates.ReadFile(path.Join("templates", entry.Name()))
+		if err != nil {
+			panic(err)
+		}
+		id := strings.TrimSuffix(entry.Name(), ".txt")
+		if pos := strings.IndexByte(id, '~'); pos >= 0 {
+			id = id[:pos]
+		}
+		res = append(res, template{
+			id:       id,
+			trigrams: trigrams(string(data)),
+		})
+	}
+	return res
+}
+
+// Licenses returns SPDX identifiers of licenses Classify can recognize
+func Licenses() []string {
+	seen := map[string]bool{}
+	var res []string
+	for _, t := range known {
+		if !seen[t.id] {
+			seen[t.id] = true
+			res = append(res, t.id)
+		}
+	}
+	sort.Strings(res)
+	return res
+}
+
+// Classify returns SPDX identifier of the license with the given text, Unknown if it is not recognized. Texts are
+// compared by words, so formatting, punctuation and copyright lines do not matter. A text is recognized if it has
+// most of the bundled text of the license, which is the opening part only for long licenses, so a text starting like
+// the license is taken for it whatever follows
+func Classify(text string) string {
+	words := trigrams(text)
+	res := Unknown
+	var best float64
+	var bestSize int
+	for _, t := range known {
+		if len(t.trigrams) == 0 {
+			continue
+		}
+		var found int
+		for trigram := range t.trigrams {
+			if _, ok := words[trigram]; ok {
+				found++
+			}
+		}
+		score := float64(found) / float64(len(t.trigrams))
+		if score < minScore {
+			continue
+		}
+		// a license may include the whole text of another one, like BSD-3-Clause does with BSD-2-Clause, the
+		// longer text wins when both are found
+		if score > best+tieScore || (score > best-tieScore && len(t.trigrams) > bestSize) {
+			res = t.id
+			best = score
+			bestSize = len(t.trigrams)
+		}
+	}
+	return res
+}
+
+// trigrams returns sequences of three consequent words of the text, in lower case. Copyright lines are left out as
+// they differ from one project to another
+func trigrams(text string) map[string]struct{} {
+	var words []string
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(strings.ToLower(strings.TrimSpace(line)), "copyright") {
+			continue
+		}
+		words = append(words, strings.FieldsFunc(strings.ToLower(line), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})...)
+	}
+	res := map[string]struct{}{}
+	for i := 2; i < len(words); i++ {
+		res[words[i-2]+" "+words[i-1]+" "+words[i]] = struct{}{}
+	}
+	return res
+}
@@ -0,0 +1,108 @@
+package license
+
+import (
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+const goLicense = `Copyright (c) 2009 The Go Authors. All rights reserved.
+
+Redistribution and use in source and binary forms, with or without
+modification, are permitted provided that the following conditions are
+met:
+
+   * Redistributions of source code must retain the above copyright
+notice, this list of conditions and the following disclaimer.
+   * Redistributions in binary form must reproduce the above
+copyright notice, this list of conditions and the following disclaimer
+in the documentation and/or other materials provided with the
+distribution.
+   * Neither the name of Google Inc. nor the names of its
+contributors may be used to endorse or promote products derived from
+this software without specific prior written permission.
+
+THIS SOFTWARE IS PROVIDED BY THE COPYRIGHT HOLDERS AND CONTRIBUTORS
+"AS IS" AND ANY EXPRESS OR IMPLIED WARRANTIES, INCLUDING, BUT NOT
+LIMITED TO, THE IMPLIED WARRANTIES OF MERCHANTABILITY AND FITNESS FOR
+A PARTICULAR PURPOSE ARE DISCLAIMED. IN NO EVENT SHALL THE COPYRIGHT
+OWNER OR CONTRIBUTORS BE LIABLE FOR ANY DIRECT, INDIRECT, INCIDENTAL,
+SPECIAL, EXEMPLARY, OR CONSEQUENTIAL DAMAGES (INCLUDING, BUT NOT
+LIMITED TO, PROCUREMENT OF SUBSTITUTE GOODS OR SERVICES; LOSS OF USE,
+DATA, OR PROFITS; OR BUSINESS INTERRUPTION) HOWEVER CAUSED AND ON ANY
+THEORY OF LIABILITY, WHETHER IN CONTRACT, STRICT LIABILITY, OR TORT
+(INCLUDING NEGLIGENCE OR OTHERWISE) ARISING IN ANY WAY OUT OF THE USE
+OF THIS SOFTWARE, EVEN IF ADVISED OF THE POSSIBILITY OF SUCH DAMAGE.
+`
+
+// licenseText returns the bundled text of the license as a project would have it: with a copyright line and
+// rewrapped
+func licenseText(t *testing.T, name string) string {
+	t.Helper()
+	data, err := templates.ReadFile(path.Join("templates", name+".txt"))
+	require.NoError(t, err)
+	words := strings.Fields(string(data))
+	var buf strings.Builder
+	buf.WriteString("Copyright (c) 2020 Someone <someone@example.com>\n\n")
+	for i, word := range words {
+		buf.WriteString(word)
+		if i%7 == 6 {
+			buf.WriteByte('\n')
+		} else {
+			buf.WriteByte(' ')
+		}
+	}
+	return buf.String()
+}
+
+func TestClassify(t *testing.T) {
+	for _, id := range Licenses() {
+		t.Run(id, func(t *testing.T) {
+			require.Equal(t, id, Classify(licenseText(t, id)))
+		})
+	}
+
+	tests := []struct {
+		name string
+		text string
+		want string
+	}{
+		{
+			name: "go-license",
+			text: goLicense,
+			want: "BSD-3-Clause",
+		},
+		{
+			name: "apache-notice",
+			text: licenseText(t, "Apache-2.0~notice"),
+			want: "Apache-2.0",
+		},
+		{
+			name: "gpl-with-trailing-text",
+			text: licenseText(t, "GPL-3.0") + "\n\nTERMS AND CONDITIONS\n\n0. Definitions.\n",
+			want: "GPL-3.0",
+		},
+		{
+			name: "apache-opening-with-other-terms",
+			text: licenseText(t, "Apache-2.0") + "\n\nThe software must not be used commercially.\n",
+			want: "Apache-2.0",
+		},
+		{
+			name: "proprietary",
+			text: "Copyright (c) 2020 Company. All rights reserved.\n\nDo not copy, ever.\n",
+			want: Unknown,
+		},
+		{
+			name: "empty",
+			text: "",
+			want: Unknown,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, Classify(tt.text))
+		})
+	}
+}
@@ -0,0 +1,138 @@
+package license
+
+import (
+	"archive/zip"
+	"context"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog"
+
+	"github.com/sirkon/goproxy"
+	"github.com/sirkon/goproxy/internal/errors"
+	"github.com/sirkon/goproxy/internal/spool"
+)
+
+// maxLicenseSize license files larger than this are not read, no license text is that long
+const maxLicenseSize = 1 << 20
+
+// licenseModule detects licenses of zips before they are served
+type licenseModule struct {
+	goproxy.Module
+	plugin *plugin
+}
+
+func (m *licenseModule) Zip(ctx context.Context, version string) (file io.ReadCloser, err error) {
+	// versions do not change, so the zip is not looked into again once its licenses are known
+	if licenses, ok := m.plugin.registry.Lookup(m.ModulePath(), version); ok {
+		if err := m.check(ctx, version, licenses); err != nil {
+			return nil, err
+		}
+		return m.Module.Zip(ctx, version)
+	}
+
+	archive, err := m.Module.Zip(ctx, version)
+	if err != nil {
+		return nil, err
+	}
+	spooled, err := spool.New("", archive)
+	if cErr := archive.Close(); cErr != nil && err == nil {
+		err = cErr
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "license reading archive of %s@%s", m.ModulePath(), version)
+	}
+	defer func() {
+		if err != nil {
+			_ = spooled.Close()
+		}
+	}()
+	zipReader, err := zip.NewReader(spooled, spooled.Size())
+	if err != nil {
+		return nil, errors.Wrapf(err, "license extracting archive of %s@%s", m.ModulePath(), version)
+	}
+	licenses, err := Detect(zipReader, m.ModulePath()+"@"+version+"/")
+	if err != nil {
+		return nil, errors.Wrapf(err, "license detecting licenses of %s@%s", m.ModulePath(), version)
+	}
+	m.plugin.registry.record(m.ModulePath(), version, licenses)
+
+	if err := m.check(ctx, version, licenses); err != nil {
+		return nil, err
+	}
+	return spooled, nil
+}
+
+// check returns Rejected error if the version is not available under any of allowed licenses
+func (m *licenseModule) check(ctx context.Context, version string, licenses []string) error {
+	if m.plugin.permits(licenses) {
+		return nil
+	}
+	zerolog.Ctx(ctx).Warn().Strs("licenses", licenses).Str("version", version).Msg("license is not allowed")
+	return &Rejected{
+		Path:     m.ModulePath(),
+		Version:  version,
+		Licenses: licenses,
+	}
+}
+
+// Detect returns sorted SPDX identifiers of licenses found in license files of the archive directory having given
+// prefix, e.g. LICENSE, LICENSE.md, LICENCE-MIT, COPYING or COPYING.LESSER. The result is None if there are no such
+// files
+func Detect(archive *zip.Reader, prefix string) ([]string, error) {
+	seen := map[string]bool{}
+	var res []string
+	for _, file := range archive.File {
+		if !strings.HasPrefix(file.Name, prefix) || !isLicenseFile(file.Name[len(prefix):]) {
+			continue
+		}
+		id := Unknown
+		if file.UncompressedSize64 <= maxLicenseSize {
+			text, err := readFile(file)
+			if err != nil {
+				return nil, err
+			}
+			id = Classify(text)
+		}
+		if !seen[id] {
+			seen[id] = true
+			res = append(res, id)
+		}
+	}
+	if len(res) == 0 {
+		return []string{None}, nil
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+// isLicenseFile checks if the name is of a license file of the directory itself, not of some subdirectory
+func isLicenseFile(name string) bool {
+	if strings.Contains(name, "/") {
+		return false
+	}
+	name = strings.ToUpper(name)
+	for _, prefix := range []string{"LICENSE", "LICENCE", "COPYING", "UNLICENSE"} {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func readFile(file *zip.File) (string, error) {
+	src, err := file.Open()
+	if err != nil {
+		return "", errors.Wrapf(err, "opening %s", file.Name)
+	}
+	data, err := ioutil.ReadAll(src)
+	if cErr := src.Close(); cErr != nil && err == nil {
+		err = cErr
+	}
+	if err != nil {
+		return "", errors.Wrapf(err, "reading %s", file.Name)
+	}
+	return string(data), nil
+}
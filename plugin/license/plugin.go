@@ -0,0 +1,93 @@
+package license
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/sirkon/goproxy"
+)
+
+// New creates a plugin detecting licenses of module zips served by upstream and recording them into the registry.
+// Zips none of whose licenses is in allowed are refused with Rejected error, a module having several licenses is
+// considered available under any of them. Add Unknown or None to allowed to serve modules with unrecognized or
+// without license files. Nothing is refused with empty allowed. See Classify for how license texts are recognized,
+// long licenses are recognized by their opening parts
+func New(upstream goproxy.Plugin, registry *Registry, allowed ...string) goproxy.Plugin {
+	res := &plugin{
+		upstream: upstream,
+		registry: registry,
+	}
+	if len(allowed) > 0 {
+		res.allowed = map[string]bool{}
+		for _, id := range allowed {
+			res.allowed[id] = true
+		}
+	}
+	return res
+}
+
+type plugin struct {
+	upstream goproxy.Plugin
+	registry *Registry
+	allowed  map[string]bool
+}
+
+func (p *plugin) String() string {
+	return fmt.Sprintf("license(%s)", p.upstream)
+}
+
+func (p *plugin) Module(req *http.Request, prefix string) (goproxy.Module, error) {
+	mod, err := p.upstream.Module(req, prefix)
+	if err != nil {
+		return nil, err
+	}
+	return &licenseModule{
+		Module: mod,
+		plugin: p,
+	}, nil
+}
+
+func (p *plugin) Leave(source goproxy.Module) error {
+	if mod, ok := source.(*licenseModule); ok {
+		return p.upstream.Leave(mod.Module)
+	}
+	return p.upstream.Leave(source)
+}
+
+func (p *plugin) Close() error {
+	return p.upstream.Close()
+}
+
+func (p *plugin) Invalidate(path string) {
+	goproxy.Invalidate(p.upstream, path)
+}
+
+// permits checks if any of licenses is allowed
+func (p *plugin) permits(licenses []string) bool {
+	if p.allowed == nil {
+		return true
+	}
+	for _, id := range licenses {
+		if p.allowed[id] {
+			return true
+		}
+	}
+	return false
+}
+
+// Rejected error of a module version refused because of its licenses
+type Rejected struct {
+	Path     string
+	Version  string
+	Licenses []string
+}
+
+func (r *Rejected) Error() string {
+	return fmt.Sprintf("%s@%s license %s is not allowed", r.Path, r.Version, strings.Join(r.Licenses, ", "))
+}
+
+// StatusCode 403 Forbidden
+func (r *Rejected) StatusCode() int {
+	return http.StatusForbidden
+}
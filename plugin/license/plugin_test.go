@@ -0,0 +1,159 @@
+package license
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sirkon/goproxy/internal/errors"
+	"github.com/sirkon/goproxy/internal/plugintest"
+)
+
+func TestPlugin(t *testing.T) {
+	upstream := &plugintest.Plugin{Files: map[string]map[string]string{
+		"v1.0.0": {"LICENSE": goLicense, "lib.go": "package lib\n"},
+		"v1.1.0": {"COPYING": licenseText(t, "GPL-3.0"), "lib.go": "package lib\n"},
+		"v1.2.0": {
+			"LICENSE-MIT":        licenseText(t, "MIT"),
+			"LICENSE-APACHE":     licenseText(t, "Apache-2.0"),
+			"vendored/COPYING":   licenseText(t, "AGPL-3.0"),
+			"internal/LICENSE":   licenseText(t, "AGPL-3.0"),
+			"lib.go":             "package lib\n",
+			"internal/object.go": "package internal\n",
+		},
+		"v1.3.0": {"lib.go": "package lib\n"},
+		"v1.4.0": {"LICENSE.md": "All rights reserved", "lib.go": "package lib\n"},
+	}}
+
+	tests := []struct {
+		name     string
+		allowed  []string
+		version  string
+		licenses []string
+		rejected bool
+	}{
+		{
+			name:     "bsd",
+			allowed:  []string{"MIT", "BSD-3-Clause"},
+			version:  "v1.0.0",
+			licenses: []string{"BSD-3-Clause"},
+		},
+		{
+			name:     "gpl",
+			allowed:  []string{"MIT", "BSD-3-Clause"},
+			version:  "v1.1.0",
+			licenses: []string{"GPL-3.0"},
+			rejected: true,
+		},
+		{
+			name:     "gpl-not-enforced",
+			version:  "v1.1.0",
+			licenses: []string{"GPL-3.0"},
+		},
+		{
+			name:     "dual",
+			allowed:  []string{"Apache-2.0"},
+			version:  "v1.2.0",
+			licenses: []string{"Apache-2.0", "MIT"},
+		},
+		{
+			name:     "none",
+			allowed:  []string{"MIT"},
+			version:  "v1.3.0",
+			licenses: []string{None},
+			rejected: true,
+		},
+		{
+			name:     "none-allowed",
+			allowed:  []string{"MIT", None},
+			version:  "v1.3.0",
+			licenses: []string{None},
+		},
+		{
+			name:     "unknown",
+			allowed:  []string{"MIT", None},
+			version:  "v1.4.0",
+			licenses: []string{Unknown},
+			rejected: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := NewRegistry()
+			p := New(upstream, registry, tt.allowed...)
+			mod := plugintest.GetModule(t, p, "github.com/user/lib")
+
+			file, err := mod.Zip(context.Background(), tt.version)
+			if tt.rejected {
+				var r *Rejected
+				require.True(t, errors.As(err, &r))
+				require.Equal(t, http.StatusForbidden, r.StatusCode())
+				require.Equal(t, tt.licenses, r.Licenses)
+			} else {
+				require.NoError(t, err)
+				data, err := ioutil.ReadAll(file)
+				require.NoError(t, err)
+				require.NoError(t, file.Close())
+				_, err = zip.NewReader(bytes.NewReader(data), int64(len(data)))
+				require.NoError(t, err)
+			}
+
+			licenses, ok := registry.Lookup("github.com/user/lib", tt.version)
+			require.True(t, ok)
+			require.Equal(t, tt.licenses, licenses)
+			require.NoError(t, p.Leave(mod))
+		})
+	}
+}
+
+func TestPluginRecorded(t *testing.T) {
+	upstream := &plugintest.Plugin{Files: map[string]map[string]string{
+		"v1.0.0": {"LICENSE": goLicense, "lib.go": "package lib\n"},
+	}}
+	registry := NewRegistry()
+	p := New(upstream, registry, "MIT")
+	mod := plugintest.GetModule(t, p, "github.com/user/lib")
+
+	// licenses already known are not detected again
+	registry.record("github.com/user/lib", "v1.0.0", []string{"MIT"})
+	file, err := mod.Zip(context.Background(), "v1.0.0")
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+	licenses, ok := registry.Lookup("github.com/user/lib", "v1.0.0")
+	require.True(t, ok)
+	require.Equal(t, []string{"MIT"}, licenses)
+
+	registry.record("github.com/user/lib", "v1.0.0", []string{"GPL-3.0"})
+	_, err = mod.Zip(context.Background(), "v1.0.0")
+	var r *Rejected
+	require.True(t, errors.As(err, &r))
+	require.Equal(t, []string{"GPL-3.0"}, r.Licenses)
+}
+
+func TestRegistryServeHTTP(t *testing.T) {
+	registry := NewRegistry()
+	registry.record("github.com/user/lib", "v1.10.0", []string{"MIT"})
+	registry.record("github.com/user/lib", "v1.9.0", []string{"GPL-3.0"})
+	registry.record("github.com/another/lib", "v0.1.0", []string{None})
+
+	w := httptest.NewRecorder()
+	registry.ServeHTTP(w, httptest.NewRequest("GET", "/licenses", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var records []Record
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &records))
+	require.Len(t, records, 3)
+	require.Equal(t, "github.com/another/lib", records[0].Path)
+	require.Equal(t, "v1.9.0", records[1].Version)
+	require.Equal(t, []string{"GPL-3.0"}, records[1].Licenses)
+	require.Equal(t, "v1.10.0", records[2].Version)
+
+	_, ok := registry.Lookup("github.com/user/lib", "v1.0.0")
+	require.False(t, ok)
+}
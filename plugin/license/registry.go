@@ -0,0 +1,83 @@
+package license
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirkon/goproxy/internal/module"
+	"github.com/sirkon/goproxy/semver"
+)
+
+// Record licenses detected in a module version
+type Record struct {
+	Path     string
+	Version  string
+	Licenses []string  // SPDX identifiers, Unknown for unrecognized license files, None if there are no such files
+	Detected time.Time // time of the last detection
+}
+
+// Registry keeps licenses detected in served module versions, it can be shared by plugins of different routes.
+// Registry is an http.Handler responding with all records in JSON
+type Registry struct {
+	lock    sync.RWMutex
+	records map[module.Version]Record
+}
+
+// NewRegistry creates an empty registry
+func NewRegistry() *Registry {
+	return &Registry{
+		records: map[module.Version]Record{},
+	}
+}
+
+// record remembers licenses of the module version
+func (r *Registry) record(path, version string, licenses []string) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.records[module.Version{Path: path, Version: version}] = Record{
+		Path:     path,
+		Version:  version,
+		Licenses: licenses,
+		Detected: time.Now(),
+	}
+}
+
+// Lookup returns licenses detected in the module version, false if its zip has not been served yet
+func (r *Registry) Lookup(path, version string) ([]string, bool) {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+	rec, ok := r.records[module.Version{Path: path, Version: version}]
+	return rec.Licenses, ok
+}
+
+// Records lists all records ordered by module paths and versions
+func (r *Registry) Records() []Record {
+	r.lock.RLock()
+	res := make([]Record, 0, len(r.records))
+	for _, rec := range r.records {
+		res = append(res, rec)
+	}
+	r.lock.RUnlock()
+
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Path != res[j].Path {
+			return res[i].Path < res[j].Path
+		}
+		return semver.Compare(res[i].Version, res[j].Version) < 0
+	})
+	return res
+}
+
+// ServeHTTP responds with records
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	data, err := json.Marshal(r.Records())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
@@ -0,0 +1,147 @@
+package local
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/sirkon/goproxy"
+	"github.com/sirkon/goproxy/internal/errors"
+	"github.com/sirkon/goproxy/plugin/vcs"
+	"github.com/sirkon/goproxy/semver"
+)
+
+// plugin serves modules from a local repository or working tree
+type plugin struct {
+	root     string // module path corresponding to dir
+	dir      string
+	cacheDir string
+	dev      string         // version of the working tree state, not served if empty
+	repo     goproxy.Plugin // repository versions, nil if dir is not a git repository
+}
+
+// New creates a plugin serving modules of the git repository at dir, either a working tree or a bare one, whose root
+// corresponds to module path root: module root/sub is looked for in the subdirectory sub. Tags and commits are served
+// as versions and pseudo-versions just like for remote repositories, nothing goes to the network. Everything derived
+// from the repository is kept in cacheDir
+func New(root, dir, cacheDir string) (goproxy.Plugin, error) {
+	return newPlugin(root, dir, cacheDir, "")
+}
+
+// NewDev New which also serves the current state of the working tree at dir, uncommitted changes included, as
+// version devVersion, e.g. v0.0.0-dev. The tree is read on every request, so the content of this version follows
+// the tree and go.sum entries for it become stale. dir may be not a repository at all, only devVersion is served then
+func NewDev(root, dir, cacheDir, devVersion string) (goproxy.Plugin, error) {
+	if !semver.IsValid(devVersion) || semver.Canonical(devVersion) != devVersion {
+		return nil, errors.Newf("local dev version `%s` is not a canonical semver", devVersion)
+	}
+	return newPlugin(root, dir, cacheDir, devVersion)
+}
+
+func newPlugin(root, dir, cacheDir, dev string) (*plugin, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "local getting absolute path of `%s`", dir)
+	}
+	stat, err := os.Stat(dir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "local getting directory `%s`", dir)
+	}
+	if !stat.IsDir() {
+		return nil, errors.Newf("local %s is not a directory", dir)
+	}
+
+	res := &plugin{
+		root:     root,
+		dir:      dir,
+		cacheDir: cacheDir,
+		dev:      dev,
+	}
+	bare := isBareRepo(dir)
+	if bare && len(dev) > 0 {
+		return nil, errors.Newf("local %s is a bare repository, it has no working tree to serve as a dev version", dir)
+	}
+	if bare || isWorkingTree(dir) {
+		res.repo, err = vcs.NewPluginRemotes(cacheDir, map[string]vcs.Remote{
+			root: {VCS: vcs.Git, URL: "file://" + filepath.ToSlash(dir)},
+		})
+		if err != nil {
+			return nil, errors.Wrapf(err, "local setting up repository %s", dir)
+		}
+	} else if len(dev) == 0 {
+		return nil, errors.Newf("local %s is not a git repository", dir)
+	}
+	if err := os.MkdirAll(cacheDir, 0755); err != nil {
+		return nil, errors.Wrapf(err, "local creating directory `%s`", cacheDir)
+	}
+	return res, nil
+}
+
+// isWorkingTree checks if dir is the root of a git working tree
+func isWorkingTree(dir string) bool {
+	_, err := os.Stat(filepath.Join(dir, ".git"))
+	return err == nil
+}
+
+// isBareRepo checks if dir looks like a bare git repository
+func isBareRepo(dir string) bool {
+	for _, name := range []string{"HEAD", "objects", "refs"} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *plugin) Module(req *http.Request, prefix string) (goproxy.Module, error) {
+	path, _, err := goproxy.GetModInfo(req, prefix)
+	if err != nil {
+		return nil, err
+	}
+	if path != p.root && !strings.HasPrefix(path, p.root+"/") {
+		return nil, errors.Newf("local module %s is out of %s", path, p.root)
+	}
+
+	res := &module{
+		path:     path,
+		dev:      p.dev,
+		cacheDir: p.cacheDir,
+	}
+	if len(p.dev) > 0 {
+		res.dir = filepath.Join(p.dir, filepath.FromSlash(strings.TrimPrefix(path[len(p.root):], "/")))
+	}
+	if p.repo != nil {
+		res.repo, err = p.repo.Module(req, prefix)
+		if err != nil {
+			return nil, err
+		}
+		res.plugin = p.repo
+	}
+	return res, nil
+}
+
+// Invalidate makes tags and commits of the module to be looked up again
+func (p *plugin) Invalidate(path string) {
+	if p.repo != nil {
+		goproxy.Invalidate(p.repo, path)
+	}
+}
+
+func (p *plugin) Leave(source goproxy.Module) error {
+	if mod, ok := source.(*module); ok && mod.repo != nil {
+		return p.repo.Leave(mod.repo)
+	}
+	return nil
+}
+
+func (p *plugin) Close() error {
+	if p.repo != nil {
+		return p.repo.Close()
+	}
+	return nil
+}
+
+func (p *plugin) String() string {
+	return "local"
+}
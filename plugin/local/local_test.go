@@ -0,0 +1,249 @@
+package local
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sirkon/goproxy"
+	"github.com/sirkon/goproxy/internal/plugintest"
+)
+
+func run(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command(args[0], args[1:]...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	require.NoError(t, err, string(out))
+}
+
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+	}
+}
+
+// makeWorkingTree creates git working tree with tag v1.0.0
+func makeWorkingTree(t *testing.T, dir string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git binary not found")
+	}
+	writeFiles(t, dir, map[string]string{
+		"go.mod":  "module example.com/repo\n",
+		"repo.go": "package repo\n",
+	})
+	run(t, dir, "git", "init", "-q")
+	run(t, dir, "git", "add", ".")
+	run(t, dir, "git", "-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "init")
+	run(t, dir, "git", "tag", "v1.0.0")
+}
+
+func zipFiles(t *testing.T, mod goproxy.Module, version string) map[string]string {
+	t.Helper()
+	file, err := mod.Zip(context.Background(), version)
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(file)
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	res := map[string]string{}
+	for _, f := range zr.File {
+		fr, err := f.Open()
+		require.NoError(t, err)
+		content, err := ioutil.ReadAll(fr)
+		require.NoError(t, err)
+		require.NoError(t, fr.Close())
+		res[f.Name] = string(content)
+	}
+	return res
+}
+
+func TestWorkingTree(t *testing.T) {
+	root, err := ioutil.TempDir("", "local-plugin")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	dir := filepath.Join(root, "repo")
+	makeWorkingTree(t, dir)
+	writeFiles(t, dir, map[string]string{
+		"repo.go":                   "package repo // changed\n",
+		"vendor/modules.txt":        "# vendored\n",
+		"vendor/example.com/x/x.go": "package x\n",
+		"nested/go.mod":             "module example.com/repo/nested\n",
+		"nested/nested.go":          "package nested\n",
+	})
+
+	p, err := NewDev("example.com/repo", dir, filepath.Join(root, "cache"), "v0.0.0-dev")
+	require.NoError(t, err)
+	defer p.Close()
+
+	ctx := context.Background()
+	mod := plugintest.GetModule(t, p, "example.com/repo")
+	versions, err := mod.Versions(ctx, "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"v0.0.0-dev", "v1.0.0"}, versions)
+
+	info, err := mod.Stat(ctx, "v0.0.0-dev")
+	require.NoError(t, err)
+	require.Equal(t, "v0.0.0-dev", info.Version)
+	info, err = mod.Stat(ctx, "v1.0.0")
+	require.NoError(t, err)
+	require.Equal(t, "v1.0.0", info.Version)
+
+	require.Equal(t, map[string]string{
+		"example.com/repo@v0.0.0-dev/go.mod":             "module example.com/repo\n",
+		"example.com/repo@v0.0.0-dev/repo.go":            "package repo // changed\n",
+		"example.com/repo@v0.0.0-dev/vendor/modules.txt": "# vendored\n",
+	}, zipFiles(t, mod, "v0.0.0-dev"))
+	require.Equal(t, map[string]string{
+		"example.com/repo@v1.0.0/go.mod":  "module example.com/repo\n",
+		"example.com/repo@v1.0.0/repo.go": "package repo\n",
+	}, zipFiles(t, mod, "v1.0.0"))
+
+	nested := plugintest.GetModule(t, p, "example.com/repo/nested")
+	goMod, err := nested.GoMod(ctx, "v0.0.0-dev")
+	require.NoError(t, err)
+	require.Equal(t, "module example.com/repo/nested\n", string(goMod))
+
+	_, err = p.Module(httptest.NewRequest("GET", "/example.com/other/@v/list", nil), "")
+	require.Error(t, err)
+
+	// temporary archives are removed
+	entries, err := ioutil.ReadDir(filepath.Join(root, "cache"))
+	require.NoError(t, err)
+	for _, entry := range entries {
+		require.False(t, strings.HasPrefix(entry.Name(), ".dev-"), entry.Name())
+	}
+}
+
+func TestBareRepo(t *testing.T) {
+	root, err := ioutil.TempDir("", "local-plugin")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	tree := filepath.Join(root, "tree")
+	makeWorkingTree(t, tree)
+	run(t, root, "git", "clone", "-q", "--bare", tree, "repo.git")
+	dir := filepath.Join(root, "repo.git")
+
+	_, err = NewDev("example.com/repo", dir, filepath.Join(root, "cache"), "v0.0.0-dev")
+	require.Error(t, err)
+
+	p, err := New("example.com/repo", dir, filepath.Join(root, "cache"))
+	require.NoError(t, err)
+	defer p.Close()
+
+	mod := plugintest.GetModule(t, p, "example.com/repo")
+	versions, err := mod.Versions(context.Background(), "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"v1.0.0"}, versions)
+	goMod, err := mod.GoMod(context.Background(), "v1.0.0")
+	require.NoError(t, err)
+	require.Equal(t, "module example.com/repo\n", string(goMod))
+}
+
+func TestNewTags(t *testing.T) {
+	root, err := ioutil.TempDir("", "local-plugin")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	dir := filepath.Join(root, "repo")
+	makeWorkingTree(t, dir)
+
+	p, err := New("example.com/repo", dir, filepath.Join(root, "cache"))
+	require.NoError(t, err)
+	defer p.Close()
+
+	ctx := context.Background()
+	versions, err := plugintest.GetModule(t, p, "example.com/repo").Versions(ctx, "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"v1.0.0"}, versions)
+
+	// tags made after the first request are seen
+	writeFiles(t, dir, map[string]string{"repo.go": "package repo // v1.1.0\n"})
+	run(t, dir, "git", "add", ".")
+	run(t, dir, "git", "-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "next")
+	run(t, dir, "git", "tag", "v1.1.0")
+
+	mod := plugintest.GetModule(t, p, "example.com/repo")
+	versions, err = mod.Versions(ctx, "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"v1.0.0", "v1.1.0"}, versions)
+	info, err := mod.Stat(ctx, "v1.1.0")
+	require.NoError(t, err)
+	require.Equal(t, "v1.1.0", info.Version)
+	require.Equal(t, map[string]string{
+		"example.com/repo@v1.1.0/go.mod":  "module example.com/repo\n",
+		"example.com/repo@v1.1.0/repo.go": "package repo // v1.1.0\n",
+	}, zipFiles(t, mod, "v1.1.0"))
+}
+
+func TestPlainDirectory(t *testing.T) {
+	root, err := ioutil.TempDir("", "local-plugin")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	dir := filepath.Join(root, "tree")
+	writeFiles(t, dir, map[string]string{
+		"main.go": "package main\n",
+	})
+
+	_, err = New("example.com/tree", dir, filepath.Join(root, "cache"))
+	require.Error(t, err)
+	_, err = NewDev("example.com/tree", dir, filepath.Join(root, "cache"), "dev")
+	require.Error(t, err)
+
+	p, err := NewDev("example.com/tree", dir, filepath.Join(root, "cache"), "v0.0.0-dev")
+	require.NoError(t, err)
+	defer p.Close()
+
+	ctx := context.Background()
+	mod := plugintest.GetModule(t, p, "example.com/tree")
+	versions, err := mod.Versions(ctx, "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"v0.0.0-dev"}, versions)
+	goMod, err := mod.GoMod(ctx, "v0.0.0-dev")
+	require.NoError(t, err)
+	require.Equal(t, "module example.com/tree\n", string(goMod))
+
+	files := zipFiles(t, mod, "v0.0.0-dev")
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	require.Equal(t, []string{"example.com/tree@v0.0.0-dev/main.go"}, names)
+}
+
+func TestIsVendoredPackage(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{"vendor/modules.txt", false},
+		{"vendor/example.com/x/x.go", true},
+		{"sub/vendor/modules.txt", false},
+		{"sub/vendor/example.com/x/x.go", true},
+		{"vendors/x/x.go", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.want, isVendoredPackage(tt.name))
+		})
+	}
+}
@@ -0,0 +1,188 @@
+package local
+
+import (
+	"archive/zip"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/sirkon/goproxy"
+	"github.com/sirkon/goproxy/internal/errors"
+	"github.com/sirkon/goproxy/internal/modfetch/codehost"
+	"github.com/sirkon/goproxy/semver"
+)
+
+type module struct {
+	path     string
+	dir      string // module directory in the working tree
+	dev      string
+	cacheDir string
+	repo     goproxy.Module
+	plugin   goproxy.Plugin // plugin repo comes from
+}
+
+func (m *module) ModulePath() string {
+	return m.path
+}
+
+// Versions returns tags of the repository, they are looked up again on each call, so new tags are seen right away
+func (m *module) Versions(ctx context.Context, prefix string) (tags []string, err error) {
+	if m.repo != nil {
+		goproxy.Invalidate(m.plugin, m.path)
+		tags, err = m.repo.Versions(ctx, prefix)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(m.dev) > 0 && strings.HasPrefix(m.dev, prefix) {
+		tags = append(tags, m.dev)
+		sort.Slice(tags, func(i, j int) bool {
+			return semver.Compare(tags[i], tags[j]) < 0
+		})
+	}
+	return tags, nil
+}
+
+func (m *module) Stat(ctx context.Context, rev string) (*goproxy.RevInfo, error) {
+	if !m.isDev(rev) {
+		return m.repo.Stat(ctx, rev)
+	}
+	if _, err := os.Stat(m.dir); err != nil {
+		return nil, errors.Wrapf(err, "local getting module directory")
+	}
+	return &goproxy.RevInfo{
+		Version: m.dev,
+		Time:    time.Now().UTC().Format(time.RFC3339),
+	}, nil
+}
+
+func (m *module) GoMod(ctx context.Context, version string) (data []byte, err error) {
+	if !m.isDev(version) {
+		return m.repo.GoMod(ctx, version)
+	}
+	data, err = ioutil.ReadFile(filepath.Join(m.dir, "go.mod"))
+	if os.IsNotExist(err) {
+		// just like for repositories without go.mod
+		return []byte("module " + m.path + "\n"), nil
+	}
+	if err != nil {
+		return nil, errors.Wrap(err, "local reading go.mod")
+	}
+	return data, nil
+}
+
+func (m *module) Zip(ctx context.Context, version string) (file io.ReadCloser, err error) {
+	if !m.isDev(version) {
+		return m.repo.Zip(ctx, version)
+	}
+
+	f, err := ioutil.TempFile(m.cacheDir, ".dev-*.zip")
+	if err != nil {
+		return nil, errors.Wrap(err, "local creating temporary file for source archive")
+	}
+	res := &tempFile{File: f}
+	defer func() {
+		if err != nil {
+			_ = res.Close()
+		}
+	}()
+	if err := zipTree(ctx, f, m.dir, m.path+"@"+version+"/", codehost.MaxZipFile); err != nil {
+		return nil, errors.Wrap(err, "local making source archive")
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, errors.Wrap(err, "local rewinding source archive")
+	}
+	return res, nil
+}
+
+// isDev checks if version is the one of the working tree. Every other version is of the repository, the working
+// tree is all there is if there is no repository
+func (m *module) isDev(version string) bool {
+	return m.repo == nil || (len(m.dev) > 0 && version == m.dev)
+}
+
+// zipTree writes files of the module in dir into zip archive prefixing their names with prefix. Version control
+// directories, nested modules, vendored packages and special files are left out, the same as the go command does
+func zipTree(ctx context.Context, w io.Writer, dir, prefix string, maxSize int64) error {
+	zw := zip.NewWriter(w)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if info.IsDir() {
+			if path == dir {
+				return nil
+			}
+			switch info.Name() {
+			case ".git", ".hg", ".svn", ".bzr":
+				return filepath.SkipDir
+			}
+			if _, err := os.Stat(filepath.Join(path, "go.mod")); err == nil {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() || isVendoredPackage(name) {
+			return nil
+		}
+
+		maxSize -= info.Size()
+		if maxSize < 0 {
+			return errors.New("module source tree too big")
+		}
+		src, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer src.Close()
+		dst, err := zw.Create(prefix + name)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(dst, src)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// isVendoredPackage checks if the file belongs to a vendored package, vendor/modules.txt and alike are kept
+func isVendoredPackage(name string) bool {
+	var i int
+	if strings.HasPrefix(name, "vendor/") {
+		i += len("vendor/")
+	} else if j := strings.Index(name, "/vendor/"); j >= 0 {
+		i += j + len("/vendor/")
+	} else {
+		return false
+	}
+	return strings.Contains(name[i:], "/")
+}
+
+// tempFile temporary file which is removed when closed
+type tempFile struct {
+	*os.File
+}
+
+func (f *tempFile) Close() error {
+	closeErr := f.File.Close()
+	if err := os.Remove(f.Name()); err != nil {
+		return errors.Wrap(err, "local removing temporary file")
+	}
+	return closeErr
+}
@@ -0,0 +1,432 @@
+package mirror
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/sirkon/goproxy"
+	"github.com/sirkon/goproxy/internal/errors"
+	"github.com/sirkon/goproxy/plugin/aposteriori"
+	"github.com/sirkon/goproxy/semver"
+)
+
+// ListName name of the cached version list of a mirrored module
+const ListName = "list"
+
+// ModulesName name of the cached list of mirrored modules which were matched by path patterns
+const ModulesName = "mirror-modules"
+
+// Target describes modules to mirror
+type Target struct {
+	// Path is a module path or a path.Match pattern for module paths, e.g. github.com/company/*. Go proxy protocol has
+	// no way to enumerate modules, so a module matching a pattern is mirrored since it was requested for the first time
+	Path string
+
+	// Versions is a path.Match pattern for versions to mirror, e.g. v1.*. All versions are mirrored if it is empty
+	Versions string
+}
+
+func (t Target) isPattern() bool {
+	return strings.ContainsAny(t.Path, `*?[\`)
+}
+
+func (t Target) matchPath(modPath string) bool {
+	ok, _ := path.Match(t.Path, modPath)
+	return ok
+}
+
+func (t Target) match(version string) bool {
+	if len(t.Versions) == 0 {
+		return true
+	}
+	ok, _ := path.Match(t.Versions, version)
+	return ok
+}
+
+// ModuleStatus sync status of a mirrored module
+type ModuleStatus struct {
+	Path     string
+	Versions []string  // mirrored versions
+	LastSync time.Time // time of the last successful sync
+	Error    string    `json:",omitempty"` // error of the last sync attempt
+}
+
+// Status sync status of a mirror
+type Status struct {
+	Running     bool
+	LastStart   time.Time
+	LastFinish  time.Time
+	LastSuccess time.Time
+	Modules     []ModuleStatus
+}
+
+// Mirror replicates modules from upstream into a FileCache on a schedule and serves them from there. Use it as a
+// Plugin for mirrored modules: it fails to give a Module for anything else, so it should be combined with choice.New
+// for fallback. Mirror is also an http.Handler responding with its Status in JSON
+type Mirror struct {
+	upstream goproxy.Plugin
+	cache    aposteriori.FileCache
+	patterns []Target
+	interval time.Duration
+
+	lock    sync.Mutex
+	loaded  bool
+	targets map[string]Target // mirrored modules: explicit ones and the ones matched by patterns
+	status  Status
+	modules map[string]*ModuleStatus
+}
+
+// New creates a mirror of given targets polling upstream every interval
+func New(upstream goproxy.Plugin, cache aposteriori.FileCache, interval time.Duration, targets ...Target) *Mirror {
+	res := &Mirror{
+		upstream: upstream,
+		cache:    cache,
+		targets:  map[string]Target{},
+		interval: interval,
+		modules:  map[string]*ModuleStatus{},
+	}
+	for _, target := range targets {
+		if target.isPattern() {
+			res.patterns = append(res.patterns, target)
+			continue
+		}
+		res.targets[target.Path] = target
+	}
+	return res
+}
+
+// Run syncs targets right away and then every interval until ctx is done
+func (m *Mirror) Run(ctx context.Context) error {
+	if m.interval <= 0 {
+		return errors.Newf("mirror sync interval must be positive, got %s", m.interval)
+	}
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+	for {
+		if err := m.Sync(ctx); err != nil {
+			zerolog.Ctx(ctx).Error().Err(err).Msg("mirror sync failed")
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+// target returns mirroring target for a module path, discovered is true for modules matching a pattern which are not
+// synced yet, see addTarget
+func (m *Mirror) target(ctx context.Context, modPath string) (target Target, discovered bool, ok bool) {
+	m.load(ctx)
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if target, ok := m.targets[modPath]; ok {
+		return target, false, true
+	}
+	for _, pattern := range m.patterns {
+		if pattern.matchPath(modPath) {
+			return Target{Path: modPath, Versions: pattern.Versions}, true, true
+		}
+	}
+	return Target{}, false, false
+}
+
+// addTarget remembers the module matched by a pattern in the cache to be synced from now on. It is called once the
+// module was synced, so paths which are not modules do not get there
+func (m *Mirror) addTarget(ctx context.Context, target Target) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if _, ok := m.targets[target.Path]; ok {
+		return
+	}
+	m.targets[target.Path] = target
+	if err := m.saveModules(); err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("mirror saving module list")
+	}
+}
+
+// load loads the list of modules matched by patterns before from the cache
+func (m *Mirror) load(ctx context.Context) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if m.loaded || len(m.patterns) == 0 {
+		return
+	}
+	m.loaded = true
+
+	file, err := m.cache.Get(ModulesName)
+	if err != nil {
+		zerolog.Ctx(ctx).Debug().Err(err).Msg("mirror no cached module list")
+		return
+	}
+	defer func() {
+		if err := file.Close(); err != nil {
+			zerolog.Ctx(ctx).Error().Err(err).Msg("mirror closing cached module list")
+		}
+	}()
+	var paths []string
+	decoder := json.NewDecoder(file)
+	if err := decoder.Decode(&paths); err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("mirror decoding cached module list")
+		return
+	}
+	for _, modPath := range paths {
+		if _, ok := m.targets[modPath]; ok {
+			continue
+		}
+		for _, pattern := range m.patterns {
+			if pattern.matchPath(modPath) {
+				m.targets[modPath] = Target{Path: modPath, Versions: pattern.Versions}
+				break
+			}
+		}
+	}
+}
+
+// saveModules must be called under the lock
+func (m *Mirror) saveModules() error {
+	var paths []string
+	for modPath := range m.targets {
+		paths = append(paths, modPath)
+	}
+	sort.Strings(paths)
+	data, err := json.Marshal(paths)
+	if err != nil {
+		return errors.Wrap(err, "mirror marshaling module list")
+	}
+	if err := m.cache.Set(ModulesName, bytes.NewReader(data)); err != nil {
+		return errors.Wrap(err, "mirror saving module list")
+	}
+	return nil
+}
+
+// Sync syncs all targets once. It doesn't stop on a failed module, the error returned reports all failures
+func (m *Mirror) Sync(ctx context.Context) error {
+	m.load(ctx)
+	m.lock.Lock()
+	if m.status.Running {
+		m.lock.Unlock()
+		return errors.New("mirror sync is already running")
+	}
+	m.status.Running = true
+	m.status.LastStart = time.Now()
+	targets := m.sortedTargets()
+	m.lock.Unlock()
+
+	var failed []string
+	for _, target := range targets {
+		if err := m.syncModule(ctx, target); err != nil {
+			zerolog.Ctx(ctx).Error().Err(err).Str("module", target.Path).Msg("mirror module sync failed")
+			failed = append(failed, target.Path)
+		}
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.status.Running = false
+	m.status.LastFinish = time.Now()
+	if len(failed) > 0 {
+		return errors.Newf("mirror failed to sync %s", strings.Join(failed, ", "))
+	}
+	m.status.LastSuccess = m.status.LastFinish
+	return nil
+}
+
+// sortedTargets must be called under the lock
+func (m *Mirror) sortedTargets() []Target {
+	res := make([]Target, 0, len(m.targets))
+	for _, target := range m.targets {
+		res = append(res, target)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Path < res[j].Path
+	})
+	return res
+}
+
+func (m *Mirror) syncModule(ctx context.Context, target Target) (err error) {
+	logger := zerolog.Ctx(ctx).With().Str("module", target.Path).Logger()
+	ctx = logger.WithContext(ctx)
+	defer func() {
+		m.lock.Lock()
+		defer m.lock.Unlock()
+		status := m.moduleStatus(target.Path)
+		if err != nil {
+			status.Error = err.Error()
+		} else {
+			status.Error = ""
+			status.LastSync = time.Now()
+		}
+	}()
+
+	known, err := m.versions(ctx, target.Path)
+	if err != nil {
+		return err
+	}
+	req, err := goproxy.NewModuleRequest(ctx, target.Path)
+	if err != nil {
+		return errors.Wrap(err, "mirror")
+	}
+	mod, err := m.upstream.Module(req, "")
+	if err != nil {
+		return errors.Wrapf(err, "mirror getting module %s from upstream", target.Path)
+	}
+	upstream, err := mod.Versions(ctx, "")
+	if err != nil {
+		return errors.Wrapf(err, "mirror getting versions of %s from upstream", target.Path)
+	}
+
+	have := map[string]struct{}{}
+	for _, version := range known {
+		have[version] = struct{}{}
+	}
+	for _, version := range upstream {
+		if _, ok := have[version]; ok || !semver.IsValid(version) || !target.match(version) {
+			continue
+		}
+		logger.Info().Str("version", version).Msg("mirroring new version")
+		if err := m.download(ctx, mod, version); err != nil {
+			return err
+		}
+		known = append(known, version)
+		sort.Slice(known, func(i, j int) bool {
+			return semver.Compare(known[i], known[j]) < 0
+		})
+		if err := m.saveVersions(target.Path, known); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// download saves files of module version into the cache. Zip goes first and revision info goes last, so a version is
+// never listed without all its files in place
+func (m *Mirror) download(ctx context.Context, mod goproxy.Module, version string) error {
+	archive, err := mod.Zip(ctx, version)
+	if err != nil {
+		return errors.Wrapf(err, "mirror getting source archive of %s@%s", mod.ModulePath(), version)
+	}
+	err = m.cache.Set(aposteriori.CachePath(mod.ModulePath(), version, aposteriori.ZipName), archive)
+	if cErr := archive.Close(); cErr != nil {
+		zerolog.Ctx(ctx).Error().Err(cErr).Msg("mirror closing source archive")
+	}
+	if err != nil {
+		return errors.Wrapf(err, "mirror saving source archive of %s@%s", mod.ModulePath(), version)
+	}
+
+	goMod, err := mod.GoMod(ctx, version)
+	if err != nil {
+		return errors.Wrapf(err, "mirror getting go.mod of %s@%s", mod.ModulePath(), version)
+	}
+	name := aposteriori.CachePath(mod.ModulePath(), version, aposteriori.GoModName)
+	if err := m.cache.Set(name, bytes.NewReader(goMod)); err != nil {
+		return errors.Wrapf(err, "mirror saving go.mod of %s@%s", mod.ModulePath(), version)
+	}
+
+	info, err := mod.Stat(ctx, version)
+	if err != nil {
+		return errors.Wrapf(err, "mirror getting revision info of %s@%s", mod.ModulePath(), version)
+	}
+	data, err := json.Marshal(info)
+	if err != nil {
+		return errors.Wrapf(err, "mirror marshaling revision info of %s@%s", mod.ModulePath(), version)
+	}
+	name = aposteriori.CachePath(mod.ModulePath(), version, aposteriori.RevInfoName)
+	if err := m.cache.Set(name, bytes.NewReader(data)); err != nil {
+		return errors.Wrapf(err, "mirror saving revision info of %s@%s", mod.ModulePath(), version)
+	}
+	return nil
+}
+
+// versions returns mirrored versions of a module, they are loaded from the cache on the first access
+func (m *Mirror) versions(ctx context.Context, path string) ([]string, error) {
+	m.lock.Lock()
+	status, ok := m.modules[path]
+	m.lock.Unlock()
+	if ok && status.Versions != nil {
+		return append([]string(nil), status.Versions...), nil
+	}
+
+	var versions []string
+	file, err := m.cache.Get(aposteriori.CachePath(path, "", ListName))
+	if err == nil {
+		defer func() {
+			if err := file.Close(); err != nil {
+				zerolog.Ctx(ctx).Error().Err(err).Msg("mirror closing cached version list")
+			}
+		}()
+		decoder := json.NewDecoder(file)
+		if err := decoder.Decode(&versions); err != nil {
+			return nil, errors.Wrapf(err, "mirror decoding cached version list of %s", path)
+		}
+	} else {
+		zerolog.Ctx(ctx).Debug().Err(err).Msg("mirror no cached version list")
+	}
+	if versions == nil {
+		versions = []string{}
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.moduleStatus(path).Versions = versions
+	return append([]string(nil), versions...), nil
+}
+
+func (m *Mirror) saveVersions(path string, versions []string) error {
+	data, err := json.Marshal(versions)
+	if err != nil {
+		return errors.Wrapf(err, "mirror marshaling version list of %s", path)
+	}
+	if err := m.cache.Set(aposteriori.CachePath(path, "", ListName), bytes.NewReader(data)); err != nil {
+		return errors.Wrapf(err, "mirror saving version list of %s", path)
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.moduleStatus(path).Versions = append([]string(nil), versions...)
+	return nil
+}
+
+// moduleStatus must be called under the lock
+func (m *Mirror) moduleStatus(path string) *ModuleStatus {
+	status, ok := m.modules[path]
+	if !ok {
+		status = &ModuleStatus{Path: path}
+		m.modules[path] = status
+	}
+	return status
+}
+
+// Status returns current sync status
+func (m *Mirror) Status() Status {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	res := m.status
+	res.Modules = nil
+	for _, target := range m.sortedTargets() {
+		status := ModuleStatus{Path: target.Path}
+		if s, ok := m.modules[target.Path]; ok {
+			status = *s
+			status.Versions = append([]string(nil), s.Versions...)
+		}
+		res.Modules = append(res.Modules, status)
+	}
+	return res
+}
+
+// ServeHTTP responds with sync status
+func (m *Mirror) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	encoder := json.NewEncoder(w)
+	if err := encoder.Encode(m.Status()); err != nil {
+		zerolog.Ctx(req.Context()).Error().Err(err).Msg("mirror writing status")
+	}
+}
@@ -0,0 +1,126 @@
+package mirror
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sirkon/goproxy"
+	"github.com/sirkon/goproxy/internal/plugintest"
+	"github.com/sirkon/goproxy/plugin/apriori"
+)
+
+func TestMirror(t *testing.T) {
+	root, err := ioutil.TempDir("", "mirror-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+	dir := filepath.Join(root, "example.com", "lib", "@v")
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	plugintest.WriteVersion(t, dir, "v0.9.0")
+	plugintest.WriteVersion(t, dir, "v1.0.0")
+
+	upstream, err := apriori.NewDirPlugin(root)
+	require.NoError(t, err)
+	cache := plugintest.NewCache()
+	m := New(upstream, cache, time.Hour, Target{Path: "example.com/lib", Versions: "v1.*"}, Target{Path: "example.com/missing"})
+
+	ctx := context.Background()
+	require.Error(t, m.Sync(ctx))
+	status := m.Status()
+	require.False(t, status.Running)
+	require.True(t, status.LastSuccess.IsZero())
+	require.Len(t, status.Modules, 2)
+	require.Equal(t, []string{"v1.0.0"}, status.Modules[0].Versions)
+	require.Empty(t, status.Modules[0].Error)
+	require.NotEmpty(t, status.Modules[1].Error)
+
+	// new upstream version is picked up on the next sync
+	plugintest.WriteVersion(t, dir, "v1.1.0")
+	require.Error(t, m.Sync(ctx))
+	require.Equal(t, []string{"v1.0.0", "v1.1.0"}, m.Status().Modules[0].Versions)
+
+	// mirrored content is served from the cache by a fresh mirror even when upstream is gone
+	require.NoError(t, os.RemoveAll(root))
+	m = New(upstream, cache, time.Hour, Target{Path: "example.com/lib"})
+	req, err := goproxy.NewModuleRequest(ctx, "example.com/lib")
+	require.NoError(t, err)
+	mod, err := m.Module(req, "")
+	require.NoError(t, err)
+	versions, err := mod.Versions(ctx, "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"v1.0.0", "v1.1.0"}, versions)
+	info, err := mod.Stat(ctx, "v1.1.0")
+	require.NoError(t, err)
+	require.Equal(t, "v1.1.0", info.Version)
+	archive, err := mod.Zip(ctx, "v1.1.0")
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(archive)
+	require.NoError(t, err)
+	require.Equal(t, "zip v1.1.0", string(data))
+	_, err = mod.GoMod(ctx, "v0.9.0")
+	require.Error(t, err)
+
+	req, err = goproxy.NewModuleRequest(ctx, "example.com/other")
+	require.NoError(t, err)
+	_, err = m.Module(req, "")
+	require.Error(t, err)
+}
+
+func TestMirrorPattern(t *testing.T) {
+	root, err := ioutil.TempDir("", "mirror-test")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+	dir := filepath.Join(root, "example.com", "lib", "@v")
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	plugintest.WriteVersion(t, dir, "v1.0.0")
+
+	upstream, err := apriori.NewDirPlugin(root)
+	require.NoError(t, err)
+	cache := plugintest.NewCache()
+	m := New(upstream, cache, time.Hour, Target{Path: "example.com/*"})
+
+	// nothing to sync until a module matching the pattern is requested
+	ctx := context.Background()
+	require.NoError(t, m.Sync(ctx))
+	require.Empty(t, m.Status().Modules)
+
+	req, err := goproxy.NewModuleRequest(ctx, "example.com/lib")
+	require.NoError(t, err)
+	mod, err := m.Module(req, "")
+	require.NoError(t, err)
+	versions, err := mod.Versions(ctx, "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"v1.0.0"}, versions)
+
+	req, err = goproxy.NewModuleRequest(ctx, "example.org/lib")
+	require.NoError(t, err)
+	_, err = m.Module(req, "")
+	require.Error(t, err)
+
+	// paths matching the pattern which fail to sync are not remembered
+	req, err = goproxy.NewModuleRequest(ctx, "example.com/missing")
+	require.NoError(t, err)
+	_, err = m.Module(req, "")
+	require.Error(t, err)
+	require.NoError(t, m.Sync(ctx))
+	require.Len(t, m.Status().Modules, 1)
+
+	// matched modules are remembered and kept in sync by a fresh mirror
+	plugintest.WriteVersion(t, dir, "v1.1.0")
+	m = New(upstream, cache, time.Hour, Target{Path: "example.com/*"})
+	require.NoError(t, m.Sync(ctx))
+	status := m.Status()
+	require.Len(t, status.Modules, 1)
+	require.Equal(t, "example.com/lib", status.Modules[0].Path)
+	require.Equal(t, []string{"v1.0.0", "v1.1.0"}, status.Modules[0].Versions)
+}
+
+func TestMirrorRunInterval(t *testing.T) {
+	m := New(nil, plugintest.NewCache(), 0, Target{Path: "example.com/lib"})
+	require.Error(t, m.Run(context.Background()))
+}
@@ -0,0 +1,97 @@
+package mirror
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/rs/zerolog"
+
+	"github.com/sirkon/goproxy"
+	"github.com/sirkon/goproxy/internal/errors"
+	"github.com/sirkon/goproxy/plugin/aposteriori"
+)
+
+var _ goproxy.Module = &module{}
+
+// module serves mirrored module versions from the cache. Nothing is requested from the upstream here
+type module struct {
+	parent *Mirror
+	path   string
+}
+
+func (m *module) ModulePath() string {
+	return m.path
+}
+
+func (m *module) Versions(ctx context.Context, prefix string) (tags []string, err error) {
+	versions, err := m.parent.versions(ctx, m.path)
+	if err != nil {
+		return nil, err
+	}
+	for _, version := range versions {
+		if strings.HasPrefix(version, prefix) {
+			tags = append(tags, version)
+		}
+	}
+	return tags, nil
+}
+
+func (m *module) Stat(ctx context.Context, rev string) (*goproxy.RevInfo, error) {
+	file, err := m.get(ctx, rev, aposteriori.RevInfoName)
+	if err != nil {
+		return nil, err
+	}
+	defer m.close(ctx, file)
+
+	var res goproxy.RevInfo
+	decoder := json.NewDecoder(file)
+	if err := decoder.Decode(&res); err != nil {
+		return nil, errors.Wrapf(err, "mirror decoding revision info of %s@%s", m.path, rev)
+	}
+	return &res, nil
+}
+
+func (m *module) GoMod(ctx context.Context, version string) (data []byte, err error) {
+	file, err := m.get(ctx, version, aposteriori.GoModName)
+	if err != nil {
+		return nil, err
+	}
+	defer m.close(ctx, file)
+	return ioutil.ReadAll(file)
+}
+
+func (m *module) Zip(ctx context.Context, version string) (file io.ReadCloser, err error) {
+	return m.get(ctx, version, aposteriori.ZipName)
+}
+
+// get returns cached item of the mirrored version
+func (m *module) get(ctx context.Context, version, name string) (io.ReadCloser, error) {
+	versions, err := m.parent.versions(ctx, m.path)
+	if err != nil {
+		return nil, err
+	}
+	var found bool
+	for _, v := range versions {
+		if v == version {
+			found = true
+			break
+		}
+	}
+	if !found {
+		return nil, errors.Newf("mirror version %s of %s is not mirrored", version, m.path)
+	}
+	file, err := m.parent.cache.Get(aposteriori.CachePath(m.path, version, name))
+	if err != nil {
+		return nil, errors.Wrapf(err, "mirror getting %s of %s@%s", name, m.path, version)
+	}
+	return file, nil
+}
+
+func (m *module) close(ctx context.Context, file io.Closer) {
+	if err := file.Close(); err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("mirror closing cached item")
+	}
+}
@@ -0,0 +1,47 @@
+package mirror
+
+import (
+	"net/http"
+
+	"github.com/sirkon/goproxy"
+	"github.com/sirkon/goproxy/internal/errors"
+)
+
+var _ goproxy.Plugin = &Mirror{}
+
+// Module returns source of a mirrored module. A module matching a path pattern is synced right away when it is
+// requested for the first time
+func (m *Mirror) Module(req *http.Request, prefix string) (goproxy.Module, error) {
+	path, _, err := goproxy.GetModInfo(req, prefix)
+	if err != nil {
+		return nil, err
+	}
+	ctx := req.Context()
+	target, discovered, ok := m.target(ctx, path)
+	if !ok {
+		return nil, errors.Newf("mirror module %s is not mirrored", path)
+	}
+	if discovered {
+		// the module is matched by a pattern for the first time, there's nothing in the cache yet
+		if err := m.syncModule(ctx, target); err != nil {
+			return nil, err
+		}
+		m.addTarget(ctx, target)
+	}
+	return &module{
+		parent: m,
+		path:   path,
+	}, nil
+}
+
+func (m *Mirror) Leave(source goproxy.Module) error {
+	return nil
+}
+
+func (m *Mirror) Close() error {
+	return nil
+}
+
+func (m *Mirror) String() string {
+	return "mirror"
+}
@@ -0,0 +1,266 @@
+package osv
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/sirkon/goproxy/internal/errors"
+	"github.com/sirkon/goproxy/semver"
+)
+
+// GoEcosystem OSV ecosystem of Go modules, entries of other ecosystems are ignored
+const GoEcosystem = "Go"
+
+// Entry vulnerability in OSV format, only fields needed to find affected versions are here
+type Entry struct {
+	ID        string     `json:"id"`
+	Aliases   []string   `json:"aliases,omitempty"`
+	Summary   string     `json:"summary,omitempty"`
+	Withdrawn string     `json:"withdrawn,omitempty"`
+	Affected  []Affected `json:"affected"`
+}
+
+// Affected package of a vulnerability
+type Affected struct {
+	Package struct {
+		Ecosystem string `json:"ecosystem"`
+		Name      string `json:"name"`
+	} `json:"package"`
+	Ranges   []Range  `json:"ranges,omitempty"`
+	Versions []string `json:"versions,omitempty"`
+}
+
+// Range of affected versions
+type Range struct {
+	Type   string  `json:"type"`
+	Events []Event `json:"events"`
+}
+
+// Event of a range, only one of fields is set. Versions are semver without v prefix, "0" introduced means from the
+// very beginning
+type Event struct {
+	Introduced   string `json:"introduced,omitempty"`
+	Fixed        string `json:"fixed,omitempty"`
+	LastAffected string `json:"last_affected,omitempty"`
+	Limit        string `json:"limit,omitempty"`
+}
+
+// affects checks if the version of the module is affected
+func (a *Affected) affects(version string) bool {
+	for _, v := range a.Versions {
+		if goVersion(v) == version {
+			return true
+		}
+	}
+	for _, r := range a.Ranges {
+		if r.affects(version) {
+			return true
+		}
+	}
+	return false
+}
+
+// affects evaluates events in their version order, as OSV schema prescribes
+func (r *Range) affects(version string) bool {
+	if r.Type != "SEMVER" && r.Type != "ECOSYSTEM" {
+		return false
+	}
+	events := append([]Event(nil), r.Events...)
+	sort.SliceStable(events, func(i, j int) bool {
+		return compare(events[i].version(), events[j].version()) < 0
+	})
+	var affected bool
+	for _, e := range events {
+		switch {
+		case len(e.Introduced) > 0:
+			if compare(version, e.Introduced) >= 0 {
+				affected = true
+			}
+		case len(e.Fixed) > 0:
+			if compare(version, e.Fixed) >= 0 {
+				affected = false
+			}
+		case len(e.LastAffected) > 0:
+			if compare(version, e.LastAffected) > 0 {
+				affected = false
+			}
+		case len(e.Limit) > 0:
+			if compare(version, e.Limit) >= 0 {
+				affected = false
+			}
+		}
+	}
+	return affected
+}
+
+func (e Event) version() string {
+	for _, v := range []string{e.Introduced, e.Fixed, e.LastAffected, e.Limit} {
+		if len(v) > 0 {
+			return v
+		}
+	}
+	return ""
+}
+
+// compare compares Go version with OSV version or two OSV versions, "0" is less than anything
+func compare(x, y string) int {
+	switch {
+	case x == "0" && y == "0":
+		return 0
+	case x == "0":
+		return -1
+	case y == "0":
+		return 1
+	}
+	return semver.Compare(goVersion(x), goVersion(y))
+}
+
+// goVersion converts OSV version into Go one
+func goVersion(v string) string {
+	if strings.HasPrefix(v, "v") {
+		return v
+	}
+	return "v" + v
+}
+
+// DB vulnerabilities loaded from a directory of OSV JSON entries. New entries can be dropped into the directory,
+// Run picks them up
+type DB struct {
+	dir string
+
+	lock      sync.RWMutex
+	modules   map[string][]*Entry
+	signature string
+}
+
+// LoadDB loads entries from *.json files in the directory and its subdirectories
+func LoadDB(dir string) (*DB, error) {
+	res := &DB{dir: dir}
+	if err := res.Reload(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Reload reads entries from the directory again. Current entries are kept if any of files is broken
+func (db *DB) Reload() error {
+	signature, err := db.dirSignature()
+	if err != nil {
+		return err
+	}
+	modules := map[string][]*Entry{}
+	err = filepath.Walk(db.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || filepath.Ext(path) != ".json" {
+			return nil
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var entry Entry
+		if err := json.Unmarshal(data, &entry); err != nil {
+			return errors.Wrapf(err, "decoding %s", path)
+		}
+		if len(entry.Withdrawn) > 0 {
+			return nil
+		}
+		seen := map[string]bool{}
+		for _, a := range entry.Affected {
+			if a.Package.Ecosystem != GoEcosystem || seen[a.Package.Name] {
+				continue
+			}
+			seen[a.Package.Name] = true
+			modules[a.Package.Name] = append(modules[a.Package.Name], &entry)
+		}
+		return nil
+	})
+	if err != nil {
+		return errors.Wrap(err, "osv loading vulnerabilities")
+	}
+
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	db.modules = modules
+	db.signature = signature
+	return nil
+}
+
+// dirSignature describes names, sizes and modification times of files in the directory, it changes when files do
+func (db *DB) dirSignature() (string, error) {
+	var buf strings.Builder
+	err := filepath.Walk(db.dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			_, _ = fmt.Fprintf(&buf, "%s %d %d\n", path, info.Size(), info.ModTime().UnixNano())
+		}
+		return nil
+	})
+	if err != nil {
+		return "", errors.Wrapf(err, "osv reading directory %s", db.dir)
+	}
+	return buf.String(), nil
+}
+
+// Run checks the directory every interval and reloads entries when files there have changed until ctx is done
+func (db *DB) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		signature, err := db.dirSignature()
+		if err != nil {
+			zerolog.Ctx(ctx).Error().Err(err).Msg("osv checking vulnerabilities directory")
+			continue
+		}
+		db.lock.RLock()
+		changed := signature != db.signature
+		db.lock.RUnlock()
+		if !changed {
+			continue
+		}
+		if err := db.Reload(); err != nil {
+			zerolog.Ctx(ctx).Error().Err(err).Msg("osv reloading vulnerabilities")
+			continue
+		}
+		zerolog.Ctx(ctx).Info().Str("dir", db.dir).Msg("osv vulnerabilities reloaded")
+	}
+}
+
+// Affecting returns vulnerabilities affecting the module version
+func (db *DB) Affecting(path, version string) []*Entry {
+	if !semver.IsValid(version) {
+		return nil
+	}
+	db.lock.RLock()
+	defer db.lock.RUnlock()
+	var res []*Entry
+	for _, entry := range db.modules[path] {
+		for i := range entry.Affected {
+			a := &entry.Affected[i]
+			if a.Package.Ecosystem == GoEcosystem && a.Package.Name == path && a.affects(version) {
+				res = append(res, entry)
+				break
+			}
+		}
+	}
+	return res
+}
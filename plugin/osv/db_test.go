@@ -0,0 +1,129 @@
+package osv
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const entryLib = `{
+  "id": "GO-2020-0001",
+  "summary": "bad thing",
+  "affected": [{
+    "package": {"ecosystem": "Go", "name": "github.com/user/lib"},
+    "ranges": [{"type": "SEMVER", "events": [{"introduced": "1.2.0"}, {"fixed": "1.2.5"}, {"introduced": "1.4.0"}]}]
+  }]
+}`
+
+const entryOther = `{
+  "id": "GO-2020-0002",
+  "affected": [
+    {
+      "package": {"ecosystem": "Go", "name": "github.com/user/other"},
+      "ranges": [{"type": "SEMVER", "events": [{"introduced": "0"}, {"last_affected": "1.0.0"}]}],
+      "versions": ["2.0.0"]
+    },
+    {
+      "package": {"ecosystem": "npm", "name": "github.com/user/lib"},
+      "ranges": [{"type": "SEMVER", "events": [{"introduced": "0"}]}]
+    }
+  ]
+}`
+
+const entryWithdrawn = `{
+  "id": "GO-2020-0003",
+  "withdrawn": "2020-01-01T00:00:00Z",
+  "affected": [{
+    "package": {"ecosystem": "Go", "name": "github.com/user/lib"},
+    "ranges": [{"type": "SEMVER", "events": [{"introduced": "0"}]}]
+  }]
+}`
+
+func writeEntries(t *testing.T, dir string, entries map[string]string) {
+	t.Helper()
+	for name, content := range entries {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, ioutil.WriteFile(path, []byte(content), 0644))
+	}
+}
+
+func ids(entries []*Entry) []string {
+	res := []string{}
+	for _, entry := range entries {
+		res = append(res, entry.ID)
+	}
+	return res
+}
+
+func TestDB(t *testing.T) {
+	dir, err := ioutil.TempDir("", "osv")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	writeEntries(t, dir, map[string]string{
+		"GO-2020-0001.json":     entryLib,
+		"sub/GO-2020-0002.json": entryOther,
+		"GO-2020-0003.json":     entryWithdrawn,
+		"README.md":             "not an entry",
+	})
+
+	db, err := LoadDB(dir)
+	require.NoError(t, err)
+
+	tests := []struct {
+		path    string
+		version string
+		want    []string
+	}{
+		{"github.com/user/lib", "v1.1.0", []string{}},
+		{"github.com/user/lib", "v1.2.0", []string{"GO-2020-0001"}},
+		{"github.com/user/lib", "v1.2.4", []string{"GO-2020-0001"}},
+		{"github.com/user/lib", "v1.2.5", []string{}},
+		{"github.com/user/lib", "v1.3.0", []string{}},
+		{"github.com/user/lib", "v1.4.1", []string{"GO-2020-0001"}},
+		{"github.com/user/lib", "master", []string{}},
+		{"github.com/user/other", "v0.1.0", []string{"GO-2020-0002"}},
+		{"github.com/user/other", "v1.0.0", []string{"GO-2020-0002"}},
+		{"github.com/user/other", "v1.0.1", []string{}},
+		{"github.com/user/other", "v2.0.0", []string{"GO-2020-0002"}},
+		{"github.com/user/unknown", "v1.0.0", []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path+"@"+tt.version, func(t *testing.T) {
+			require.Equal(t, tt.want, ids(db.Affecting(tt.path, tt.version)))
+		})
+	}
+}
+
+func TestDBReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "osv")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	db, err := LoadDB(dir)
+	require.NoError(t, err)
+	require.Empty(t, db.Affecting("github.com/user/lib", "v1.2.0"))
+
+	// broken entries are not applied
+	writeEntries(t, dir, map[string]string{"broken.json": "{"})
+	require.Error(t, db.Reload())
+	require.NoError(t, os.Remove(filepath.Join(dir, "broken.json")))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		db.Run(ctx, 10*time.Millisecond)
+		close(done)
+	}()
+	writeEntries(t, dir, map[string]string{"GO-2020-0001.json": entryLib})
+	require.Eventually(t, func() bool {
+		return len(db.Affecting("github.com/user/lib", "v1.2.0")) > 0
+	}, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	<-done
+}
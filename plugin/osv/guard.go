@@ -0,0 +1,188 @@
+package osv
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/sirkon/goproxy"
+	"github.com/sirkon/goproxy/internal/module"
+	"github.com/sirkon/goproxy/semver"
+)
+
+// Mode how affected versions are treated
+type Mode int
+
+const (
+	// Flag serves affected versions, they are logged and reported
+	Flag Mode = iota
+
+	// Block leaves affected versions out of version lists and refuses to serve them with 403 Forbidden. go.mod files
+	// are still served, the go command needs them to build module graphs
+	Block
+)
+
+// maxServed how many requested versions are remembered for the report, the least recently requested ones are
+// forgotten first
+const maxServed = 10000
+
+// Guard checks versions of modules served by upstream against vulnerability database. Guard is a Plugin and also an
+// http.Handler responding with Report in JSON
+type Guard struct {
+	upstream goproxy.Plugin
+	db       *DB
+	mode     Mode
+
+	lock   sync.Mutex
+	served map[module.Version]time.Time
+}
+
+// New creates a guard of upstream modules
+func New(upstream goproxy.Plugin, db *DB, mode Mode) *Guard {
+	return &Guard{
+		upstream: upstream,
+		db:       db,
+		mode:     mode,
+		served:   map[module.Version]time.Time{},
+	}
+}
+
+func (g *Guard) String() string {
+	return fmt.Sprintf("osv(%s)", g.upstream)
+}
+
+// Module gets the module from upstream and wraps it
+func (g *Guard) Module(req *http.Request, prefix string) (goproxy.Module, error) {
+	mod, err := g.upstream.Module(req, prefix)
+	if err != nil {
+		return nil, err
+	}
+	return &guardModule{
+		Module: mod,
+		guard:  g,
+	}, nil
+}
+
+// Leave passes the module of upstream to it
+func (g *Guard) Leave(source goproxy.Module) error {
+	if mod, ok := source.(*guardModule); ok {
+		return g.upstream.Leave(mod.Module)
+	}
+	return g.upstream.Leave(source)
+}
+
+// Close closes upstream
+func (g *Guard) Close() error {
+	return g.upstream.Close()
+}
+
+// Invalidate passes invalidation to upstream
+func (g *Guard) Invalidate(path string) {
+	goproxy.Invalidate(g.upstream, path)
+}
+
+// markServed remembers a version was requested, affected ones get into the report
+func (g *Guard) markServed(path, version string) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.served[module.Version{Path: path, Version: version}] = time.Now()
+	if len(g.served) > maxServed {
+		g.forget(len(g.served) - maxServed*3/4)
+	}
+}
+
+// forget drops n least recently requested versions, it is called under the lock. Versions are dropped in bulk, so
+// the cost of sorting is shared by many requests
+func (g *Guard) forget(n int) {
+	versions := make([]module.Version, 0, len(g.served))
+	for version := range g.served {
+		versions = append(versions, version)
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return g.served[versions[i]].Before(g.served[versions[j]])
+	})
+	for _, version := range versions[:n] {
+		delete(g.served, version)
+	}
+}
+
+// Finding affected module version which was requested
+type Finding struct {
+	Path            string
+	Version         string
+	Vulnerabilities []string  // IDs of vulnerabilities
+	Blocked         bool      // whether the version was refused
+	LastRequested   time.Time // time of the last request of the version
+}
+
+// Report lists requested module versions affected by vulnerabilities known at the moment. Only up to maxServed
+// most recently requested versions are taken into account
+func (g *Guard) Report() []Finding {
+	g.lock.Lock()
+	served := make(map[module.Version]time.Time, len(g.served))
+	for version, moment := range g.served {
+		served[version] = moment
+	}
+	g.lock.Unlock()
+
+	res := []Finding{}
+	for version, moment := range served {
+		entries := g.db.Affecting(version.Path, version.Version)
+		if len(entries) == 0 {
+			continue
+		}
+		finding := Finding{
+			Path:          version.Path,
+			Version:       version.Version,
+			Blocked:       g.mode == Block,
+			LastRequested: moment,
+		}
+		for _, entry := range entries {
+			finding.Vulnerabilities = append(finding.Vulnerabilities, entry.ID)
+		}
+		sort.Strings(finding.Vulnerabilities)
+		res = append(res, finding)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Path != res[j].Path {
+			return res[i].Path < res[j].Path
+		}
+		return semver.Compare(res[i].Version, res[j].Version) < 0
+	})
+	return res
+}
+
+// ServeHTTP responds with the report
+func (g *Guard) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	data, err := json.Marshal(g.Report())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
+
+// Vulnerable error of a version refused because of vulnerabilities
+type Vulnerable struct {
+	Path    string
+	Version string
+	Entries []*Entry
+}
+
+func (v *Vulnerable) Error() string {
+	ids := make([]string, len(v.Entries))
+	for i, entry := range v.Entries {
+		ids[i] = entry.ID
+	}
+	return fmt.Sprintf("%s@%s is affected by %s", v.Path, v.Version, strings.Join(ids, ", "))
+}
+
+// StatusCode 403 Forbidden
+func (v *Vulnerable) StatusCode() int {
+	return http.StatusForbidden
+}
@@ -0,0 +1,143 @@
+package osv
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sirkon/goproxy"
+	"github.com/sirkon/goproxy/internal/errors"
+	"github.com/sirkon/goproxy/internal/module"
+	"github.com/sirkon/goproxy/internal/plugintest"
+)
+
+// upstream serves every module with the same versions
+var upstream = &plugintest.Plugin{
+	Versions: []string{"v1.1.0", "v1.2.0", "v1.2.5"},
+	Master:   "v1.2.0",
+}
+
+func newGuard(t *testing.T, mode Mode) (*Guard, func()) {
+	t.Helper()
+	dir, err := ioutil.TempDir("", "osv")
+	require.NoError(t, err)
+	writeEntries(t, dir, map[string]string{"GO-2020-0001.json": entryLib})
+	db, err := LoadDB(dir)
+	require.NoError(t, err)
+	return New(upstream, db, mode), func() { os.RemoveAll(dir) }
+}
+
+func getReport(t *testing.T, g *Guard) []Finding {
+	t.Helper()
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, httptest.NewRequest("GET", "/report", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+	var res []Finding
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &res))
+	return res
+}
+
+func TestGuardBlock(t *testing.T) {
+	g, cleanup := newGuard(t, Block)
+	defer cleanup()
+	ctx := context.Background()
+
+	mod := plugintest.GetModule(t, g, "github.com/user/lib")
+	versions, err := mod.Versions(ctx, "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"v1.1.0", "v1.2.5"}, versions)
+
+	_, err = mod.Zip(ctx, "v1.2.0")
+	var v *Vulnerable
+	require.True(t, errors.As(err, &v))
+	require.Equal(t, http.StatusForbidden, v.StatusCode())
+	_, err = mod.Stat(ctx, "master")
+	require.Error(t, err)
+	_, err = mod.GoMod(ctx, "v1.2.0")
+	require.NoError(t, err)
+	_, err = mod.Zip(ctx, "v1.2.5")
+	require.NoError(t, err)
+
+	report := getReport(t, g)
+	require.Len(t, report, 1)
+	require.Equal(t, "github.com/user/lib", report[0].Path)
+	require.Equal(t, "v1.2.0", report[0].Version)
+	require.Equal(t, []string{"GO-2020-0001"}, report[0].Vulnerabilities)
+	require.True(t, report[0].Blocked)
+}
+
+func TestGuardFlag(t *testing.T) {
+	g, cleanup := newGuard(t, Flag)
+	defer cleanup()
+	ctx := context.Background()
+
+	require.Empty(t, getReport(t, g))
+
+	mod := plugintest.GetModule(t, g, "github.com/user/lib")
+	versions, err := mod.Versions(ctx, "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"v1.1.0", "v1.2.0", "v1.2.5"}, versions)
+	info, err := mod.Stat(ctx, "master")
+	require.NoError(t, err)
+	require.Equal(t, "v1.2.0", info.Version)
+	_, err = mod.Zip(ctx, "v1.1.0")
+	require.NoError(t, err)
+
+	report := getReport(t, g)
+	require.Len(t, report, 1)
+	require.Equal(t, "v1.2.0", report[0].Version)
+	require.False(t, report[0].Blocked)
+}
+
+// statsModule counts Stat calls reaching upstream
+type statsModule struct {
+	goproxy.Module
+	stats *int
+}
+
+func (m statsModule) Stat(ctx context.Context, rev string) (*goproxy.RevInfo, error) {
+	*m.stats++
+	return m.Module.Stat(ctx, rev)
+}
+
+func TestGuardBlockBeforeUpstream(t *testing.T) {
+	g, cleanup := newGuard(t, Block)
+	defer cleanup()
+	ctx := context.Background()
+
+	var stats int
+	mod := &guardModule{
+		Module: statsModule{Module: plugintest.GetModule(t, upstream, "github.com/user/lib"), stats: &stats},
+		guard:  g,
+	}
+	_, err := mod.Stat(ctx, "v1.2.0")
+	var v *Vulnerable
+	require.True(t, errors.As(err, &v))
+	require.Zero(t, stats)
+
+	info, err := mod.Stat(ctx, "v1.2.5")
+	require.NoError(t, err)
+	require.Equal(t, "v1.2.5", info.Version)
+	require.Equal(t, 1, stats)
+}
+
+func TestGuardServedBound(t *testing.T) {
+	g, cleanup := newGuard(t, Flag)
+	defer cleanup()
+
+	g.markServed("github.com/user/lib", "v1.2.0")
+	for i := 0; i < maxServed; i++ {
+		g.markServed("example.com/lib", fmt.Sprintf("v1.0.%d", i))
+	}
+	require.True(t, len(g.served) <= maxServed)
+	require.Empty(t, getReport(t, g))
+	_, ok := g.served[module.Version{Path: "example.com/lib", Version: fmt.Sprintf("v1.0.%d", maxServed-1)}]
+	require.True(t, ok)
+}
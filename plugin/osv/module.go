@@ -0,0 +1,82 @@
+package osv
+
+import (
+	"context"
+	"io"
+
+	"github.com/rs/zerolog"
+
+	"github.com/sirkon/goproxy"
+	"github.com/sirkon/goproxy/semver"
+)
+
+// guardModule checks versions of the module against vulnerability database
+type guardModule struct {
+	goproxy.Module
+	guard *Guard
+}
+
+// check logs vulnerabilities of the version and returns Vulnerable error in Block mode
+func (m *guardModule) check(ctx context.Context, version string) error {
+	m.guard.markServed(m.ModulePath(), version)
+	entries := m.guard.db.Affecting(m.ModulePath(), version)
+	if len(entries) == 0 {
+		return nil
+	}
+	ids := make([]string, len(entries))
+	for i, entry := range entries {
+		ids[i] = entry.ID
+	}
+	zerolog.Ctx(ctx).Warn().Strs("vulnerabilities", ids).Str("version", version).Msg("osv affected version requested")
+	if m.guard.mode != Block {
+		return nil
+	}
+	return &Vulnerable{
+		Path:    m.ModulePath(),
+		Version: version,
+		Entries: entries,
+	}
+}
+
+func (m *guardModule) Versions(ctx context.Context, prefix string) (tags []string, err error) {
+	all, err := m.Module.Versions(ctx, prefix)
+	if err != nil || m.guard.mode != Block {
+		return all, err
+	}
+	for _, version := range all {
+		if len(m.guard.db.Affecting(m.ModulePath(), version)) > 0 {
+			zerolog.Ctx(ctx).Debug().Str("version", version).Msg("osv filtered out affected version")
+			continue
+		}
+		tags = append(tags, version)
+	}
+	return tags, nil
+}
+
+// Stat checks canonical versions before they are requested from upstream, other revisions are checked once they are
+// resolved into versions
+func (m *guardModule) Stat(ctx context.Context, rev string) (*goproxy.RevInfo, error) {
+	canonical := semver.IsValid(rev) && semver.Canonical(rev) == rev
+	if canonical {
+		if err := m.check(ctx, rev); err != nil {
+			return nil, err
+		}
+	}
+	info, err := m.Module.Stat(ctx, rev)
+	if err != nil {
+		return nil, err
+	}
+	if !canonical || info.Version != rev {
+		if err := m.check(ctx, info.Version); err != nil {
+			return nil, err
+		}
+	}
+	return info, nil
+}
+
+func (m *guardModule) Zip(ctx context.Context, version string) (file io.ReadCloser, err error) {
+	if err := m.check(ctx, version); err != nil {
+		return nil, err
+	}
+	return m.Module.Zip(ctx, version)
+}
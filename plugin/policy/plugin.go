@@ -0,0 +1,127 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/rs/zerolog"
+
+	"github.com/sirkon/goproxy"
+	"github.com/sirkon/goproxy/semver"
+)
+
+// New creates a plugin serving modules of upstream as long as the policy allows them. Versions not allowed are left
+// out of version lists, requests for them fail with Violation error
+func New(upstream goproxy.Plugin, policy *Policy) goproxy.Plugin {
+	return &plugin{
+		upstream: upstream,
+		policy:   policy,
+	}
+}
+
+type plugin struct {
+	upstream goproxy.Plugin
+	policy   *Policy
+}
+
+func (p *plugin) String() string {
+	return fmt.Sprintf("policy(%s)", p.upstream)
+}
+
+func (p *plugin) Module(req *http.Request, prefix string) (goproxy.Module, error) {
+	mod, err := p.upstream.Module(req, prefix)
+	if err != nil {
+		return nil, err
+	}
+	return &policyModule{
+		Module: mod,
+		policy: p.policy,
+	}, nil
+}
+
+func (p *plugin) Leave(source goproxy.Module) error {
+	if mod, ok := source.(*policyModule); ok {
+		return p.upstream.Leave(mod.Module)
+	}
+	return p.upstream.Leave(source)
+}
+
+func (p *plugin) Close() error {
+	return p.upstream.Close()
+}
+
+func (p *plugin) Invalidate(path string) {
+	goproxy.Invalidate(p.upstream, path)
+}
+
+// policyModule checks versions of the module before they are served
+type policyModule struct {
+	goproxy.Module
+	policy *Policy
+}
+
+// check returns a Violation error if the version is not allowed, the matching rule is logged then
+func (m *policyModule) check(ctx context.Context, version string) error {
+	v := m.policy.violation(m.ModulePath(), version)
+	if v == nil {
+		return nil
+	}
+	zerolog.Ctx(ctx).Warn().Str("rule", v.Rule.String()).Str("version", version).Msg("policy violation")
+	return v
+}
+
+func (m *policyModule) Versions(ctx context.Context, prefix string) (tags []string, err error) {
+	all, err := m.Module.Versions(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+	for _, version := range all {
+		if rule := m.policy.Check(m.ModulePath(), version); rule != nil && rule.Action != Allow {
+			zerolog.Ctx(ctx).Debug().Str("rule", rule.String()).Str("version", version).Msg("policy filtered out version")
+			continue
+		}
+		tags = append(tags, version)
+	}
+	if len(tags) == 0 {
+		// nothing is left, it may be the whole module is not allowed
+		if err := m.check(ctx, ""); err != nil {
+			return nil, err
+		}
+	}
+	return tags, nil
+}
+
+func (m *policyModule) Stat(ctx context.Context, rev string) (*goproxy.RevInfo, error) {
+	// revisions other than versions are checked after they are resolved into versions
+	if semver.IsValid(rev) {
+		if err := m.check(ctx, rev); err != nil {
+			return nil, err
+		}
+	} else if err := m.check(ctx, ""); err != nil {
+		return nil, err
+	}
+	info, err := m.Module.Stat(ctx, rev)
+	if err != nil {
+		return nil, err
+	}
+	if err := m.check(ctx, info.Version); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+func (m *policyModule) GoMod(ctx context.Context, version string) (data []byte, err error) {
+	if err := m.check(ctx, version); err != nil {
+		return nil, err
+	}
+	return m.Module.GoMod(ctx, version)
+}
+
+func (m *policyModule) Zip(ctx context.Context, version string) (file io.ReadCloser, err error) {
+	if err := m.check(ctx, version); err != nil {
+		return nil, err
+	}
+	return m.Module.Zip(ctx, version)
+}
@@ -0,0 +1,112 @@
+package policy
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sirkon/goproxy/internal/errors"
+	"github.com/sirkon/goproxy/internal/plugintest"
+)
+
+// upstream serves every module with the same versions
+var upstream = &plugintest.Plugin{
+	Versions: []string{"v1.0.0", "v1.2.0", "v1.2.4", "v1.3.0"},
+	Master:   "v1.2.4",
+}
+
+func requireViolation(t *testing.T, err error, code int) {
+	t.Helper()
+	var v *Violation
+	require.True(t, errors.As(err, &v), "policy violation expected, got %v", err)
+	require.Equal(t, code, v.StatusCode())
+}
+
+func TestPlugin(t *testing.T) {
+	policy, err := NewPolicy(
+		&Rule{Action: Hide, Path: "github.com/user/lib", Versions: ">=v1.2.0 <v1.2.5"},
+		&Rule{Action: Deny, Path: "github.com/evil/*"},
+		&Rule{Action: Allow, Path: "github.com/user/*"},
+		&Rule{Action: Deny, Path: "*", Versions: ">=v1.3.0"},
+	)
+	require.NoError(t, err)
+	p := New(upstream, policy)
+	ctx := context.Background()
+
+	mod := plugintest.GetModule(t, p, "github.com/user/lib")
+	versions, err := mod.Versions(ctx, "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"v1.0.0", "v1.3.0"}, versions)
+
+	_, err = mod.GoMod(ctx, "v1.2.0")
+	requireViolation(t, err, http.StatusGone)
+	_, err = mod.Zip(ctx, "v1.2.4")
+	requireViolation(t, err, http.StatusGone)
+	// revisions are checked after resolving
+	_, err = mod.Stat(ctx, "master")
+	requireViolation(t, err, http.StatusGone)
+	info, err := mod.Stat(ctx, "v1.0.0")
+	require.NoError(t, err)
+	require.Equal(t, "v1.0.0", info.Version)
+
+	mod = plugintest.GetModule(t, p, "github.com/evil/lib")
+	_, err = mod.Versions(ctx, "")
+	requireViolation(t, err, http.StatusForbidden)
+	_, err = mod.Stat(ctx, "master")
+	requireViolation(t, err, http.StatusForbidden)
+
+	mod = plugintest.GetModule(t, p, "github.com/other/lib")
+	versions, err = mod.Versions(ctx, "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"v1.0.0", "v1.2.0", "v1.2.4"}, versions)
+	_, err = mod.Zip(ctx, "v1.3.0")
+	requireViolation(t, err, http.StatusForbidden)
+	versions, err = mod.Versions(ctx, "v1.3")
+	require.NoError(t, err)
+	require.Empty(t, versions)
+}
+
+func TestPolicyReload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "policy")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	file := filepath.Join(dir, "rules")
+	require.NoError(t, ioutil.WriteFile(file, []byte("deny github.com/user/lib\n"), 0644))
+
+	policy, err := LoadPolicy(file)
+	require.NoError(t, err)
+	require.Equal(t, Deny, policy.Check("github.com/user/lib", "v1.0.0").Action)
+
+	// broken rules are not applied
+	require.NoError(t, ioutil.WriteFile(file, []byte("block github.com/user/lib\n"), 0644))
+	require.Error(t, policy.Reload())
+	require.Equal(t, Deny, policy.Check("github.com/user/lib", "v1.0.0").Action)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		policy.Run(ctx, 10*time.Millisecond)
+		close(done)
+	}()
+	require.NoError(t, ioutil.WriteFile(file, []byte("allow github.com/user/lib\n"), 0644))
+	later := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(file, later, later))
+	require.Eventually(t, func() bool {
+		rule := policy.Check("github.com/user/lib", "v1.0.0")
+		return rule != nil && rule.Action == Allow
+	}, 5*time.Second, 10*time.Millisecond)
+	cancel()
+	<-done
+
+	empty, err := NewPolicy()
+	require.NoError(t, err)
+	require.Error(t, empty.Reload())
+	// there is nothing to watch, Run returns without waiting for ctx
+	empty.Run(context.Background(), 10*time.Millisecond)
+}
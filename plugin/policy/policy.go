@@ -0,0 +1,152 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/sirkon/goproxy/internal/errors"
+	"github.com/sirkon/goproxy/semver"
+)
+
+// Policy ordered rules, the first one matching a module version decides. Modules and versions matching no rule are
+// allowed, put "deny *" in the end to change this
+type Policy struct {
+	file string
+
+	lock    sync.RWMutex
+	rules   []*Rule
+	modTime time.Time
+}
+
+// NewPolicy creates policy with given rules
+func NewPolicy(rules ...*Rule) (*Policy, error) {
+	for _, rule := range rules {
+		if err := rule.compile(); err != nil {
+			return nil, errors.Wrapf(err, "policy rule %s", rule)
+		}
+	}
+	return &Policy{rules: rules}, nil
+}
+
+// LoadPolicy creates policy with rules from the file, see ParseRules for its format. Rules can be reloaded then
+func LoadPolicy(file string) (*Policy, error) {
+	res := &Policy{file: file}
+	if err := res.Reload(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Reload reads rules from the file again. Current rules are kept if the file is broken
+func (p *Policy) Reload() error {
+	if len(p.file) == 0 {
+		return errors.New("policy has no rules file to reload")
+	}
+	file, err := os.Open(p.file)
+	if err != nil {
+		return errors.Wrap(err, "policy opening rules file")
+	}
+	defer file.Close()
+	stat, err := file.Stat()
+	if err != nil {
+		return errors.Wrap(err, "policy getting rules file info")
+	}
+	rules, err := ParseRules(p.file, file)
+	if err != nil {
+		return errors.Wrap(err, "policy")
+	}
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.rules = rules
+	p.modTime = stat.ModTime()
+	return nil
+}
+
+// Run checks the rules file every interval and reloads it when it has changed until ctx is done. It returns right
+// away for a policy with no file, i.e. made with NewPolicy
+func (p *Policy) Run(ctx context.Context, interval time.Duration) {
+	if len(p.file) == 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+		stat, err := os.Stat(p.file)
+		if err != nil {
+			zerolog.Ctx(ctx).Error().Err(err).Msg("policy checking rules file")
+			continue
+		}
+		p.lock.RLock()
+		changed := !stat.ModTime().Equal(p.modTime)
+		p.lock.RUnlock()
+		if !changed {
+			continue
+		}
+		if err := p.Reload(); err != nil {
+			zerolog.Ctx(ctx).Error().Err(err).Msg("policy reloading rules")
+			continue
+		}
+		zerolog.Ctx(ctx).Info().Str("file", p.file).Msg("policy rules reloaded")
+	}
+}
+
+// Check returns the rule deciding on the module version, nil if there is none. Rules with version ranges never match
+// non-semver versions and an empty version which means the module as a whole
+func (p *Policy) Check(path, version string) *Rule {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	valid := semver.IsValid(version)
+	for _, rule := range p.rules {
+		if !rule.matchPath(path) {
+			continue
+		}
+		if rule.wholeModule() || (valid && rule.matchVersion(version)) {
+			return rule
+		}
+	}
+	return nil
+}
+
+// violation returns a violation if the module version is not allowed, nil otherwise
+func (p *Policy) violation(path, version string) *Violation {
+	rule := p.Check(path, version)
+	if rule == nil || rule.Action == Allow {
+		return nil
+	}
+	return &Violation{Path: path, Version: version, Rule: rule}
+}
+
+// Violation error of a module version not allowed by a policy
+type Violation struct {
+	Path    string
+	Version string // empty if the module is not allowed as a whole
+	Rule    *Rule
+}
+
+func (v *Violation) Error() string {
+	subject := v.Path
+	if len(v.Version) > 0 {
+		subject += "@" + v.Version
+	}
+	return fmt.Sprintf("%s is not allowed by policy rule %s", subject, v.Rule)
+}
+
+// StatusCode 403 Forbidden for denied versions and 410 Gone for hidden ones
+func (v *Violation) StatusCode() int {
+	if v.Rule.Action == Hide {
+		return http.StatusGone
+	}
+	return http.StatusForbidden
+}
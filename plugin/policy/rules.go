@@ -0,0 +1,205 @@
+package policy
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/sirkon/goproxy/internal/errors"
+	"github.com/sirkon/goproxy/semver"
+)
+
+// Action what to do with modules and versions matching a rule
+type Action int
+
+const (
+	// Allow serves matching modules and versions
+	Allow Action = iota
+
+	// Deny refuses to serve with 403 Forbidden, the go command stops at it
+	Deny
+
+	// Hide refuses to serve with 410 Gone as if there was no such version. Beware the go command tries the next proxy
+	// of GOPROXY list after this
+	Hide
+)
+
+func (a Action) String() string {
+	switch a {
+	case Allow:
+		return "allow"
+	case Deny:
+		return "deny"
+	case Hide:
+		return "hide"
+	default:
+		return fmt.Sprintf("action(%d)", int(a))
+	}
+}
+
+// Rule of a policy
+type Rule struct {
+	Action Action
+
+	// Path is a glob pattern in terms of path.Match matching a module path or its leading elements, the same way
+	// GOPRIVATE patterns do: github.com/user/* matches github.com/user/project and github.com/user/project/v2
+	Path string
+
+	// Versions is a range of versions, space separated comparisons which must all hold, e.g. ">=v1.2.0 <v1.2.5".
+	// Comparison operators are =, !=, <, <=, > and >=, a bare version means =. Empty range matches any version
+	Versions string
+
+	// Source where the rule came from, for logging
+	Source string
+
+	constraints []constraint
+}
+
+func (r *Rule) String() string {
+	res := r.Action.String() + " " + r.Path
+	if len(r.Versions) > 0 {
+		res += " " + r.Versions
+	}
+	if len(r.Source) > 0 {
+		res = r.Source + ": " + res
+	}
+	return res
+}
+
+// compile validates the rule and prepares it to match
+func (r *Rule) compile() error {
+	if _, err := path.Match(r.Path, ""); err != nil || len(r.Path) == 0 {
+		return errors.Newf("invalid module path pattern `%s`", r.Path)
+	}
+	switch r.Action {
+	case Allow, Deny, Hide:
+	default:
+		return errors.Newf("unknown %s", r.Action)
+	}
+	r.constraints = r.constraints[:0]
+	for _, item := range strings.Fields(r.Versions) {
+		c, err := parseConstraint(item)
+		if err != nil {
+			return err
+		}
+		r.constraints = append(r.constraints, c)
+	}
+	return nil
+}
+
+// matchPath checks if the rule applies to the module
+func (r *Rule) matchPath(modulePath string) bool {
+	elems := strings.Count(r.Path, "/") + 1
+	parts := strings.SplitN(modulePath, "/", elems+1)
+	if len(parts) < elems {
+		return false
+	}
+	ok, _ := path.Match(r.Path, strings.Join(parts[:elems], "/"))
+	return ok
+}
+
+// wholeModule checks if the rule applies to every version
+func (r *Rule) wholeModule() bool {
+	return len(r.constraints) == 0
+}
+
+// matchVersion checks if the version is in the range of the rule
+func (r *Rule) matchVersion(version string) bool {
+	for _, c := range r.constraints {
+		if !c.match(version) {
+			return false
+		}
+	}
+	return true
+}
+
+type constraint struct {
+	op      string
+	version string
+}
+
+func parseConstraint(item string) (constraint, error) {
+	var res constraint
+	for _, op := range []string{">=", "<=", "!=", "=", "<", ">"} {
+		if strings.HasPrefix(item, op) {
+			res.op = op
+			break
+		}
+	}
+	res.version = item[len(res.op):]
+	if len(res.op) == 0 {
+		res.op = "="
+	}
+	if !semver.IsValid(res.version) {
+		return res, errors.Newf("invalid version `%s` in `%s`", res.version, item)
+	}
+	return res, nil
+}
+
+func (c constraint) match(version string) bool {
+	cmp := semver.Compare(version, c.version)
+	switch c.op {
+	case "=":
+		return cmp == 0
+	case "!=":
+		return cmp != 0
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	default:
+		return cmp >= 0
+	}
+}
+
+// ParseRules reads rules, one per line as <action> <module path pattern> [<version range>], e.g.
+//
+//	deny  github.com/evil/*
+//	hide  github.com/user/lib  >=v1.2.0 <v1.2.5
+//	allow github.com/user/*
+//
+// Empty lines and lines starting with # are skipped. name is used to refer to rules in logs and errors
+func ParseRules(name string, r io.Reader) ([]*Rule, error) {
+	var res []*Rule
+	scanner := bufio.NewScanner(r)
+	var lineNo int
+	for scanner.Scan() {
+		lineNo++
+		line := strings.TrimSpace(scanner.Text())
+		if len(line) == 0 || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		source := fmt.Sprintf("%s:%d", name, lineNo)
+		if len(fields) < 2 {
+			return nil, errors.Newf("%s: action and module path pattern expected, got `%s`", source, line)
+		}
+		rule := &Rule{
+			Path:     fields[1],
+			Versions: strings.Join(fields[2:], " "),
+			Source:   source,
+		}
+		switch fields[0] {
+		case "allow":
+			rule.Action = Allow
+		case "deny":
+			rule.Action = Deny
+		case "hide":
+			rule.Action = Hide
+		default:
+			return nil, errors.Newf("%s: unknown action `%s`", source, fields[0])
+		}
+		if err := rule.compile(); err != nil {
+			return nil, errors.Wrap(err, source)
+		}
+		res = append(res, rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, errors.Wrapf(err, "reading %s", name)
+	}
+	return res, nil
+}
@@ -0,0 +1,84 @@
+package policy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRules(t *testing.T) {
+	rules, err := ParseRules("rules", strings.NewReader(`
+# known bad versions
+hide  github.com/user/lib  >=v1.2.0 <v1.2.5
+deny  github.com/evil/*
+
+allow github.com/user/*
+deny  *
+`))
+	require.NoError(t, err)
+	require.Len(t, rules, 4)
+	require.Equal(t, "rules:3: hide github.com/user/lib >=v1.2.0 <v1.2.5", rules[0].String())
+	require.Equal(t, "rules:7: deny *", rules[3].String())
+
+	for _, input := range []string{
+		"deny",
+		"block github.com/user/lib",
+		"deny github.com/user/lib >=1.2.0",
+		"deny github.com/[user",
+	} {
+		t.Run(input, func(t *testing.T) {
+			_, err := ParseRules("rules", strings.NewReader(input))
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestRuleMatchPath(t *testing.T) {
+	tests := []struct {
+		pattern string
+		path    string
+		want    bool
+	}{
+		{"*", "github.com/user/lib", true},
+		{"github.com/user/*", "github.com/user/lib", true},
+		{"github.com/user/*", "github.com/user/lib/v2", true},
+		{"github.com/user/*", "github.com/user", false},
+		{"github.com/user/lib", "github.com/user/lib/v2", true},
+		{"github.com/user/lib", "github.com/user/library", false},
+		{"github.com/*/lib", "github.com/user/lib", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.pattern+" "+tt.path, func(t *testing.T) {
+			rule := &Rule{Path: tt.pattern}
+			require.NoError(t, rule.compile())
+			require.Equal(t, tt.want, rule.matchPath(tt.path))
+		})
+	}
+}
+
+func TestRuleMatchVersion(t *testing.T) {
+	tests := []struct {
+		versions string
+		version  string
+		want     bool
+	}{
+		{">=v1.2.0 <v1.2.5", "v1.2.0", true},
+		{">=v1.2.0 <v1.2.5", "v1.2.4", true},
+		{">=v1.2.0 <v1.2.5", "v1.2.5", false},
+		{">=v1.2.0 <v1.2.5", "v1.1.9", false},
+		{"v1.0.0", "v1.0.0", true},
+		{"=v1.0.0", "v1.0.1", false},
+		{"!=v1.0.0", "v1.0.1", true},
+		{"<=v1.0.0", "v1.0.0", true},
+		{">v1.0.0", "v1.0.0", false},
+		{"<v1.0.0", "v1.0.0-rc.1", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.versions+" "+tt.version, func(t *testing.T) {
+			rule := &Rule{Path: "*", Versions: tt.versions}
+			require.NoError(t, rule.compile())
+			require.Equal(t, tt.want, rule.matchVersion(tt.version))
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package rewrite
+
+import (
+	"archive/zip"
+	"context"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+
+	"github.com/sirkon/goproxy"
+	"github.com/sirkon/goproxy/fsrepack"
+	"github.com/sirkon/goproxy/internal/errors"
+	"github.com/sirkon/goproxy/internal/modfile"
+	"github.com/sirkon/goproxy/internal/spool"
+	"github.com/sirkon/goproxy/semver"
+)
+
+// rewriteModule serves module path with its substitute fork
+type rewriteModule struct {
+	path string
+	fork goproxy.Module
+	rule *rule
+}
+
+// forkVersion returns version of the substitute serving the given version of the module
+func (m *rewriteModule) forkVersion(version string) string {
+	if res, ok := m.rule.Versions[version]; ok {
+		return res
+	}
+	return version
+}
+
+// version returns version of the module served with the given version of the substitute
+func (m *rewriteModule) version(forkVersion string) string {
+	if res, ok := m.rule.reverse[forkVersion]; ok {
+		return res
+	}
+	return forkVersion
+}
+
+func (m *rewriteModule) ModulePath() string {
+	return m.path
+}
+
+func (m *rewriteModule) Versions(ctx context.Context, prefix string) (tags []string, err error) {
+	forkTags, err := m.fork.Versions(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+	seen := map[string]struct{}{}
+	for _, forkTag := range forkTags {
+		tag := m.version(forkTag)
+		if _, ok := seen[tag]; ok || !strings.HasPrefix(tag, prefix) {
+			continue
+		}
+		seen[tag] = struct{}{}
+		tags = append(tags, tag)
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		return semver.Compare(tags[i], tags[j]) < 0
+	})
+	return tags, nil
+}
+
+func (m *rewriteModule) Stat(ctx context.Context, rev string) (*goproxy.RevInfo, error) {
+	info, err := m.fork.Stat(ctx, m.forkVersion(rev))
+	if err != nil {
+		return nil, err
+	}
+	res := *info
+	// a version of the substitute requested as is is a version of the module as well, only versions mapped by the
+	// rule are to be mapped back
+	if _, ok := m.rule.Versions[rev]; ok {
+		res.Version = m.version(info.Version)
+	}
+	return &res, nil
+}
+
+func (m *rewriteModule) GoMod(ctx context.Context, version string) (data []byte, err error) {
+	forkVersion := m.forkVersion(version)
+	data, err = m.fork.GoMod(ctx, forkVersion)
+	if err != nil {
+		return nil, err
+	}
+	return m.rewriteGoMod(data, forkVersion)
+}
+
+// rewriteGoMod replaces module path of the substitute in its go.mod with the one of the module
+func (m *rewriteModule) rewriteGoMod(data []byte, forkVersion string) ([]byte, error) {
+	file, err := modfile.ParseLax("go.mod", data, nil)
+	if err != nil {
+		return nil, errors.Wrapf(err, "rewrite parsing go.mod of %s@%s", m.fork.ModulePath(), forkVersion)
+	}
+	if file.Module != nil && file.Module.Mod.Path == m.path {
+		return data, nil
+	}
+	if err := file.AddModuleStmt(m.path); err != nil {
+		return nil, errors.Wrap(err, "rewrite setting module path")
+	}
+	data, err = file.Format()
+	if err != nil {
+		return nil, errors.Wrap(err, "rewrite formatting go.mod")
+	}
+	return data, nil
+}
+
+func (m *rewriteModule) Zip(ctx context.Context, version string) (file io.ReadCloser, err error) {
+	forkVersion := m.forkVersion(version)
+	archive, err := m.fork.Zip(ctx, forkVersion)
+	if err != nil {
+		return nil, err
+	}
+	spooled, err := spool.New("", archive)
+	if cErr := archive.Close(); cErr != nil && err == nil {
+		err = cErr
+	}
+	if err != nil {
+		return nil, errors.Wrapf(err, "rewrite reading source archive of %s@%s", m.fork.ModulePath(), forkVersion)
+	}
+	defer func() {
+		if cErr := spooled.Close(); cErr != nil && err == nil {
+			err = cErr
+		}
+	}()
+	zipReader, err := zip.NewReader(spooled, spooled.Size())
+	if err != nil {
+		return nil, errors.Wrapf(err, "rewrite extracting source archive of %s@%s", m.fork.ModulePath(), forkVersion)
+	}
+
+	// go.mod of the module root needs its module path changed, everything else is copied as is
+	repacker := fsrepack.Module(m.fork.ModulePath(), forkVersion, m.path, version)
+	goModName := m.fork.ModulePath() + "@" + forkVersion + "/go.mod"
+	var goMod *zip.File
+	rest := &zip.Reader{Comment: zipReader.Comment}
+	for _, file := range zipReader.File {
+		if file.Name == goModName {
+			goMod = file
+			continue
+		}
+		rest.File = append(rest.File, file)
+	}
+
+	res, err := spool.Create("")
+	if err != nil {
+		return nil, errors.Wrap(err, "rewrite creating an output archive")
+	}
+	defer func() {
+		if err != nil {
+			_ = res.Close()
+		}
+	}()
+	dest := zip.NewWriter(res)
+	if err := fsrepack.Repack(dest, rest, repacker); err != nil {
+		return nil, errors.Wrapf(err, "rewrite repacking %s@%s as %s@%s", m.fork.ModulePath(), forkVersion, m.path, version)
+	}
+	if goMod != nil {
+		if err := m.repackGoMod(dest, goMod, forkVersion, repacker.Destinator("go.mod")); err != nil {
+			return nil, err
+		}
+	}
+	if err := dest.Close(); err != nil {
+		return nil, errors.Wrap(err, "rewrite closing an output archive")
+	}
+	if err := res.Rewind(); err != nil {
+		return nil, errors.Wrap(err, "rewrite reading an output archive")
+	}
+	return res, nil
+}
+
+// repackGoMod writes go.mod of the substitute into the archive of the module with the module path changed
+func (m *rewriteModule) repackGoMod(dest *zip.Writer, goMod *zip.File, forkVersion, name string) error {
+	src, err := goMod.Open()
+	if err != nil {
+		return errors.Wrap(err, "rewrite opening go.mod in source archive")
+	}
+	data, err := ioutil.ReadAll(src)
+	if cErr := src.Close(); cErr != nil && err == nil {
+		err = cErr
+	}
+	if err != nil {
+		return errors.Wrap(err, "rewrite reading go.mod in source archive")
+	}
+	if data, err = m.rewriteGoMod(data, forkVersion); err != nil {
+		return err
+	}
+
+	fh := goMod.FileHeader
+	fh.Name = name
+	w, err := dest.CreateHeader(&fh)
+	if err != nil {
+		return errors.Wrap(err, "rewrite copying attributes for go.mod")
+	}
+	if _, err := w.Write(data); err != nil {
+		return errors.Wrap(err, "rewrite writing go.mod")
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package rewrite
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/sirkon/goproxy"
+	"github.com/sirkon/goproxy/internal/errors"
+	"github.com/sirkon/goproxy/internal/module"
+)
+
+// Rule substitutes modules under one path prefix with modules under another one, e.g. From github.com/user/lib and
+// To gitlab.com/fork/lib serve github.com/user/lib/v2 with gitlab.com/fork/lib/v2
+type Rule struct {
+	From string
+	To   string
+
+	// Versions maps versions of From modules into versions of To modules, e.g. v1.2.3 → v1.2.3-patched.1. Versions
+	// not mentioned here are the same for both
+	Versions map[string]string
+}
+
+// New creates a plugin serving modules covered by rules with their substitutes got from upstream, so the go command
+// sees substitutes as if they were the original modules: with their paths in go.mod and in source archives and with
+// their versions. Other modules are passed to upstream as they are. The longest matching From wins
+func New(upstream goproxy.Plugin, rules ...Rule) (goproxy.Plugin, error) {
+	res := &plugin{upstream: upstream}
+	for _, item := range rules {
+		if err := module.CheckImportPath(item.From); err != nil {
+			return nil, errors.Wrapf(err, "rewrite invalid module path prefix `%s`", item.From)
+		}
+		if err := module.CheckImportPath(item.To); err != nil {
+			return nil, errors.Wrapf(err, "rewrite invalid module path prefix `%s`", item.To)
+		}
+		r := &rule{
+			Rule:    item,
+			reverse: map[string]string{},
+		}
+		for from, to := range item.Versions {
+			if prev, ok := r.reverse[to]; ok {
+				return nil, errors.Newf("rewrite both %s and %s of %s are mapped into %s", prev, from, item.From, to)
+			}
+			r.reverse[to] = from
+		}
+		res.rules = append(res.rules, r)
+	}
+	sort.Slice(res.rules, func(i, j int) bool {
+		return len(res.rules[i].From) > len(res.rules[j].From)
+	})
+	return res, nil
+}
+
+type plugin struct {
+	upstream goproxy.Plugin
+	rules    []*rule
+}
+
+// rule Rule with reverse version mapping
+type rule struct {
+	Rule
+	reverse map[string]string
+}
+
+func (p *plugin) String() string {
+	return fmt.Sprintf("rewrite(%s)", p.upstream)
+}
+
+func (p *plugin) Module(req *http.Request, prefix string) (goproxy.Module, error) {
+	path, _, err := goproxy.GetModInfo(req, prefix)
+	if err != nil {
+		return nil, errors.Wrapf(err, "rewrite getting module data from %s", req.URL.Path)
+	}
+	r, ok := p.match(path)
+	if !ok {
+		return p.upstream.Module(req, prefix)
+	}
+
+	forkPath := r.To + path[len(r.From):]
+	forkReq, err := goproxy.NewModuleRequest(req.Context(), forkPath)
+	if err != nil {
+		return nil, errors.Wrap(err, "rewrite")
+	}
+	// credentials and alike are for the substitute as well
+	forkReq.Header = req.Header.Clone()
+	fork, err := p.upstream.Module(forkReq, "")
+	if err != nil {
+		return nil, errors.Wrapf(err, "rewrite getting %s substituting %s", forkPath, path)
+	}
+	return &rewriteModule{
+		path: path,
+		fork: fork,
+		rule: r,
+	}, nil
+}
+
+// match returns a rule with the longest From the path belongs to
+func (p *plugin) match(path string) (*rule, bool) {
+	for _, r := range p.rules {
+		if path == r.From || strings.HasPrefix(path, r.From+"/") {
+			return r, true
+		}
+	}
+	return nil, false
+}
+
+func (p *plugin) Leave(source goproxy.Module) error {
+	if mod, ok := source.(*rewriteModule); ok {
+		return p.upstream.Leave(mod.fork)
+	}
+	return p.upstream.Leave(source)
+}
+
+func (p *plugin) Close() error {
+	return p.upstream.Close()
+}
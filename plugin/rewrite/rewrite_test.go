@@ -0,0 +1,196 @@
+package rewrite
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sirkon/goproxy"
+	"github.com/sirkon/goproxy/internal/errors"
+	"github.com/sirkon/goproxy/internal/plugintest"
+)
+
+// forkPlugin serves gitlab.com/fork/lib and github.com/other/lib modules
+type forkPlugin struct {
+	left []string
+}
+
+func (p *forkPlugin) Module(req *http.Request, prefix string) (goproxy.Module, error) {
+	path, _, err := goproxy.GetModInfo(req, prefix)
+	if err != nil {
+		return nil, err
+	}
+	switch path {
+	case "gitlab.com/fork/lib", "gitlab.com/fork/lib/v2", "github.com/other/lib":
+		return &forkModule{path: path}, nil
+	default:
+		return nil, errors.Newf("unknown module %s", path)
+	}
+}
+
+func (p *forkPlugin) Leave(source goproxy.Module) error {
+	p.left = append(p.left, source.ModulePath())
+	return nil
+}
+
+func (p *forkPlugin) Close() error {
+	return nil
+}
+
+func (p *forkPlugin) String() string {
+	return "fork"
+}
+
+type forkModule struct {
+	path string
+}
+
+func (m *forkModule) ModulePath() string {
+	return m.path
+}
+
+func (m *forkModule) Versions(ctx context.Context, prefix string) ([]string, error) {
+	return []string{"v1.0.0", "v1.1.0-patched.1", "v1.2.0-patched.1"}, nil
+}
+
+func (m *forkModule) Stat(ctx context.Context, rev string) (*goproxy.RevInfo, error) {
+	return &goproxy.RevInfo{Version: rev, Time: "2019-01-02T03:04:05Z"}, nil
+}
+
+func (m *forkModule) GoMod(ctx context.Context, version string) ([]byte, error) {
+	return []byte("module " + m.path + " // fork\n\ngo 1.12\n\nrequire github.com/pkg/errors v0.8.1\n"), nil
+}
+
+func (m *forkModule) Zip(ctx context.Context, version string) (io.ReadCloser, error) {
+	goMod, _ := m.GoMod(ctx, version)
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range map[string]string{
+		"go.mod":         string(goMod),
+		"lib.go":         "package lib // " + version + "\n",
+		"sub/go.mod.txt": "module " + m.path + "\n",
+	} {
+		w, err := zw.Create(m.path + "@" + version + "/" + name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := w.Write([]byte(content)); err != nil {
+			return nil, err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(&buf), nil
+}
+
+func TestRewrite(t *testing.T) {
+	upstream := &forkPlugin{}
+	p, err := New(upstream, Rule{
+		From:     "github.com/user/lib",
+		To:       "gitlab.com/fork/lib",
+		Versions: map[string]string{"v1.1.0": "v1.1.0-patched.1"},
+	})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	mod := plugintest.GetModule(t, p, "github.com/user/lib")
+	require.Equal(t, "github.com/user/lib", mod.ModulePath())
+
+	versions, err := mod.Versions(ctx, "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"v1.0.0", "v1.1.0", "v1.2.0-patched.1"}, versions)
+	versions, err = mod.Versions(ctx, "v1.1")
+	require.NoError(t, err)
+	require.Equal(t, []string{"v1.1.0"}, versions)
+
+	info, err := mod.Stat(ctx, "v1.1.0")
+	require.NoError(t, err)
+	require.Equal(t, "v1.1.0", info.Version)
+	require.Equal(t, "2019-01-02T03:04:05Z", info.Time)
+	// the version of the substitute requested as is is not taken for the one it is mapped from
+	info, err = mod.Stat(ctx, "v1.1.0-patched.1")
+	require.NoError(t, err)
+	require.Equal(t, "v1.1.0-patched.1", info.Version)
+
+	goMod, err := mod.GoMod(ctx, "v1.1.0")
+	require.NoError(t, err)
+	require.Equal(t, "module github.com/user/lib // fork\n\ngo 1.12\n\nrequire github.com/pkg/errors v0.8.1\n", string(goMod))
+
+	archive, err := mod.Zip(ctx, "v1.1.0")
+	require.NoError(t, err)
+	data, err := ioutil.ReadAll(archive)
+	require.NoError(t, err)
+	require.NoError(t, archive.Close())
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+	files := map[string]string{}
+	for _, file := range zr.File {
+		rc, err := file.Open()
+		require.NoError(t, err)
+		content, err := ioutil.ReadAll(rc)
+		require.NoError(t, err)
+		require.NoError(t, rc.Close())
+		files[file.Name] = string(content)
+	}
+	require.Equal(t, map[string]string{
+		"github.com/user/lib@v1.1.0/go.mod":         string(goMod),
+		"github.com/user/lib@v1.1.0/lib.go":         "package lib // v1.1.0-patched.1\n",
+		"github.com/user/lib@v1.1.0/sub/go.mod.txt": "module gitlab.com/fork/lib\n",
+	}, files)
+
+	require.NoError(t, p.Leave(mod))
+	require.Equal(t, []string{"gitlab.com/fork/lib"}, upstream.left)
+
+	// major versions are substituted as well
+	mod = plugintest.GetModule(t, p, "github.com/user/lib/v2")
+	goMod, err = mod.GoMod(ctx, "v2.0.0")
+	require.NoError(t, err)
+	require.Contains(t, string(goMod), "module github.com/user/lib/v2")
+
+	// other modules are passed as they are
+	mod = plugintest.GetModule(t, p, "github.com/other/lib")
+	goMod, err = mod.GoMod(ctx, "v1.0.0")
+	require.NoError(t, err)
+	require.Contains(t, string(goMod), "module github.com/other/lib")
+
+	_, err = p.Module(httptest.NewRequest("GET", "/github.com/user/library/@v/list", nil), "")
+	require.Error(t, err)
+}
+
+func TestRewriteRules(t *testing.T) {
+	tests := []struct {
+		name  string
+		rules []Rule
+	}{
+		{
+			name:  "invalid-from",
+			rules: []Rule{{From: "github.com/user/lib/", To: "gitlab.com/fork/lib"}},
+		},
+		{
+			name:  "invalid-to",
+			rules: []Rule{{From: "github.com/user/lib", To: ""}},
+		},
+		{
+			name: "ambiguous-versions",
+			rules: []Rule{{
+				From:     "github.com/user/lib",
+				To:       "gitlab.com/fork/lib",
+				Versions: map[string]string{"v1.0.0": "v1.0.0-patched", "v1.0.1": "v1.0.0-patched"},
+			}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := New(&forkPlugin{}, tt.rules...)
+			require.Error(t, err)
+		})
+	}
+}
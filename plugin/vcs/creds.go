@@ -0,0 +1,139 @@
+package vcs
+
+import (
+	"crypto/rand"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/sirkon/goproxy/internal/errors"
+	"github.com/sirkon/goproxy/internal/modfetch"
+)
+
+const (
+	// credsMaxIdle fetchers of credentials identities unused for this long are dropped with everything they fetched
+	credsMaxIdle = 24 * time.Hour
+
+	// credsCleanInterval how often idle credentials identities are looked for
+	credsCleanInterval = 10 * time.Minute
+
+	// credsTouchInterval how often the last use of an identity is recorded on its directory
+	credsTouchInterval = time.Minute
+)
+
+// credentialsRequired error of a request which has no credentials to pass to the repository
+type credentialsRequired struct {
+	path string
+}
+
+func (e *credentialsRequired) Error() string {
+	return "vcs credentials required to access " + e.path
+}
+
+// StatusCode 401 Unauthorized, the request may get through with credentials
+func (e *credentialsRequired) StatusCode() int {
+	return http.StatusUnauthorized
+}
+
+// identityFetcher fetcher of a credentials identity
+type identityFetcher struct {
+	fetcher *modfetch.Fetcher
+	dir     string
+	used    time.Time
+}
+
+// newCredsKey generates a key for credentials identities. It is never stored, so identities of one plugin instance
+// mean nothing to anyone else
+func newCredsKey() ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, errors.Wrap(err, "vcs generating credentials key")
+	}
+	return key, nil
+}
+
+// touch records the use of the identity, its directory modification time tells other instances sharing the root it
+// is still in use
+func (f *identityFetcher) touch(now time.Time) {
+	if now.Sub(f.used) < credsTouchInterval {
+		return
+	}
+	f.used = now
+	_ = os.Chtimes(f.dir, now, now)
+}
+
+// cleanCreds drops identities unused for maxIdle and removes their directories, including the ones left by other
+// instances. It keeps going on failures, these are reported together
+func (f *plugin) cleanCreds(maxIdle time.Duration) error {
+	credsDir := filepath.Join(f.rootDir, "creds")
+	deadline := time.Now().Add(-maxIdle)
+
+	f.accessLock.Lock()
+	for identity, fetcher := range f.fetchers {
+		if fetcher.used.After(deadline) {
+			continue
+		}
+		delete(f.fetchers, identity)
+		for key := range f.inWork {
+			if key.identity == identity {
+				delete(f.inWork, key)
+			}
+		}
+	}
+	active := map[string]struct{}{}
+	for identity := range f.fetchers {
+		active[identity] = struct{}{}
+	}
+	f.accessLock.Unlock()
+
+	entries, err := ioutil.ReadDir(credsDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Wrapf(err, "vcs reading directory `%s`", credsDir)
+	}
+	var failed int
+	var lastErr error
+	for _, entry := range entries {
+		if _, ok := active[entry.Name()]; ok || entry.ModTime().After(deadline) {
+			continue
+		}
+		if err := removeTree(filepath.Join(credsDir, entry.Name())); err != nil {
+			failed++
+			lastErr = err
+		}
+	}
+	if lastErr != nil {
+		return errors.Wrapf(lastErr, "vcs failed to remove %d idle credentials caches, the last error", failed)
+	}
+	return nil
+}
+
+// credsJanitor drops idle credentials identities every interval until the plugin is closed
+func (f *plugin) credsJanitor(interval, maxIdle time.Duration) {
+	defer close(f.credsDone)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			_ = f.cleanCreds(maxIdle)
+		case <-f.credsStop:
+			return
+		}
+	}
+}
+
+// removeTree removes a directory with the module cache inside, whose directories are made read-only
+func removeTree(dir string) error {
+	_ = filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.IsDir() {
+			_ = os.Chmod(path, 0755)
+		}
+		return nil
+	})
+	return os.RemoveAll(dir)
+}
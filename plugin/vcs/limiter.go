@@ -0,0 +1,50 @@
+package vcs
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// hostLimiter bounds the number of concurrent operations with repositories of each host
+type hostLimiter struct {
+	limit int
+
+	lock  sync.Mutex
+	slots map[string]chan struct{}
+}
+
+// newHostLimiter creates limiter allowing up to limit concurrent operations per host, limit ≤ 0 means no limit
+func newHostLimiter(limit int) *hostLimiter {
+	return &hostLimiter{
+		limit: limit,
+		slots: map[string]chan struct{}{},
+	}
+}
+
+// acquire takes a slot of the host of a module with the given path waiting until one is free or ctx is done.
+// The returned function frees the slot
+func (l *hostLimiter) acquire(ctx context.Context, path string) (release func(), err error) {
+	if l.limit <= 0 {
+		return func() {}, ctx.Err()
+	}
+
+	host := path
+	if pos := strings.IndexByte(path, '/'); pos >= 0 {
+		host = path[:pos]
+	}
+	l.lock.Lock()
+	slots, ok := l.slots[host]
+	if !ok {
+		slots = make(chan struct{}, l.limit)
+		l.slots[host] = slots
+	}
+	l.lock.Unlock()
+
+	select {
+	case slots <- struct{}{}:
+		return func() { <-slots }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
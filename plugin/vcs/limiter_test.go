@@ -0,0 +1,58 @@
+package vcs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestHostLimiter(t *testing.T) {
+	ctx := context.Background()
+	l := newHostLimiter(2)
+
+	release1, err := l.acquire(ctx, "github.com/user/project1")
+	require.NoError(t, err)
+	release2, err := l.acquire(ctx, "github.com/user/project2")
+	require.NoError(t, err)
+
+	// other hosts are not affected
+	release3, err := l.acquire(ctx, "gitlab.com/user/project")
+	require.NoError(t, err)
+	release3()
+
+	timeout, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err = l.acquire(timeout, "github.com/user/project3")
+	require.Equal(t, context.DeadlineExceeded, err)
+
+	acquired := make(chan struct{})
+	go func() {
+		release, err := l.acquire(ctx, "github.com/user/project3")
+		if err == nil {
+			release()
+		}
+		close(acquired)
+	}()
+	select {
+	case <-acquired:
+		t.Fatal("slot must not be available until release")
+	case <-time.After(50 * time.Millisecond):
+	}
+	release1()
+	select {
+	case <-acquired:
+	case <-time.After(5 * time.Second):
+		t.Fatal("slot must be available after release")
+	}
+	release2()
+}
+
+func TestHostLimiterNoLimit(t *testing.T) {
+	l := newHostLimiter(0)
+	for i := 0; i < 100; i++ {
+		_, err := l.acquire(context.Background(), "github.com/user/project")
+		require.NoError(t, err)
+	}
+}
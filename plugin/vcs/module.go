@@ -3,7 +3,6 @@ package vcs
 import (
 	"context"
 	"io"
-	"io/ioutil"
 	"os"
 	"time"
 
@@ -12,10 +11,26 @@ import (
 	"github.com/sirkon/goproxy"
 	"github.com/sirkon/goproxy/internal/errors"
 	"github.com/sirkon/goproxy/internal/modfetch"
+	"github.com/sirkon/goproxy/internal/module"
+	"github.com/sirkon/goproxy/metrics"
+	"github.com/sirkon/goproxy/tracing"
 )
 
 type vcsModule struct {
-	repo modfetch.Repo
+	repo    modfetch.Repo
+	fetcher *modfetch.Fetcher
+	scratch *scratch
+	limiter *hostLimiter
+}
+
+// startFetch starts a call to the repository, the returned function records its latency and ends its span
+func startFetch(ctx context.Context, operation string) (context.Context, func(err error)) {
+	start := time.Now()
+	ctx, span := tracing.Start(ctx, "vcs."+operation)
+	return ctx, func(err error) {
+		metrics.ObserveUpstream("vcs", operation, start, err)
+		tracing.End(span, err)
+	}
 }
 
 func (s *vcsModule) ModulePath() string {
@@ -28,33 +43,23 @@ func (s *vcsModule) Versions(ctx context.Context, prefix string) (tags []string,
 			err = errors.Wrap(err, "vcs getting versions")
 		}
 	}()
-	type data struct {
-		tags []string
-		err  error
+	release, err := s.limiter.acquire(ctx, s.repo.ModulePath())
+	if err != nil {
+		return nil, err
 	}
-	dataChan := make(chan data, 1)
-	go func() {
-		t, e := s.repo.Versions(prefix)
-		if len(t) == 0 {
-			info, err := s.repo.Latest()
-			if err != nil {
-				e = err
-			} else {
-				t = []string{info.Version}
-			}
+	defer release()
+	ctx, done := startFetch(ctx, metrics.EndpointList)
+	defer func() { done(err) }()
+
+	tags, err = s.repo.Versions(ctx, prefix)
+	if len(tags) == 0 {
+		info, latestErr := s.repo.Latest(ctx)
+		if latestErr != nil {
+			return nil, latestErr
 		}
-		dataChan <- data{
-			tags: t,
-			err:  e,
-		}
-	}()
-
-	select {
-	case info := <-dataChan:
-		return info.tags, info.err
-	case <-ctx.Done():
-		return nil, ctx.Err()
+		tags = []string{info.Version}
 	}
+	return tags, err
 }
 
 func (s *vcsModule) Stat(ctx context.Context, rev string) (res *goproxy.RevInfo, err error) {
@@ -63,38 +68,24 @@ func (s *vcsModule) Stat(ctx context.Context, rev string) (res *goproxy.RevInfo,
 			err = errors.Wrap(err, "vcs getting stat")
 		}
 	}()
-
-	type data struct {
-		info *goproxy.RevInfo
-		err  error
+	release, err := s.limiter.acquire(ctx, s.repo.ModulePath())
+	if err != nil {
+		return nil, err
 	}
-	dataChan := make(chan data, 1)
-	go func() {
-		raw, err := s.repo.Stat(rev)
-		if err != nil {
-			dataChan <- data{
-				info: nil,
-				err:  err,
-			}
-			return
-		}
-		res := &goproxy.RevInfo{}
-		res.Name = raw.Name
-		res.Short = raw.Short
-		res.Time = raw.Time.Format(time.RFC3339)
-		res.Version = raw.Version
-		dataChan <- data{
-			info: res,
-			err:  nil,
-		}
-	}()
+	defer release()
+	ctx, done := startFetch(ctx, metrics.EndpointInfo)
+	defer func() { done(err) }()
 
-	select {
-	case res := <-dataChan:
-		return res.info, res.err
-	case <-ctx.Done():
-		return nil, ctx.Err()
+	raw, err := s.repo.Stat(ctx, rev)
+	if err != nil {
+		return nil, err
 	}
+	res = &goproxy.RevInfo{}
+	res.Name = raw.Name
+	res.Short = raw.Short
+	res.Time = raw.Time.Format(time.RFC3339)
+	res.Version = raw.Version
+	return res, nil
 }
 
 func (s *vcsModule) GoMod(ctx context.Context, version string) (file []byte, err error) {
@@ -103,76 +94,83 @@ func (s *vcsModule) GoMod(ctx context.Context, version string) (file []byte, err
 			err = errors.Wrap(err, "vcs getting go.mod")
 		}
 	}()
-
-	type data struct {
-		data []byte
-		err  error
+	release, err := s.limiter.acquire(ctx, s.repo.ModulePath())
+	if err != nil {
+		return nil, err
 	}
-	dataChan := make(chan data, 1)
-	go func() {
-		res, err := s.repo.GoMod(version)
-		dataChan <- data{
-			data: res,
-			err:  err,
-		}
-	}()
+	defer release()
+	ctx, done := startFetch(ctx, metrics.EndpointMod)
+	defer func() { done(err) }()
 
-	select {
-	case res := <-dataChan:
-		return res.data, res.err
-	case <-ctx.Done():
-		return nil, ctx.Err()
-	}
+	return s.repo.GoMod(ctx, version)
 }
 
 func (s *vcsModule) Zip(ctx context.Context, version string) (file io.ReadCloser, err error) {
-	type data struct {
-		file io.ReadCloser
-		err  error
+	// archives are served from the download cache when they are there. Versions other than canonical ones have no
+	// place in the cache, they are always made from scratch
+	mod := module.Version{Path: s.repo.ModulePath(), Version: version}
+	zipFile, cacheErr := s.fetcher.ZipFile(mod)
+	if cacheErr == nil {
+		osFile, err := os.Open(zipFile)
+		metrics.ObserveCache("vcs", err == nil)
+		if err == nil {
+			return osFile, nil
+		}
 	}
-	dataChan := make(chan data, 1)
 
-	go func() {
-		dir, err := ioutil.TempDir(".", ".downloads")
-		if err != nil {
-			dataChan <- data{
-				file: nil,
-				err:  errors.Wrap(err, "vcs creating temporary directory to save source archive"),
-			}
-		}
-		defer func() {
-			if err := os.RemoveAll(dir); err != nil {
-				zerolog.Ctx(ctx).Error().Err(err).Msg("failed to remove temporary directory")
-			}
-		}()
-		fileName, err := s.repo.Zip(version, dir)
-		if err != nil {
-			dataChan <- data{
-				file: nil,
-				err:  errors.Wrap(err, "vcs getting source archive"),
-			}
-			return
+	release, err := s.limiter.acquire(ctx, s.repo.ModulePath())
+	if err != nil {
+		return nil, errors.Wrap(err, "vcs getting source archive")
+	}
+	defer release()
+
+	dir, err := s.scratch.tempDir()
+	if err != nil {
+		return nil, err
+	}
+	removeDir := func() {
+		if err := os.RemoveAll(dir); err != nil {
+			zerolog.Ctx(ctx).Error().Err(err).Msg("failed to remove temporary directory")
 		}
+	}
 
-		osFile, err := os.Open(fileName)
-		if err != nil {
-			dataChan <- data{
-				file: nil,
-				err:  errors.Wrap(err, "vcs opening downloaded source archive"),
+	fetchCtx, done := startFetch(ctx, metrics.EndpointZip)
+	fileName, err := s.repo.Zip(fetchCtx, version, dir)
+	done(err)
+	if err != nil {
+		removeDir()
+		return nil, errors.Wrap(err, "vcs getting source archive")
+	}
+	if cacheErr == nil {
+		if zipFile, err = s.fetcher.InstallZip(mod, fileName); err == nil {
+			removeDir()
+			osFile, err := os.Open(zipFile)
+			if err != nil {
+				return nil, errors.Wrap(err, "vcs opening cached source archive")
 			}
-			return
+			return osFile, nil
 		}
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("failed to put source archive into download cache")
+	}
+	osFile, err := os.Open(fileName)
+	if err != nil {
+		removeDir()
+		return nil, errors.Wrap(err, "vcs opening downloaded source archive")
+	}
 
-		dataChan <- data{
-			file: osFile,
-			err:  nil,
-		}
-	}()
+	return &tempFile{File: osFile, dir: dir}, nil
+}
+
+// tempFile file in a temporary directory which is removed when the file is closed
+type tempFile struct {
+	*os.File
+	dir string
+}
 
-	select {
-	case res := <-dataChan:
-		return res.file, res.err
-	case <-ctx.Done():
-		return nil, errors.Wrap(ctx.Err(), "vcs getting source archive")
+func (f *tempFile) Close() error {
+	closeErr := f.File.Close()
+	if err := os.RemoveAll(f.dir); err != nil {
+		return errors.Wrap(err, "vcs removing temporary directory")
 	}
+	return closeErr
 }
@@ -0,0 +1,152 @@
+package vcs
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sirkon/goproxy/internal/errors"
+	"github.com/sirkon/goproxy/internal/modfetch"
+	"github.com/sirkon/goproxy/internal/module"
+)
+
+// zipRepo gives the same archive content for every version and counts Zip calls
+type zipRepo struct {
+	modfetch.Repo
+	calls int
+}
+
+func (r *zipRepo) ModulePath() string {
+	return "example.com/repo"
+}
+
+func (r *zipRepo) Zip(ctx context.Context, version, tmpdir string) (string, error) {
+	r.calls++
+	f, err := ioutil.TempFile(tmpdir, "zip")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	if err := writeZip(f, version); err != nil {
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// writeZip writes an archive with a single file whose content is the version
+func writeZip(w io.Writer, version string) error {
+	zw := zip.NewWriter(w)
+	fw, err := zw.Create("example.com/repo@" + version + "/version")
+	if err != nil {
+		return err
+	}
+	if _, err := fw.Write([]byte(version)); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+func TestModuleZip(t *testing.T) {
+	root, err := ioutil.TempDir("", "vcs-zip")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	s, err := newScratch(root)
+	require.NoError(t, err)
+	defer s.Close()
+
+	repo := &zipRepo{}
+	fetcher := modfetch.NewFetcher(filepath.Join(root, "pkg", "mod"))
+	mod := &vcsModule{
+		repo:    repo,
+		fetcher: fetcher,
+		scratch: s,
+		limiter: newHostLimiter(0),
+	}
+
+	read := func(version string) string {
+		t.Helper()
+		file, err := mod.Zip(context.Background(), version)
+		require.NoError(t, err)
+		data, err := ioutil.ReadAll(file)
+		require.NoError(t, err)
+		require.NoError(t, file.Close())
+		zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		require.NoError(t, err)
+		require.Len(t, zr.File, 1)
+		fr, err := zr.File[0].Open()
+		require.NoError(t, err)
+		defer fr.Close()
+		content, err := ioutil.ReadAll(fr)
+		require.NoError(t, err)
+		return string(content)
+	}
+
+	// non-canonical versions have no place in the download cache, they are made every time
+	require.Equal(t, "master", read("master"))
+	require.Equal(t, "master", read("master"))
+	require.Equal(t, 2, repo.calls)
+
+	// archives of canonical versions are put into the download cache and served from there
+	require.Equal(t, "v1.0.0", read("v1.0.0"))
+	require.Equal(t, "v1.0.0", read("v1.0.0"))
+	require.Equal(t, 3, repo.calls)
+	zipFile, err := fetcher.ZipFile(module.Version{Path: "example.com/repo", Version: "v1.0.0"})
+	require.NoError(t, err)
+	_, err = os.Stat(zipFile + "hash")
+	require.NoError(t, err)
+
+	// archives put into the download cache by others are served as well
+	zipFile, err = fetcher.ZipFile(module.Version{Path: "example.com/repo", Version: "v1.1.0"})
+	require.NoError(t, err)
+	var buf bytes.Buffer
+	require.NoError(t, writeZip(&buf, "v1.1.0"))
+	require.NoError(t, ioutil.WriteFile(zipFile, buf.Bytes(), 0644))
+	require.Equal(t, "v1.1.0", read("v1.1.0"))
+	require.Equal(t, 3, repo.calls)
+
+	entries, err := ioutil.ReadDir(filepath.Join(root, "tmp"))
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+func TestModuleZipError(t *testing.T) {
+	root, err := ioutil.TempDir("", "vcs-zip")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	s, err := newScratch(root)
+	require.NoError(t, err)
+	defer s.Close()
+
+	mod := &vcsModule{
+		repo:    failingZipRepo{},
+		fetcher: modfetch.NewFetcher(filepath.Join(root, "pkg", "mod")),
+		scratch: s,
+		limiter: newHostLimiter(0),
+	}
+	_, err = mod.Zip(context.Background(), "v1.0.0")
+	require.Error(t, err)
+	entries, err := ioutil.ReadDir(filepath.Join(root, "tmp"))
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
+
+type failingZipRepo struct {
+	modfetch.Repo
+}
+
+func (failingZipRepo) ModulePath() string {
+	return "example.com/repo"
+}
+
+func (failingZipRepo) Zip(ctx context.Context, version, tmpdir string) (string, error) {
+	return "", errors.New("no archive")
+}
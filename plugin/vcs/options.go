@@ -0,0 +1,98 @@
+package vcs
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/sirkon/goproxy"
+	"github.com/sirkon/goproxy/internal/errors"
+	"github.com/sirkon/goproxy/internal/module"
+)
+
+// Option sets up a plugin created with NewPluginOptions
+type Option func(o *options) error
+
+// options of a plugin
+type options struct {
+	backend   GitBackend
+	passCreds func(req *http.Request) bool
+	hostLimit int
+
+	// remotes is nil unless Remotes option was given
+	remotes     map[string]Remote
+	remoteRoots []string
+}
+
+// WithGitBackend chooses how to access git repositories, GitBinary is used by default
+func WithGitBackend(backend GitBackend) Option {
+	return func(o *options) error {
+		o.backend = backend
+		return nil
+	}
+}
+
+// WithPassCreds sets a function deciding is it worth to pass credentials of a request to repositories, see
+// NewPluginPassCreds
+func WithPassCreds(passCreds func(req *http.Request) bool) Option {
+	return func(o *options) error {
+		o.passCreds = passCreds
+		return nil
+	}
+}
+
+// WithHostLimit limits concurrent operations with repositories of each host, see NewPluginHostLimit
+func WithHostLimit(hostLimit int) Option {
+	return func(o *options) error {
+		o.hostLimit = hostLimit
+		return nil
+	}
+}
+
+// WithRemotes serves modules from given repositories only, see NewPluginRemotes. There must be at least one remote
+func WithRemotes(remotes map[string]Remote) Option {
+	return func(o *options) error {
+		if len(remotes) == 0 {
+			return errors.New("vcs no remotes given")
+		}
+		res := make(map[string]Remote, len(remotes))
+		roots := make([]string, 0, len(remotes))
+		for root, remote := range remotes {
+			if err := module.CheckImportPath(root); err != nil {
+				return errors.Wrapf(err, "vcs invalid module path prefix `%s`", root)
+			}
+			switch remote.VCS {
+			case Git, Mercurial, Bazaar, Fossil, Subversion:
+			default:
+				return errors.Newf("vcs unsupported version control system `%s` for `%s`", remote.VCS, root)
+			}
+			if !strings.Contains(remote.URL, "://") {
+				return errors.Newf("vcs remote URL `%s` for `%s` has no scheme", remote.URL, root)
+			}
+			res[root] = remote
+			roots = append(roots, root)
+		}
+		// longer prefixes go first
+		sort.Slice(roots, func(i, j int) bool {
+			return len(roots[i]) > len(roots[j])
+		})
+		o.remotes = res
+		o.remoteRoots = roots
+		return nil
+	}
+}
+
+// NewPluginOptions creates a plugin keeping everything it downloads under rootDir set up with given options
+func NewPluginOptions(rootDir string, opts ...Option) (goproxy.Plugin, error) {
+	var o options
+	for _, opt := range opts {
+		if err := opt(&o); err != nil {
+			return nil, err
+		}
+	}
+	res, err := newPlugin(rootDir, o)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
@@ -3,30 +3,100 @@ package vcs
 import (
 	"net/http"
 	"os"
+	"path/filepath"
 	"sync"
+	"time"
 
 	"github.com/sirkon/goproxy/internal/errors"
 
 	"github.com/sirkon/goproxy"
+	"github.com/sirkon/goproxy/auth"
 	"github.com/sirkon/goproxy/internal/modfetch"
+	"github.com/sirkon/goproxy/internal/modfetch/codehost"
+)
+
+// GitBackend selects how the plugin accesses git repositories
+type GitBackend = codehost.GitBackend
+
+const (
+	// GitBinary runs the git command
+	GitBinary = codehost.GitBinary
+
+	// GitInProcess uses go-git, thus the git command is not needed. Remotes are accessed over http(s), ssh and git
+	// protocols then, credentials of requests can only be passed over http(s)
+	GitInProcess = codehost.GitInProcess
 )
 
 // plugin creates source for VCS repositories
 type plugin struct {
-	rootDir string
-
-	// accessLock is for access to inWork
+	rootDir    string
+	gitBackend GitBackend
+	fetcher    *modfetch.Fetcher
+	passCreds  func(req *http.Request) bool
+	limiter    *hostLimiter
+	scratch    *scratch
+
+	// remotes maps module path prefixes to their repositories when useRemotes is set, repositories are discovered
+	// with go-get meta tags otherwise
+	useRemotes  bool
+	remotes     map[string]Remote
+	remoteRoots []string
+
+	// accessLock is for access to inWork and fetchers
 	accessLock sync.Locker
-	inWork     map[string]modfetch.Repo
+	inWork     map[repoKey]modfetch.Repo
+	fetchers   map[string]*identityFetcher
+
+	// credsKey keys credentials identities, fetchers of idle ones are dropped by the janitor
+	credsKey  []byte
+	credsStop chan struct{}
+	credsDone chan struct{}
+	stopOnce  sync.Once
+}
+
+// repoKey repositories are looked up separately for each credentials identity
+type repoKey struct {
+	identity string
+	path     string
 }
 
 func (f *plugin) String() string {
 	return "legacy"
 }
 
-// NewPlugin creates new valid plugin instance
+// NewPlugin creates new valid plugin instance. Everything the plugin downloads is kept under rootDir/pkg/mod, just
+// like the go command does with $GOPATH/pkg/mod. The plugin doesn't touch process-wide state, so there can be several
+// independent plugins with different root directories in one process
 func NewPlugin(rootDir string) (f goproxy.Plugin, err error) {
-	setupEnv(rootDir)
+	return NewPluginOptions(rootDir)
+}
+
+// NewPluginPassCreds NewPlugin with a function deciding is it worth to pass credentials of a request to git, see
+// auth.Credentials. Repositories are fetched with the requester's credentials then instead of the ones of the proxy
+// host and everything fetched is kept under rootDir/creds/<credentials identity>/pkg/mod, so nothing fetched by one
+// user is served to another. Requests without credentials are rejected with 401 Unauthorized, requests passCreds
+// refuses are served with credentials of the proxy host. Caches of credentials unused for a day are removed
+func NewPluginPassCreds(rootDir string, passCreds func(req *http.Request) bool) (f goproxy.Plugin, err error) {
+	return NewPluginOptions(rootDir, WithPassCreds(passCreds))
+}
+
+// NewPluginGitBackend NewPluginPassCreds with a choice of how to access git repositories. passCreds may be nil
+func NewPluginGitBackend(rootDir string, backend GitBackend, passCreds func(req *http.Request) bool) (f goproxy.Plugin, err error) {
+	return NewPluginOptions(rootDir, WithGitBackend(backend), WithPassCreds(passCreds))
+}
+
+// NewPluginHostLimit NewPluginGitBackend with up to hostLimit concurrent operations with repositories of each host
+// (the first element of module path, github.com, gitlab.com, etc). Requests exceeding the limit wait for their turn
+// until their contexts are done. hostLimit ≤ 0 means no limit
+func NewPluginHostLimit(rootDir string, backend GitBackend, passCreds func(req *http.Request) bool, hostLimit int) (f goproxy.Plugin, err error) {
+	return NewPluginOptions(rootDir, WithGitBackend(backend), WithPassCreds(passCreds), WithHostLimit(hostLimit))
+}
+
+func newPlugin(rootDir string, o options) (f *plugin, err error) {
+	rootDir, err = filepath.Abs(rootDir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "vcs getting absolute path of `%s`", rootDir)
+	}
 	stat, err := os.Stat(rootDir)
 	if os.IsNotExist(err) {
 		if err := os.MkdirAll(rootDir, 0755); err != nil {
@@ -37,23 +107,41 @@ func NewPlugin(rootDir string) (f goproxy.Plugin, err error) {
 			return nil, errors.Newf("vcs %s is not a directory", rootDir)
 		}
 	}
-	if err = os.Chdir(rootDir); err != nil {
-		return nil, errors.Wrapf(err, "vcs cding into `%s`", rootDir)
+	scratch, err := newScratch(rootDir)
+	if err != nil {
+		return nil, err
 	}
-
-	if err = os.Setenv("GOPATH", rootDir); err != nil {
-		return nil, errors.Wrapf(err, "vcs setting up GOPATH environment variable")
+	pkgMod := filepath.Join(rootDir, "pkg", "mod")
+	host := codehost.NewHost(filepath.Join(pkgMod, "cache", "vcs"))
+	host.SetGitBackend(o.backend)
+	host.SetTempDir(scratch.dir)
+	res := &plugin{
+		rootDir:     rootDir,
+		gitBackend:  o.backend,
+		fetcher:     modfetch.NewFetcherHost(pkgMod, host),
+		passCreds:   o.passCreds,
+		limiter:     newHostLimiter(o.hostLimit),
+		scratch:     scratch,
+		useRemotes:  o.remotes != nil,
+		remotes:     o.remotes,
+		remoteRoots: o.remoteRoots,
+		inWork:      map[repoKey]modfetch.Repo{},
+		fetchers:    map[string]*identityFetcher{},
+		accessLock:  &sync.Mutex{},
+		credsStop:   make(chan struct{}),
+		credsDone:   make(chan struct{}),
 	}
-
-	if err = os.Setenv("GO111MODULE", "on"); err != nil {
-		return nil, errors.Wrapf(err, "vcs setting up GO111MODULE environment variable")
+	if res.passCreds == nil {
+		close(res.credsDone)
+		return res, nil
 	}
-
-	return &plugin{
-		rootDir:    rootDir,
-		inWork:     map[string]modfetch.Repo{},
-		accessLock: &sync.Mutex{},
-	}, nil
+	res.credsKey, err = newCredsKey()
+	if err != nil {
+		_ = scratch.Close()
+		return nil, err
+	}
+	go res.credsJanitor(credsCleanInterval, credsMaxIdle)
+	return res, nil
 }
 
 // Module creates a source for a module with given path
@@ -63,13 +151,25 @@ func (f *plugin) Module(req *http.Request, prefix string) (goproxy.Module, error
 		return nil, err
 	}
 
-	repo, err := f.getRepo(path)
+	var identity, user, pass string
+	if f.passCreds != nil && f.passCreds(req) {
+		var ok bool
+		if user, pass, ok = auth.Credentials(req); !ok {
+			return nil, &credentialsRequired{path: path}
+		}
+		identity = codehost.CredentialsIdentity(f.credsKey, user, pass)
+	}
+
+	repo, fetcher, err := f.getRepo(identity, user, pass, path)
 	if err != nil {
 		return nil, err
 	}
 
 	return &vcsModule{
-		repo: repo,
+		repo:    repo,
+		fetcher: fetcher,
+		scratch: f.scratch,
+		limiter: f.limiter,
 	}, nil
 }
 
@@ -78,21 +178,78 @@ func (f *plugin) Leave(s goproxy.Module) error {
 	return nil
 }
 
-// Close ...
+// Close stops cleaning of temporary download directories and idle credentials caches
 func (f *plugin) Close() error {
-	return nil
+	f.stopOnce.Do(func() {
+		close(f.credsStop)
+	})
+	<-f.credsDone
+	return f.scratch.Close()
+}
+
+// Invalidate refreshes repositories of the module, so their version lists and revisions are looked up again
+func (f *plugin) Invalidate(path string) {
+	f.accessLock.Lock()
+	var repos []modfetch.Repo
+	for key, repo := range f.inWork {
+		if key.path == path {
+			repos = append(repos, repo)
+		}
+	}
+	f.accessLock.Unlock()
+
+	// refreshing waits for running git commands of a repository, the plugin is not locked for it
+	for _, repo := range repos {
+		codehost.Refresh(repo)
+	}
 }
 
-func (f *plugin) getRepo(path string) (repo modfetch.Repo, err error) {
+func (f *plugin) getRepo(identity, user, pass, path string) (repo modfetch.Repo, fetcher *modfetch.Fetcher, err error) {
 	f.accessLock.Lock()
 	defer f.accessLock.Unlock()
-	repo, ok := f.inWork[path]
+	fetcher = f.getFetcher(identity, user, pass)
+	key := repoKey{identity: identity, path: path}
+	repo, ok := f.inWork[key]
 	if !ok {
-		repo, err = modfetch.Lookup(path)
+		repo, err = f.lookup(fetcher, path)
 		if err != nil {
-			return nil, errors.Wrapf(err, "vcs getting module for `%s`", path)
+			return nil, nil, errors.Wrapf(err, "vcs getting module for `%s`", path)
+		}
+	}
+	f.inWork[key] = repo
+	return repo, fetcher, nil
+}
+
+// getFetcher returns fetcher for the given credentials identity, the default one is used for an empty identity
+func (f *plugin) getFetcher(identity, user, pass string) *modfetch.Fetcher {
+	if len(identity) == 0 {
+		return f.fetcher
+	}
+	fetcher, ok := f.fetchers[identity]
+	if !ok {
+		dir := filepath.Join(f.rootDir, "creds", identity)
+		pkgMod := filepath.Join(dir, "pkg", "mod")
+		host := codehost.NewCredentialsHost(filepath.Join(pkgMod, "cache", "vcs"), user, pass)
+		host.SetGitBackend(f.gitBackend)
+		host.SetTempDir(f.scratch.dir)
+		fetcher = &identityFetcher{
+			fetcher: modfetch.NewFetcherHost(pkgMod, host),
+			dir:     dir,
 		}
+		f.fetchers[identity] = fetcher
+	}
+	fetcher.touch(time.Now())
+	return fetcher.fetcher
+}
+
+func (f *plugin) lookup(fetcher *modfetch.Fetcher, path string) (modfetch.Repo, error) {
+	if !f.useRemotes {
+		return fetcher.Lookup(path)
+	}
+	root, ok := f.remoteRoot(path)
+	if !ok {
+		return nil, errors.Newf("no repository configured for the module")
 	}
-	f.inWork[path] = repo
-	return repo, nil
+	remote := f.remotes[root]
+	return fetcher.LookupRemote(path, root, string(remote.VCS), remote.URL)
 }
@@ -0,0 +1,120 @@
+package vcs
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/sirkon/goproxy"
+)
+
+func TestPluginInvalidate(t *testing.T) {
+	root, err := ioutil.TempDir("", "vcs-invalidate")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	repoDir := filepath.Join(root, "repo")
+	makeRepo(t, Git, repoDir, "example.com/repo")
+
+	p, err := NewPluginRemotes(filepath.Join(root, "cache"), map[string]Remote{
+		"example.com/repo": {VCS: Git, URL: "file://" + filepath.ToSlash(repoDir)},
+	})
+	require.NoError(t, err)
+	defer p.Close()
+
+	ctx := context.Background()
+	versions := func() []string {
+		mod, err := p.Module(httptest.NewRequest("GET", "/example.com/repo/@v/list", nil), "")
+		require.NoError(t, err)
+		res, err := mod.Versions(ctx, "")
+		require.NoError(t, err)
+		return res
+	}
+	require.Equal(t, []string{"v1.0.0"}, versions())
+
+	require.NoError(t, ioutil.WriteFile(filepath.Join(repoDir, "lib.go"), []byte("package repo\n"), 0644))
+	for _, args := range [][]string{
+		{"git", "add", "lib.go"},
+		{"git", "-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "lib"},
+		{"git", "tag", "v1.1.0"},
+	} {
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Dir = repoDir
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+
+	// the list is cached until the module is invalidated
+	require.Equal(t, []string{"v1.0.0"}, versions())
+	goproxy.Invalidate(p, "example.com/repo")
+	require.Equal(t, []string{"v1.0.0", "v1.1.0"}, versions())
+
+	mod, err := p.Module(httptest.NewRequest("GET", "/example.com/repo/@v/v1.1.0.info", nil), "")
+	require.NoError(t, err)
+	info, err := mod.Stat(ctx, "v1.1.0")
+	require.NoError(t, err)
+	require.Equal(t, "v1.1.0", info.Version)
+}
+
+func TestPluginPassCreds(t *testing.T) {
+	root, err := ioutil.TempDir("", "vcs-creds")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	repoDir := filepath.Join(root, "repo")
+	makeRepo(t, Git, repoDir, "example.com/repo")
+
+	res, err := NewPluginRemotes(filepath.Join(root, "cache"), map[string]Remote{
+		"example.com/repo": {VCS: Git, URL: "file://" + filepath.ToSlash(repoDir)},
+	}, WithPassCreds(func(req *http.Request) bool { return true }))
+	require.NoError(t, err)
+	defer res.Close()
+	p := res.(*plugin)
+
+	// requests without credentials are not served with credentials of the proxy host
+	_, err = p.Module(httptest.NewRequest("GET", "/example.com/repo/@v/list", nil), "")
+	var statusErr goproxy.StatusError
+	require.True(t, errors.As(err, &statusErr))
+	require.Equal(t, http.StatusUnauthorized, statusErr.StatusCode())
+
+	req := httptest.NewRequest("GET", "/example.com/repo/@v/list", nil)
+	req.SetBasicAuth("user", "password")
+	mod, err := p.Module(req, "")
+	require.NoError(t, err)
+	versions, err := mod.Versions(context.Background(), "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"v1.0.0"}, versions)
+
+	// the cache directory name tells nothing about the credentials without the plugin key
+	entries, err := ioutil.ReadDir(filepath.Join(root, "cache", "creds"))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	sum := sha256.Sum256([]byte("user\x00password"))
+	require.NotEqual(t, hex.EncodeToString(sum[:]), entries[0].Name())
+
+	// idle credentials caches are removed
+	require.NoError(t, p.cleanCreds(time.Hour))
+	require.Len(t, p.fetchers, 1)
+	for _, fetcher := range p.fetchers {
+		fetcher.used = time.Now().Add(-2 * time.Hour)
+	}
+	old := time.Now().Add(-2 * time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(root, "cache", "creds", entries[0].Name()), old, old))
+	require.NoError(t, p.cleanCreds(time.Hour))
+	require.Empty(t, p.fetchers)
+	require.Empty(t, p.inWork)
+	entries, err = ioutil.ReadDir(filepath.Join(root, "cache", "creds"))
+	require.NoError(t, err)
+	require.Empty(t, entries)
+}
@@ -0,0 +1,47 @@
+package vcs
+
+import (
+	"strings"
+
+	"github.com/sirkon/goproxy"
+)
+
+// VCS version control system of a repository
+type VCS string
+
+// Supported version control systems, each one needs its command to be installed
+const (
+	Git        VCS = "git"
+	Mercurial  VCS = "hg"
+	Bazaar     VCS = "bzr"
+	Fossil     VCS = "fossil"
+	Subversion VCS = "svn"
+)
+
+// Remote repository of modules
+type Remote struct {
+	VCS VCS
+
+	// URL repository URL including scheme, file:// for local repositories
+	URL string
+}
+
+// NewPluginRemotes creates a plugin serving modules from repositories given explicitly instead of discovering them
+// with go-get meta tags, so there's no need in a discovery server for internal repositories. Keys of remotes are
+// module path prefixes corresponding to roots of repositories: module example.com/repo/sub is looked for in the
+// subdirectory sub of the repository mapped to example.com/repo. The longest matching prefix wins. Modules out of
+// all prefixes are not served, thus the plugin is to be combined with others via choice plugin. Other options may be
+// given too
+func NewPluginRemotes(rootDir string, remotes map[string]Remote, opts ...Option) (f goproxy.Plugin, err error) {
+	return NewPluginOptions(rootDir, append([]Option{WithRemotes(remotes)}, opts...)...)
+}
+
+// remoteRoot returns the longest module path prefix of remotes the path belongs to
+func (f *plugin) remoteRoot(path string) (string, bool) {
+	for _, root := range f.remoteRoots {
+		if path == root || strings.HasPrefix(path, root+"/") {
+			return root, true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,164 @@
+package vcs
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// makeRepo creates a repository of the given version control system in dir with go.mod of the module and tag v1.0.0
+// on it
+func makeRepo(t *testing.T, vcs VCS, dir, modulePath string) {
+	t.Helper()
+	if _, err := exec.LookPath(string(vcs)); err != nil {
+		t.Skipf("%s binary not found", vcs)
+	}
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	require.NoError(t, ioutil.WriteFile(filepath.Join(dir, "go.mod"), []byte("module "+modulePath+"\n"), 0644))
+
+	var cmds [][]string
+	switch vcs {
+	case Git:
+		cmds = [][]string{
+			{"git", "init", "-q"},
+			{"git", "add", "go.mod"},
+			{"git", "-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "init"},
+			{"git", "tag", "v1.0.0"},
+		}
+	case Mercurial:
+		cmds = [][]string{
+			{"hg", "init"},
+			{"hg", "add", "go.mod"},
+			{"hg", "commit", "-u", "test", "-m", "init"},
+			{"hg", "tag", "-u", "test", "-r", "0", "v1.0.0"},
+		}
+	default:
+		t.Fatalf("no way to make %s repository", vcs)
+	}
+	for _, args := range cmds {
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Dir = dir
+		out, err := cmd.CombinedOutput()
+		require.NoError(t, err, string(out))
+	}
+}
+
+func TestPluginRemotes(t *testing.T) {
+	for _, vcs := range []VCS{Git, Mercurial} {
+		t.Run(string(vcs), func(t *testing.T) {
+			root, err := ioutil.TempDir("", "vcs-remotes")
+			require.NoError(t, err)
+			defer os.RemoveAll(root)
+
+			repoDir := filepath.Join(root, "repo")
+			makeRepo(t, vcs, repoDir, "example.com/repo")
+
+			p, err := NewPluginRemotes(filepath.Join(root, "cache"), map[string]Remote{
+				"example.com/repo": {VCS: vcs, URL: "file://" + filepath.ToSlash(repoDir)},
+			})
+			require.NoError(t, err)
+			defer p.Close()
+
+			ctx := context.Background()
+			mod, err := p.Module(httptest.NewRequest("GET", "/example.com/repo/@v/list", nil), "")
+			require.NoError(t, err)
+			versions, err := mod.Versions(ctx, "")
+			require.NoError(t, err)
+			require.Equal(t, []string{"v1.0.0"}, versions)
+			goMod, err := mod.GoMod(ctx, "v1.0.0")
+			require.NoError(t, err)
+			require.Equal(t, "module example.com/repo\n", string(goMod))
+
+			_, err = p.Module(httptest.NewRequest("GET", "/example.com/other/@v/list", nil), "")
+			require.Error(t, err)
+			_, err = p.Module(httptest.NewRequest("GET", "/example.com/repository/@v/list", nil), "")
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestPluginRemotesValidation(t *testing.T) {
+	root, err := ioutil.TempDir("", "vcs-remotes")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	tests := []struct {
+		name    string
+		remotes map[string]Remote
+	}{
+		{
+			name:    "no-remotes",
+			remotes: nil,
+		},
+		{
+			name:    "unsupported-vcs",
+			remotes: map[string]Remote{"example.com/repo": {VCS: "cvs", URL: "file:///repo"}},
+		},
+		{
+			name:    "no-scheme",
+			remotes: map[string]Remote{"example.com/repo": {VCS: Mercurial, URL: "/repo"}},
+		},
+		{
+			name:    "invalid-prefix",
+			remotes: map[string]Remote{"example.com/repo/": {VCS: Mercurial, URL: "file:///repo"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewPluginRemotes(root, tt.remotes)
+			require.Error(t, err)
+		})
+	}
+}
+
+func TestPluginRemoteRoot(t *testing.T) {
+	p := &plugin{remoteRoots: []string{"example.com/repo/sub", "example.com/repo"}}
+	tests := []struct {
+		path string
+		root string
+		ok   bool
+	}{
+		{"example.com/repo", "example.com/repo", true},
+		{"example.com/repo/v2", "example.com/repo", true},
+		{"example.com/repo/sub/pkg", "example.com/repo/sub", true},
+		{"example.com/repository", "", false},
+		{"example.com", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			root, ok := p.remoteRoot(tt.path)
+			require.Equal(t, tt.ok, ok)
+			require.Equal(t, tt.root, root)
+		})
+	}
+}
+
+func TestPluginRemotesOptions(t *testing.T) {
+	root, err := ioutil.TempDir("", "vcs-remotes")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	repoDir := filepath.Join(root, "repo")
+	makeRepo(t, Git, repoDir, "example.com/repo")
+
+	remotes := map[string]Remote{
+		"example.com/repo": {VCS: Git, URL: "file://" + filepath.ToSlash(repoDir)},
+	}
+	p, err := NewPluginRemotes(filepath.Join(root, "cache"), remotes, WithGitBackend(GitInProcess), WithHostLimit(1))
+	require.NoError(t, err)
+	defer p.Close()
+
+	// the plugin keeps its own copy of remotes
+	delete(remotes, "example.com/repo")
+	mod, err := p.Module(httptest.NewRequest("GET", "/example.com/repo/@v/list", nil), "")
+	require.NoError(t, err)
+	versions, err := mod.Versions(context.Background(), "")
+	require.NoError(t, err)
+	require.Equal(t, []string{"v1.0.0"}, versions)
+}
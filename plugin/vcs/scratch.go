@@ -0,0 +1,118 @@
+package vcs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/sirkon/goproxy/internal/errors"
+)
+
+const (
+	// scratchMaxAge download directories older than this are considered orphaned
+	scratchMaxAge = time.Hour
+
+	// scratchCleanInterval how often orphaned download directories are looked for
+	scratchCleanInterval = 10 * time.Minute
+)
+
+// scratch manages temporary download directories and archives under the plugin root and removes orphaned ones, i.e.
+// left by crashed processes or by failed cleanups
+type scratch struct {
+	dir string
+
+	stop     chan struct{}
+	done     chan struct{}
+	stopOnce sync.Once
+}
+
+// newScratch creates scratch space at rootDir/tmp and starts its janitor. The root may be shared with other plugins
+// and processes, so only downloads older than scratchMaxAge are removed, both here and by the janitor
+func newScratch(rootDir string) (*scratch, error) {
+	dir := filepath.Join(rootDir, "tmp")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, errors.Wrapf(err, "vcs creating directory `%s`", dir)
+	}
+	s := &scratch{
+		dir:  dir,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	if err := s.clean(scratchMaxAge); err != nil {
+		return nil, err
+	}
+	// older versions kept download directories right in the root
+	legacy, _ := filepath.Glob(filepath.Join(rootDir, ".downloads*"))
+	deadline := time.Now().Add(-scratchMaxAge)
+	for _, path := range legacy {
+		if stat, err := os.Stat(path); err != nil || stat.ModTime().After(deadline) {
+			continue
+		}
+		if err := os.RemoveAll(path); err != nil {
+			return nil, errors.Wrapf(err, "vcs removing orphaned download `%s`", path)
+		}
+	}
+
+	go s.janitor(scratchCleanInterval, scratchMaxAge)
+	return s, nil
+}
+
+// tempDir creates new download directory
+func (s *scratch) tempDir() (string, error) {
+	dir, err := ioutil.TempDir(s.dir, "download-")
+	if err != nil {
+		return "", errors.Wrapf(err, "vcs creating temporary directory in `%s`", s.dir)
+	}
+	return dir, nil
+}
+
+// clean removes download directories older than maxAge. It keeps going on failures, these are reported together
+func (s *scratch) clean(maxAge time.Duration) error {
+	entries, err := ioutil.ReadDir(s.dir)
+	if err != nil {
+		return errors.Wrapf(err, "vcs reading directory `%s`", s.dir)
+	}
+	deadline := time.Now().Add(-maxAge)
+	var failed int
+	var lastErr error
+	for _, entry := range entries {
+		if entry.ModTime().After(deadline) {
+			continue
+		}
+		if err := os.RemoveAll(filepath.Join(s.dir, entry.Name())); err != nil {
+			failed++
+			lastErr = err
+		}
+	}
+	if lastErr != nil {
+		return errors.Wrapf(lastErr, "vcs failed to remove %d orphaned downloads, the last error", failed)
+	}
+	return nil
+}
+
+// janitor cleans orphaned download directories every interval until the scratch is closed. Failures are not fatal
+// here: what is left is retried the next time
+func (s *scratch) janitor(interval, maxAge time.Duration) {
+	defer close(s.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			_ = s.clean(maxAge)
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// Close stops the janitor
+func (s *scratch) Close() error {
+	s.stopOnce.Do(func() {
+		close(s.stop)
+	})
+	<-s.done
+	return nil
+}
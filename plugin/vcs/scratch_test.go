@@ -0,0 +1,49 @@
+package vcs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestScratch(t *testing.T) {
+	root, err := ioutil.TempDir("", "vcs-scratch")
+	require.NoError(t, err)
+	defer os.RemoveAll(root)
+
+	// old leftovers of previous runs are removed at start, recent downloads may belong to others sharing the root
+	old := time.Now().Add(-2 * scratchMaxAge)
+	for _, dir := range []string{filepath.Join(root, "tmp", "download-1"), filepath.Join(root, ".downloads2")} {
+		require.NoError(t, os.MkdirAll(dir, 0755))
+		require.NoError(t, os.Chtimes(dir, old, old))
+	}
+	inFlight := filepath.Join(root, "tmp", "download-2")
+	require.NoError(t, os.MkdirAll(inFlight, 0755))
+	s, err := newScratch(root)
+	require.NoError(t, err)
+	defer s.Close()
+	entries, err := ioutil.ReadDir(filepath.Join(root, "tmp"))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, "download-2", entries[0].Name())
+	_, err = os.Stat(filepath.Join(root, ".downloads2"))
+	require.True(t, os.IsNotExist(err))
+
+	orphan, err := s.tempDir()
+	require.NoError(t, err)
+	require.NoError(t, os.Chtimes(orphan, old, old))
+	fresh, err := s.tempDir()
+	require.NoError(t, err)
+
+	require.NoError(t, s.clean(scratchMaxAge))
+	_, err = os.Stat(orphan)
+	require.True(t, os.IsNotExist(err))
+	_, err = os.Stat(fresh)
+	require.NoError(t, err)
+
+	require.NoError(t, s.Close())
+}
@@ -0,0 +1,51 @@
+package goproxy
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/sirkon/goproxy/metrics"
+)
+
+// responseRecorder remembers status and size of a response for metrics
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	size   int64
+}
+
+func (r *responseRecorder) WriteHeader(code int) {
+	if r.status == 0 {
+		r.status = code
+	}
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *responseRecorder) Write(p []byte) (int, error) {
+	if r.status == 0 {
+		r.status = http.StatusOK
+	}
+	n, err := r.ResponseWriter.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// code returns status of the response, 200 if nothing has been written
+func (r *responseRecorder) code() int {
+	if r.status == 0 {
+		return http.StatusOK
+	}
+	return r.status
+}
+
+// observe records the response of the request started at start, plugin is empty if there was no plugin for it
+func (r *responseRecorder) observe(plugin, endpoint string, start time.Time) {
+	if len(plugin) == 0 {
+		plugin = "none"
+	}
+	code := strconv.Itoa(r.code())
+	metrics.Requests.WithLabelValues(plugin, endpoint, code).Inc()
+	metrics.RequestDuration.WithLabelValues(plugin, endpoint, code).Observe(time.Since(start).Seconds())
+	metrics.ResponseBytes.WithLabelValues(plugin, endpoint).Add(float64(r.size))
+}
@@ -0,0 +1,55 @@
+package goproxy
+
+import (
+	"io/ioutil"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+
+	"github.com/sirkon/goproxy/metrics"
+)
+
+// metricsPlugin listPlugin with its own name, so metrics of other tests do not interfere
+type metricsPlugin struct {
+	listPlugin
+}
+
+func (metricsPlugin) String() string { return "metrics" }
+
+func TestMiddlewareMetrics(t *testing.T) {
+	r, err := NewRouter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.AddRoute("metrics.example.com", metricsPlugin{}); err != nil {
+		t.Fatal(err)
+	}
+	logger := zerolog.New(ioutil.Discard)
+	m := Middleware(r, "", &logger)
+	for _, path := range []string{
+		"/metrics.example.com/lib/@v/list",
+		"/metrics.example.com/lib/@v/v1.0.0.mod",
+		"/metrics.example.com/lib/@v/v1.0.0.zip",
+		"/unknown.example.com/lib/@v/list",
+	} {
+		m.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+	}
+
+	w := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(w, httptest.NewRequest("GET", "/metrics", nil))
+	out := w.Body.String()
+	for _, line := range []string{
+		`goproxy_requests_total{endpoint="list",plugin="metrics",status="200"} 1`,
+		`goproxy_requests_total{endpoint="mod",plugin="metrics",status="200"} 1`,
+		`goproxy_requests_total{endpoint="zip",plugin="metrics",status="400"} 1`,
+		`goproxy_requests_total{endpoint="list",plugin="none",status="400"} 1`,
+		`goproxy_response_bytes_total{endpoint="mod",plugin="metrics"} 30`,
+		`goproxy_request_duration_seconds_count{endpoint="list",plugin="metrics",status="200"} 1`,
+	} {
+		if !strings.Contains(out, line) {
+			t.Errorf("%s expected in metrics", line)
+		}
+	}
+}
@@ -2,13 +2,15 @@ package goproxy
 
 // Router routes to some plugin
 type Router struct {
-	tree *node
+	tree   *node
+	access *node
 }
 
 // NewRouter ...
 func NewRouter() (*Router, error) {
 	return &Router{
-		tree: &node{},
+		tree:   &node{},
+		access: &node{},
 	}, nil
 }
 
@@ -19,5 +21,25 @@ func (r *Router) AddRoute(mask string, f Plugin) error {
 
 // Plugin returns plugin for given route
 func (r *Router) Factory(path string) Plugin {
-	return r.tree.getNode(path)
+	f, _ := r.tree.getNode(path).(Plugin)
+	return f
+}
+
+// AddAccess sets access rules for a given path mask, masks are matched the same way AddRoute ones are. Modules with
+// no access rules for them are served to anyone
+func (r *Router) AddAccess(mask string, access *Access) error {
+	return r.access.addNode(mask, access)
+}
+
+// Access returns access rules for given route, nil if there are none
+func (r *Router) Access(path string) *Access {
+	access, _ := r.access.getNode(path).(*Access)
+	return access
+}
+
+// Invalidate invalidates data of the module kept by its plugin, see Invalidator
+func (r *Router) Invalidate(path string) {
+	if f := r.Factory(path); f != nil {
+		Invalidate(f, path)
+	}
 }
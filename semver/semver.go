@@ -98,3 +98,36 @@ func IsPrerelease(v string) bool {
 	build := v[len(Base(v)):]
 	return strings.HasPrefix(build, "-pre-")
 }
+
+// Latest returns the highest release version out of given ones, the highest pre-release version is returned if there
+// are no releases. Invalid versions are ignored, +incompatible ones are only taken into account when there are no
+// compatible versions, the way the go command does. Returns empty string if there are no valid versions at all
+func Latest(versions []string) string {
+	var compatible []string
+	for _, v := range versions {
+		if semver.IsValid(v) && semver.Build(v) != "+incompatible" {
+			compatible = append(compatible, v)
+		}
+	}
+	if len(compatible) > 0 {
+		versions = compatible
+	}
+
+	var release, prerelease string
+	for _, v := range versions {
+		if !semver.IsValid(v) {
+			continue
+		}
+		if len(semver.Prerelease(v)) == 0 {
+			if len(release) == 0 || semver.Compare(v, release) > 0 {
+				release = v
+			}
+		} else if len(prerelease) == 0 || semver.Compare(v, prerelease) > 0 {
+			prerelease = v
+		}
+	}
+	if len(release) > 0 {
+		return release
+	}
+	return prerelease
+}
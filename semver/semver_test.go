@@ -144,3 +144,49 @@ func TestIsPrerelease(t *testing.T) {
 		})
 	}
 }
+
+func TestLatest(t *testing.T) {
+	tests := []struct {
+		name     string
+		versions []string
+		want     string
+	}{
+		{
+			name:     "empty",
+			versions: nil,
+			want:     "",
+		},
+		{
+			name:     "releases",
+			versions: []string{"v0.1.0", "v1.2.0", "v1.10.0", "v1.3.0-rc.1"},
+			want:     "v1.10.0",
+		},
+		{
+			name:     "prereleases-only",
+			versions: []string{"v1.0.0-alpha", "v1.0.0-beta", "garbage"},
+			want:     "v1.0.0-beta",
+		},
+		{
+			name:     "incompatible-skipped",
+			versions: []string{"v1.2.0", "v2.0.0+incompatible", "v3.1.0+incompatible"},
+			want:     "v1.2.0",
+		},
+		{
+			name:     "incompatible-only",
+			versions: []string{"v2.0.0+incompatible", "v3.1.0+incompatible"},
+			want:     "v3.1.0+incompatible",
+		},
+		{
+			name:     "invalid-only",
+			versions: []string{"master", "1.2.3"},
+			want:     "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Latest(tt.versions); got != tt.want {
+				t.Errorf("Latest() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
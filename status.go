@@ -0,0 +1,23 @@
+package goproxy
+
+import (
+	"net/http"
+
+	"github.com/sirkon/goproxy/internal/errors"
+)
+
+// StatusError is an error with HTTP status code to respond with. Errors of plugins and modules are responded with
+// 400 Bad Request unless there's a StatusError among them and errors they wrap
+type StatusError interface {
+	error
+	StatusCode() int
+}
+
+// errStatus returns status code of the StatusError in the chain of err, 400 Bad Request if there's none
+func errStatus(err error) int {
+	var statusErr StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode()
+	}
+	return http.StatusBadRequest
+}
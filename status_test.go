@@ -0,0 +1,44 @@
+package goproxy
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/sirkon/goproxy/internal/errors"
+)
+
+type forbiddenError struct{}
+
+func (forbiddenError) Error() string   { return "forbidden" }
+func (forbiddenError) StatusCode() int { return http.StatusForbidden }
+
+func Test_errStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{
+			name: "plain",
+			err:  errors.New("error"),
+			want: http.StatusBadRequest,
+		},
+		{
+			name: "status",
+			err:  forbiddenError{},
+			want: http.StatusForbidden,
+		},
+		{
+			name: "wrapped-status",
+			err:  errors.Wrap(errors.Wrap(forbiddenError{}, "1"), "2"),
+			want: http.StatusForbidden,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errStatus(tt.err); got != tt.want {
+				t.Errorf("errStatus() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
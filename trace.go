@@ -0,0 +1,62 @@
+package goproxy
+
+import (
+	"context"
+	"io"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"github.com/sirkon/goproxy/tracing"
+)
+
+// traceModule wraps the module to have a span for each method call
+func traceModule(src Module) Module {
+	res := &tracedModule{Module: src}
+	if l, ok := src.(LatestModule); ok {
+		return &tracedLatestModule{
+			tracedModule: res,
+			latest:       l,
+		}
+	}
+	return res
+}
+
+type tracedModule struct {
+	Module
+}
+
+func (m *tracedModule) Versions(ctx context.Context, prefix string) (tags []string, err error) {
+	ctx, span := tracing.Start(ctx, "module.Versions", attribute.String("goproxy.prefix", prefix))
+	defer func() { tracing.End(span, err) }()
+	return m.Module.Versions(ctx, prefix)
+}
+
+func (m *tracedModule) Stat(ctx context.Context, rev string) (info *RevInfo, err error) {
+	ctx, span := tracing.Start(ctx, "module.Stat", attribute.String("goproxy.revision", rev))
+	defer func() { tracing.End(span, err) }()
+	return m.Module.Stat(ctx, rev)
+}
+
+func (m *tracedModule) GoMod(ctx context.Context, version string) (data []byte, err error) {
+	ctx, span := tracing.Start(ctx, "module.GoMod", attribute.String("goproxy.version", version))
+	defer func() { tracing.End(span, err) }()
+	return m.Module.GoMod(ctx, version)
+}
+
+// Zip span ends once the archive is opened, sending it to the client is a part of the request span
+func (m *tracedModule) Zip(ctx context.Context, version string) (file io.ReadCloser, err error) {
+	ctx, span := tracing.Start(ctx, "module.Zip", attribute.String("goproxy.version", version))
+	defer func() { tracing.End(span, err) }()
+	return m.Module.Zip(ctx, version)
+}
+
+type tracedLatestModule struct {
+	*tracedModule
+	latest LatestModule
+}
+
+func (m *tracedLatestModule) Latest(ctx context.Context) (info *RevInfo, err error) {
+	ctx, span := tracing.Start(ctx, "module.Latest")
+	defer func() { tracing.End(span, err) }()
+	return m.latest.Latest(ctx)
+}
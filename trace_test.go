@@ -0,0 +1,57 @@
+package goproxy
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestMiddlewareTracing(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	defer func() {
+		_ = provider.Shutdown(context.Background())
+	}()
+
+	r, err := NewRouter()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := r.AddRoute("example.com", listPlugin{}); err != nil {
+		t.Fatal(err)
+	}
+	logger := zerolog.New(ioutil.Discard)
+	m := Middleware(r, "", &logger)
+	m.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/example.com/lib/@v/v1.0.0.mod", nil))
+
+	spans := recorder.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("2 spans expected, got %d", len(spans))
+	}
+	method, request := spans[0], spans[1]
+	if request.Name() != "goproxy mod" {
+		t.Errorf("unexpected request span name %s", request.Name())
+	}
+	if method.Name() != "module.GoMod" {
+		t.Errorf("unexpected module span name %s", method.Name())
+	}
+	if method.Parent().SpanID() != request.SpanContext().SpanID() {
+		t.Errorf("module span must be a child of the request span")
+	}
+	var plugin string
+	for _, kv := range request.Attributes() {
+		if kv.Key == "goproxy.plugin" {
+			plugin = kv.Value.AsString()
+		}
+	}
+	if plugin != "list" {
+		t.Errorf("unexpected plugin attribute %q", plugin)
+	}
+}
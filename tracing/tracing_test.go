@@ -0,0 +1,147 @@
+package tracing
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// setupRecorder makes spans go into the returned recorder
+func setupRecorder(t *testing.T) *tracetest.SpanRecorder {
+	recorder := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		_ = provider.Shutdown(context.Background())
+	})
+	return recorder
+}
+
+func attr(span sdktrace.ReadOnlySpan, key attribute.Key) attribute.Value {
+	for _, kv := range span.Attributes() {
+		if kv.Key == key {
+			return kv.Value
+		}
+	}
+	return attribute.Value{}
+}
+
+func TestTransport(t *testing.T) {
+	recorder := setupRecorder(t)
+
+	var traceparent string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		traceparent = req.Header.Get("traceparent")
+		if req.URL.Path == "/missing" {
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	client := &http.Client{Transport: Transport(nil)}
+
+	tests := []struct {
+		name   string
+		path   string
+		status int
+		code   codes.Code
+	}{
+		{
+			name:   "ok",
+			path:   "/module/@v/list?token=secret",
+			status: http.StatusOK,
+			code:   codes.Unset,
+		},
+		{
+			name:   "not-found",
+			path:   "/missing",
+			status: http.StatusNotFound,
+			code:   codes.Error,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder.Reset()
+			ctx, parent := Start(context.Background(), "parent")
+			req, err := http.NewRequest(http.MethodGet, server.URL+tt.path, nil)
+			require.NoError(t, err)
+			resp, err := client.Do(req.WithContext(ctx))
+			require.NoError(t, err)
+			require.NoError(t, resp.Body.Close())
+			parent.End()
+
+			spans := recorder.Ended()
+			require.Len(t, spans, 2)
+			span := spans[0]
+			require.Equal(t, "HTTP GET", span.Name())
+			require.Equal(t, trace.SpanKindClient, span.SpanKind())
+			require.Equal(t, parent.SpanContext().SpanID(), span.Parent().SpanID())
+			require.Equal(t, tt.code, span.Status().Code)
+			require.Equal(t, int64(tt.status), attr(span, "http.response.status_code").AsInt64())
+			require.NotContains(t, attr(span, "url.full").AsString(), "secret")
+			require.Contains(t, traceparent, span.SpanContext().SpanID().String())
+		})
+	}
+}
+
+func TestStartServer(t *testing.T) {
+	recorder := setupRecorder(t)
+
+	req := httptest.NewRequest(http.MethodGet, "/module/@v/list", nil)
+	req.Header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	req, span := StartServer(req, "goproxy")
+	require.Equal(t, span.SpanContext(), trace.SpanContextFromContext(req.Context()))
+	_, child := Start(req.Context(), "child")
+	End(child, errors.New("failure"))
+	EndHTTP(span, http.StatusBadGateway)
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	require.Equal(t, "child", spans[0].Name())
+	require.Equal(t, codes.Error, spans[0].Status().Code)
+	require.Len(t, spans[0].Events(), 1)
+	require.Equal(t, span.SpanContext().SpanID(), spans[0].Parent().SpanID())
+
+	server := spans[1]
+	require.Equal(t, trace.SpanKindServer, server.SpanKind())
+	require.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", server.SpanContext().TraceID().String())
+	require.Equal(t, "00f067aa0ba902b7", server.Parent().SpanID().String())
+	require.Equal(t, codes.Error, server.Status().Code)
+	require.Equal(t, "/module/@v/list", attr(server, "url.path").AsString())
+}
+
+func TestSetup(t *testing.T) {
+	// collector stand-in
+	received := make(chan string, 1)
+	collector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		select {
+		case received <- req.Method + " " + req.URL.Path:
+		default:
+		}
+	}))
+	defer collector.Close()
+
+	shutdown, err := Setup(context.Background(), collector.URL, "goproxy-test")
+	require.NoError(t, err)
+	_, span := Start(context.Background(), "exported")
+	span.End()
+	require.NoError(t, shutdown(context.Background()))
+
+	select {
+	case got := <-received:
+		require.Equal(t, "POST /v1/traces", got)
+	default:
+		t.Fatal("no spans exported")
+	}
+}
@@ -11,20 +11,21 @@ type nodeExtension struct {
 	node *node
 }
 
+// node of a prefix tree, values are plugins of routes or their access rules
 type node struct {
-	f       Plugin
+	f       interface{}
 	further []*nodeExtension
 }
 
-func (n *node) addNode(path string, f Plugin) error {
+func (n *node) addNode(path string, f interface{}) error {
 	return n.realAdd(path, path, f)
 }
 
-func (n *node) getNode(path string) Plugin {
+func (n *node) getNode(path string) interface{} {
 	return n.realGet(path, path)
 }
 
-func (n *node) realAdd(path string, origPath string, f Plugin) error {
+func (n *node) realAdd(path string, origPath string, f interface{}) error {
 	if len(path) == 0 {
 		if n.f == nil {
 			n.f = f
@@ -99,7 +100,7 @@ func commonPrefix(p1 string, p2 string) string {
 	return ""
 }
 
-func (n *node) realGet(path string, origPath string) Plugin {
+func (n *node) realGet(path string, origPath string) interface{} {
 	for _, ne := range n.further {
 		if strings.HasPrefix(path, ne.path) {
 			res := ne.node.realGet(path[len(ne.path):], origPath)
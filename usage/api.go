@@ -0,0 +1,64 @@
+package usage
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ServeHTTP serves analytics as JSON, mount it with http.StripPrefix:
+//
+//	GET /top?n=10                              most downloaded modules, all of them if n is not set
+//	GET /versions?module=path                  downloaded versions of the module
+//	GET /consumers?module=path&version=v1.0.0  principals which downloaded the version
+func (s *Store) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := req.URL.Query()
+	var res interface{}
+	var err error
+	switch strings.Trim(req.URL.Path, "/") {
+	case "top":
+		var n int
+		if value := query.Get("n"); len(value) > 0 {
+			if n, err = strconv.Atoi(value); err != nil {
+				http.Error(w, "invalid n: "+value, http.StatusBadRequest)
+				return
+			}
+		}
+		res, err = s.Top(n)
+	case "versions":
+		module := query.Get("module")
+		if len(module) == 0 {
+			http.Error(w, "module is required", http.StatusBadRequest)
+			return
+		}
+		res, err = s.Versions(module)
+	case "consumers":
+		module, version := query.Get("module"), query.Get("version")
+		if len(module) == 0 || len(version) == 0 {
+			http.Error(w, "module and version are required", http.StatusBadRequest)
+			return
+		}
+		res, err = s.Consumers(module, version)
+	default:
+		http.NotFound(w, req)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	data, err := json.Marshal(res)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(data)
+}
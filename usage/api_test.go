@@ -0,0 +1,67 @@
+package usage
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestServeHTTP(t *testing.T) {
+	store := openStore(t)
+	at := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	require.NoError(t, store.Add("example.com/lib", "v1.0.0", "alice", at))
+
+	tests := []struct {
+		name   string
+		url    string
+		status int
+		body   string
+	}{
+		{
+			name:   "top",
+			url:    "/top?n=1",
+			status: http.StatusOK,
+			body:   `[{"path":"example.com/lib","downloads":1,"last_fetch":"2020-01-01T00:00:00Z"}]`,
+		},
+		{
+			name:   "versions",
+			url:    "/versions?module=example.com/lib",
+			status: http.StatusOK,
+			body:   `[{"version":"v1.0.0","downloads":1,"last_fetch":"2020-01-01T00:00:00Z"}]`,
+		},
+		{
+			name:   "consumers",
+			url:    "/consumers?module=example.com/lib&version=v1.0.0",
+			status: http.StatusOK,
+			body:   `[{"principal":"alice","downloads":1,"last_fetch":"2020-01-01T00:00:00Z"}]`,
+		},
+		{
+			name:   "no-version",
+			url:    "/consumers?module=example.com/lib",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "invalid-n",
+			url:    "/top?n=many",
+			status: http.StatusBadRequest,
+		},
+		{
+			name:   "unknown",
+			url:    "/unknown",
+			status: http.StatusNotFound,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			store.ServeHTTP(w, httptest.NewRequest("GET", tt.url, nil))
+			require.Equal(t, tt.status, w.Code)
+			if len(tt.body) > 0 {
+				require.JSONEq(t, tt.body, w.Body.String())
+			}
+		})
+	}
+}
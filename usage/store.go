@@ -0,0 +1,311 @@
+// Package usage analytics of module downloads: counts of downloads per module, version and principal kept in an
+// embedded database
+package usage
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+	bolt "go.etcd.io/bbolt"
+
+	"github.com/sirkon/goproxy/accesslog"
+	"github.com/sirkon/goproxy/internal/errors"
+	"github.com/sirkon/goproxy/metrics"
+	"github.com/sirkon/goproxy/semver"
+)
+
+const (
+	// queueSize downloads waiting to be written, downloads are dropped when the queue is full
+	queueSize = 4096
+
+	// maxBatch downloads written in one transaction at most
+	maxBatch = 256
+)
+
+var (
+	modulesBucket   = []byte("modules")
+	versionsBucket  = []byte("versions")
+	consumersBucket = []byte("consumers")
+)
+
+// Stat downloads of a module, version or by a consumer
+type Stat struct {
+	Downloads int64     `json:"downloads"`
+	LastFetch time.Time `json:"last_fetch"`
+}
+
+func (s *Stat) add(at time.Time) {
+	s.Downloads++
+	if at.After(s.LastFetch) {
+		s.LastFetch = at
+	}
+}
+
+// ModuleStat downloads of a module
+type ModuleStat struct {
+	Path string `json:"path"`
+	Stat
+}
+
+// VersionStat downloads of a module version
+type VersionStat struct {
+	Version string `json:"version"`
+	Stat
+}
+
+// ConsumerStat downloads of a module version by a principal
+type ConsumerStat struct {
+	Principal string `json:"principal"`
+	Stat
+}
+
+// Store of downloads. It is an access log sink counting successful source archive downloads, see Log
+type Store struct {
+	db     *bolt.DB
+	logger *zerolog.Logger
+
+	// queue of downloads to be written by the writer, it is closed by Close
+	lock   sync.RWMutex
+	closed bool
+	queue  chan download
+	done   chan struct{}
+}
+
+// download of a module version, downloads with flushed set are just marks closed once everything before is written
+type download struct {
+	path      string
+	version   string
+	principal string
+	at        time.Time
+	flushed   chan struct{}
+}
+
+// Open opens the store in the file, it is created if there is none. Errors of counting downloads go to the logger
+func Open(path string, logger *zerolog.Logger) (*Store, error) {
+	db, err := bolt.Open(path, 0644, &bolt.Options{Timeout: time.Second})
+	if err != nil {
+		return nil, errors.Wrapf(err, "usage opening %s", path)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{modulesBucket, versionsBucket, consumersBucket} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		_ = db.Close()
+		return nil, errors.Wrapf(err, "usage initializing %s", path)
+	}
+	res := &Store{
+		db:     db,
+		logger: logger,
+		queue:  make(chan download, queueSize),
+		done:   make(chan struct{}),
+	}
+	go res.writer()
+	return res, nil
+}
+
+// Close writes downloads logged so far and closes the store
+func (s *Store) Close() error {
+	s.lock.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+	s.lock.Unlock()
+	<-s.done
+	return s.db.Close()
+}
+
+// Flush waits until downloads logged so far are written
+func (s *Store) Flush() {
+	s.lock.RLock()
+	if s.closed {
+		s.lock.RUnlock()
+		return
+	}
+	flushed := make(chan struct{})
+	s.queue <- download{flushed: flushed}
+	s.lock.RUnlock()
+	<-flushed
+}
+
+// writer writes queued downloads, the ones waiting together go in one transaction
+func (s *Store) writer() {
+	defer close(s.done)
+	for d := range s.queue {
+		batch := []download{d}
+	drain:
+		for len(batch) < maxBatch {
+			select {
+			case d, ok := <-s.queue:
+				if !ok {
+					break drain
+				}
+				batch = append(batch, d)
+			default:
+				break drain
+			}
+		}
+		s.write(batch)
+	}
+}
+
+func (s *Store) write(batch []download) {
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		for _, d := range batch {
+			if d.flushed != nil {
+				continue
+			}
+			if err := add(tx, d); err != nil {
+				return errors.Wrapf(err, "usage adding download of %s@%s", d.path, d.version)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		// logging is the only option here, there's nobody to return an error to
+		s.logger.Error().Err(err).Int("downloads", len(batch)).Msg("usage recording downloads")
+	}
+	for _, d := range batch {
+		if d.flushed != nil {
+			close(d.flushed)
+		}
+	}
+}
+
+// versionKey key of a version of a module, keys of the module versions share the module prefix
+func versionKey(path, version string) []byte {
+	return []byte(path + "@" + version)
+}
+
+// consumerKey key of a principal downloads of a version, keys of the version consumers share the version prefix
+func consumerKey(path, version, principal string) []byte {
+	return []byte(path + "@" + version + "\x00" + principal)
+}
+
+// Log counts the download if the record is of a successfully served source archive. The download is written in the
+// background, it is dropped if too many downloads are waiting to be written already
+func (s *Store) Log(rec *accesslog.Record) {
+	if rec.Endpoint != metrics.EndpointZip || rec.Status != http.StatusOK || len(rec.Version) == 0 {
+		return
+	}
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if s.closed {
+		return
+	}
+	select {
+	case s.queue <- download{path: rec.Module, version: rec.Version, principal: rec.Principal, at: rec.Start}:
+	default:
+		s.logger.Error().Str("module", rec.Module).Str("version", rec.Version).Msg("usage queue is full, download dropped")
+	}
+}
+
+// Add counts a download of the module version by the principal, principal is empty for anonymous downloads.
+// Concurrent calls are written in one transaction
+func (s *Store) Add(path, version, principal string, at time.Time) error {
+	err := s.db.Batch(func(tx *bolt.Tx) error {
+		return add(tx, download{path: path, version: version, principal: principal, at: at})
+	})
+	if err != nil {
+		return errors.Wrapf(err, "usage adding download of %s@%s", path, version)
+	}
+	return nil
+}
+
+func add(tx *bolt.Tx, d download) error {
+	if err := update(tx.Bucket(modulesBucket), []byte(d.path), d.at); err != nil {
+		return err
+	}
+	if err := update(tx.Bucket(versionsBucket), versionKey(d.path, d.version), d.at); err != nil {
+		return err
+	}
+	if len(d.principal) == 0 {
+		return nil
+	}
+	return update(tx.Bucket(consumersBucket), consumerKey(d.path, d.version, d.principal), d.at)
+}
+
+func update(bucket *bolt.Bucket, key []byte, at time.Time) error {
+	var stat Stat
+	if data := bucket.Get(key); data != nil {
+		if err := json.Unmarshal(data, &stat); err != nil {
+			return errors.Wrapf(err, "decoding stat of %s", key)
+		}
+	}
+	stat.add(at)
+	data, err := json.Marshal(&stat)
+	if err != nil {
+		return errors.Wrapf(err, "encoding stat of %s", key)
+	}
+	return bucket.Put(key, data)
+}
+
+// scan calls f for each item of the bucket with keys starting with prefix, f gets keys without the prefix
+func (s *Store) scan(bucket, prefix []byte, f func(key string, stat Stat)) error {
+	return s.db.View(func(tx *bolt.Tx) error {
+		c := tx.Bucket(bucket).Cursor()
+		for k, v := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, v = c.Next() {
+			var stat Stat
+			if err := json.Unmarshal(v, &stat); err != nil {
+				return errors.Wrapf(err, "usage decoding stat of %s", k)
+			}
+			f(string(k[len(prefix):]), stat)
+		}
+		return nil
+	})
+}
+
+// Top returns n most downloaded modules, all of them if n is not positive
+func (s *Store) Top(n int) ([]ModuleStat, error) {
+	var res []ModuleStat
+	err := s.scan(modulesBucket, nil, func(key string, stat Stat) {
+		res = append(res, ModuleStat{Path: key, Stat: stat})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(res, func(i, j int) bool {
+		return res[i].Downloads > res[j].Downloads
+	})
+	if n > 0 && len(res) > n {
+		res = res[:n]
+	}
+	return res, nil
+}
+
+// Versions returns downloaded versions of the module with their last fetch times
+func (s *Store) Versions(path string) ([]VersionStat, error) {
+	var res []VersionStat
+	err := s.scan(versionsBucket, versionKey(path, ""), func(key string, stat Stat) {
+		res = append(res, VersionStat{Version: key, Stat: stat})
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return semver.Compare(res[i].Version, res[j].Version) < 0
+	})
+	return res, nil
+}
+
+// Consumers returns principals which downloaded the module version
+func (s *Store) Consumers(path, version string) ([]ConsumerStat, error) {
+	var res []ConsumerStat
+	err := s.scan(consumersBucket, consumerKey(path, version, ""), func(key string, stat Stat) {
+		res = append(res, ConsumerStat{Principal: key, Stat: stat})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
@@ -0,0 +1,156 @@
+package usage
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+
+	"github.com/sirkon/goproxy/accesslog"
+	"github.com/sirkon/goproxy/metrics"
+)
+
+func openStore(t *testing.T) *Store {
+	dir, err := ioutil.TempDir("", "usage")
+	require.NoError(t, err)
+	logger := zerolog.New(ioutil.Discard)
+	store, err := Open(filepath.Join(dir, "usage.db"), &logger)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, store.Close())
+		require.NoError(t, os.RemoveAll(dir))
+	})
+	return store
+}
+
+func TestStore(t *testing.T) {
+	store := openStore(t)
+	base := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i, d := range []struct {
+		path, version, principal string
+	}{
+		{"example.com/lib", "v1.0.0", "alice"},
+		{"example.com/lib", "v1.0.0", "bob"},
+		{"example.com/lib", "v1.0.0", "alice"},
+		{"example.com/lib", "v1.10.0", ""},
+		{"example.com/lib", "v1.2.0", "bob"},
+		{"example.com/lib/v2", "v2.0.0", "alice"},
+		{"example.com/other", "v0.1.0", ""},
+		{"example.com/other", "v0.1.0", ""},
+	} {
+		require.NoError(t, store.Add(d.path, d.version, d.principal, base.Add(time.Duration(i)*time.Hour)))
+	}
+	at := func(hours int) time.Time {
+		return base.Add(time.Duration(hours) * time.Hour)
+	}
+
+	top, err := store.Top(2)
+	require.NoError(t, err)
+	require.Equal(t, []ModuleStat{
+		{Path: "example.com/lib", Stat: Stat{Downloads: 5, LastFetch: at(4)}},
+		{Path: "example.com/other", Stat: Stat{Downloads: 2, LastFetch: at(7)}},
+	}, top)
+
+	versions, err := store.Versions("example.com/lib")
+	require.NoError(t, err)
+	require.Equal(t, []VersionStat{
+		{Version: "v1.0.0", Stat: Stat{Downloads: 3, LastFetch: at(2)}},
+		{Version: "v1.2.0", Stat: Stat{Downloads: 1, LastFetch: at(4)}},
+		{Version: "v1.10.0", Stat: Stat{Downloads: 1, LastFetch: at(3)}},
+	}, versions)
+
+	consumers, err := store.Consumers("example.com/lib", "v1.0.0")
+	require.NoError(t, err)
+	require.Equal(t, []ConsumerStat{
+		{Principal: "alice", Stat: Stat{Downloads: 2, LastFetch: at(2)}},
+		{Principal: "bob", Stat: Stat{Downloads: 1, LastFetch: at(1)}},
+	}, consumers)
+
+	consumers, err = store.Consumers("example.com/lib", "v1.10.0")
+	require.NoError(t, err)
+	require.Empty(t, consumers)
+}
+
+func TestStoreLog(t *testing.T) {
+	tests := []struct {
+		name   string
+		record accesslog.Record
+		want   int64
+	}{
+		{
+			name:   "zip",
+			record: accesslog.Record{Module: "example.com/lib", Version: "v1.0.0", Endpoint: metrics.EndpointZip, Status: http.StatusOK},
+			want:   1,
+		},
+		{
+			name:   "failed",
+			record: accesslog.Record{Module: "example.com/lib", Version: "v1.0.0", Endpoint: metrics.EndpointZip, Status: http.StatusNotFound},
+			want:   0,
+		},
+		{
+			name:   "mod",
+			record: accesslog.Record{Module: "example.com/lib", Version: "v1.0.0", Endpoint: metrics.EndpointMod, Status: http.StatusOK},
+			want:   0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := openStore(t)
+			store.Log(&tt.record)
+			store.Flush()
+			versions, err := store.Versions("example.com/lib")
+			require.NoError(t, err)
+			var got int64
+			for _, v := range versions {
+				got += v.Downloads
+			}
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestStoreLogConcurrent(t *testing.T) {
+	dir, err := ioutil.TempDir("", "usage")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "usage.db")
+	logger := zerolog.New(ioutil.Discard)
+	store, err := Open(path, &logger)
+	require.NoError(t, err)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				store.Log(&accesslog.Record{
+					Module:   "example.com/lib",
+					Version:  "v1.0.0",
+					Endpoint: metrics.EndpointZip,
+					Status:   http.StatusOK,
+				})
+			}
+		}()
+	}
+	wg.Wait()
+
+	// downloads waiting to be written are written on close
+	require.NoError(t, store.Close())
+	store.Log(&accesslog.Record{Module: "example.com/lib", Version: "v1.0.0", Endpoint: metrics.EndpointZip, Status: http.StatusOK})
+	store.Flush()
+
+	store, err = Open(path, &logger)
+	require.NoError(t, err)
+	defer store.Close()
+	top, err := store.Top(0)
+	require.NoError(t, err)
+	require.Len(t, top, 1)
+	require.Equal(t, int64(1000), top[0].Downloads)
+}